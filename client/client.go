@@ -0,0 +1,266 @@
+/*
+Package client is a Go client of the WASA Photo API.
+
+Every operation of the OpenAPI specification (doc/api.yaml) is a method of Client named after its operationId, e.g.
+DoLogin for POST /session. The path parameters are arguments of the method, the optional parameters are fields of a
+<Method>Params struct, and the bodies are the types of the service/structs package:
+
+	c := client.New("http://localhost:3000")
+	session, err := c.DoLogin(ctx, structs.Credentials{Username: "maria"}, nil)
+	if err != nil {
+		return err
+	}
+	c.Token = session.Token
+	photoID, err := c.UploadPhoto(ctx, session.UserID, client.File{Name: "cat.jpg", Content: f}, nil)
+
+Edits of users, posts and comments return the ETag of the resource, to send back in the If-Match header of the next
+edit. Paginated operations also have a <Method>All method returning the items of all the pages. Error responses are
+returned as *Error.
+
+The methods are generated from the specification into operations.go by "go generate", a test checks that they are up
+to date.
+*/
+package client
+
+//go:generate go run ./gen -o operations.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// Client sends the requests to the API
+type Client struct {
+	// BaseURL is the URL of the API, e.g. http://localhost:3000
+	BaseURL string
+
+	// Token is the bearer token of the requests, i.e. the token of the session returned by DoLogin. No token is sent
+	// if it is empty.
+	Token string
+
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the API at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Error is an error response of the API
+type Error structs.Error
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%d %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// StatusCode returns the status of the error response err, 0 if err is not an *Error
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return 0
+}
+
+// File is a file sent in a multipart request, e.g. a photo
+type File struct {
+	Name    string // File name, e.g. cat.jpg
+	Content io.Reader
+}
+
+// multipartFile is a File in a field of a multipart request
+type multipartFile struct {
+	field string
+	file  File
+}
+
+// request is a request to an operation
+type request struct {
+	method string
+	path   string // Path of the operation, with the path parameters
+	query  url.Values
+	header http.Header
+
+	// body is the request body, sent as is if it is a []byte and encoded as JSON otherwise
+	body        interface{}
+	contentType string
+	// compact leaves out the fields of the JSON object body with an empty string: they are the fields not set of the
+	// structs types, which the handlers ignore anyway but which could fail the validation of their format
+	compact bool
+
+	// file is sent as multipart/form-data instead of body, if set
+	file *multipartFile
+
+	// redirect returns the redirects instead of following them
+	redirect bool
+}
+
+func (req *request) setQuery(name string, value string) {
+	if req.query == nil {
+		req.query = make(url.Values)
+	}
+	req.query.Set(name, value)
+}
+
+func (req *request) setHeader(name string, value string) {
+	if req.header == nil {
+		req.header = make(http.Header)
+	}
+	req.header.Set(name, value)
+}
+
+// response is the successful response to a request
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// isJSON returns true if the body of the response is JSON
+func (resp *response) isJSON() bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// decode decodes the JSON body of the response into v. An empty body leaves v unchanged.
+func (resp *response) decode(v interface{}) error {
+	if len(bytes.TrimSpace(resp.body)) == 0 {
+		return nil
+	}
+	if !resp.isJSON() {
+		return fmt.Errorf("unexpected content type %q", resp.header.Get("Content-Type"))
+	}
+	err := json.Unmarshal(resp.body, v)
+	if err != nil {
+		return fmt.Errorf("error decoding the response: %w", err)
+	}
+	return nil
+}
+
+// do sends the request, and returns the response if successful. Error responses are returned as *Error.
+func (c *Client) do(ctx context.Context, req request) (*response, error) {
+	body, contentType, err := req.encodeBody()
+	if err != nil {
+		return nil, err
+	}
+
+	u := c.BaseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the request: %w", err)
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if req.redirect {
+		noRedirects := *httpClient
+		noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		httpClient = &noRedirects
+	}
+	httpResp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	data, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the response: %w", err)
+	}
+	resp := &response{status: httpResp.StatusCode, header: httpResp.Header, body: data}
+
+	if resp.status >= 400 {
+		return nil, resp.error()
+	}
+	return resp, nil
+}
+
+// encodeBody returns the body of the request and its content type
+func (req *request) encodeBody() (io.Reader, string, error) {
+	if req.file != nil {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, err := writer.CreateFormFile(req.file.field, req.file.file.Name)
+		if err == nil {
+			_, err = io.Copy(part, req.file.file.Content)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error encoding the file: %w", err)
+		}
+		return &buf, writer.FormDataContentType(), nil
+	}
+
+	switch body := req.body.(type) {
+	case nil:
+		return nil, "", nil
+	case []byte:
+		return bytes.NewReader(body), req.contentType, nil
+	}
+	data, err := json.Marshal(req.body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding the body: %w", err)
+	}
+	if req.compact {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data, &fields) == nil {
+			for name, value := range fields {
+				if string(value) == `""` {
+					delete(fields, name)
+				}
+			}
+			data, err = json.Marshal(fields)
+			if err != nil {
+				return nil, "", fmt.Errorf("error encoding the body: %w", err)
+			}
+		}
+	}
+	return bytes.NewReader(data), req.contentType, nil
+}
+
+// error returns the *Error of an error response
+func (resp *response) error() error {
+	apiErr := &Error{Status: resp.status}
+	if resp.isJSON() && json.Unmarshal(resp.body, apiErr) == nil && apiErr.Message != "" {
+		apiErr.Status = resp.status
+		return apiErr
+	}
+
+	// Not an error of the API, e.g. of a proxy
+	apiErr.Message = strings.TrimSpace(string(resp.body))
+	if apiErr.Message == "" {
+		apiErr.Message = strings.ToLower(http.StatusText(resp.status))
+	}
+	return apiErr
+}
@@ -0,0 +1,143 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attiliov/WASA-Photo/client"
+	"github.com/attiliov/WASA-Photo/client/internal/codegen"
+	"github.com/attiliov/WASA-Photo/doc"
+	"github.com/attiliov/WASA-Photo/service/api"
+	"github.com/attiliov/WASA-Photo/service/api/apitest"
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// jpeg is the start of a JPEG file, enough to be stored as a photo
+var jpeg = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00\xff\xd9")
+
+// TestGenerated checks that operations.go is generated from the current specification
+func TestGenerated(t *testing.T) {
+	t.Parallel()
+	generated, err := codegen.Generate(doc.OpenAPI)
+	if err != nil {
+		t.Fatalf("generating the client: %v", err)
+	}
+	committed, err := ioutil.ReadFile("operations.go")
+	if err != nil {
+		t.Fatalf("reading operations.go: %v", err)
+	}
+	if !bytes.Equal(generated, committed) {
+		t.Fatal("operations.go is out of date with doc/api.yaml, run \"go generate ./client\"")
+	}
+}
+
+// newServer starts the API on an in-memory database, validating the requests and the responses against the
+// specification
+func newServer(t *testing.T) (*httptest.Server, database.AppDatabase) {
+	t.Helper()
+
+	db := memdb.New()
+	router, err := api.New(api.Config{
+		Logger:            apitest.Logger(),
+		Database:          db,
+		Validator:         apitest.Validator(t),
+		UsernameOnlyLogin: true,
+		ExportDirectory:   t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("creating the router: %v", err)
+	}
+	t.Cleanup(func() { _ = router.Close() })
+
+	// The responses not matching the specification fail the test, as the client could not decode them
+	return apitest.NewServer(t, router.Handler()), db
+}
+
+// login returns a client logged in as username, and the ID of the user
+func login(t *testing.T, baseURL string, username string) (*client.Client, string) {
+	t.Helper()
+	c := client.New(baseURL)
+	session, err := c.DoLogin(context.Background(), structs.Credentials{Username: username}, nil)
+	if err != nil {
+		t.Fatalf("logging in %s: %v", username, err)
+	}
+	c.Token = session.Token
+	return c, session.UserID
+}
+
+// TestClient drives the API through the client
+func TestClient(t *testing.T) {
+	t.Parallel()
+	server, db := newServer(t)
+	ctx := context.Background()
+	alice, aliceID := login(t, server.URL, "alice")
+	bob, bobID := login(t, server.URL, "bobby")
+
+	// Multipart upload and JSON bodies
+	photoID, err := alice.UploadPhoto(ctx, aliceID, client.File{Name: "cat.jpg", Content: bytes.NewReader(jpeg)}, nil)
+	if err != nil {
+		t.Fatalf("uploading the photo: %v", err)
+	}
+	photo, err := bob.GetPhoto(ctx, aliceID, photoID)
+	if err != nil || !bytes.Equal(photo, jpeg) {
+		t.Fatalf("getting the photo: %v", err)
+	}
+	created, err := alice.CreatePost(ctx, aliceID, structs.UserPost{AuthorID: aliceID, AuthorUsername: "alice", Caption: "A cat", Image: photoID}, nil)
+	if err != nil {
+		t.Fatalf("creating the post: %v", err)
+	}
+	body, _ := created.Body.(map[string]interface{})
+	postID, ok := body["resourceId"].(string)
+	if !ok {
+		t.Fatalf("unexpected body of the created post: %v", created.Body)
+	}
+	_, err = bob.LikePhoto(ctx, aliceID, postID, bobID)
+	if err != nil {
+		t.Fatalf("liking the post: %v", err)
+	}
+	likes, err := alice.GetPostLikes(ctx, aliceID, postID)
+	if err != nil || len(likes.Likes) != 1 || likes.Likes[0].UserID != bobID {
+		t.Fatalf("unexpected likes %v: %v", likes.Likes, err)
+	}
+
+	// ETags
+	post, etag, err := alice.GetPost(ctx, aliceID, postID)
+	if err != nil || post.Caption != "A cat" || etag == "" {
+		t.Fatalf("unexpected post %v with ETag %q: %v", post, etag, err)
+	}
+	_, _, err = alice.PatchPost(ctx, aliceID, postID, map[string]interface{}{"caption": "Two cats"}, &client.PatchPostParams{IfMatch: etag})
+	if err != nil {
+		t.Fatalf("patching the post: %v", err)
+	}
+	_, _, err = alice.PatchPost(ctx, aliceID, postID, map[string]interface{}{"caption": "Three cats"}, &client.PatchPostParams{IfMatch: etag})
+	if client.StatusCode(err) != http.StatusPreconditionFailed {
+		t.Fatalf("patching a stale post: expected a 412 error, got %v", err)
+	}
+
+	// Error responses
+	_, _, err = bob.GetPost(ctx, aliceID, "00000000-0000-0000-0000-000000000000")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Code == "" || apiErr.RequestID == "" {
+		t.Fatalf("expected a 404 error, got %#v", err)
+	}
+
+	// Pagination
+	for _, username := range []string{"carol", "david", "erina"} {
+		login(t, server.URL, username)
+	}
+	err = db.SetUserRole(aliceID, database.RoleAdmin)
+	if err != nil {
+		t.Fatalf("promoting alice: %v", err)
+	}
+	users, err := alice.ListUsersAll(ctx, &client.ListUsersParams{Limit: 2})
+	if err != nil || len(users) != 5 {
+		t.Fatalf("expected the 5 users, got %d: %v", len(users), err)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Gen generates the methods of the client package from the OpenAPI specification of the API (doc/api.yaml), see
+client/internal/codegen. It's run by "go generate" in the client directory.
+
+Usage:
+
+	gen [flags]
+
+The flags are:
+
+	-o <file>
+		Write the methods to this file, operations.go by default.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/attiliov/WASA-Photo/client/internal/codegen"
+	"github.com/attiliov/WASA-Photo/doc"
+)
+
+func main() {
+	var output = flag.String("o", "operations.go", "file where the methods are written")
+
+	flag.Parse()
+
+	src, err := codegen.Generate(doc.OpenAPI)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error generating the client:", err)
+		os.Exit(1)
+	}
+	err = ioutil.WriteFile(*output, src, 0644) // #nosec G306 -- source code, not a secret
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error writing the client:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,614 @@
+/*
+Package codegen generates the methods of the client package from the OpenAPI specification of the API.
+
+Every operation becomes a method named after its operationId. The path parameters, the required query parameters and
+the required headers are arguments of the method, the optional ones are fields of a <Method>Params struct. Request
+and response bodies are typed with the x-go-type extension of their schema, which names a type of the
+service/structs package; strings are strings, and the bodies that are not JSON are byte slices.
+
+Operations that take offset and limit query parameters, and return an object with a single list, also get a
+<Method>All method walking all the pages.
+*/
+package codegen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// header is the start of the generated file
+const header = "// Code generated by client/gen from doc/api.yaml. DO NOT EDIT.\n\npackage client\n"
+
+// methodOrder is the order of the methods of a path in the generated file
+var methodOrder = []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete}
+
+// operation is an operation of the specification, as a method of the client
+type operation struct {
+	name    string // Name of the method
+	method  string
+	path    string
+	summary string
+
+	pathArgs []string  // Names of the arguments with the path parameters, in order
+	pathExpr string    // Go expression building the path
+	required []param   // Required query parameters and headers, arguments of the method
+	optional []param   // Optional query parameters and headers, fields of the params struct
+	body     *bodyType // nil if the operation has no request body
+
+	result   string // Go type of the JSON responses, empty if none
+	data     bool   // Some responses are not JSON, their body is returned as []byte
+	etag     bool   // Some responses carry an ETag header, returned too
+	redirect bool   // The operation only redirects, the Location is returned
+	page     *page  // Set if the operation returns a page of a list
+}
+
+// param is a query parameter or a header
+type param struct {
+	name        string // Name in the request, e.g. If-Match
+	in          string // "query" or "header"
+	goName      string // Name of the argument or of the field
+	goType      string // "string" or "int"
+	description string
+}
+
+// bodyType is the request body of an operation
+type bodyType struct {
+	contentType string
+	goType      string
+	compact     bool   // Fields with empty strings are not sent, see request.compact
+	fileField   string // Name of the multipart field, if the body is a file
+}
+
+// page describes the list returned by a paginated operation
+type page struct {
+	field        string // Field of the result with the list
+	elem         string // Go type of the items of the list
+	defaultLimit int    // Size of the pages when no limit is given
+}
+
+// Generate returns the source code of the methods of the client for the OpenAPI specification spec
+func Generate(spec []byte) ([]byte, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the specification: %w", err)
+	}
+	err = doc.Validate(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error validating the specification: %w", err)
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	for _, path := range paths {
+		item := doc.Paths[path]
+		for _, method := range methodOrder {
+			op := item.GetOperation(method)
+			if op == nil {
+				continue
+			}
+			o, err := newOperation(path, method, item, op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			o.write(&buf)
+		}
+	}
+
+	// Import the packages used by the methods
+	var imports []string
+	for _, pkg := range []string{"context", "net/url", "strconv", "", "github.com/attiliov/WASA-Photo/service/structs"} {
+		if pkg == "" {
+			// Standard library first, as goimports does
+			imports = append(imports, "")
+		} else if bytes.Contains(buf.Bytes(), []byte(pkg[strings.LastIndex(pkg, "/")+1:]+".")) {
+			imports = append(imports, fmt.Sprintf("%q", pkg))
+		}
+	}
+	src := header + "\nimport (\n" + strings.TrimSpace(strings.Join(imports, "\n")) + "\n)\n" + buf.String()
+
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return nil, fmt.Errorf("error formatting the generated code: %w", err)
+	}
+	return formatted, nil
+}
+
+// newOperation describes the operation op as a method of the client
+func newOperation(path string, method string, item *openapi3.PathItem, op *openapi3.Operation) (*operation, error) {
+	if op.OperationID == "" {
+		return nil, errors.New("missing operationId")
+	}
+	o := &operation{
+		name:    exported(op.OperationID),
+		method:  method,
+		path:    path,
+		summary: strings.TrimSuffix(strings.TrimSpace(op.Summary), "."),
+	}
+
+	// Parameters, the ones of the operation override the ones of the path
+	params := make(map[string]*openapi3.Parameter)
+	for _, ref := range append(append(openapi3.Parameters{}, item.Parameters...), op.Parameters...) {
+		params[ref.Value.In+" "+ref.Value.Name] = ref.Value
+	}
+	err := o.setPath(params)
+	if err != nil {
+		return nil, err
+	}
+	err = o.setParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if op.RequestBody != nil {
+		o.body, err = newBody(op.RequestBody.Value)
+		if err != nil {
+			return nil, fmt.Errorf("request body: %w", err)
+		}
+	}
+
+	err = o.setResponses(op.Responses)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// setPath sets the arguments and the expression of the path
+func (o *operation) setPath(params map[string]*openapi3.Parameter) error {
+	var parts []string
+	rest := o.path
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest, "}")
+		if end < start {
+			return errors.New("malformed path")
+		}
+		name := rest[start+1 : end]
+		if params["path "+name] == nil {
+			return fmt.Errorf("path parameter %s is not described", name)
+		}
+		arg := unexported(name)
+		o.pathArgs = append(o.pathArgs, arg)
+		parts = append(parts, fmt.Sprintf("%q", rest[:start]), "url.PathEscape("+arg+")")
+		rest = rest[end+1:]
+	}
+	if rest != "" {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+	o.pathExpr = strings.Join(parts, " + ")
+	return nil
+}
+
+// setParams sets the query parameters and the headers of the operation
+func (o *operation) setParams(params map[string]*openapi3.Parameter) error {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var hasOffset, hasLimit bool
+	for _, key := range keys {
+		p := params[key]
+		if p.In != openapi3.ParameterInQuery && p.In != openapi3.ParameterInHeader {
+			continue
+		}
+		goType := "string"
+		if p.Schema != nil && p.Schema.Value.Type == "integer" {
+			goType = "int"
+		}
+		prm := param{name: p.Name, in: p.In, goType: goType, description: firstParagraph(p.Description)}
+		if p.Required {
+			prm.goName = unexported(p.Name)
+			o.required = append(o.required, prm)
+		} else {
+			prm.goName = exported(p.Name)
+			o.optional = append(o.optional, prm)
+		}
+		if p.In == openapi3.ParameterInQuery && p.Name == "offset" {
+			hasOffset = true
+		}
+		if p.In == openapi3.ParameterInQuery && p.Name == "limit" && !p.Required {
+			hasLimit = true
+			if p.Schema != nil {
+				if limit, ok := p.Schema.Value.Default.(float64); ok {
+					o.page = &page{defaultLimit: int(limit)}
+				}
+			}
+		}
+	}
+	if !hasOffset || !hasLimit {
+		o.page = nil
+	}
+	return nil
+}
+
+// newBody describes the request body
+func newBody(body *openapi3.RequestBody) (*bodyType, error) {
+	if len(body.Content) != 1 {
+		return nil, errors.New("exactly one media type is supported")
+	}
+	for contentType, media := range body.Content {
+		switch {
+		case contentType == "application/json":
+			goType, err := schemaType(media.Schema)
+			if err != nil {
+				return nil, err
+			}
+			return &bodyType{contentType: contentType, goType: goType, compact: strings.HasPrefix(goType, "structs.")}, nil
+		case contentType == "application/merge-patch+json":
+			return &bodyType{contentType: contentType, goType: "map[string]interface{}"}, nil
+		case contentType == "multipart/form-data":
+			if media.Schema == nil || len(media.Schema.Value.Properties) != 1 {
+				return nil, errors.New("multipart bodies must have a single field")
+			}
+			for field := range media.Schema.Value.Properties {
+				return &bodyType{contentType: contentType, goType: "File", fileField: field}, nil
+			}
+		default:
+			return &bodyType{contentType: contentType, goType: "[]byte"}, nil
+		}
+	}
+	return nil, nil
+}
+
+// setResponses sets what the method returns from the successful responses
+func (o *operation) setResponses(responses openapi3.Responses) error {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var success, redirects int
+	for _, code := range codes {
+		response := responses[code].Value
+		switch code[0] {
+		case '2':
+			success++
+		case '3':
+			redirects++
+			continue
+		default:
+			continue
+		}
+
+		if _, ok := response.Headers["ETag"]; ok {
+			o.etag = true
+		}
+		for contentType, media := range response.Content {
+			if contentType != "application/json" {
+				o.data = true
+				continue
+			}
+			goType, err := schemaType(media.Schema)
+			if err != nil {
+				return fmt.Errorf("response %s: %w", code, err)
+			}
+			if o.result != "" && o.result != goType {
+				return fmt.Errorf("response %s: %s is not %s, the type of the other responses", code, goType, o.result)
+			}
+			o.result = goType
+		}
+	}
+	if success == 0 && redirects > 0 {
+		o.redirect = true
+	}
+
+	// The list in the pages, if paginated
+	if o.page != nil {
+		schema := responses.Get(http.StatusOK)
+		o.page = listOf(schema, o.page.defaultLimit)
+	}
+	return nil
+}
+
+// listOf describes the list of the paginated response, nil if it is not an object with a single list
+func listOf(response *openapi3.ResponseRef, defaultLimit int) *page {
+	if response == nil || response.Value.Content.Get("application/json") == nil {
+		return nil
+	}
+	schema := response.Value.Content.Get("application/json").Schema
+	if schema == nil || len(schema.Value.Properties) != 1 {
+		return nil
+	}
+	for name, property := range schema.Value.Properties {
+		if property.Value.Type != "array" || property.Value.Items == nil {
+			return nil
+		}
+		elem, err := schemaType(property.Value.Items)
+		if err != nil {
+			return nil
+		}
+		return &page{field: exported(name), elem: elem, defaultLimit: defaultLimit}
+	}
+	return nil
+}
+
+// schemaType returns the Go type of the JSON values of the schema
+func schemaType(schema *openapi3.SchemaRef) (string, error) {
+	if schema == nil {
+		return "", errors.New("missing schema")
+	}
+	if goType := extension(schema.Value, "x-go-type"); goType != "" {
+		return "structs." + goType, nil
+	}
+	if schema.Value.Type == "string" {
+		return "string", nil
+	}
+	name := "inline schema"
+	if schema.Ref != "" {
+		name = schema.Ref
+	}
+	return "", fmt.Errorf("%s has no x-go-type", name)
+}
+
+// extension returns the value of the string extension of the schema, empty if missing
+func extension(schema *openapi3.Schema, name string) string {
+	raw, ok := schema.Extensions[name]
+	if !ok {
+		return ""
+	}
+	// The values are kept as raw JSON by the loader
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return ""
+	}
+	var value string
+	if json.Unmarshal(data, &value) != nil {
+		var rawValue json.RawMessage
+		if json.Unmarshal(data, &rawValue) != nil || json.Unmarshal(rawValue, &value) != nil {
+			return ""
+		}
+	}
+	return value
+}
+
+// write writes the method of the operation, and its params struct and paging method if any
+func (o *operation) write(buf *bytes.Buffer) {
+	if len(o.optional) > 0 {
+		fmt.Fprintf(buf, "\n// %sParams are the optional parameters of %s\ntype %sParams struct {\n", o.name, o.name, o.name)
+		for _, p := range o.optional {
+			if p.description != "" {
+				writeComment(buf, "\t", p.description)
+			}
+			fmt.Fprintf(buf, "\t%s %s\n", p.goName, p.goType)
+		}
+		buf.WriteString("}\n")
+	}
+
+	// Signature
+	doc := o.name + " calls " + o.method + " " + o.path
+	if o.summary != "" {
+		doc += ": " + lowerFirst(o.summary)
+	}
+	doc += "."
+	switch {
+	case o.redirect:
+		doc += " It returns the URL the response redirects to."
+	case o.data && o.result != "":
+		doc += " The body of the responses that are not JSON is returned as data."
+	}
+	if o.etag {
+		doc += " The ETag of the response is returned too."
+	}
+	buf.WriteString("\n")
+	writeComment(buf, "", doc)
+
+	args := []string{"ctx context.Context"}
+	for _, arg := range o.pathArgs {
+		args = append(args, arg+" string")
+	}
+	for _, p := range o.required {
+		args = append(args, p.goName+" "+p.goType)
+	}
+	if o.body != nil {
+		args = append(args, o.bodyArg()+" "+o.body.goType)
+	}
+	if len(o.optional) > 0 {
+		args = append(args, "params *"+o.name+"Params")
+	}
+	var results []string
+	if o.result != "" {
+		results = append(results, "result "+o.result)
+	}
+	if o.data {
+		results = append(results, "data []byte")
+	}
+	if o.redirect {
+		results = append(results, "location string")
+	}
+	if o.etag {
+		results = append(results, "etag string")
+	}
+	results = append(results, "err error")
+	fmt.Fprintf(buf, "func (c *Client) %s(%s) (%s) {\n", o.name, strings.Join(args, ", "), strings.Join(results, ", "))
+
+	// Request
+	fmt.Fprintf(buf, "\treq := request{method: %q, path: %s", o.method, o.pathExpr)
+	if o.redirect {
+		buf.WriteString(", redirect: true")
+	}
+	buf.WriteString("}\n")
+	for _, p := range o.required {
+		writeParam(buf, "\t", p, p.goName)
+	}
+	if len(o.optional) > 0 {
+		buf.WriteString("\tif params != nil {\n")
+		for _, p := range o.optional {
+			zero := `""`
+			if p.goType == "int" {
+				zero = "0"
+			}
+			fmt.Fprintf(buf, "\t\tif params.%s != %s {\n", p.goName, zero)
+			writeParam(buf, "\t\t\t", p, "params."+p.goName)
+			buf.WriteString("\t\t}\n")
+		}
+		buf.WriteString("\t}\n")
+	}
+	if o.body != nil {
+		arg := o.bodyArg()
+		switch {
+		case o.body.fileField != "":
+			fmt.Fprintf(buf, "\treq.file = &multipartFile{field: %q, file: %s}\n", o.body.fileField, arg)
+		default:
+			fmt.Fprintf(buf, "\treq.body = %s\n\treq.contentType = %q\n", arg, o.body.contentType)
+			if o.body.compact {
+				buf.WriteString("\treq.compact = true\n")
+			}
+		}
+	}
+
+	// Response
+	if !o.etag && !o.redirect && o.result == "" && !o.data {
+		buf.WriteString("\t_, err = c.do(ctx, req)\n\treturn\n}\n")
+		return
+	}
+	buf.WriteString("\tresp, err := c.do(ctx, req)\n\tif err != nil {\n\t\treturn\n\t}\n")
+	if o.etag {
+		buf.WriteString("\tetag = resp.header.Get(\"ETag\")\n")
+	}
+	switch {
+	case o.redirect:
+		buf.WriteString("\tlocation = resp.header.Get(\"Location\")\n")
+	case o.result != "" && o.data:
+		buf.WriteString("\tif !resp.isJSON() {\n\t\tdata = resp.body\n\t\treturn\n\t}\n\terr = resp.decode(&result)\n")
+	case o.result != "":
+		buf.WriteString("\terr = resp.decode(&result)\n")
+	case o.data:
+		buf.WriteString("\tdata = resp.body\n")
+	}
+	buf.WriteString("\treturn\n}\n")
+
+	if o.page != nil && o.result != "" {
+		o.writeAll(buf)
+	}
+}
+
+// writeAll writes the method getting all the pages of a paginated operation
+func (o *operation) writeAll(buf *bytes.Buffer) {
+	args := []string{"ctx context.Context"}
+	callArgs := []string{"ctx"}
+	for _, arg := range o.pathArgs {
+		args = append(args, arg+" string")
+		callArgs = append(callArgs, arg)
+	}
+	for _, p := range o.required {
+		args = append(args, p.goName+" "+p.goType)
+		callArgs = append(callArgs, p.goName)
+	}
+	args = append(args, "params *"+o.name+"Params")
+	callArgs = append(callArgs, "&p")
+
+	buf.WriteString("\n")
+	writeComment(buf, "", fmt.Sprintf("%sAll calls %s until the last page, and returns the %s of all the pages. The Offset "+
+		"and Limit of params are the first item and the size of the pages.", o.name, o.name, strings.ToLower(o.page.field)))
+	fmt.Fprintf(buf, "func (c *Client) %sAll(%s) ([]%s, error) {\n", o.name, strings.Join(args, ", "), o.page.elem)
+	fmt.Fprintf(buf, "\tvar p %sParams\n\tif params != nil {\n\t\tp = *params\n\t}\n", o.name)
+	fmt.Fprintf(buf, "\tif p.Limit == 0 {\n\t\tp.Limit = %d\n\t}\n", o.page.defaultLimit)
+	fmt.Fprintf(buf, "\tvar all []%s\n\tfor {\n", o.page.elem)
+	fmt.Fprintf(buf, "\t\tpage, err := c.%s(%s)\n\t\tif err != nil {\n\t\t\treturn all, err\n\t\t}\n", o.name, strings.Join(callArgs, ", "))
+	fmt.Fprintf(buf, "\t\tall = append(all, page.%s...)\n", o.page.field)
+	fmt.Fprintf(buf, "\t\tif len(page.%s) < p.Limit {\n\t\t\treturn all, nil\n\t\t}\n", o.page.field)
+	fmt.Fprintf(buf, "\t\tp.Offset += len(page.%s)\n\t}\n}\n", o.page.field)
+}
+
+// bodyArg returns the name of the argument with the request body
+func (o *operation) bodyArg() string {
+	switch {
+	case o.body.fileField != "":
+		return unexported(o.body.fileField)
+	case o.body.contentType == "application/merge-patch+json":
+		return "patch"
+	default:
+		return "body"
+	}
+}
+
+// writeParam writes the statement adding the parameter p, with the value of the Go expression value, to req
+func writeParam(buf *bytes.Buffer, indent string, p param, value string) {
+	if p.goType == "int" {
+		value = "strconv.Itoa(" + value + ")"
+	}
+	if p.in == openapi3.ParameterInHeader {
+		fmt.Fprintf(buf, "%sreq.setHeader(%q, %s)\n", indent, p.name, value)
+	} else {
+		fmt.Fprintf(buf, "%sreq.setQuery(%q, %s)\n", indent, p.name, value)
+	}
+}
+
+// exported returns the Go name of an exported identifier for the name of the specification, e.g. IfMatch for
+// If-Match and UserID for userId
+func exported(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, c := range name {
+		if c == '-' || c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+	s := b.String()
+	if strings.HasSuffix(s, "Id") {
+		s = strings.TrimSuffix(s, "Id") + "ID"
+	}
+	return s
+}
+
+// unexported returns the Go name of an unexported identifier for the name of the specification, e.g. ifMatch for
+// If-Match and userID for userId
+func unexported(name string) string {
+	return lowerFirst(exported(name))
+}
+
+// lowerFirst returns s with its first letter in lower case
+func lowerFirst(s string) string {
+	if s == "" || s[0] < 'A' || s[0] > 'Z' {
+		return s
+	}
+	return string(s[0]+'a'-'A') + s[1:]
+}
+
+// firstParagraph returns the first paragraph of s on a single line, without the trailing period
+func firstParagraph(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "\n\n"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSuffix(strings.Join(strings.Fields(s), " "), ".")
+}
+
+// writeComment writes text as a comment wrapped at 120 columns, the line length of the repository
+func writeComment(buf *bytes.Buffer, indent string, text string) {
+	line := indent + "//"
+	for _, word := range strings.Fields(text) {
+		if len(line)+1+len(word) > 120 && len(line) > len(indent)+2 {
+			buf.WriteString(line + "\n")
+			line = indent + "//"
+		}
+		line += " " + word
+	}
+	buf.WriteString(line + "\n")
+}
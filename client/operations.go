@@ -0,0 +1,1048 @@
+// Code generated by client/gen from doc/api.yaml. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// GetAuditLogParams are the optional parameters of GetAuditLog
+type GetAuditLogParams struct {
+	// How many items of the list to return
+	Limit int
+	// How many items of the list to skip
+	Offset int
+}
+
+// GetAuditLog calls GET /admin/audit: get the audit log (admin).
+func (c *Client) GetAuditLog(ctx context.Context, params *GetAuditLogParams) (result structs.AuditLog, err error) {
+	req := request{method: "GET", path: "/admin/audit"}
+	if params != nil {
+		if params.Limit != 0 {
+			req.setQuery("limit", strconv.Itoa(params.Limit))
+		}
+		if params.Offset != 0 {
+			req.setQuery("offset", strconv.Itoa(params.Offset))
+		}
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetAuditLogAll calls GetAuditLog until the last page, and returns the entries of all the pages. The Offset and Limit
+// of params are the first item and the size of the pages.
+func (c *Client) GetAuditLogAll(ctx context.Context, params *GetAuditLogParams) ([]structs.AuditEntry, error) {
+	var p GetAuditLogParams
+	if params != nil {
+		p = *params
+	}
+	if p.Limit == 0 {
+		p.Limit = 50
+	}
+	var all []structs.AuditEntry
+	for {
+		page, err := c.GetAuditLog(ctx, &p)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, page.Entries...)
+		if len(page.Entries) < p.Limit {
+			return all, nil
+		}
+		p.Offset += len(page.Entries)
+	}
+}
+
+// RemoveComment calls DELETE /admin/comments/{commentId}: delete any comment (moderator).
+func (c *Client) RemoveComment(ctx context.Context, commentID string) (result structs.Success, err error) {
+	req := request{method: "DELETE", path: "/admin/comments/" + url.PathEscape(commentID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// RemovePost calls DELETE /admin/posts/{postId}: delete any post (moderator).
+func (c *Client) RemovePost(ctx context.Context, postID string) (result structs.Success, err error) {
+	req := request{method: "DELETE", path: "/admin/posts/" + url.PathEscape(postID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ListReportsParams are the optional parameters of ListReports
+type ListReportsParams struct {
+	// How many items of the list to return
+	Limit int
+	// How many items of the list to skip
+	Offset int
+	// Only return the reports with this status
+	Status string
+}
+
+// ListReports calls GET /admin/reports: get the moderation queue (moderator).
+func (c *Client) ListReports(ctx context.Context, params *ListReportsParams) (result structs.ReportCollection, err error) {
+	req := request{method: "GET", path: "/admin/reports"}
+	if params != nil {
+		if params.Limit != 0 {
+			req.setQuery("limit", strconv.Itoa(params.Limit))
+		}
+		if params.Offset != 0 {
+			req.setQuery("offset", strconv.Itoa(params.Offset))
+		}
+		if params.Status != "" {
+			req.setQuery("status", params.Status)
+		}
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ListReportsAll calls ListReports until the last page, and returns the reports of all the pages. The Offset and Limit
+// of params are the first item and the size of the pages.
+func (c *Client) ListReportsAll(ctx context.Context, params *ListReportsParams) ([]structs.Report, error) {
+	var p ListReportsParams
+	if params != nil {
+		p = *params
+	}
+	if p.Limit == 0 {
+		p.Limit = 50
+	}
+	var all []structs.Report
+	for {
+		page, err := c.ListReports(ctx, &p)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, page.Reports...)
+		if len(page.Reports) < p.Limit {
+			return all, nil
+		}
+		p.Offset += len(page.Reports)
+	}
+}
+
+// GetReport calls GET /admin/reports/{reportId}: get a report (moderator).
+func (c *Client) GetReport(ctx context.Context, reportID string) (result structs.Report, err error) {
+	req := request{method: "GET", path: "/admin/reports/" + url.PathEscape(reportID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ClaimReport calls POST /admin/reports/{reportId}/claim: claim a report (moderator).
+func (c *Client) ClaimReport(ctx context.Context, reportID string) (result structs.Success, err error) {
+	req := request{method: "POST", path: "/admin/reports/" + url.PathEscape(reportID) + "/claim"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// DismissReport calls POST /admin/reports/{reportId}/dismiss: dismiss a report without taking any action (moderator).
+func (c *Client) DismissReport(ctx context.Context, reportID string, body structs.Resolution) (result structs.Success, err error) {
+	req := request{method: "POST", path: "/admin/reports/" + url.PathEscape(reportID) + "/dismiss"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ResolveReport calls POST /admin/reports/{reportId}/resolve: resolve a report with an action (moderator).
+func (c *Client) ResolveReport(ctx context.Context, reportID string, body structs.Resolution) (result structs.Success, err error) {
+	req := request{method: "POST", path: "/admin/reports/" + url.PathEscape(reportID) + "/resolve"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetStats calls GET /admin/stats: get the statistics of the system (admin).
+func (c *Client) GetStats(ctx context.Context) (result structs.Stats, err error) {
+	req := request{method: "GET", path: "/admin/stats"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ListUsersParams are the optional parameters of ListUsers
+type ListUsersParams struct {
+	// How many items of the list to return
+	Limit int
+	// How many items of the list to skip
+	Offset int
+}
+
+// ListUsers calls GET /admin/users: list every user, including the deleted and the suspended ones (moderator).
+func (c *Client) ListUsers(ctx context.Context, params *ListUsersParams) (result structs.AdminUserCollection, err error) {
+	req := request{method: "GET", path: "/admin/users"}
+	if params != nil {
+		if params.Limit != 0 {
+			req.setQuery("limit", strconv.Itoa(params.Limit))
+		}
+		if params.Offset != 0 {
+			req.setQuery("offset", strconv.Itoa(params.Offset))
+		}
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ListUsersAll calls ListUsers until the last page, and returns the users of all the pages. The Offset and Limit of
+// params are the first item and the size of the pages.
+func (c *Client) ListUsersAll(ctx context.Context, params *ListUsersParams) ([]structs.AdminUser, error) {
+	var p ListUsersParams
+	if params != nil {
+		p = *params
+	}
+	if p.Limit == 0 {
+		p.Limit = 50
+	}
+	var all []structs.AdminUser
+	for {
+		page, err := c.ListUsers(ctx, &p)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, page.Users...)
+		if len(page.Users) < p.Limit {
+			return all, nil
+		}
+		p.Offset += len(page.Users)
+	}
+}
+
+// SetUserRole calls PUT /admin/users/{userId}/role: set the role of a user (admin).
+func (c *Client) SetUserRole(ctx context.Context, userID string, body structs.Role) (result structs.Success, err error) {
+	req := request{method: "PUT", path: "/admin/users/" + url.PathEscape(userID) + "/role"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// SuspendUser calls PUT /admin/users/{userId}/suspension: suspend a user (moderator).
+func (c *Client) SuspendUser(ctx context.Context, userID string, body structs.Suspension) (result structs.Success, err error) {
+	req := request{method: "PUT", path: "/admin/users/" + url.PathEscape(userID) + "/suspension"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// UnsuspendUser calls DELETE /admin/users/{userId}/suspension: lift the suspension of a user (moderator).
+func (c *Client) UnsuspendUser(ctx context.Context, userID string) (result structs.Success, err error) {
+	req := request{method: "DELETE", path: "/admin/users/" + url.PathEscape(userID) + "/suspension"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetContextReply calls GET /context: example endpoint replying with "Hello World!".
+func (c *Client) GetContextReply(ctx context.Context) (data []byte, err error) {
+	req := request{method: "GET", path: "/context"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	data = resp.body
+	return
+}
+
+// Liveness calls GET /liveness: check that the server can serve requests.
+func (c *Client) Liveness(ctx context.Context) (err error) {
+	req := request{method: "GET", path: "/liveness"}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// DoLoginParams are the optional parameters of DoLogin
+type DoLoginParams struct {
+	// A unique key chosen by the client, to retry the request safely. A retry with the same key and the same body gets the
+	// response of the first request, with the Idempotent-Replayed header, instead of creating a duplicate. Keys are kept
+	// for 24 hours by default, and are scoped to the user of the session, or to the submitted username for logins
+	IdempotencyKey string
+}
+
+// DoLogin calls POST /session: logs in the user.
+func (c *Client) DoLogin(ctx context.Context, body structs.Credentials, params *DoLoginParams) (result structs.Session, err error) {
+	req := request{method: "POST", path: "/session"}
+	if params != nil {
+		if params.IdempotencyKey != "" {
+			req.setHeader("Idempotency-Key", params.IdempotencyKey)
+		}
+	}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ClaimAccount calls POST /session/claim: claims a username-only account.
+func (c *Client) ClaimAccount(ctx context.Context, body structs.Credentials) (result string, err error) {
+	req := request{method: "POST", path: "/session/claim"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// FinishOIDCLoginParams are the optional parameters of FinishOIDCLogin
+type FinishOIDCLoginParams struct {
+	Code  string
+	State string
+}
+
+// FinishOIDCLogin calls GET /session/oidc/callback: completes the login through the OpenID Connect provider.
+func (c *Client) FinishOIDCLogin(ctx context.Context, params *FinishOIDCLoginParams) (result structs.Session, err error) {
+	req := request{method: "GET", path: "/session/oidc/callback"}
+	if params != nil {
+		if params.Code != "" {
+			req.setQuery("code", params.Code)
+		}
+		if params.State != "" {
+			req.setQuery("state", params.State)
+		}
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// StartOIDCLogin calls GET /session/oidc/login: starts the login through the OpenID Connect provider. It returns the
+// URL the response redirects to.
+func (c *Client) StartOIDCLogin(ctx context.Context) (location string, err error) {
+	req := request{method: "GET", path: "/session/oidc/login", redirect: true}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	location = resp.header.Get("Location")
+	return
+}
+
+// SearchUser calls GET /users: search for a user, based on the username.
+func (c *Client) SearchUser(ctx context.Context, username string) (result structs.UserCollection, err error) {
+	req := request{method: "GET", path: "/users"}
+	req.setQuery("username", username)
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetUserProfile calls GET /users/{userId}: get the profile of a user. The ETag of the response is returned too.
+func (c *Client) GetUserProfile(ctx context.Context, userID string) (result structs.User, etag string, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// SetMyUserNameParams are the optional parameters of SetMyUserName
+type SetMyUserNameParams struct {
+	// The ETag of the version of the resource being edited, or "*" for any version. It is required, a request without it
+	// gets a 428 response (not a 400), telling the client to get the resource first
+	IfMatch string
+}
+
+// SetMyUserName calls PUT /users/{userId}: update the profile of a user. The ETag of the response is returned too.
+func (c *Client) SetMyUserName(ctx context.Context, userID string, body structs.User, params *SetMyUserNameParams) (result structs.User, etag string, err error) {
+	req := request{method: "PUT", path: "/users/" + url.PathEscape(userID)}
+	if params != nil {
+		if params.IfMatch != "" {
+			req.setHeader("If-Match", params.IfMatch)
+		}
+	}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// PatchUserProfileParams are the optional parameters of PatchUserProfile
+type PatchUserProfileParams struct {
+	// The ETag of the version of the resource being edited, if the edit must fail when it changed
+	IfMatch string
+}
+
+// PatchUserProfile calls PATCH /users/{userId}: change some fields of the profile of a user. The ETag of the response
+// is returned too.
+func (c *Client) PatchUserProfile(ctx context.Context, userID string, patch map[string]interface{}, params *PatchUserProfileParams) (result structs.User, etag string, err error) {
+	req := request{method: "PATCH", path: "/users/" + url.PathEscape(userID)}
+	if params != nil {
+		if params.IfMatch != "" {
+			req.setHeader("If-Match", params.IfMatch)
+		}
+	}
+	req.body = patch
+	req.contentType = "application/merge-patch+json"
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// DeleteUser calls DELETE /users/{userId}: delete a user.
+func (c *Client) DeleteUser(ctx context.Context, userID string) (result structs.Success, err error) {
+	req := request{method: "DELETE", path: "/users/" + url.PathEscape(userID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetBannedUsers calls GET /users/{userId}/banned: get all the users banned by a user.
+func (c *Client) GetBannedUsers(ctx context.Context, userID string) (result structs.UserCollection, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/banned"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// BanUser calls PUT /users/{userId}/banned/{bannedId}: ban a user.
+func (c *Client) BanUser(ctx context.Context, userID string, bannedID string) (err error) {
+	req := request{method: "PUT", path: "/users/" + url.PathEscape(userID) + "/banned/" + url.PathEscape(bannedID)}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// UnbanUser calls DELETE /users/{userId}/banned/{bannedId}: unban a user.
+func (c *Client) UnbanUser(ctx context.Context, userID string, bannedID string) (err error) {
+	req := request{method: "DELETE", path: "/users/" + url.PathEscape(userID) + "/banned/" + url.PathEscape(bannedID)}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// StartExport calls POST /users/{userId}/export: start an export of the user data.
+func (c *Client) StartExport(ctx context.Context, userID string) (result structs.Job, err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/export"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetExport calls GET /users/{userId}/export/{jobId}: download the export archive. The body of the responses that are
+// not JSON is returned as data.
+func (c *Client) GetExport(ctx context.Context, userID string, jobID string) (result structs.Job, data []byte, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/export/" + url.PathEscape(jobID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	if !resp.isJSON() {
+		data = resp.body
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetMyStream calls GET /users/{userId}/feed: get the feed of a user.
+func (c *Client) GetMyStream(ctx context.Context, userID string) (result structs.PostStream, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/feed"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetFollowers calls GET /users/{userId}/followers: get all the followers of a user.
+func (c *Client) GetFollowers(ctx context.Context, userID string) (result structs.UserCollection, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/followers"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetFollowing calls GET /users/{userId}/following: get all the users followed by a user.
+func (c *Client) GetFollowing(ctx context.Context, userID string) (result structs.UserCollection, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/following"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// FollowUser calls PUT /users/{userId}/following/{followingId}: follow a user.
+func (c *Client) FollowUser(ctx context.Context, userID string, followingID string) (result structs.Success, err error) {
+	req := request{method: "PUT", path: "/users/" + url.PathEscape(userID) + "/following/" + url.PathEscape(followingID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// UnfollowUser calls DELETE /users/{userId}/following/{followingId}: unfollow a user.
+func (c *Client) UnfollowUser(ctx context.Context, userID string, followingID string) (result structs.Success, err error) {
+	req := request{method: "DELETE", path: "/users/" + url.PathEscape(userID) + "/following/" + url.PathEscape(followingID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetJob calls GET /users/{userId}/jobs/{jobId}: get the status of a job.
+func (c *Client) GetJob(ctx context.Context, userID string, jobID string) (result structs.Job, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/jobs/" + url.PathEscape(jobID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ChangePassword calls PUT /users/{userId}/password: set or change the password of a user.
+func (c *Client) ChangePassword(ctx context.Context, userID string, body structs.PasswordChange) (result structs.Success, err error) {
+	req := request{method: "PUT", path: "/users/" + url.PathEscape(userID) + "/password"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// UploadPhotoParams are the optional parameters of UploadPhoto
+type UploadPhotoParams struct {
+	// A unique key chosen by the client, to retry the request safely. A retry with the same key and the same body gets the
+	// response of the first request, with the Idempotent-Replayed header, instead of creating a duplicate. Keys are kept
+	// for 24 hours by default, and are scoped to the user of the session, or to the submitted username for logins
+	IdempotencyKey string
+}
+
+// UploadPhoto calls POST /users/{userId}/photos: upload a photo.
+func (c *Client) UploadPhoto(ctx context.Context, userID string, photo File, params *UploadPhotoParams) (result string, err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/photos"}
+	if params != nil {
+		if params.IdempotencyKey != "" {
+			req.setHeader("Idempotency-Key", params.IdempotencyKey)
+		}
+	}
+	req.file = &multipartFile{field: "photo", file: photo}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetPhoto calls GET /users/{userId}/photos/{photoId}: get a photo.
+func (c *Client) GetPhoto(ctx context.Context, userID string, photoID string) (data []byte, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/photos/" + url.PathEscape(photoID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	data = resp.body
+	return
+}
+
+// DeletePhoto calls DELETE /users/{userId}/photos/{photoId}: delete a photo.
+func (c *Client) DeletePhoto(ctx context.Context, userID string, photoID string) (err error) {
+	req := request{method: "DELETE", path: "/users/" + url.PathEscape(userID) + "/photos/" + url.PathEscape(photoID)}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// GetUserPosts calls GET /users/{userId}/posts: get all the posts of a user.
+func (c *Client) GetUserPosts(ctx context.Context, userID string) (result structs.PostStream, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/posts"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// CreatePostParams are the optional parameters of CreatePost
+type CreatePostParams struct {
+	// A unique key chosen by the client, to retry the request safely. A retry with the same key and the same body gets the
+	// response of the first request, with the Idempotent-Replayed header, instead of creating a duplicate. Keys are kept
+	// for 24 hours by default, and are scoped to the user of the session, or to the submitted username for logins
+	IdempotencyKey string
+}
+
+// CreatePost calls POST /users/{userId}/posts: create a new post.
+func (c *Client) CreatePost(ctx context.Context, userID string, body structs.UserPost, params *CreatePostParams) (result structs.Success, err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/posts"}
+	if params != nil {
+		if params.IdempotencyKey != "" {
+			req.setHeader("Idempotency-Key", params.IdempotencyKey)
+		}
+	}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetPost calls GET /users/{userId}/posts/{postId}: get the details of a post. The ETag of the response is returned
+// too.
+func (c *Client) GetPost(ctx context.Context, userID string, postID string) (result structs.UserPost, etag string, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// EditPostParams are the optional parameters of EditPost
+type EditPostParams struct {
+	// The ETag of the version of the resource being edited, or "*" for any version. It is required, a request without it
+	// gets a 428 response (not a 400), telling the client to get the resource first
+	IfMatch string
+}
+
+// EditPost calls PUT /users/{userId}/posts/{postId}: edit a post. The ETag of the response is returned too.
+func (c *Client) EditPost(ctx context.Context, userID string, postID string, body structs.UserPost, params *EditPostParams) (result structs.Success, etag string, err error) {
+	req := request{method: "PUT", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID)}
+	if params != nil {
+		if params.IfMatch != "" {
+			req.setHeader("If-Match", params.IfMatch)
+		}
+	}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// PatchPostParams are the optional parameters of PatchPost
+type PatchPostParams struct {
+	// The ETag of the version of the resource being edited, if the edit must fail when it changed
+	IfMatch string
+}
+
+// PatchPost calls PATCH /users/{userId}/posts/{postId}: change some fields of a post. The ETag of the response is
+// returned too.
+func (c *Client) PatchPost(ctx context.Context, userID string, postID string, patch map[string]interface{}, params *PatchPostParams) (result structs.Success, etag string, err error) {
+	req := request{method: "PATCH", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID)}
+	if params != nil {
+		if params.IfMatch != "" {
+			req.setHeader("If-Match", params.IfMatch)
+		}
+	}
+	req.body = patch
+	req.contentType = "application/merge-patch+json"
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// DeletePost calls DELETE /users/{userId}/posts/{postId}: delete the post.
+func (c *Client) DeletePost(ctx context.Context, userID string, postID string) (result structs.Success, err error) {
+	req := request{method: "DELETE", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetPostComments calls GET /users/{userId}/posts/{postId}/comments: get all the comments of a post.
+func (c *Client) GetPostComments(ctx context.Context, userID string, postID string) (result structs.CommentStream, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// CommentPhotoParams are the optional parameters of CommentPhoto
+type CommentPhotoParams struct {
+	// A unique key chosen by the client, to retry the request safely. A retry with the same key and the same body gets the
+	// response of the first request, with the Idempotent-Replayed header, instead of creating a duplicate. Keys are kept
+	// for 24 hours by default, and are scoped to the user of the session, or to the submitted username for logins
+	IdempotencyKey string
+}
+
+// CommentPhoto calls POST /users/{userId}/posts/{postId}/comments: create a new comment.
+func (c *Client) CommentPhoto(ctx context.Context, userID string, postID string, body structs.Comment, params *CommentPhotoParams) (result structs.Success, err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments"}
+	if params != nil {
+		if params.IdempotencyKey != "" {
+			req.setHeader("Idempotency-Key", params.IdempotencyKey)
+		}
+	}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetComment calls GET /users/{userId}/posts/{postId}/comments/{commentId}: get the details of a comment. The ETag of
+// the response is returned too.
+func (c *Client) GetComment(ctx context.Context, userID string, postID string, commentID string) (result structs.Comment, etag string, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// EditCommentParams are the optional parameters of EditComment
+type EditCommentParams struct {
+	// The ETag of the version of the resource being edited, or "*" for any version. It is required, a request without it
+	// gets a 428 response (not a 400), telling the client to get the resource first
+	IfMatch string
+}
+
+// EditComment calls PUT /users/{userId}/posts/{postId}/comments/{commentId}: edit a comment. The ETag of the response
+// is returned too.
+func (c *Client) EditComment(ctx context.Context, userID string, postID string, commentID string, body structs.Comment, params *EditCommentParams) (result structs.Success, etag string, err error) {
+	req := request{method: "PUT", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID)}
+	if params != nil {
+		if params.IfMatch != "" {
+			req.setHeader("If-Match", params.IfMatch)
+		}
+	}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// PatchCommentParams are the optional parameters of PatchComment
+type PatchCommentParams struct {
+	// The ETag of the version of the resource being edited, if the edit must fail when it changed
+	IfMatch string
+}
+
+// PatchComment calls PATCH /users/{userId}/posts/{postId}/comments/{commentId}: change some fields of a comment. The
+// ETag of the response is returned too.
+func (c *Client) PatchComment(ctx context.Context, userID string, postID string, commentID string, patch map[string]interface{}, params *PatchCommentParams) (result structs.Success, etag string, err error) {
+	req := request{method: "PATCH", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID)}
+	if params != nil {
+		if params.IfMatch != "" {
+			req.setHeader("If-Match", params.IfMatch)
+		}
+	}
+	req.body = patch
+	req.contentType = "application/merge-patch+json"
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	etag = resp.header.Get("ETag")
+	err = resp.decode(&result)
+	return
+}
+
+// UncommentPhoto calls DELETE /users/{userId}/posts/{postId}/comments/{commentId}: delete a comment.
+func (c *Client) UncommentPhoto(ctx context.Context, userID string, postID string, commentID string) (err error) {
+	req := request{method: "DELETE", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID)}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// GetCommentLikes calls GET /users/{userId}/posts/{postId}/comments/{commentId}/likes: get all the likes of a comment.
+func (c *Client) GetCommentLikes(ctx context.Context, userID string, postID string, commentID string) (result structs.LikeCollection, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID) + "/likes"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// LikeComment calls PUT /users/{userId}/posts/{postId}/comments/{commentId}/likes/{likeId}: like a comment.
+func (c *Client) LikeComment(ctx context.Context, userID string, postID string, commentID string, likeID string) (result structs.Success, err error) {
+	req := request{method: "PUT", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID) + "/likes/" + url.PathEscape(likeID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// UnlikeComment calls DELETE /users/{userId}/posts/{postId}/comments/{commentId}/likes/{likeId}: unlike a comment.
+func (c *Client) UnlikeComment(ctx context.Context, userID string, postID string, commentID string, likeID string) (err error) {
+	req := request{method: "DELETE", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID) + "/likes/" + url.PathEscape(likeID)}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// ReportComment calls POST /users/{userId}/posts/{postId}/comments/{commentId}/reports: report a comment to the
+// moderators.
+func (c *Client) ReportComment(ctx context.Context, userID string, postID string, commentID string, body structs.Report) (result structs.Report, err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID) + "/reports"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// RestoreComment calls POST /users/{userId}/posts/{postId}/comments/{commentId}/restore: restore a deleted comment.
+func (c *Client) RestoreComment(ctx context.Context, userID string, postID string, commentID string) (err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID) + "/restore"}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// GetCommentRevisions calls GET /users/{userId}/posts/{postId}/comments/{commentId}/revisions: get the edit history of
+// a comment.
+func (c *Client) GetCommentRevisions(ctx context.Context, userID string, postID string, commentID string) (result structs.RevisionCollection, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/comments/" + url.PathEscape(commentID) + "/revisions"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetPostLikes calls GET /users/{userId}/posts/{postId}/likes: get all the likes of a post.
+func (c *Client) GetPostLikes(ctx context.Context, userID string, postID string) (result structs.LikeCollection, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/likes"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// LikePhoto calls PUT /users/{userId}/posts/{postId}/likes/{likeId}: like a post.
+func (c *Client) LikePhoto(ctx context.Context, userID string, postID string, likeID string) (result structs.Success, err error) {
+	req := request{method: "PUT", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/likes/" + url.PathEscape(likeID)}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// UnlikePhoto calls DELETE /users/{userId}/posts/{postId}/likes/{likeId}: unlike a post.
+func (c *Client) UnlikePhoto(ctx context.Context, userID string, postID string, likeID string) (err error) {
+	req := request{method: "DELETE", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/likes/" + url.PathEscape(likeID)}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// ReportPost calls POST /users/{userId}/posts/{postId}/reports: report a post to the moderators.
+func (c *Client) ReportPost(ctx context.Context, userID string, postID string, body structs.Report) (result structs.Report, err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/reports"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// RestorePost calls POST /users/{userId}/posts/{postId}/restore: restore a deleted post.
+func (c *Client) RestorePost(ctx context.Context, userID string, postID string) (result structs.Success, err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/restore"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetPostRevisions calls GET /users/{userId}/posts/{postId}/revisions: get the edit history of a post.
+func (c *Client) GetPostRevisions(ctx context.Context, userID string, postID string) (result structs.RevisionCollection, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/posts/" + url.PathEscape(postID) + "/revisions"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// ReportUser calls POST /users/{userId}/reports: report a user to the moderators.
+func (c *Client) ReportUser(ctx context.Context, userID string, body structs.Report) (result structs.Report, err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/reports"}
+	req.body = body
+	req.contentType = "application/json"
+	req.compact = true
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// RestoreUser calls POST /users/{userId}/restore: restore a deleted user.
+func (c *Client) RestoreUser(ctx context.Context, userID string) (err error) {
+	req := request{method: "POST", path: "/users/" + url.PathEscape(userID) + "/restore"}
+	_, err = c.do(ctx, req)
+	return
+}
+
+// GetUsernameHistory calls GET /users/{userId}/usernames: get the previous usernames of a user.
+func (c *Client) GetUsernameHistory(ctx context.Context, userID string) (result structs.UsernameHistory, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/usernames"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
+
+// GetUserWarnings calls GET /users/{userId}/warnings: get the warnings the user received from the moderators.
+func (c *Client) GetUserWarnings(ctx context.Context, userID string) (result structs.WarningCollection, err error) {
+	req := request{method: "GET", path: "/users/" + url.PathEscape(userID) + "/warnings"}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return
+	}
+	err = resp.decode(&result)
+	return
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/gofrs/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// photoSize is the width and height of the placeholder photos, in pixels
+const photoSize = 160
+
+// words are the words of the generated captions and comments
+var words = strings.Fields(`the a my our this that sunset beach mountain city street coffee breakfast dinner cat dog
+	friends family weekend morning night light rain snow summer winter trip road view sky sea lake forest garden
+	today again finally best new old little big happy lovely quiet busy amazing`)
+
+// generator generates the data
+type generator struct {
+	db    database.AppDatabase
+	rng   *rand.Rand
+	until time.Time
+	days  int
+
+	users     []structs.User
+	followers [][]int // Indexes of the followers of every user
+	follows   int     // Total number of follows
+	posts     int
+	likes     int
+	comments  int
+}
+
+func generate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	dbFile := fs.String("db", "/tmp/decaf.db", "database file")
+	seed := fs.Int64("seed", 1, "seed of the random generator")
+	userCount := fs.Int("users", 1000, "number of users")
+	follows := fs.Float64("follows", 20, "average number of users followed by a user")
+	posts := fs.Float64("posts", 5, "average number of posts of a user")
+	likes := fs.Float64("likes", 10, "average number of likes of a post")
+	comments := fs.Float64("comments", 2, "average number of comments of a post")
+	days := fs.Int("days", 90, "number of days the posts are spread over")
+	untilDate := fs.String("until", "", "date of the last posts, RFC 3339 (default the start of the current day)")
+	_ = fs.Parse(args)
+
+	until := globaltime.Now().UTC().Truncate(24 * time.Hour)
+	if *untilDate != "" {
+		var err error
+		until, err = time.Parse(time.RFC3339, *untilDate)
+		if err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+	}
+	if *userCount < 1 || *days < 1 {
+		return fmt.Errorf("-users and -days must be at least 1")
+	}
+
+	// The dates set by the database (e.g. the sign up date) are the date of the data too, and the IDs come from their
+	// own generator, so that the whole data only depends on the flags
+	globaltime.FixedTime = until
+	uuid.DefaultGenerator = uuid.NewGenWithOptions(uuid.WithRandomReader(rand.New(rand.NewSource(*seed)))) // #nosec G404 -- IDs of test data
+
+	// The data can be generated again if the program fails: no need to sync every write to disk
+	conn, err := sql.Open("sqlite3", *dbFile+"?_foreign_keys=1&_sync=OFF")
+	if err != nil {
+		return fmt.Errorf("opening SQLite: %w", err)
+	}
+	defer conn.Close()
+	db, err := database.New(conn)
+	if err != nil {
+		return fmt.Errorf("creating the AppDatabase: %w", err)
+	}
+
+	g := &generator{
+		db:    db,
+		rng:   rand.New(rand.NewSource(*seed)), // #nosec G404 -- test data
+		until: until,
+		days:  *days,
+	}
+	start := time.Now()
+	err = g.createUsers(*userCount)
+	if err != nil {
+		return err
+	}
+	err = g.createFollows(*follows)
+	if err != nil {
+		return err
+	}
+	err = g.createPosts(*posts, *likes, *comments)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("generated %d users, %d follows, %d posts, %d likes and %d comments in %s\n",
+		len(g.users), g.follows, g.posts, g.likes, g.comments, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// createUsers creates n users
+func (g *generator) createUsers(n int) error {
+	g.users = make([]structs.User, n)
+	g.followers = make([][]int, n)
+	for i := range g.users {
+		user, err := g.db.CreateUser(username(i))
+		if err != nil {
+			return fmt.Errorf("creating user %s (the database must not have seeded users yet): %w", username(i), err)
+		}
+		g.users[i] = user
+	}
+	return nil
+}
+
+// createFollows makes every user follow, on average, mean users. Users follow the users who joined before them,
+// picked proportionally to their followers (preferential attachment), which gives a power-law distribution of the
+// followers.
+func (g *generator) createFollows(mean float64) error {
+	// Every user is in targets once, and once more for each follower
+	targets := make([]int, 0, len(g.users)+int(mean)*len(g.users))
+	for i, user := range g.users {
+		n := int(g.rng.ExpFloat64() * mean)
+		if n > i {
+			n = i
+		}
+		for _, t := range g.pick(targets, n, i) {
+			err := g.db.FollowUser(user.UserID, g.users[t].UserID)
+			if err != nil {
+				return fmt.Errorf("following %s: %w", g.users[t].Username, err)
+			}
+			g.followers[t] = append(g.followers[t], i)
+			targets = append(targets, t)
+			g.follows++
+		}
+		targets = append(targets, i)
+	}
+	return nil
+}
+
+// createPosts creates, on average, mean posts for every user. The posts have, on average, likes likes and comments
+// comments, from the followers of the author mostly: the posts of the popular users get more likes.
+func (g *generator) createPosts(mean float64, likes float64, comments float64) error {
+	averageFollowers := float64(g.follows) / float64(len(g.users))
+	for i, user := range g.users {
+		n := int(g.rng.ExpFloat64() * mean)
+		for j := 0; j < n; j++ {
+			photo, err := g.photo()
+			if err != nil {
+				return fmt.Errorf("generating a photo: %w", err)
+			}
+			photoID, err := g.db.SavePhoto(user.UserID, photoFile{bytes.NewReader(photo)})
+			if err != nil {
+				return fmt.Errorf("saving a photo: %w", err)
+			}
+			date := g.until.Add(-time.Duration(g.rng.Int63n(int64(g.days) * int64(24*time.Hour))))
+			post, err := g.db.AddPost(structs.UserPost{
+				AuthorID:       user.UserID,
+				AuthorUsername: user.Username,
+				CreationDate:   date,
+				Caption:        g.text(3, 12),
+				Image:          photoID,
+			})
+			if err != nil {
+				return fmt.Errorf("adding a post: %w", err)
+			}
+			g.posts++
+
+			popularity := (float64(len(g.followers[i])) + 1) / (averageFollowers + 1)
+			for _, liker := range g.pick(g.followers[i], int(g.rng.ExpFloat64()*likes*popularity), i) {
+				err = g.db.LikePost(post.ResourceID, g.users[liker].UserID)
+				if err != nil {
+					return fmt.Errorf("liking a post: %w", err)
+				}
+				g.likes++
+			}
+
+			for k := int(g.rng.ExpFloat64() * comments); k > 0; k-- {
+				author := g.users[g.pick(g.followers[i], 1, -1)[0]]
+				commented := date.Add(time.Duration(g.rng.Int63n(int64(g.until.Sub(date)) + 1)))
+				_, err = g.db.CreateComment(post.ResourceID, structs.Comment{
+					AuthorID:       author.UserID,
+					AuthorUsername: author.Username,
+					CreationDate:   commented,
+					Caption:        g.text(1, 8),
+				})
+				if err != nil {
+					return fmt.Errorf("adding a comment: %w", err)
+				}
+				g.comments++
+			}
+		}
+	}
+	return nil
+}
+
+// pick returns up to n distinct users other than exclude, drawn from pool, or from all the users if the pool is empty.
+// The users appearing more times in the pool are more likely to be picked.
+func (g *generator) pick(pool []int, n int, exclude int) []int {
+	picked := make([]int, 0, n)
+	seen := map[int]bool{exclude: true}
+	for attempts := 0; len(picked) < n && attempts < 10*n; attempts++ {
+		var u int
+		if len(pool) > 0 {
+			u = pool[g.rng.Intn(len(pool))]
+		} else {
+			u = g.rng.Intn(len(g.users))
+		}
+		if !seen[u] {
+			seen[u] = true
+			picked = append(picked, u)
+		}
+	}
+	return picked
+}
+
+// text returns a sentence of min to max random words
+func (g *generator) text(min int, max int) string {
+	n := min + g.rng.Intn(max-min+1)
+	sentence := make([]string, n)
+	for i := range sentence {
+		sentence[i] = words[g.rng.Intn(len(words))]
+	}
+	return strings.ToUpper(sentence[0][:1]) + strings.Join(sentence, " ")[1:]
+}
+
+// photo returns a placeholder photo: a JPEG with a gradient between two random colors
+func (g *generator) photo() ([]byte, error) {
+	from := color.RGBA{R: uint8(g.rng.Intn(256)), G: uint8(g.rng.Intn(256)), B: uint8(g.rng.Intn(256)), A: 255}
+	to := color.RGBA{R: uint8(g.rng.Intn(256)), G: uint8(g.rng.Intn(256)), B: uint8(g.rng.Intn(256)), A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, photoSize, photoSize))
+	for y := 0; y < photoSize; y++ {
+		for x := 0; x < photoSize; x++ {
+			t := (x + y) * 255 / (2*photoSize - 2)
+			img.Set(x, y, color.RGBA{
+				R: uint8((int(from.R)*(255-t) + int(to.R)*t) / 255),
+				G: uint8((int(from.G)*(255-t) + int(to.G)*t) / 255),
+				B: uint8((int(from.B)*(255-t) + int(to.B)*t) / 255),
+				A: 255,
+			})
+		}
+	}
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75})
+	return buf.Bytes(), err
+}
+
+// photoFile is a photo in memory, as the multipart.File taken by AppDatabase.SavePhoto
+type photoFile struct {
+	*bytes.Reader
+}
+
+func (photoFile) Close() error {
+	return nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/client"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// defaultMix is the default weight of every kind of request, mostly reads as from the web UI
+const defaultMix = "feed=30,post=25,profile=10,posts=10,comments=10,like=8,comment=4,follow=2,upload=1"
+
+// knownPosts is how many posts of the users are looked up before sending the load, for the requests on posts
+const knownPosts = 1000
+
+// requestKinds are the kinds of request of the load, by name
+var requestKinds = map[string]func(ctx context.Context, w *worker) error{
+	// Reads
+	"feed": func(ctx context.Context, w *worker) error {
+		_, err := w.client.GetMyStream(ctx, w.me.UserID)
+		return err
+	},
+	"post": func(ctx context.Context, w *worker) error {
+		p := w.post()
+		_, _, err := w.client.GetPost(ctx, p.AuthorID, p.PostID)
+		return err
+	},
+	"profile": func(ctx context.Context, w *worker) error {
+		_, _, err := w.client.GetUserProfile(ctx, w.user().UserID)
+		return err
+	},
+	"posts": func(ctx context.Context, w *worker) error {
+		_, err := w.client.GetUserPosts(ctx, w.user().UserID)
+		return err
+	},
+	"comments": func(ctx context.Context, w *worker) error {
+		p := w.post()
+		_, err := w.client.GetPostComments(ctx, p.AuthorID, p.PostID)
+		return err
+	},
+
+	// Writes
+	"like": func(ctx context.Context, w *worker) error {
+		p := w.post()
+		_, err := w.client.LikePhoto(ctx, p.AuthorID, p.PostID, w.me.UserID)
+		return err
+	},
+	"comment": func(ctx context.Context, w *worker) error {
+		p := w.post()
+		_, err := w.client.CommentPhoto(ctx, p.AuthorID, p.PostID, structs.Comment{
+			AuthorID:       w.me.UserID,
+			AuthorUsername: w.me.Username,
+			Caption:        w.text(1, 8),
+		}, nil)
+		return err
+	},
+	"follow": func(ctx context.Context, w *worker) error {
+		_, err := w.client.FollowUser(ctx, w.me.UserID, w.user().UserID)
+		return err
+	},
+	"upload": func(ctx context.Context, w *worker) error {
+		photoID, err := w.client.UploadPhoto(ctx, w.me.UserID, client.File{Name: "load.jpg", Content: bytes.NewReader(w.load.photo)}, nil)
+		if err != nil {
+			return err
+		}
+		_, err = w.client.CreatePost(ctx, w.me.UserID, structs.UserPost{
+			AuthorID:       w.me.UserID,
+			AuthorUsername: w.me.Username,
+			Caption:        w.text(3, 12),
+			Image:          photoID,
+		}, nil)
+		return err
+	},
+}
+
+// mixEntry is a kind of request of the mix, with its weight
+type mixEntry struct {
+	name   string
+	weight int
+}
+
+// loadState is the state shared by the workers
+type loadState struct {
+	users  []structs.User
+	tokens map[string]string  // Session tokens of the users, by user ID
+	posts  []structs.UserPost // Posts the requests on posts are about
+	mix    []mixEntry
+	total  int // Sum of the weights of the mix
+	photo  []byte
+}
+
+// worker sends requests as one of the users
+type worker struct {
+	load   *loadState
+	client *client.Client
+	me     structs.User
+	rng    *rand.Rand
+
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	lastError map[string]error
+}
+
+func load(args []string) error {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:3000", "URL of the API")
+	seed := fs.Int64("seed", 1, "seed of the random generator")
+	userCount := fs.Int("users", 100, "number of seeded users to act as")
+	workers := fs.Int("workers", 8, "number of concurrent requests")
+	duration := fs.Duration("duration", 30*time.Second, "duration of the load")
+	mixFlag := fs.String("mix", defaultMix, "weight of every kind of request")
+	_ = fs.Parse(args)
+
+	mix, total, err := parseMix(*mixFlag)
+	if err != nil {
+		return err
+	}
+	if *userCount < 1 || *workers < 1 {
+		return fmt.Errorf("-users and -workers must be at least 1")
+	}
+	rng := rand.New(rand.NewSource(*seed)) // #nosec G404 -- test load
+	httpClient := &http.Client{Timeout: time.Minute, Transport: &http.Transport{MaxIdleConnsPerHost: *workers}}
+
+	// Log in as the users and look up their posts; not part of the measured load
+	ctx := context.Background()
+	state := &loadState{tokens: make(map[string]string), mix: mix, total: total}
+	for i := 0; i < *userCount; i++ {
+		c := client.New(*server)
+		c.HTTPClient = httpClient
+		session, err := c.DoLogin(ctx, structs.Credentials{Username: username(i)}, nil)
+		if err != nil {
+			return fmt.Errorf("logging in as %s (are the users seeded?): %w", username(i), err)
+		}
+		state.users = append(state.users, structs.User{UserID: session.UserID, Username: username(i)})
+		state.tokens[session.UserID] = session.Token
+	}
+	lookup := client.New(*server)
+	lookup.HTTPClient = httpClient
+	lookup.Token = state.tokens[state.users[0].UserID]
+	for _, i := range rng.Perm(len(state.users)) {
+		if len(state.posts) >= knownPosts {
+			break
+		}
+		stream, err := lookup.GetUserPosts(ctx, state.users[i].UserID)
+		if err != nil {
+			return fmt.Errorf("getting the posts of %s: %w", state.users[i].Username, err)
+		}
+		for _, p := range stream.Posts {
+			state.posts = append(state.posts, structs.UserPost{PostID: p.ResourceID, AuthorID: state.users[i].UserID})
+		}
+	}
+	if len(state.posts) == 0 {
+		return errors.New("the users have no posts, seed them with \"seed generate\"")
+	}
+	g := generator{rng: rng}
+	state.photo, err = g.photo()
+	if err != nil {
+		return fmt.Errorf("generating a photo: %w", err)
+	}
+
+	// Send the load
+	fmt.Printf("sending the load for %s from %d workers as %d users, %d posts known\n", *duration, *workers, len(state.users), len(state.posts))
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+	results := make([]*worker, *workers)
+	var wg sync.WaitGroup
+	for i := range results {
+		c := client.New(*server)
+		c.HTTPClient = httpClient
+		w := &worker{
+			load:      state,
+			client:    c,
+			rng:       rand.New(rand.NewSource(rng.Int63())), // #nosec G404 -- test load
+			latencies: make(map[string][]time.Duration),
+			errors:    make(map[string]int),
+			lastError: make(map[string]error),
+		}
+		results[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return report(results, *duration)
+}
+
+// parseMix parses the -mix flag, e.g. "feed=3,like=1", and returns its entries and the sum of their weights
+func parseMix(s string) ([]mixEntry, int, error) {
+	var mix []mixEntry
+	total := 0
+	for _, field := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			return nil, 0, fmt.Errorf("invalid -mix entry %q, expected <name>=<weight>", field)
+		}
+		name := parts[0]
+		weight, err := strconv.Atoi(parts[1])
+		if err != nil || weight < 0 {
+			return nil, 0, fmt.Errorf("invalid -mix entry %q, expected <name>=<weight>", field)
+		}
+		if _, ok := requestKinds[name]; !ok {
+			return nil, 0, fmt.Errorf("unknown kind of request %q in -mix", name)
+		}
+		mix = append(mix, mixEntry{name: name, weight: weight})
+		total += weight
+	}
+	if total == 0 {
+		return nil, 0, errors.New("the weights of -mix sum to 0")
+	}
+	return mix, total, nil
+}
+
+// run sends requests until the context is done, each time as a random user
+func (w *worker) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		w.me = w.user()
+		w.client.Token = w.load.tokens[w.me.UserID]
+		name := w.kind()
+
+		start := time.Now()
+		err := requestKinds[name](ctx, w)
+		elapsed := time.Since(start)
+		if ctx.Err() != nil {
+			// Interrupted by the end of the load
+			return
+		}
+		w.latencies[name] = append(w.latencies[name], elapsed)
+		if err != nil {
+			w.errors[name]++
+			w.lastError[name] = err
+		}
+	}
+}
+
+// kind returns a random kind of request, following the weights of the mix
+func (w *worker) kind() string {
+	n := w.rng.Intn(w.load.total)
+	for _, entry := range w.load.mix {
+		if n < entry.weight {
+			return entry.name
+		}
+		n -= entry.weight
+	}
+	return w.load.mix[len(w.load.mix)-1].name
+}
+
+// user returns a random user
+func (w *worker) user() structs.User {
+	return w.load.users[w.rng.Intn(len(w.load.users))]
+}
+
+// text returns a random sentence of min to max words: the content filter refuses the same text sent again and again
+func (w *worker) text(min int, max int) string {
+	g := generator{rng: w.rng}
+	return g.text(min, max)
+}
+
+// post returns a random known post, with only its ID and author ID
+func (w *worker) post() structs.UserPost {
+	return w.load.posts[w.rng.Intn(len(w.load.posts))]
+}
+
+// report prints the number of requests, the errors and the latency percentiles of every kind of request
+func report(workers []*worker, duration time.Duration) error {
+	latencies := make(map[string][]time.Duration)
+	errorCounts := make(map[string]int)
+	lastErrors := make(map[string]error)
+	for _, w := range workers {
+		for name, l := range w.latencies {
+			latencies[name] = append(latencies[name], l...)
+		}
+		for name, n := range w.errors {
+			errorCounts[name] += n
+			lastErrors[name] = w.lastError[name]
+		}
+	}
+	names := make([]string, 0, len(latencies))
+	for name := range latencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(tw, "REQUEST\tCOUNT\tERRORS\tREQ/S\tP50\tP90\tP99\tMAX\t")
+	var all []time.Duration
+	for _, name := range names {
+		l := latencies[name]
+		all = append(all, l...)
+		_, _ = fmt.Fprintln(tw, row(name, l, errorCounts[name], duration))
+	}
+	totalErrors := 0
+	for _, n := range errorCounts {
+		totalErrors += n
+	}
+	_, _ = fmt.Fprintln(tw, row("total", all, totalErrors, duration))
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if lastErrors[name] != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "last error of %s: %v\n", name, lastErrors[name])
+		}
+	}
+	return nil
+}
+
+// row returns the row of the report of the requests with the latencies l
+func row(name string, l []time.Duration, errorCount int, duration time.Duration) string {
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	return fmt.Sprintf("%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t", name, len(l), errorCount, float64(len(l))/duration.Seconds(),
+		percentile(l, 50), percentile(l, 90), percentile(l, 99), percentile(l, 100))
+}
+
+// percentile returns the p-th percentile of the sorted latencies l (nearest rank)
+func percentile(l []time.Duration, p int) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	rank := (p*len(l) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return l[rank-1].Round(10 * time.Microsecond)
+}
@@ -0,0 +1,82 @@
+/*
+Seed fills a database with synthetic data, and generates a synthetic load on the API, to test the performance of the
+feeds with realistic data volumes.
+
+Usage:
+
+	seed generate [flags]
+	seed load [flags]
+
+Generate writes to the database file directly, through service/database: users named user1, user2, ... with a power-law
+follow graph (a few users have most of the followers, as they are followed preferentially), and their posts with
+placeholder photos, likes and comments. The data depends only on the flags: the same seed and the same -until give the
+same data, IDs included. The flags are:
+
+	-db <file>
+		The database file, the one of webapi (default /tmp/decaf.db).
+	-seed <n>
+		Seed of the random generator (default 1).
+	-users <n>, -follows <n>, -posts <n>, -likes <n>, -comments <n>
+		How many users to create, and the average number of users they follow, of posts per user, of likes and
+		comments per post.
+	-days <n>, -until <date>
+		The posts are spread over the days before the date (RFC 3339, by default the start of the current day).
+
+Load logs in as the seeded users through the API, and sends a mix of read and write requests from concurrent workers,
+each waiting for the response before sending the next request. It then reports the latency percentiles of every kind
+of request. The flags are:
+
+	-server <url>
+		URL of the API (default http://localhost:3000).
+	-seed <n>, -users <n>
+		Seed of the random generator, and how many seeded users to act as (default 100).
+	-workers <n>, -duration <duration>
+		How many requests are sent concurrently, and for how long (default 8 for 30s).
+	-mix <name=weight,...>
+		The weight of every kind of request in the mix, see defaultMix. Kinds not listed are not sent.
+
+The rate limits of webapi would refuse most of the load, disable them for the test:
+
+	webapi --rate-limit-reads 0 --rate-limit-writes 0 --rate-limit-uploads 0 --rate-limit-sessions 0
+
+Return values (exit codes):
+
+	0
+		The data was generated, or the load was sent (even if some requests failed)
+
+	> 0
+		The program ended due to an error
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// username returns the username of the i-th seeded user, from 0
+func username(i int) string {
+	return fmt.Sprintf("user%d", i+1)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		_, _ = fmt.Fprintln(os.Stderr, "usage: seed generate|load [flags]")
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = generate(os.Args[2:])
+	case "load":
+		err = load(os.Args[2:])
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "unknown command %q, usage: seed generate|load [flags]\n", os.Args[1])
+		os.Exit(2)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
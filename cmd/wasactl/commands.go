@@ -0,0 +1,335 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/client"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// exportPollInterval is how often the status of an export is checked
+const exportPollInterval = time.Second
+
+func login(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("login")
+	password := fs.String("password", os.Getenv("WASACTL_PASSWORD"), "password of the user, if any (env WASACTL_PASSWORD)")
+	args, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	session, err := a.client.DoLogin(ctx, structs.Credentials{Username: args[0], Password: *password}, nil)
+	if err != nil {
+		return fmt.Errorf("error logging in: %w", err)
+	}
+	a.client.Token = session.Token
+	user, _, err := a.client.GetUserProfile(ctx, session.UserID)
+	if err != nil {
+		return fmt.Errorf("error getting the profile: %w", err)
+	}
+
+	err = saveConfig(a.configPath, config{Server: a.client.BaseURL, Token: session.Token, UserID: session.UserID, Username: user.Username})
+	if err != nil {
+		return err
+	}
+	return a.printUsers([]structs.User{user})
+}
+
+func logout(ctx context.Context, a *app, args []string) error {
+	_, err := a.parse(a.flagSet("logout"), args, 0, 0)
+	if err != nil {
+		return err
+	}
+	// Sessions do not expire on the server, forgetting the token is enough
+	return saveConfig(a.configPath, config{Server: a.cfg.Server})
+}
+
+func whoami(ctx context.Context, a *app, args []string) error {
+	_, err := a.parse(a.flagSet("whoami"), args, 0, 0)
+	if err != nil {
+		return err
+	}
+	if err = a.requireLogin(); err != nil {
+		return err
+	}
+
+	user, _, err := a.client.GetUserProfile(ctx, a.cfg.UserID)
+	if err != nil {
+		return fmt.Errorf("error getting the profile: %w", err)
+	}
+	return a.printUsers([]structs.User{user})
+}
+
+// postResult is the output of the post command
+type postResult struct {
+	PostID  string `json:"postId"`
+	PhotoID string `json:"photoId"`
+	Message string `json:"message"` // Tells if the post is held for review
+}
+
+func post(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("post")
+	caption := fs.String("caption", "", "caption of the post")
+	args, err := a.parse(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *caption == "" {
+		return usageError{"the caption is required"}
+	}
+	if err = a.requireLogin(); err != nil {
+		return err
+	}
+
+	photo, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("error opening the photo: %w", err)
+	}
+	defer photo.Close()
+	photoID, err := a.client.UploadPhoto(ctx, a.cfg.UserID, client.File{Name: filepath.Base(args[0]), Content: photo}, nil)
+	if err != nil {
+		return fmt.Errorf("error uploading the photo: %w", err)
+	}
+
+	created, err := a.client.CreatePost(ctx, a.cfg.UserID, structs.UserPost{
+		AuthorID:       a.cfg.UserID,
+		AuthorUsername: a.cfg.Username,
+		Caption:        *caption,
+		Image:          photoID,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("error creating the post: %w", err)
+	}
+
+	// The body of the response is the ResourceID of the post
+	var postID structs.ResourceID
+	data, _ := json.Marshal(created.Body)
+	_ = json.Unmarshal(data, &postID)
+
+	result := postResult{PostID: postID.ResourceID, PhotoID: photoID, Message: created.Message}
+	return a.print(result, []string{"POST", "PHOTO", "MESSAGE"}, [][]string{{result.PostID, result.PhotoID, result.Message}})
+}
+
+// relationship returns a command acting on the user with the username of the argument, e.g. to follow them. do has the
+// signature of the method expressions of the client, e.g. (*client.Client).BanUser
+func relationship(name string, do func(c *client.Client, ctx context.Context, userID string, otherID string) error) func(context.Context, *app, []string) error {
+	return func(ctx context.Context, a *app, args []string) error {
+		args, err := a.parse(a.flagSet(name), args, 1, 1)
+		if err != nil {
+			return err
+		}
+		if err = a.requireLogin(); err != nil {
+			return err
+		}
+
+		other, err := a.findUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		err = do(a.client, ctx, a.cfg.UserID, other.UserID)
+		if err != nil {
+			return fmt.Errorf("error doing %s: %w", name, err)
+		}
+		return nil
+	}
+}
+
+var (
+	follow = relationship("follow", func(c *client.Client, ctx context.Context, userID string, otherID string) error {
+		_, err := c.FollowUser(ctx, userID, otherID)
+		return err
+	})
+	unfollow = relationship("unfollow", func(c *client.Client, ctx context.Context, userID string, otherID string) error {
+		_, err := c.UnfollowUser(ctx, userID, otherID)
+		return err
+	})
+	ban   = relationship("ban", (*client.Client).BanUser)
+	unban = relationship("unban", (*client.Client).UnbanUser)
+)
+
+func feed(ctx context.Context, a *app, args []string) error {
+	_, err := a.parse(a.flagSet("feed"), args, 0, 0)
+	if err != nil {
+		return err
+	}
+	if err = a.requireLogin(); err != nil {
+		return err
+	}
+
+	stream, err := a.client.GetMyStream(ctx, a.cfg.UserID)
+	if err != nil {
+		return fmt.Errorf("error getting the feed: %w", err)
+	}
+	// The posts of the feed are read through the path of the user, as the web UI does
+	list, err := a.getPosts(ctx, a.cfg.UserID, stream)
+	if err != nil {
+		return err
+	}
+	return a.printPosts(list)
+}
+
+func posts(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flagSet("posts"), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if err = a.requireLogin(); err != nil {
+		return err
+	}
+
+	userID := a.cfg.UserID
+	if len(args) > 0 {
+		user, err := a.findUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		userID = user.UserID
+	}
+	stream, err := a.client.GetUserPosts(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error getting the posts: %w", err)
+	}
+	list, err := a.getPosts(ctx, userID, stream)
+	if err != nil {
+		return err
+	}
+	return a.printPosts(list)
+}
+
+func comments(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flagSet("comments"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err = a.requireLogin(); err != nil {
+		return err
+	}
+
+	// The comments are read through the path of the author of the post
+	p, _, err := a.client.GetPost(ctx, a.cfg.UserID, args[0])
+	if err != nil {
+		return fmt.Errorf("error getting the post: %w", err)
+	}
+	stream, err := a.client.GetPostComments(ctx, p.AuthorID, p.PostID)
+	if err != nil {
+		return fmt.Errorf("error getting the comments: %w", err)
+	}
+	return a.printComments(stream.Comments)
+}
+
+func users(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flagSet("users"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err = a.requireLogin(); err != nil {
+		return err
+	}
+
+	found, err := a.client.SearchUser(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("error searching the users: %w", err)
+	}
+	return a.printUsers(found.Users)
+}
+
+func export(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("export")
+	file := fs.String("file", "", "write the archive to this file instead of printing its JSON")
+	timeout := fs.Duration("timeout", 5*time.Minute, "how long to wait for the export")
+	_, err := a.parse(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+	if err = a.requireLogin(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	job, err := a.client.StartExport(ctx, a.cfg.UserID)
+	if err != nil {
+		return fmt.Errorf("error starting the export: %w", err)
+	}
+
+	// The archive is returned once the job is done, the job itself until then
+	var archive []byte
+	for archive == nil {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error waiting for the export %s: %w", job.JobID, ctx.Err())
+		case <-time.After(exportPollInterval):
+		}
+		_, archive, err = a.client.GetExport(ctx, a.cfg.UserID, job.JobID)
+		if err != nil {
+			return fmt.Errorf("error getting the export: %w", err)
+		}
+	}
+
+	if *file != "" {
+		err = ioutil.WriteFile(*file, archive, 0600)
+		if err != nil {
+			return fmt.Errorf("error writing the archive: %w", err)
+		}
+		return nil
+	}
+
+	// Print the JSON files of the archive as a single object, e.g. {"profile": ..., "posts": ...}
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return fmt.Errorf("error reading the archive: %w", err)
+	}
+	documents := make(map[string]json.RawMessage)
+	for _, f := range reader.File {
+		if !strings.HasSuffix(f.Name, ".json") {
+			continue
+		}
+		content, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", f.Name, err)
+		}
+		data, err := ioutil.ReadAll(content)
+		_ = content.Close()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", f.Name, err)
+		}
+		documents[strings.TrimSuffix(f.Name, ".json")] = data
+	}
+	return a.printJSON(documents)
+}
+
+// findUser returns the user with the username
+func (a *app) findUser(ctx context.Context, username string) (structs.User, error) {
+	found, err := a.client.SearchUser(ctx, username)
+	if err != nil {
+		return structs.User{}, fmt.Errorf("error searching the user %s: %w", username, err)
+	}
+	for _, user := range found.Users {
+		if strings.EqualFold(user.Username, username) {
+			return user, nil
+		}
+	}
+	return structs.User{}, fmt.Errorf("user %s not found", username)
+}
+
+// getPosts returns the posts of the stream, reading them through the path of the user userID
+func (a *app) getPosts(ctx context.Context, userID string, stream structs.PostStream) ([]structs.UserPost, error) {
+	list := make([]structs.UserPost, 0, len(stream.Posts))
+	for _, id := range stream.Posts {
+		p, _, err := a.client.GetPost(ctx, userID, id.ResourceID)
+		if err != nil {
+			return list, fmt.Errorf("error getting the post %s: %w", id.ResourceID, err)
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// config is the configuration file of wasactl, with the session of the last login
+type config struct {
+	Server   string `json:"server"`
+	Token    string `json:"token"`
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+}
+
+// loadConfig reads the configuration file at path. A missing file is an empty configuration.
+func loadConfig(path string) (config, error) {
+	var cfg config
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return cfg, fmt.Errorf("error reading the configuration: %w", err)
+	}
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("error decoding the configuration %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// saveConfig writes the configuration file at path. Only the user can read it, as it holds the session token.
+func saveConfig(path string, cfg config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding the configuration: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("error creating the configuration directory: %w", err)
+	}
+	err = ioutil.WriteFile(path, append(data, '\n'), 0600)
+	if err != nil {
+		return fmt.Errorf("error writing the configuration: %w", err)
+	}
+	return nil
+}
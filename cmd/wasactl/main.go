@@ -0,0 +1,239 @@
+/*
+Wasactl is a command-line client of the WASA Photo API, for scripting, demos and seeding test environments. It uses the
+client package.
+
+Usage:
+
+	wasactl [flags] <command> [command flags] [arguments]
+
+The commands are:
+
+	login [-password <password>] <username>
+		Log in, and store the session in the configuration file. The password can also be set with the
+		WASACTL_PASSWORD environment variable, it's not needed for the accounts without one.
+	logout
+		Forget the session.
+	whoami
+		Print the profile of the logged in user.
+	post -caption <caption> <photo>
+		Upload a photo and post it with the caption.
+	follow <username>, unfollow <username>
+		Follow or unfollow a user.
+	ban <username>, unban <username>
+		Ban or unban a user.
+	feed
+		List the posts of the feed of the logged in user.
+	posts [username]
+		List the posts of a user, the logged in one by default.
+	comments <post ID>
+		List the comments of a post.
+	users <username>
+		Search the users by username.
+	export [-file <archive>] [-timeout <duration>]
+		Export the data of the logged in user, and print it as a single JSON object (whatever the output flag) or
+		write the archive of JSON files to a file.
+
+The flags are accepted before and after the command:
+
+	-server <url>
+		URL of the API, by default the one of the last login (env WASACTL_SERVER), or http://localhost:3000.
+	-config <file>
+		Configuration file with the session, by default wasactl/config.json in the user configuration directory
+		(env WASACTL_CONFIG).
+	-output json|table
+		Print the results as JSON or as a table (default).
+
+Return values (exit codes):
+
+	0
+		The command was successful
+
+	1
+		The command failed (connection error or error response of the API)
+
+	2
+		The command line is not valid
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/attiliov/WASA-Photo/client"
+)
+
+// defaultServer is the URL of the API when none is given nor stored
+const defaultServer = "http://localhost:3000"
+
+// command is a command of wasactl
+type command struct {
+	usage string // Usage of the arguments, e.g. "<username>"
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+// commands are the commands of wasactl, by name
+var commands = map[string]command{
+	"login":    {"[-password <password>] <username>", login},
+	"logout":   {"", logout},
+	"whoami":   {"", whoami},
+	"post":     {"-caption <caption> <photo>", post},
+	"follow":   {"<username>", follow},
+	"unfollow": {"<username>", unfollow},
+	"ban":      {"<username>", ban},
+	"unban":    {"<username>", unban},
+	"feed":     {"", feed},
+	"posts":    {"[username]", posts},
+	"comments": {"<post ID>", comments},
+	"users":    {"<username>", users},
+	"export":   {"[-file <archive>] [-timeout <duration>]", export},
+}
+
+// usageError is an error in the command line
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+// app is the state of a run of wasactl
+type app struct {
+	// Common flags
+	server     string
+	configPath string
+	output     string
+
+	usage  string // Usage of the arguments of the command
+	cfg    config
+	client *client.Client
+	stdout io.Writer
+}
+
+func main() {
+	err := run(os.Args[1:])
+	var usageErr usageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.As(err, &usageErr):
+		_, _ = fmt.Fprintln(os.Stderr, "error:", err)
+		_, _ = fmt.Fprintln(os.Stderr, "run \"wasactl -h\" for the usage")
+		os.Exit(2)
+	default:
+		_, _ = fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command line args
+func run(args []string) error {
+	a := &app{
+		server:     os.Getenv("WASACTL_SERVER"),
+		configPath: os.Getenv("WASACTL_CONFIG"),
+		output:     outputTable,
+		stdout:     os.Stdout,
+	}
+	if a.configPath == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return fmt.Errorf("error finding the configuration directory, use -config: %w", err)
+		}
+		a.configPath = dir + "/wasactl/config.json"
+	}
+
+	fs := a.flagSet("wasactl")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "Usage: wasactl [flags] <command> [command flags] [arguments]\n\nCommands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, _ = fmt.Fprintln(fs.Output(), "  "+strings.TrimSpace(name+" "+commands[name].usage))
+		}
+		_, _ = fmt.Fprintln(fs.Output(), "\nFlags, before or after the command:")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return usageError{"missing command"}
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		return usageError{fmt.Sprintf("unknown command %q", fs.Arg(0))}
+	}
+
+	// Stop the requests on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	a.usage = cmd.usage
+	return cmd.run(ctx, a, fs.Args()[1:])
+}
+
+// flagSet returns a flag set with the common flags
+func (a *app) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&a.server, "server", a.server, "URL of the API (default the one of the last login, or "+defaultServer+")")
+	fs.StringVar(&a.configPath, "config", a.configPath, "configuration file with the session")
+	fs.StringVar(&a.output, "output", a.output, "output format, json or table")
+	return fs
+}
+
+// parse parses the arguments of the command, which takes from min to max positional arguments, and connects to
+// the API
+func (a *app) parse(fs *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: wasactl %s %s\n\nFlags:\n", fs.Name(), a.usage)
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if a.output != outputJSON && a.output != outputTable {
+		return nil, usageError{fmt.Sprintf("unknown output format %q, use json or table", a.output)}
+	}
+	args = fs.Args()
+	if len(args) < min || len(args) > max {
+		return nil, usageError{fmt.Sprintf("usage: wasactl %s %s", fs.Name(), a.usage)}
+	}
+
+	a.cfg, err = loadConfig(a.configPath)
+	if err != nil {
+		return nil, err
+	}
+	if a.server == "" {
+		a.server = a.cfg.Server
+	}
+	if a.server == "" {
+		a.server = defaultServer
+	}
+	a.client = client.New(a.server)
+	if a.cfg.Server == a.client.BaseURL {
+		// The session is only valid on the server of the login
+		a.client.Token = a.cfg.Token
+	}
+	return args, nil
+}
+
+// requireLogin returns an error if there is no session
+func (a *app) requireLogin() error {
+	if a.client.Token == "" {
+		return fmt.Errorf("not logged in to %s, run \"wasactl login\" first", a.client.BaseURL)
+	}
+	return nil
+}
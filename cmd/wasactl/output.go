@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// Output formats
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+)
+
+// print prints v as JSON, or the rows as a table with the header. Lists are printed as [] rather than null when empty,
+// for the scripts.
+func (a *app) print(v interface{}, header []string, rows [][]string) error {
+	if a.output == outputJSON {
+		return a.printJSON(v)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		_, _ = fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// printJSON prints v as indented JSON
+func (a *app) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(a.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (a *app) printUsers(users []structs.User) error {
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, []string{u.UserID, u.Username, strconv.Itoa(u.Followers), strconv.Itoa(u.Following), oneLine(u.Bio)})
+	}
+	if users == nil {
+		users = []structs.User{}
+	}
+	return a.print(users, []string{"ID", "USERNAME", "FOLLOWERS", "FOLLOWING", "BIO"}, rows)
+}
+
+func (a *app) printPosts(posts []structs.UserPost) error {
+	rows := make([][]string, 0, len(posts))
+	for _, p := range posts {
+		rows = append(rows, []string{p.PostID, p.AuthorUsername, p.CreationDate.Format(time.RFC3339), strconv.Itoa(p.LikeCount), strconv.Itoa(p.CommentCount), oneLine(p.Caption)})
+	}
+	if posts == nil {
+		posts = []structs.UserPost{}
+	}
+	return a.print(posts, []string{"ID", "AUTHOR", "DATE", "LIKES", "COMMENTS", "CAPTION"}, rows)
+}
+
+func (a *app) printComments(comments []structs.Comment) error {
+	rows := make([][]string, 0, len(comments))
+	for _, c := range comments {
+		rows = append(rows, []string{c.CommentID, c.AuthorUsername, c.CreationDate.Format(time.RFC3339), strconv.Itoa(c.LikeCount), oneLine(c.Caption)})
+	}
+	if comments == nil {
+		comments = []structs.Comment{}
+	}
+	return a.print(comments, []string{"ID", "AUTHOR", "DATE", "LIKES", "TEXT"}, rows)
+}
+
+// oneLine returns s on a single line, to fit a row of a table
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
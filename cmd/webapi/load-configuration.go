@@ -22,10 +22,59 @@ type WebAPIConfiguration struct {
 		ReadTimeout     time.Duration `conf:"default:5s"`
 		WriteTimeout    time.Duration `conf:"default:5s"`
 		ShutdownTimeout time.Duration `conf:"default:5s"`
+		BehindProxy     bool
 	}
 	Debug bool
 	DB    struct {
-		Filename string `conf:"default:/tmp/decaf.db"`
+		Driver          string        `conf:"default:sqlite3"`
+		Filename        string        `conf:"default:/tmp/decaf.db"`
+		DSN             string        `conf:"mask"`
+		MaxOpenConns    int           `conf:"default:16"`
+		MaxIdleConns    int           `conf:"default:4"`
+		ConnMaxLifetime time.Duration `conf:"default:1h"`
+		BusyTimeout     time.Duration `conf:"default:5s"`
+	}
+	Deletion struct {
+		GracePeriod   time.Duration `conf:"default:720h"`
+		PurgeInterval time.Duration `conf:"default:1h"`
+	}
+	Export struct {
+		Directory string        `conf:"default:/tmp/exports"`
+		Workers   int           `conf:"default:2"`
+		TTL       time.Duration `conf:"default:72h"`
+	}
+	Usernames struct {
+		ChangeCooldown time.Duration `conf:"default:168h"`
+		Reserved       []string      `conf:"default:admin;administrator;root;moderator;support;system;wasa;wasaphoto;api;session;users"`
+	}
+	Auth struct {
+		UsernameOnlyLogin bool `conf:"default:true"`
+		Admins            []string
+	}
+	OIDC struct {
+		Issuer            string
+		ClientID          string
+		ClientSecret      string `conf:"mask"`
+		RedirectURL       string
+		Scopes            []string `conf:"default:openid;email;profile"`
+		PostLoginRedirect string
+	}
+	Idempotency struct {
+		TTL time.Duration `conf:"default:24h"`
+	}
+	RateLimit struct {
+		Reads        int `conf:"default:600"`
+		Writes       int `conf:"default:60"`
+		Uploads      int `conf:"default:10"`
+		Sessions     int `conf:"default:10"`
+		IPMultiplier int `conf:"default:4"`
+	}
+	ContentFilter struct {
+		Blocked      []string
+		Held         []string
+		MaxLinks     int           `conf:"default:3"`
+		MaxRepeats   int           `conf:"default:3"`
+		RepeatWindow time.Duration `conf:"default:10m"`
 	}
 }
 
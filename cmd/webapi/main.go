@@ -25,14 +25,15 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/ardanlabs/conf"
+	"github.com/attiliov/WASA-Photo/doc"
 	"github.com/attiliov/WASA-Photo/service/api"
+	"github.com/attiliov/WASA-Photo/service/contentfilter"
 	"github.com/attiliov/WASA-Photo/service/database"
 	"github.com/attiliov/WASA-Photo/service/globaltime"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/attiliov/WASA-Photo/service/openapi"
 	"github.com/sirupsen/logrus"
 	"math/rand"
 	"net/http"
@@ -82,16 +83,19 @@ func run() error {
 
 	// Start Database
 	logger.Println("initializing database support")
-	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename+"?_foreign_keys=1")
+	dbconn, dbreader, err := openDatabase(cfg)
 	if err != nil {
-		logger.WithError(err).Error("error opening SQLite DB")
-		return fmt.Errorf("opening SQLite: %w", err)
+		logger.WithError(err).Error("error opening DB")
+		return err
 	}
 	defer func() {
 		logger.Debug("database stopping")
+		if dbreader != nil {
+			_ = dbreader.Close()
+		}
 		_ = dbconn.Close()
 	}()
-	db, err := database.New(dbconn)
+	db, err := database.NewWithReader(dbconn, dbreader)
 	if err != nil {
 		logger.WithError(err).Error("error creating AppDatabase")
 		return fmt.Errorf("creating AppDatabase: %w", err)
@@ -109,10 +113,52 @@ func run() error {
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
 
+	// Build the content filter of posts and comments
+	contentFilter, err := contentfilter.New(contentfilter.Config{
+		Blocked:      cfg.ContentFilter.Blocked,
+		Held:         cfg.ContentFilter.Held,
+		MaxLinks:     cfg.ContentFilter.MaxLinks,
+		MaxRepeats:   cfg.ContentFilter.MaxRepeats,
+		RepeatWindow: cfg.ContentFilter.RepeatWindow,
+	})
+	if err != nil {
+		logger.WithError(err).Error("error creating the content filter")
+		return fmt.Errorf("creating the content filter: %w", err)
+	}
+
+	// Load the OpenAPI specification, the responses are checked too in debug mode
+	validator, err := openapi.New(doc.OpenAPI, openapi.Config{
+		ValidateResponses: cfg.Debug,
+	})
+	if err != nil {
+		logger.WithError(err).Error("error loading the OpenAPI specification")
+		return fmt.Errorf("loading the OpenAPI specification: %w", err)
+	}
+
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:                 logger,
+		Database:               db,
+		DeletionGracePeriod:    cfg.Deletion.GracePeriod,
+		PurgeInterval:          cfg.Deletion.PurgeInterval,
+		ExportDirectory:        cfg.Export.Directory,
+		ExportWorkers:          cfg.Export.Workers,
+		ExportTTL:              cfg.Export.TTL,
+		UsernameChangeCooldown: cfg.Usernames.ChangeCooldown,
+		ReservedUsernames:      cfg.Usernames.Reserved,
+		UsernameOnlyLogin:      cfg.Auth.UsernameOnlyLogin,
+		Admins:                 cfg.Auth.Admins,
+		ContentFilter:          contentFilter,
+		IdempotencyTTL:         cfg.Idempotency.TTL,
+		Validator:              validator,
+		OIDC: api.OIDCConfig{
+			Issuer:            cfg.OIDC.Issuer,
+			ClientID:          cfg.OIDC.ClientID,
+			ClientSecret:      cfg.OIDC.ClientSecret,
+			RedirectURL:       cfg.OIDC.RedirectURL,
+			Scopes:            cfg.OIDC.Scopes,
+			PostLoginRedirect: cfg.OIDC.PostLoginRedirect,
+		},
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -126,6 +172,19 @@ func run() error {
 		return fmt.Errorf("registering web UI handler: %w", err)
 	}
 
+	// Apply the rate limits, in requests per minute. Zero disables the limit of a class of routes.
+	router = applyRateLimitHandler(router, rateLimitConfig{
+		Limits: map[string]int{
+			routeReads:    cfg.RateLimit.Reads,
+			routeWrites:   cfg.RateLimit.Writes,
+			routeUploads:  cfg.RateLimit.Uploads,
+			routeSessions: cfg.RateLimit.Sessions,
+		},
+		IPMultiplier: cfg.RateLimit.IPMultiplier,
+		BehindProxy:  cfg.Web.BehindProxy,
+		SessionUser:  apirouter.SessionUser,
+	})
+
 	// Apply CORS policy
 	router = applyCORSHandler(router)
 
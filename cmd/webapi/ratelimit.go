@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// Classes of routes, each one with its own limits
+const (
+	routeReads    = "reads"
+	routeWrites   = "writes"
+	routeUploads  = "uploads"
+	routeSessions = "sessions"
+)
+
+// rateLimitConfig are the limits of each class of routes, in requests per minute of a single user. The limits of a
+// single IP address are IPMultiplier times larger, since several users can share the same address (e.g. behind a NAT).
+type rateLimitConfig struct {
+	Limits       map[string]int
+	IPMultiplier int
+
+	// BehindProxy takes the address of the client from the X-Forwarded-For header
+	BehindProxy bool
+
+	// SessionUser returns the ID of the user of the session of the request, failing if it has no valid session. The
+	// requests without a valid session are only limited by their address. Nil limits every request by its address.
+	SessionUser func(r *http.Request) (string, error)
+}
+
+// rateLimitSweepInterval is how often the buckets that are full again are forgotten
+const rateLimitSweepInterval = time.Minute
+
+// maxRateLimitBuckets is how many buckets are kept at most. A client can have many addresses: past the limit, until
+// the next sweep, the requests of a user without a bucket are only limited by their address and the addresses without
+// a bucket share one, so that made up addresses can't fill the memory.
+const maxRateLimitBuckets = 100000
+
+// bucket is a token bucket: it holds up to capacity tokens, one is taken by every request and they are refilled at a
+// constant rate. Tokens are refilled lazily, when the bucket is used.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter holds the buckets of every user and IP address
+type rateLimiter struct {
+	cfg rateLimitConfig
+
+	mu         sync.Mutex
+	buckets    map[string]*bucket // By class, kind of key and key
+	maxBuckets int                // See maxRateLimitBuckets
+	lastSweep  time.Time
+}
+
+// applyRateLimitHandler limits how many requests each user and each IP address can make, see rateLimitConfig.
+// Every response of a limited route carries the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers of the
+// most restrictive bucket; requests over the limit are refused with a 429 status and a Retry-After header.
+func applyRateLimitHandler(h http.Handler, cfg rateLimitConfig) http.Handler {
+	if cfg.IPMultiplier < 1 {
+		cfg.IPMultiplier = 1
+	}
+	limiter := &rateLimiter{cfg: cfg, buckets: make(map[string]*bucket), maxBuckets: maxRateLimitBuckets, lastSweep: globaltime.Now()}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := routeClass(r)
+		perMinute := cfg.Limits[class]
+		if class == "" || perMinute <= 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// Take a token from the bucket of the address and, for authenticated requests, from the one of the user. The
+		// bucket of the user is the same for all their sessions, and made up tokens don't get one.
+		limits := []limit{{key: class + " ip " + clientIP(r, cfg.BehindProxy), capacity: perMinute * cfg.IPMultiplier, shared: class + " ip"}}
+		if cfg.SessionUser != nil {
+			if userID, err := cfg.SessionUser(r); err == nil {
+				limits = append(limits, limit{key: class + " user " + userID, capacity: perMinute})
+			}
+		}
+		allowed, capacity, remaining, reset, retryAfter := limiter.take(limits)
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(capacity))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(retryAfter)))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = json.NewEncoder(w).Encode(structs.Error{Code: "too_many_requests", Status: http.StatusTooManyRequests, Message: "too many requests, retry later"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// limit is a bucket of a request, with its capacity
+type limit struct {
+	key      string
+	capacity int
+	shared   string // The bucket used when there's no room for a new one, see maxRateLimitBuckets. "" skips the limit.
+}
+
+// take takes a token from each of the given buckets, creating them full if needed. If one of them is empty no token
+// is taken. It returns whether the tokens were taken, then the capacity, the tokens left and how long until the bucket
+// is full again of the bucket with less tokens left and, if the tokens weren't taken, how long until they can be.
+func (l *rateLimiter) take(limits []limit) (bool, int, int, time.Duration, time.Duration) {
+	now := globaltime.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	// Refill the buckets and check them
+	allowed := true
+	var retryAfter time.Duration
+	var buckets []*bucket
+	var kept []limit
+	for _, lim := range limits {
+		rate := float64(lim.capacity) / float64(time.Minute) // Tokens per nanosecond
+		b, found := l.buckets[lim.key]
+		if !found && len(l.buckets) >= l.maxBuckets {
+			// No room for a new bucket until the next sweep
+			if lim.shared == "" {
+				continue
+			}
+			lim.key = lim.shared
+			b, found = l.buckets[lim.key]
+		}
+		if !found {
+			b = &bucket{tokens: float64(lim.capacity), updated: now}
+			l.buckets[lim.key] = b
+		}
+		b.tokens = math.Min(float64(lim.capacity), b.tokens+float64(now.Sub(b.updated))*rate)
+		b.updated = now
+		buckets = append(buckets, b)
+		kept = append(kept, lim)
+
+		if b.tokens < 1 {
+			allowed = false
+			if wait := time.Duration((1 - b.tokens) / rate); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	// Take the tokens and find the most restrictive bucket
+	capacity, remaining := 0, 0
+	var reset time.Duration
+	for i, b := range buckets {
+		if allowed {
+			b.tokens--
+		}
+		if i == 0 || int(b.tokens) < remaining {
+			rate := float64(kept[i].capacity) / float64(time.Minute)
+			capacity, remaining = kept[i].capacity, int(b.tokens)
+			reset = time.Duration((float64(capacity) - b.tokens) / rate)
+		}
+	}
+	return allowed, capacity, remaining, reset, retryAfter
+}
+
+// sweep forgets the buckets that are full again, since they are the same as new ones. It runs at most once every
+// rateLimitSweepInterval and must be called with l.mu held.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		// A bucket is refilled in a minute at most
+		if now.Sub(b.updated) >= time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// routeClass returns the class of the route of the request, or "" if the route is not limited
+func routeClass(r *http.Request) string {
+	switch {
+	case r.Method == http.MethodOptions || r.URL.Path == "/liveness":
+		return ""
+	case strings.HasPrefix(r.URL.Path, "/session"):
+		return routeSessions
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return routeReads
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/photos"):
+		return routeUploads
+	default:
+		return routeWrites
+	}
+}
+
+// clientIP returns the address of the client making the request
+func clientIP(r *http.Request, behindProxy bool) string {
+	if behindProxy {
+		// The proxy appends the address it received the request from
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds the duration up to whole seconds, as required by the Retry-After and RateLimit-Reset headers
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
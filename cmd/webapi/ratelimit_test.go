@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+)
+
+func TestRouteClass(t *testing.T) {
+	for _, tc := range []struct {
+		method string
+		path   string
+		class  string
+	}{
+		{method: http.MethodOptions, path: "/users", class: ""},
+		{method: http.MethodGet, path: "/liveness", class: ""},
+		{method: http.MethodPost, path: "/session", class: routeSessions},
+		{method: http.MethodGet, path: "/session/oidc/login", class: routeSessions},
+		{method: http.MethodGet, path: "/users/u1/posts", class: routeReads},
+		{method: http.MethodHead, path: "/users/u1/photos/p1", class: routeReads},
+		{method: http.MethodPost, path: "/users/u1/photos", class: routeUploads},
+		{method: http.MethodPost, path: "/users/u1/posts", class: routeWrites},
+		{method: http.MethodDelete, path: "/users/u1/photos/p1", class: routeWrites},
+		{method: http.MethodPatch, path: "/users/u1", class: routeWrites},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		if class := routeClass(r); class != tc.class {
+			t.Errorf("%s %s: expected %q, got %q", tc.method, tc.path, tc.class, class)
+		}
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	globaltime.FixedTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	defer func() { globaltime.FixedTime = time.Time{} }()
+
+	limiter := &rateLimiter{buckets: make(map[string]*bucket), maxBuckets: maxRateLimitBuckets, lastSweep: globaltime.Now()}
+	limits := []limit{{key: "ip", capacity: 4}, {key: "user", capacity: 2}}
+	check := func(what string, allowed bool, capacity int, remaining int, reset time.Duration, retryAfter time.Duration) {
+		t.Helper()
+		a, c, r, rs, ra := limiter.take(limits)
+		if a != allowed || c != capacity || r != remaining || rs != reset || ra != retryAfter {
+			t.Fatalf("%s: expected %v %d %d %v %v, got %v %d %d %v %v", what, allowed, capacity, remaining, reset, retryAfter, a, c, r, rs, ra)
+		}
+	}
+
+	// The user bucket is the most restrictive: 2 tokens, refilled at one every 30 seconds
+	check("first", true, 2, 1, 30*time.Second, 0)
+	check("second", true, 2, 0, time.Minute, 0)
+	check("third", false, 2, 0, time.Minute, 30*time.Second)
+
+	// Refused requests don't take tokens from the other buckets
+	if tokens := limiter.buckets["ip"].tokens; tokens != 2 {
+		t.Fatalf("expected 2 tokens left for the address, got %v", tokens)
+	}
+
+	// Half a refill later, a token is back
+	globaltime.FixedTime = globaltime.FixedTime.Add(30 * time.Second)
+	check("after 30 seconds", true, 2, 0, time.Minute, 0)
+
+	// Buckets full again are forgotten by the next sweep
+	globaltime.FixedTime = globaltime.FixedTime.Add(rateLimitSweepInterval)
+	limiter.take([]limit{{key: "other", capacity: 1}})
+	if _, found := limiter.buckets["user"]; found {
+		t.Fatal("expected the full bucket to be forgotten")
+	}
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+	globaltime.FixedTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	defer func() { globaltime.FixedTime = time.Time{} }()
+
+	limiter := &rateLimiter{buckets: make(map[string]*bucket), maxBuckets: 2, lastSweep: globaltime.Now()}
+	limiter.take([]limit{{key: "ip 1", capacity: 2, shared: "ip"}, {key: "user 1", capacity: 1}})
+
+	// No room for new buckets: the new user is only limited by the address, the new address gets the shared bucket
+	allowed, capacity, _, _, _ := limiter.take([]limit{{key: "ip 2", capacity: 2, shared: "ip"}, {key: "user 2", capacity: 1}})
+	if !allowed || capacity != 2 {
+		t.Fatalf("expected the request to be limited by the shared bucket, got %v %d", allowed, capacity)
+	}
+	limiter.take([]limit{{key: "ip 3", capacity: 2, shared: "ip"}})
+	allowed, _, _, _, _ = limiter.take([]limit{{key: "ip 4", capacity: 2, shared: "ip"}})
+	if allowed {
+		t.Fatal("expected the shared bucket to be empty")
+	}
+	if len(limiter.buckets) != 3 {
+		t.Fatalf("expected the buckets of the first request and the shared one, got %d", len(limiter.buckets))
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	globaltime.FixedTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	defer func() { globaltime.FixedTime = time.Time{} }()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	// Two sessions of alice and one of bob
+	sessions := map[string]string{"token": "alice", "second": "alice", "other": "bob"}
+	sessionUser := func(r *http.Request) (string, error) {
+		userID, ok := sessions[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			return "", errors.New("unknown session")
+		}
+		return userID, nil
+	}
+	handler := applyRateLimitHandler(ok, rateLimitConfig{Limits: map[string]int{routeReads: 2}, IPMultiplier: 2, SessionUser: sessionUser})
+	do := func(method string, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/users/u1/posts", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	check := func(what string, w *httptest.ResponseRecorder, status int, headers map[string]string) {
+		t.Helper()
+		if w.Code != status {
+			t.Fatalf("%s: expected status %d, got %d", what, status, w.Code)
+		}
+		for name, value := range headers {
+			if got := w.Header().Get(name); got != value {
+				t.Fatalf("%s: expected %s %q, got %q", what, name, value, got)
+			}
+		}
+	}
+
+	// Unlimited routes have no headers
+	check("unlimited", do(http.MethodPost, "token"), http.StatusOK, map[string]string{"RateLimit-Limit": ""})
+
+	// The address can make twice the requests of a user
+	check("anonymous", do(http.MethodGet, ""), http.StatusOK, map[string]string{"RateLimit-Limit": "4", "RateLimit-Remaining": "3", "RateLimit-Reset": "15"})
+	check("first", do(http.MethodGet, "token"), http.StatusOK, map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "1", "RateLimit-Reset": "30"})
+
+	// The sessions of a user share the bucket of the user
+	check("second", do(http.MethodGet, "second"), http.StatusOK, map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "0", "RateLimit-Reset": "60"})
+	check("third", do(http.MethodGet, "token"), http.StatusTooManyRequests, map[string]string{"Retry-After": "30", "Content-Type": "application/json"})
+
+	// Made up tokens only get the bucket of the address
+	check("made up token", do(http.MethodGet, "made up"), http.StatusOK, map[string]string{"RateLimit-Limit": "4", "RateLimit-Remaining": "0"})
+	check("address exhausted", do(http.MethodGet, "other"), http.StatusTooManyRequests, map[string]string{"Retry-After": "15"})
+}
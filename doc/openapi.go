@@ -0,0 +1,9 @@
+// Package doc contains the OpenAPI specification of the API, for embedding
+package doc
+
+import _ "embed"
+
+// OpenAPI is the content of api.yaml
+//
+//go:embed api.yaml
+var OpenAPI []byte
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// accountDeletionJobKind is the kind of the jobs erasing a deleted account once its grace period is over
+const accountDeletionJobKind = "delete-account"
+
+// runAccountDeletions runs the account deletion jobs that are due, one at a time
+func (rt *_router) runAccountDeletions() {
+	jobs, err := rt.db.GetDueJobs(accountDeletionJobKind, globaltime.Now())
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error getting account deletion jobs")
+		return
+	}
+
+	for _, job := range jobs {
+		logger := rt.baseLogger.WithField("job", job.JobID)
+
+		err = rt.db.UpdateJob(job.JobID, database.JobRunning, job.Progress)
+		if errors.Is(err, database.ErrConflict) || errors.Is(err, database.ErrNotFound) {
+			// Cancelled since it was read
+			continue
+		} else if err != nil {
+			logger.WithError(err).Error("error starting account deletion job")
+			return
+		}
+
+		err = rt.eraseAccount(job)
+		if errors.Is(err, errJobStopped) {
+			logger.Info("account deletion interrupted, it will be resumed at the next start")
+			return
+		} else if errors.Is(err, errJobCancelled) {
+			logger.Info("account deletion cancelled, the account was restored")
+			continue
+		} else if err != nil {
+			// Leave the job running: it will be retried at the next purge, as every step is idempotent
+			logger.WithError(err).Error("error deleting account")
+			continue
+		}
+
+		// The job itself was removed by the last step, with every other row of the user
+		logger.Info("account deleted")
+	}
+}
+
+// eraseAccount removes every trace of the job user: photo files, export archives and all the rows referring to them,
+// updating the counters of the other users content. No row holds the user ID after the last step, not even the job.
+// Every step is idempotent, so an interrupted deletion is completed by running it again from the beginning.
+// Before every step, it checks that the job was not cancelled and that the user is still deleted: a restore of the
+// account stops the deletion, at worst one step later.
+func (rt *_router) eraseAccount(job structs.Job) error {
+	userID := job.UserID
+
+	steps := []struct {
+		description string
+		run         func(string) error
+	}{
+		{"deleting photos", rt.deleteUserPhotos},
+		{"deleting exports", rt.deleteUserExports},
+		{"deleting likes", rt.db.DeleteUserLikes},
+		{"deleting follows", rt.db.DeleteUserFollows},
+		{"deleting bans", rt.db.DeleteUserBans},
+		{"deleting comments", rt.db.DeleteUserComments},
+		{"deleting posts", rt.db.DeleteUserPosts},
+		{"erasing user", rt.db.EraseUser},
+	}
+	for i, step := range steps {
+		err := rt.checkErasure(job, i, len(steps))
+		if err != nil {
+			return err
+		}
+		err = step.run(userID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.description, err)
+		}
+	}
+	return nil
+}
+
+// checkErasure records that done out of total steps of the account deletion job are complete. It returns
+// errJobCancelled if the job was cancelled or the user restored in the meantime, errJobStopped if the router is
+// closing.
+func (rt *_router) checkErasure(job structs.Job, done int, total int) error {
+	err := rt.reportProgress(job.JobID, done, total)
+	if errors.Is(err, database.ErrConflict) {
+		return errJobCancelled
+	} else if err != nil {
+		return err
+	}
+
+	active, err := rt.db.IsActiveUser(job.UserID)
+	if err != nil {
+		return fmt.Errorf("checking user: %w", err)
+	}
+	if active {
+		return errJobCancelled
+	}
+	return nil
+}
+
+// deleteUserPhotos removes the photo files of the user with the given userID. A missing file was removed by a
+// previous run of the job: the posts and the profile still refer to it until the next steps.
+func (rt *_router) deleteUserPhotos(userID string) error {
+	photos, err := rt.db.GetUserPhotos(userID, true)
+	if err != nil {
+		return err
+	}
+	for _, photoID := range photos {
+		err = rt.db.DeletePhoto(userID, photoID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteUserExports removes the data export archives of the user with the given userID
+func (rt *_router) deleteUserExports(userID string) error {
+	jobs, err := rt.db.GetUserJobs(userID)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.Kind != exportJobKind {
+			continue
+		}
+		err = os.Remove(rt.exportPath(job.JobID))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// newDeletionRouter returns a router on an empty database with a deleted user having a post and a due account
+// deletion job
+func newDeletionRouter(t *testing.T) (*_router, structs.Job, string) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	rt := &_router{
+		baseLogger:      logger,
+		db:              memdb.New(),
+		exportDirectory: t.TempDir(),
+		stop:            make(chan struct{}),
+	}
+	alice, err := rt.db.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("creating alice: %v", err)
+	}
+	post, err := rt.db.AddPost(structs.UserPost{
+		AuthorID:       alice.UserID,
+		AuthorUsername: alice.Username,
+		CreationDate:   globaltime.Now(),
+		Caption:        "By alice",
+	})
+	if err != nil {
+		t.Fatalf("adding the post: %v", err)
+	}
+	err = rt.db.DeleteUser(alice.UserID)
+	if err != nil {
+		t.Fatalf("deleting alice: %v", err)
+	}
+	job, err := rt.db.CreateJob(accountDeletionJobKind, alice.UserID, globaltime.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("creating the job: %v", err)
+	}
+	return rt, job, post.ResourceID
+}
+
+// TestAccountDeletion checks that the deletion job erases the user, and removes its own row as its last step
+func TestAccountDeletion(t *testing.T) {
+	rt, job, postID := newDeletionRouter(t)
+
+	rt.runAccountDeletions()
+	_, err := rt.db.GetPost(postID)
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected the post to be erased, got %v", err)
+	}
+	_, err = rt.db.GetJob(job.JobID)
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected the job to be gone, got %v", err)
+	}
+}
+
+// TestAccountDeletionCancelled checks that a deletion stops before its next step once the account is restored
+func TestAccountDeletionCancelled(t *testing.T) {
+	// Restored before the job was cancelled
+	rt, job, postID := newDeletionRouter(t)
+	err := rt.db.RestoreUser(job.UserID, globaltime.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("restoring alice: %v", err)
+	}
+	err = rt.eraseAccount(job)
+	if !errors.Is(err, errJobCancelled) {
+		t.Fatalf("expected the deletion to be cancelled, got %v", err)
+	}
+	_, err = rt.db.GetPost(postID)
+	if err != nil {
+		t.Fatalf("expected the post to be kept: %v", err)
+	}
+
+	// Cancelled while running
+	rt, job, postID = newDeletionRouter(t)
+	err = rt.db.UpdateJob(job.JobID, database.JobRunning, 0)
+	if err == nil {
+		err = rt.db.CancelJobs(accountDeletionJobKind, job.UserID)
+	}
+	if err != nil {
+		t.Fatalf("cancelling the job: %v", err)
+	}
+	rt.runAccountDeletions()
+	err = rt.eraseAccount(job)
+	if !errors.Is(err, errJobCancelled) {
+		t.Fatalf("expected the deletion to be cancelled, got %v", err)
+	}
+	stored, err := rt.db.GetJob(job.JobID)
+	if err != nil || stored.Status != database.JobCancelled {
+		t.Fatalf("expected the job to stay cancelled, got %+v: %v", stored, err)
+	}
+	err = rt.db.RestoreUser(job.UserID, globaltime.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("expected alice to be kept: %v", err)
+	}
+	_, err = rt.db.GetPost(postID)
+	if err != nil {
+		t.Fatalf("expected the post to be kept: %v", err)
+	}
+}
+
+// likesErrorDB is a database failing to delete the likes of a user until fail is false
+type likesErrorDB struct {
+	database.AppDatabase
+	fail *bool
+}
+
+func (db likesErrorDB) DeleteUserLikes(userID string) error {
+	if *db.fail {
+		return errors.New("likes unavailable")
+	}
+	return db.AppDatabase.DeleteUserLikes(userID)
+}
+
+// TestAccountDeletionRetried checks that a deletion failing after removing the photo files completes when it is run
+// again, although the files of the post image and of the profile image are already gone
+func TestAccountDeletionRetried(t *testing.T) {
+	rt, job, _ := newDeletionRouter(t)
+	fail := true
+	rt.db = likesErrorDB{AppDatabase: rt.db, fail: &fail}
+
+	// Give alice a post image and a profile image
+	err := rt.db.RestoreUser(job.UserID, globaltime.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("restoring alice: %v", err)
+	}
+	alice, err := rt.db.GetUser(job.UserID)
+	if err != nil {
+		t.Fatalf("getting alice: %v", err)
+	}
+	postImage := savePhoto(t, rt.db, alice.UserID)
+	_, err = rt.db.AddPost(structs.UserPost{AuthorID: alice.UserID, AuthorUsername: alice.Username, CreationDate: globaltime.Now(), Caption: "With a photo", Image: postImage})
+	if err != nil {
+		t.Fatalf("adding the post: %v", err)
+	}
+	alice.ProfileImage = savePhoto(t, rt.db, alice.UserID)
+	_, err = rt.db.UpdateUser(alice.UserID, alice, alice.Version)
+	if err != nil {
+		t.Fatalf("setting the profile image: %v", err)
+	}
+	err = rt.db.DeleteUser(alice.UserID)
+	if err != nil {
+		t.Fatalf("deleting alice: %v", err)
+	}
+
+	// The first run removes the files, then fails
+	rt.runAccountDeletions()
+	for _, photoID := range []string{postImage, alice.ProfileImage} {
+		_, err = rt.db.GetPhoto(alice.UserID, photoID)
+		if !errors.Is(err, database.ErrNotFound) {
+			t.Fatalf("expected the photo %s to be removed, got %v", photoID, err)
+		}
+	}
+	stored, err := rt.db.GetJob(job.JobID)
+	if err != nil || stored.Status != database.JobRunning {
+		t.Fatalf("expected the job to be left running, got %+v: %v", stored, err)
+	}
+
+	// The second run completes
+	fail = false
+	rt.runAccountDeletions()
+	_, err = rt.db.GetJob(job.JobID)
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("expected the job to be complete, got %v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/julienschmidt/httprouter"
+)
+
+/*
+	This file contains the handlers for the API endpoints that are used by moderators and administrators.
+	Every action changing something is written to the audit log, in the same transaction as the action.
+	i.e. the following endpoints:
+		- GET /admin/users (moderator)
+		- PUT /admin/users/:userId/suspension (moderator)
+		- DELETE /admin/users/:userId/suspension (moderator)
+		- PUT /admin/users/:userId/role (admin)
+		- DELETE /admin/posts/:postId (moderator)
+		- DELETE /admin/comments/:commentId (moderator)
+		- GET /admin/stats (admin)
+		- GET /admin/audit (admin)
+*/
+
+// Actions recorded in the audit log
+const (
+	auditSuspendUser   = "suspend-user"
+	auditUnsuspendUser = "unsuspend-user"
+	auditSetRole       = "set-role"
+	auditRemovePost    = "remove-post"
+	auditRemoveComment = "remove-comment"
+)
+
+// audited does the action and writes its entry to the audit log in a single transaction: the action is undone if the
+// entry can't be written
+func (rt *_router) audited(actorID string, action string, targetID string, details string, do func(db database.AppDatabase) error) error {
+	return rt.db.RunInTransaction(func(tx database.AppDatabase) error {
+		err := do(tx)
+		if err != nil {
+			return err
+		}
+		return tx.AddAuditEntry(actorID, action, targetID, details)
+	})
+}
+
+func (rt *_router) listUsers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Check that the requester is a moderator
+	_, _, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Get the requested page
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, structs.Error{Message: err.Error()})
+		return
+	}
+
+	// Get the users
+	users, err := rt.db.ListUsers(offset, limit)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error listing users")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.AdminUserCollection{Users: users}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// canModerate returns true if a user with the role actorRole can act on the user with the given userID, i.e. if the
+// latter has a lower role
+func canModerate(db database.AppDatabase, actorRole string, userID string) (bool, error) {
+	role, err := db.GetUserRole(userID)
+	if err != nil {
+		return false, err
+	}
+	return roleRanks[role] < roleRanks[actorRole], nil
+}
+
+func (rt *_router) suspendUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check that the requester is a moderator
+	actorID, actorRole, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Parse and decode the request body into a Suspension object
+	var suspension structs.Suspension
+	err = json.NewDecoder(r.Body).Decode(&suspension)
+	if err != nil {
+		// If there is something wrong with the request body, return a 400 status
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	// Moderators can't suspend other moderators or administrators
+	allowed, err := canModerate(rt.db, actorRole, userID)
+	if err != nil {
+		// User not found, return a 404 status
+		writeStatus(w, http.StatusNotFound)
+		return
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, structs.Error{Message: "the user has the same or a higher role"})
+		return
+	}
+
+	// Suspend the user
+	err = rt.audited(actorID, auditSuspendUser, userID, suspension.Reason, func(db database.AppDatabase) error {
+		return db.SuspendUser(userID)
+	})
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error suspending user")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "User suspended successfully"}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) unsuspendUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check that the requester is a moderator
+	actorID, actorRole, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Moderators can't act on other moderators or administrators
+	allowed, err := canModerate(rt.db, actorRole, userID)
+	if err != nil {
+		// User not found, return a 404 status
+		writeStatus(w, http.StatusNotFound)
+		return
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, structs.Error{Message: "the user has the same or a higher role"})
+		return
+	}
+
+	// Lift the suspension
+	err = rt.audited(actorID, auditUnsuspendUser, userID, "", func(db database.AppDatabase) error {
+		return db.UnsuspendUser(userID)
+	})
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error unsuspending user")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "User unsuspended successfully"}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) setUserRole(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check that the requester is an administrator
+	actorID, _, err := rt.authorize(r, database.RoleAdmin)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Parse and decode the request body into a Role object
+	var role structs.Role
+	err = json.NewDecoder(r.Body).Decode(&role)
+	if _, known := roleRanks[role.Role]; err != nil || !known {
+		// If there is something wrong with the request body, return a 400 status
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	// Administrators can't change their own role, so that there is always one left
+	if userID == actorID {
+		writeError(w, http.StatusForbidden, structs.Error{Message: "administrators can't change their own role"})
+		return
+	}
+
+	// Set the role
+	err = rt.audited(actorID, auditSetRole, userID, role.Role, func(db database.AppDatabase) error {
+		return db.SetUserRole(userID, role.Role)
+	})
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "Role set successfully", Body: role}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) removePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the post ID from the URL
+	postID := ps.ByName("postId")
+
+	// Check that the requester is a moderator
+	actorID, actorRole, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Moderators can't remove the posts of other moderators or administrators. Held posts have an author too.
+	authorID, err := rt.db.GetPostAuthor(postID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+	allowed, err := canModerate(rt.db, actorRole, authorID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, structs.Error{Message: "the author has the same or a higher role"})
+		return
+	}
+
+	// Remove the post, the author can't restore it
+	err = rt.audited(actorID, auditRemovePost, postID, "", func(db database.AppDatabase) error {
+		return db.RemovePost(postID, actorID)
+	})
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "Post removed successfully"}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) removeComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the comment ID from the URL
+	commentID := ps.ByName("commentId")
+
+	// Check that the requester is a moderator
+	actorID, actorRole, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Moderators can't remove the comments of other moderators or administrators. Held comments have an author too.
+	authorID, err := rt.db.GetCommentAuthor(commentID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+	allowed, err := canModerate(rt.db, actorRole, authorID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, structs.Error{Message: "the author has the same or a higher role"})
+		return
+	}
+
+	// Remove the comment, the author can't restore it
+	err = rt.audited(actorID, auditRemoveComment, commentID, "", func(db database.AppDatabase) error {
+		return db.RemoveComment(commentID, actorID)
+	})
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "Comment removed successfully"}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) getStats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Check that the requester is an administrator
+	_, _, err := rt.authorize(r, database.RoleAdmin)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Get the statistics
+	stats, err := rt.db.GetStats()
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error getting stats")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+func (rt *_router) getAuditLog(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Check that the requester is an administrator
+	_, _, err := rt.authorize(r, database.RoleAdmin)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Get the requested page
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, structs.Error{Message: err.Error()})
+		return
+	}
+
+	// Get the entries of the audit log
+	entries, err := rt.db.GetAuditLog(offset, limit)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error getting audit log")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.AuditLog{Entries: entries}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// auditErrorDB is a database failing to write the audit log
+type auditErrorDB struct {
+	database.AppDatabase
+}
+
+func (db auditErrorDB) RunInTransaction(action func(tx database.AppDatabase) error) error {
+	return db.AppDatabase.RunInTransaction(func(tx database.AppDatabase) error {
+		return action(auditErrorDB{tx})
+	})
+}
+
+func (auditErrorDB) AddAuditEntry(string, string, string, string) error {
+	return errors.New("audit log unavailable")
+}
+
+// TestAuditedActionUndone checks that an action is undone when its audit entry can't be written
+func TestAuditedActionUndone(t *testing.T) {
+	rt := &_router{db: auditErrorDB{memdb.New()}}
+	bob, err := rt.db.CreateUser("bobby")
+	if err != nil {
+		t.Fatalf("creating bobby: %v", err)
+	}
+
+	err = rt.audited("moderator", auditSuspendUser, bob.UserID, "Spam", func(db database.AppDatabase) error {
+		return db.SuspendUser(bob.UserID)
+	})
+	if err == nil {
+		t.Fatal("expected the action to fail")
+	}
+	suspended, err := rt.db.IsSuspended(bob.UserID)
+	if err != nil || suspended {
+		t.Fatalf("expected the suspension to be undone: %v", err)
+	}
+}
+
+// savePhoto saves jpeg as a photo of the user with the given userID
+func savePhoto(t *testing.T, db database.AppDatabase, userID string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	err := ioutil.WriteFile(path, jpeg, 0o600)
+	if err != nil {
+		t.Fatalf("writing the photo: %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening the photo: %v", err)
+	}
+	defer file.Close()
+	photoID, err := db.SavePhoto(userID, file)
+	if err != nil {
+		t.Fatalf("saving the photo: %v", err)
+	}
+	return photoID
+}
+
+// TestPurgeUndone checks that the photo of a post purged by a resolution is kept when the resolution is undone: its
+// file is removed only once the resolution is committed
+func TestPurgeUndone(t *testing.T) {
+	rt := &_router{db: auditErrorDB{openSQLite(t)}}
+	alice, err := rt.db.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("creating alice: %v", err)
+	}
+	photoID := savePhoto(t, rt.db, alice.UserID)
+	post, err := rt.db.AddPost(structs.UserPost{AuthorID: alice.UserID, AuthorUsername: alice.Username, CreationDate: globaltime.Now(), Caption: "Spam", Image: photoID})
+	if err != nil {
+		t.Fatalf("adding the post: %v", err)
+	}
+
+	var photos []string
+	report := structs.Report{TargetType: reportPost, TargetID: post.ResourceID, TargetUserID: alice.UserID}
+	err = rt.audited("moderator", auditResolveReport, "report", resolutionDelete, func(db database.AppDatabase) error {
+		_, err := rt.applyResolution(db, report, structs.Resolution{Action: resolutionDelete}, "moderator", database.RoleModerator, &photos)
+		return err
+	})
+	if err == nil {
+		t.Fatal("expected the resolution to fail")
+	}
+	if len(photos) != 1 || photos[0] != photoID {
+		t.Errorf("expected the photo of the post to be returned, got %v", photos)
+	}
+	_, err = rt.db.GetPost(post.ResourceID)
+	if err != nil {
+		t.Errorf("expected the post to be kept: %v", err)
+	}
+	_, err = rt.db.GetPhoto(alice.UserID, photoID)
+	if err != nil {
+		t.Errorf("expected the photo to be kept: %v", err)
+	}
+	_ = rt.db.DeletePhoto(alice.UserID, photoID)
+}
@@ -15,23 +15,51 @@ type httpRouterHandler func(http.ResponseWriter, *http.Request, httprouter.Param
 // wrap parses the request and adds a reqcontext.RequestContext instance related to the request.
 func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Request, httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		reqUUID, err := uuid.NewV4()
+		ctx, ok := reqcontext.FromContext(r.Context())
+		if !ok {
+			var err error
+			ctx, err = rt.newRequestContext(r)
+			if err != nil {
+				rt.baseLogger.WithError(err).Error("can't generate a request UUID")
+				writeStatus(w, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Call the next handler in chain (usually, the handler function for the path)
+		fn(w, r, ps, ctx)
+	}
+}
+
+// withRequestContext gives every request a reqcontext.RequestContext, carried by the context of the request. The ID
+// of the request is sent back in the X-Request-ID header, and in the body of the error responses (see writeError).
+func (rt *_router) withRequestContext(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := rt.newRequestContext(r)
 		if err != nil {
 			rt.baseLogger.WithError(err).Error("can't generate a request UUID")
-			w.WriteHeader(http.StatusInternalServerError)
+			writeStatus(w, http.StatusInternalServerError)
 			return
 		}
-		var ctx = reqcontext.RequestContext{
-			ReqUUID: reqUUID,
-		}
-
-		// Create a request-specific logger
-		ctx.Logger = rt.baseLogger.WithFields(logrus.Fields{
-			"reqid":     ctx.ReqUUID.String(),
-			"remote-ip": r.RemoteAddr,
-		})
+		w.Header().Set(requestIDHeader, ctx.ReqUUID.String())
+		h.ServeHTTP(w, r.WithContext(reqcontext.NewContext(r.Context(), ctx)))
+	})
+}
 
-		// Call the next handler in chain (usually, the handler function for the path)
-		fn(w, r, ps, ctx)
+// newRequestContext returns a new reqcontext.RequestContext for the request
+func (rt *_router) newRequestContext(r *http.Request) (reqcontext.RequestContext, error) {
+	reqUUID, err := uuid.NewV4()
+	if err != nil {
+		return reqcontext.RequestContext{}, err
+	}
+	var ctx = reqcontext.RequestContext{
+		ReqUUID: reqUUID,
 	}
+
+	// Create a request-specific logger
+	ctx.Logger = rt.baseLogger.WithFields(logrus.Fields{
+		"reqid":     ctx.ReqUUID.String(),
+		"remote-ip": r.RemoteAddr,
+	})
+	return ctx, nil
 }
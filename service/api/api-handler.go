@@ -10,32 +10,61 @@ func (rt *_router) Handler() http.Handler {
 	// Register routes
 	rt.router.GET("/context", rt.wrap(rt.getContextReply))
 
-	rt.router.POST("/session", rt.getAuthToken) // TESTED, TESTED ON FRONTEND TODO: add last seen update and chech why dates are not working properly in db
+	rt.router.POST("/session", rt.idempotentLogin(rt.getAuthToken)) // TESTED, TESTED ON FRONTEND TODO: add last seen update
+	rt.router.POST("/session/claim", rt.claimAccount)
+	if rt.oidc != nil {
+		rt.router.GET("/session/oidc/login", rt.startOIDCLogin)
+		rt.router.GET("/session/oidc/callback", rt.finishOIDCLogin)
+	}
 
 	rt.router.GET("/users", rt.searchUser) // TESTED
 
 	rt.router.GET("/users/:userId", rt.getUserProfile)       // TESTED, on frontend
 	rt.router.PUT("/users/:userId", rt.updateUserProfile)    // TESTED, ON FRONTEND
 	rt.router.DELETE("/users/:userId", rt.deleteUserProfile) // TESTED, ON FRONTEND
+	rt.router.PATCH("/users/:userId", rt.patchUserProfile)
+	rt.router.POST("/users/:userId/restore", rt.restoreUserProfile)
+	rt.router.GET("/users/:userId/usernames", rt.getUsernameHistory)
+	rt.router.PUT("/users/:userId/password", rt.changePassword)
 
-	rt.router.GET("/users/:userId/posts", rt.getUserPosts) // TESTED, on frontend
-	rt.router.POST("/users/:userId/posts", rt.createPost)  // TESTED, ON FRONTEND TODO: add chcek that if the photo is not null, the photo is saved in the db
+	rt.router.POST("/users/:userId/export", rt.startExport)
+	rt.router.GET("/users/:userId/export/:jobId", rt.getExport)
+
+	rt.router.GET("/users/:userId/jobs/:jobId", rt.getJob)
+
+	rt.router.POST("/users/:userId/reports", rt.reportUser)
+	rt.router.GET("/users/:userId/warnings", rt.getUserWarnings)
+
+	rt.router.GET("/users/:userId/posts", rt.getUserPosts)               // TESTED, on frontend
+	rt.router.POST("/users/:userId/posts", rt.idempotent(rt.createPost)) // TESTED, ON FRONTEND TODO: add chcek that if the photo is not null, the photo is saved in the db
 
 	rt.router.GET("/users/:userId/posts/:postId", rt.getPost)       // TESTED, ON FRONTEND
 	rt.router.PUT("/users/:userId/posts/:postId", rt.editPost)      // TESTED, ON FRONTEND
 	rt.router.DELETE("/users/:userId/posts/:postId", rt.deletePost) // TESTED, ON FRONTEND
+	rt.router.PATCH("/users/:userId/posts/:postId", rt.patchPost)
+	rt.router.POST("/users/:userId/posts/:postId/restore", rt.restorePost)
+
+	rt.router.GET("/users/:userId/posts/:postId/revisions", rt.getPostRevisions)
+
+	rt.router.POST("/users/:userId/posts/:postId/reports", rt.reportPost)
 
 	rt.router.GET("/users/:userId/posts/:postId/likes", rt.getPostLikes) // TESTED, ON FRONTEND
 
 	rt.router.PUT("/users/:userId/posts/:postId/likes/:likeId", rt.likePost)      // TESTED, ON FRONTEND
 	rt.router.DELETE("/users/:userId/posts/:postId/likes/:likeId", rt.unlikePost) // TESTED, ON FRONTEND
 
-	rt.router.GET("/users/:userId/posts/:postId/comments", rt.getPostComments) // TESTED, ON FRONTEND
-	rt.router.POST("/users/:userId/posts/:postId/comments", rt.createComment)  // TESTED, ON FRONTEND
+	rt.router.GET("/users/:userId/posts/:postId/comments", rt.getPostComments)               // TESTED, ON FRONTEND
+	rt.router.POST("/users/:userId/posts/:postId/comments", rt.idempotent(rt.createComment)) // TESTED, ON FRONTEND
 
 	rt.router.GET("/users/:userId/posts/:postId/comments/:commentId", rt.getComment)       // TESTED, ON FRONTEND
 	rt.router.PUT("/users/:userId/posts/:postId/comments/:commentId", rt.editComment)      // TESTED, ON FRONTEND
 	rt.router.DELETE("/users/:userId/posts/:postId/comments/:commentId", rt.deleteComment) // TESTED, ON FRONTEND
+	rt.router.PATCH("/users/:userId/posts/:postId/comments/:commentId", rt.patchComment)
+	rt.router.POST("/users/:userId/posts/:postId/comments/:commentId/restore", rt.restoreComment)
+
+	rt.router.GET("/users/:userId/posts/:postId/comments/:commentId/revisions", rt.getCommentRevisions)
+
+	rt.router.POST("/users/:userId/posts/:postId/comments/:commentId/reports", rt.reportComment)
 
 	rt.router.GET("/users/:userId/posts/:postId/comments/:commentId/likes", rt.getCommentLikes) // TESTED, ON FRONTEND
 
@@ -54,15 +83,43 @@ func (rt *_router) Handler() http.Handler {
 	rt.router.PUT("/users/:userId/banned/:bannedId", rt.banUser)      // TESTED
 	rt.router.DELETE("/users/:userId/banned/:bannedId", rt.unbanUser) // TESTED
 
-	rt.router.POST("/users/:userId/photos", rt.savePhoto) // TESTED on frontend
+	rt.router.POST("/users/:userId/photos", rt.idempotent(rt.savePhoto)) // TESTED on frontend
 
 	rt.router.GET("/users/:userId/photos/:photoId", rt.getPhoto)       // TESTED on frontend
 	rt.router.DELETE("/users/:userId/photos/:photoId", rt.deletePhoto) // TESTED on frontend
 
 	rt.router.GET("/users/:userId/feed", rt.getFeed) // TESTED
 
+	rt.router.GET("/admin/users", rt.listUsers)
+	rt.router.PUT("/admin/users/:userId/suspension", rt.suspendUser)
+	rt.router.DELETE("/admin/users/:userId/suspension", rt.unsuspendUser)
+	rt.router.PUT("/admin/users/:userId/role", rt.setUserRole)
+	rt.router.DELETE("/admin/posts/:postId", rt.removePost)
+	rt.router.DELETE("/admin/comments/:commentId", rt.removeComment)
+	rt.router.GET("/admin/stats", rt.getStats)
+	rt.router.GET("/admin/audit", rt.getAuditLog)
+	rt.router.GET("/admin/reports", rt.listReports)
+	rt.router.GET("/admin/reports/:reportId", rt.getReport)
+	rt.router.POST("/admin/reports/:reportId/claim", rt.claimReport)
+	rt.router.POST("/admin/reports/:reportId/resolve", rt.resolveReport)
+	rt.router.POST("/admin/reports/:reportId/dismiss", rt.dismissReport)
+
 	// Special routes
 	rt.router.GET("/liveness", rt.liveness)
 
-	return rt.router
+	// Answer the unknown routes and the panics with the same error body as the handlers
+	rt.router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusNotFound)
+	})
+	rt.router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusMethodNotAllowed)
+	})
+	rt.router.PanicHandler = func(w http.ResponseWriter, r *http.Request, v interface{}) {
+		rt.baseLogger.WithField("reqid", w.Header().Get(requestIDHeader)).Errorf("panic serving %s: %v", r.URL.Path, v)
+		writeStatus(w, http.StatusInternalServerError)
+	}
+
+	// Every request gets an ID, sent back in the X-Request-ID header and in the error bodies, and is checked against
+	// the OpenAPI specification before reaching the router
+	return rt.withRequestContext(rt.validated(rt.router))
 }
@@ -38,10 +38,16 @@ package api
 
 import (
 	"errors"
+	"fmt"
+	"github.com/attiliov/WASA-Photo/service/contentfilter"
 	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/openapi"
+	"github.com/attiliov/WASA-Photo/service/structs"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"sync"
+	"time"
 )
 
 // Config is used to provide dependencies and configuration to the New function.
@@ -51,6 +57,51 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// DeletionGracePeriod is how long deleted users, posts and comments can be restored by their owner before being
+	// purged
+	DeletionGracePeriod time.Duration
+
+	// PurgeInterval is how often the background job purging expired deletions runs. Zero disables the job.
+	PurgeInterval time.Duration
+
+	// ExportDirectory is where the archives produced by the data export jobs are stored
+	ExportDirectory string
+
+	// ExportWorkers is how many data exports are built at the same time. Zero means one.
+	ExportWorkers int
+
+	// ExportTTL is how long the export archives are kept, removed by the purge job. Zero keeps them until the account
+	// is deleted.
+	ExportTTL time.Duration
+
+	// UsernameChangeCooldown is how long a user has to wait between two username changes
+	UsernameChangeCooldown time.Duration
+
+	// ReservedUsernames are the usernames that can't be chosen by users (case-insensitive)
+	ReservedUsernames []string
+
+	// UsernameOnlyLogin allows users without a password to log in with their username alone. They can't claim their
+	// account (see POST /session/claim) while it is disabled.
+	UsernameOnlyLogin bool
+
+	// OIDC configures the login through an OpenID Connect provider, disabled if OIDC.Issuer is empty
+	OIDC OIDCConfig
+
+	// Admins are the usernames of the users given the administrator role at startup. New fails if one of them is not
+	// registered or has no password.
+	Admins []string
+
+	// ContentFilter checks the text of posts and comments before they are saved, nil accepts everything
+	ContentFilter contentfilter.Filter
+
+	// IdempotencyTTL is how long the responses of the requests with an Idempotency-Key header are kept. Zero disables
+	// the Idempotency-Key support.
+	IdempotencyTTL time.Duration
+
+	// Validator checks the requests, and optionally the responses, against the OpenAPI specification. nil disables
+	// the validation.
+	Validator *openapi.Validator
 }
 
 // Router is the package API interface representing an API handler builder
@@ -58,6 +109,10 @@ type Router interface {
 	// Handler returns an HTTP handler for APIs provided in this package
 	Handler() http.Handler
 
+	// SessionUser returns the ID of the user of the session of the request, i.e. the one of its bearer token. It
+	// fails if the request has no token or if the session is unknown.
+	SessionUser(r *http.Request) (string, error)
+
 	// Close terminates any resource used in the package
 	Close() error
 }
@@ -71,6 +126,15 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	if cfg.DeletionGracePeriod < 0 {
+		return nil, errors.New("deletion grace period can't be negative")
+	}
+	if cfg.ExportDirectory == "" {
+		return nil, errors.New("export directory is required")
+	}
+	if cfg.OIDC.Issuer != "" && (cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "") {
+		return nil, errors.New("OIDC client ID and redirect URL are required")
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -78,11 +142,67 @@ func New(cfg Config) (Router, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
-	return &_router{
-		router:     router,
-		baseLogger: cfg.Logger,
-		db:         cfg.Database,
-	}, nil
+	rt := &_router{
+		router:                 router,
+		baseLogger:             cfg.Logger,
+		db:                     cfg.Database,
+		deletionGracePeriod:    cfg.DeletionGracePeriod,
+		exportDirectory:        cfg.ExportDirectory,
+		exports:                make(chan structs.Job, exportQueueSize),
+		exportTTL:              cfg.ExportTTL,
+		usernameChangeCooldown: cfg.UsernameChangeCooldown,
+		reservedUsernames:      cfg.ReservedUsernames,
+		usernameOnlyLogin:      cfg.UsernameOnlyLogin,
+		oidcPostLoginRedirect:  cfg.OIDC.PostLoginRedirect,
+		contentFilter:          cfg.ContentFilter,
+		idempotencyTTL:         cfg.IdempotencyTTL,
+		validator:              cfg.Validator,
+		stop:                   make(chan struct{}),
+	}
+	if cfg.OIDC.Issuer != "" {
+		rt.oidc = newOIDCProvider(cfg.OIDC)
+	}
+
+	// Promote the configured administrators. They must have registered and set a password: anyone could otherwise sign
+	// up with a configured username, or log in to it with the username alone, and get the role.
+	for _, username := range cfg.Admins {
+		user, err := rt.db.GetUser(username)
+		if err != nil {
+			return nil, fmt.Errorf("administrator %s: %w", username, err)
+		}
+		hash, err := rt.db.GetPasswordHash(user.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("administrator %s: %w", username, err)
+		}
+		if hash == "" {
+			return nil, fmt.Errorf("administrator %s has no password", username)
+		}
+		err = rt.db.SetUserRole(user.UserID, database.RoleAdmin)
+		if err != nil {
+			return nil, fmt.Errorf("promoting administrator %s: %w", username, err)
+		}
+	}
+
+	// Start the background jobs
+	if cfg.PurgeInterval > 0 {
+		rt.jobs.Add(1)
+		go rt.purgeDeleted(cfg.PurgeInterval)
+	}
+	workers := cfg.ExportWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		rt.jobs.Add(1)
+		go rt.runExportWorker()
+	}
+	err := rt.resumeJobs()
+	if err != nil {
+		_ = rt.Close()
+		return nil, fmt.Errorf("resuming jobs: %w", err)
+	}
+
+	return rt, nil
 }
 
 type _router struct {
@@ -93,4 +213,42 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	// deletionGracePeriod is how long soft-deleted resources can be restored
+	deletionGracePeriod time.Duration
+
+	// exportDirectory is where data export archives are stored
+	exportDirectory string
+
+	// exports is the queue of the export jobs, run by the export workers
+	exports chan structs.Job
+
+	// exportTTL is how long the export archives are kept, zero if forever
+	exportTTL time.Duration
+
+	// usernameChangeCooldown is the minimum time between two username changes of a user
+	usernameChangeCooldown time.Duration
+
+	// reservedUsernames can't be chosen by users
+	reservedUsernames []string
+
+	// usernameOnlyLogin allows users without a password to log in with their username alone
+	usernameOnlyLogin bool
+
+	// oidc is the OpenID Connect provider used to log in, nil if not configured
+	oidc                  *oidcProvider
+	oidcPostLoginRedirect string
+
+	// contentFilter checks posts and comments before they are saved, nil if not configured
+	contentFilter contentfilter.Filter
+
+	// idempotencyTTL is how long the responses of the requests with an Idempotency-Key header are kept
+	idempotencyTTL time.Duration
+
+	// validator checks requests and responses against the OpenAPI specification, nil if not configured
+	validator *openapi.Validator
+
+	// stop is closed to ask the background jobs to terminate, jobs tracks the running ones
+	stop chan struct{}
+	jobs sync.WaitGroup
 }
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+	"github.com/sirupsen/logrus"
+)
+
+// TestConfiguredAdministrators checks that only registered users with a password are promoted at startup
+func TestConfiguredAdministrators(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	db := memdb.New()
+	alice, err := db.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("creating alice: %v", err)
+	}
+	hash, err := hashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("hashing the password: %v", err)
+	}
+	err = db.SetPasswordHash(alice.UserID, hash)
+	if err != nil {
+		t.Fatalf("setting the password: %v", err)
+	}
+	bob, err := db.CreateUser("bobby")
+	if err != nil {
+		t.Fatalf("creating bobby: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		admins []string
+		ok     bool
+	}{
+		{name: "registered with a password", admins: []string{"alice"}, ok: true},
+		{name: "not registered", admins: []string{"alice", "carol"}},
+		{name: "no password", admins: []string{"bobby"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router, err := New(Config{Logger: logger, Database: db, ExportDirectory: t.TempDir(), Admins: tc.admins})
+			if !tc.ok {
+				if err == nil {
+					_ = router.Close()
+					t.Fatal("expected New to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("creating the router: %v", err)
+			}
+			_ = router.Close()
+		})
+	}
+
+	role, err := db.GetUserRole(alice.UserID)
+	if err != nil || role != database.RoleAdmin {
+		t.Fatalf("expected alice to be an administrator, got %q: %v", role, err)
+	}
+	role, err = db.GetUserRole(bob.UserID)
+	if err != nil || role != database.RoleUser {
+		t.Fatalf("expected bobby to stay a user, got %q: %v", role, err)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Package apitest contains the helpers shared by the tests serving the API: the contract tests of package api and the
+tests of the client.
+
+It doesn't import package api, so that the tests of package api itself can use it. The tests build the router with
+the Logger and the Validator of this package, and serve it with NewServer.
+*/
+package apitest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/attiliov/WASA-Photo/doc"
+	"github.com/attiliov/WASA-Photo/service/openapi"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger returns a logger discarding its output
+func Logger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logger
+}
+
+// Validator returns a validator of the requests and the responses against doc/api.yaml
+func Validator(t testing.TB) *openapi.Validator {
+	t.Helper()
+	validator, err := openapi.New(doc.OpenAPI, openapi.Config{ValidateResponses: true})
+	if err != nil {
+		t.Fatalf("loading the specification: %v", err)
+	}
+	return validator
+}
+
+// NewServer serves handler with httptest until the end of the test. The responses marked by the validator as not
+// matching the specification fail the test: they are recorded while serving, and reported once the server is closed,
+// as the test can't be failed from the goroutines of the server.
+func NewServer(t testing.TB, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	var violations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+		if violation := w.Header().Get(openapi.ViolationHeader); violation != "" {
+			mu.Lock()
+			violations = append(violations, r.Method+" "+r.URL.Path+": "+violation)
+			mu.Unlock()
+		}
+	}))
+	t.Cleanup(func() {
+		server.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, violation := range violations {
+			t.Errorf("the response does not match the specification: %s", violation)
+		}
+	})
+	return server
+}
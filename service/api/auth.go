@@ -1,54 +1,135 @@
 package api
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/attiliov/WASA-Photo/service/database"
 	"github.com/attiliov/WASA-Photo/service/structs"
 
 	"github.com/julienschmidt/httprouter"
 )
 
+// sessionTokenLength is the number of random bytes of a session token
+const sessionTokenLength = 32
+
+// hashSessionToken returns the hash of the token identifying its session in the database, so that the tokens can't
+// be read from the database
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startSession starts a new session of the user with the given userID, and returns it with its token
+func (rt *_router) startSession(userID string) (structs.Session, error) {
+	random := make([]byte, sessionTokenLength)
+	_, err := rand.Read(random)
+	if err != nil {
+		return structs.Session{}, fmt.Errorf("generating session token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	err = rt.db.CreateSession(hashSessionToken(token), userID)
+	if err != nil {
+		return structs.Session{}, err
+	}
+	return structs.Session{UserID: userID, Token: token}, nil
+}
+
 // getToken is the handler for POST /session
-// Parse the request body which should contain a username,
-// and return the userId if the username is valid.
+// Parse the request body which should contain a username (and the password, if the user has one),
+// and return a new session of the user if the credentials are valid.
 // If user is not present in the database, it will be created
-// and the userId will be returned.
+// and a session of the new user will be returned.
 
 func (rt *_router) getAuthToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	// Parse and decode the request body into a string
-	var username structs.Username
-	err := json.NewDecoder(r.Body).Decode(&username)
+	// Parse and decode the request body into a Credentials object
+	var credentials structs.Credentials
+	err := json.NewDecoder(r.Body).Decode(&credentials)
 	if err != nil {
 		// If there is something wrong with the request body, return a 400 status
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
 		return
 	}
 
 	// Get the user from the database
-	user, err := rt.db.GetUser(username.Username)
+	user, err := rt.db.GetUser(credentials.Username)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		rt.writeDatabaseError(w, err)
+		return
+	}
 
 	// If the user doesn't exist, create a new user
+	status := http.StatusOK
 	if err != nil {
-		user, err = rt.db.CreateUser(username.Username)
+		// Check that the username can be chosen
+		code, err := rt.checkUsername(credentials.Username, "")
 		if err != nil {
-			// If there was an error creating the user, return a 500 status
-			w.WriteHeader(http.StatusInternalServerError)
+			rt.writeUsernameError(w, code, err)
 			return
 		}
+
+		// A password is required, unless username-only login is allowed
+		var hash string
+		if credentials.Password != "" || !rt.usernameOnlyLogin {
+			if invalid := validatePassword(credentials.Password); invalid != nil {
+				writeError(w, http.StatusBadRequest, *invalid)
+				return
+			}
+			hash, err = hashPassword(credentials.Password)
+			if err != nil {
+				rt.baseLogger.WithError(err).Error("error hashing password")
+				writeStatus(w, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		user, err = rt.db.CreateUser(credentials.Username)
+		if err != nil {
+			rt.writeDatabaseError(w, err)
+			return
+		}
+		if hash != "" {
+			err = rt.db.SetPasswordHash(user.UserID, hash)
+			if err != nil {
+				rt.baseLogger.WithError(err).Error("error setting password hash")
+				writeStatus(w, http.StatusInternalServerError)
+				return
+			}
+		}
 		// If a new user was created, return a 201 status
-		w.WriteHeader(http.StatusCreated)
+		status = http.StatusCreated
 	} else {
-		// If the user already existed, return a 200 status
-		w.WriteHeader(http.StatusOK)
+		// Check the credentials of the existing user
+		err = rt.checkCredentials(user.UserID, credentials.Password)
+		if errors.Is(err, errWrongCredentials) || errors.Is(err, errUnclaimedAccount) {
+			writeError(w, http.StatusUnauthorized, structs.Error{Message: err.Error()})
+			return
+		} else if errors.Is(err, errAccountSuspended) {
+			writeError(w, http.StatusForbidden, structs.Error{Message: err.Error()})
+			return
+		} else if err != nil {
+			rt.baseLogger.WithError(err).Error("error checking credentials")
+			writeStatus(w, http.StatusInternalServerError)
+			return
+		}
 	}
 
-	// Return the user's ID in the response body
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(user.UserID)
+	// Start the session, the token is the bearer token of the next requests
+	session, err := rt.startSession(user.UserID)
 	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.baseLogger.WithError(err).Error("error starting session")
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
+
+	// Return the session in the response body
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(session)
 }
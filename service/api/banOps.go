@@ -24,15 +24,15 @@ func (rt *_router) getUserBanList(w http.ResponseWriter, r *http.Request, ps htt
 	// Check that a user with userID exists
 	_, err := rt.db.GetUser(userID)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -41,7 +41,7 @@ func (rt *_router) getUserBanList(w http.ResponseWriter, r *http.Request, ps htt
 	if err != nil {
 		rt.baseLogger.Println(err)
 		// If there was an error getting the banned users, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
@@ -50,12 +50,7 @@ func (rt *_router) getUserBanList(w http.ResponseWriter, r *http.Request, ps htt
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -67,10 +62,10 @@ func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter
 	bannedID := ps.ByName("bannedId")
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -79,7 +74,7 @@ func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter
 	if err != nil {
 		rt.baseLogger.Println(err)
 		// If there was an error unfollowing the user, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
@@ -88,15 +83,14 @@ func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter
 	if err != nil {
 		rt.baseLogger.Println(err)
 		// If there was an error unfollowing the user, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
 	// Ban the user
 	err = rt.db.BanUser(userID, bannedID)
 	if err != nil {
-		// If there was an error banning the user, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -113,10 +107,10 @@ func (rt *_router) unbanUser(w http.ResponseWriter, r *http.Request, ps httprout
 	bannedID := ps.ByName("bannedId")
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -125,7 +119,7 @@ func (rt *_router) unbanUser(w http.ResponseWriter, r *http.Request, ps httprout
 	if err != nil {
 		rt.baseLogger.Println(err)
 		// If there was an error unbanning the user, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
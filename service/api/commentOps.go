@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/json"
+	"github.com/attiliov/WASA-Photo/service/contentfilter"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
 	"github.com/attiliov/WASA-Photo/service/structs"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
@@ -14,7 +16,9 @@ import (
 		- POST /users/:userId/posts/postId/comments
 		- GET /users/:userId/posts/postId/comments/:commentId
 		- PUT /users/:userId/posts/postId/comments/commentId
+		- PATCH /users/:userId/posts/postId/comments/commentId
 		- DELETE /users/:userId/posts/postId/comments/:commentId
+		- POST /users/:userId/posts/postId/comments/:commentId/restore
 */
 
 func (rt *_router) getPostComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -26,17 +30,17 @@ func (rt *_router) getPostComments(w http.ResponseWriter, r *http.Request, ps ht
 	userID := ps.ByName("userId")
 
 	// Check that the user requesting the comments is not banned from the post owner
-	requesterId, err := getBearerToken(r)
+	requesterId, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, requesterId)
 	if err != nil || banned {
 		// If there was an error checking if the user is banned, return a 500 status
 		rt.baseLogger.Println("err: ", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -45,7 +49,7 @@ func (rt *_router) getPostComments(w http.ResponseWriter, r *http.Request, ps ht
 	if err != nil {
 		// If there was an error getting the comments, return a 500 status
 		rt.baseLogger.Println("err: ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
@@ -54,12 +58,7 @@ func (rt *_router) getPostComments(w http.ResponseWriter, r *http.Request, ps ht
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) createComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -75,31 +74,51 @@ func (rt *_router) createComment(w http.ResponseWriter, r *http.Request, ps http
 	err := json.NewDecoder(r.Body).Decode(&comment)
 	if err != nil {
 		// If there was an error decoding the request body, return a 400 status
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
 		return
 	}
+	// The creation date is the one of the server, not the one sent by the client
+	comment.CreationDate = globaltime.Now()
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != comment.AuthorID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Check that authorId is the same as bearer token
 	if comment.AuthorID != beaerToken {
 		// If the authorId is not the same as the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Check the text with the content filter
+	decision, ok := rt.filterContent(w, contentfilter.Content{AuthorID: comment.AuthorID, Kind: reportComment, Text: comment.Caption})
+	if !ok {
 		return
 	}
 
 	// Create the comment
-	err = rt.db.CreateComment(postID, comment)
+	commentID, err := rt.db.CreateComment(postID, comment)
 	if err != nil {
 		rt.baseLogger.Println("err: ", err)
 		// If there was an error creating the comment, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Hide the comment until a moderator reviews it, if the content filter asks so
+	if decision.Verdict == contentfilter.Hold {
+		err = rt.holdForReview(reportComment, commentID.ResourceID, comment.AuthorID, decision)
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error holding comment for review")
+			writeStatus(w, http.StatusInternalServerError)
+			return
+		}
+		writeHeld(w, "Comment held for review: "+decision.Message, commentID)
 		return
 	}
 
@@ -117,16 +136,16 @@ func (rt *_router) getComment(w http.ResponseWriter, r *http.Request, ps httprou
 	userID := ps.ByName("userId")
 
 	// Check that the user requesting the comments is not banned from the post owner
-	requesterId, err := getBearerToken(r)
+	requesterId, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, requesterId)
 	if err != nil || banned {
 		// If there was an error checking if the user is banned, return a 500 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -135,18 +154,14 @@ func (rt *_router) getComment(w http.ResponseWriter, r *http.Request, ps httprou
 	if err != nil {
 		// If there was an error getting the comment, return a 500 status
 		// rt.baseLogger.Println("err: ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
 	// Set the header and write the response body
+	setETag(w, comment.Version)
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(comment)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(comment)
 }
 
 func (rt *_router) editComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -162,23 +177,99 @@ func (rt *_router) editComment(w http.ResponseWriter, r *http.Request, ps httpro
 	err := json.NewDecoder(r.Body).Decode(&comment)
 	if err != nil {
 		// If there was an error decoding the request body, return a 400 status
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	// Get the current version of the comment
+	current, ok := rt.editableComment(w, r, commentID)
+	if !ok {
+		return
+	}
+
+	// Check that the request replaces the current version
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	rt.saveComment(w, current, comment)
+}
+
+func (rt *_router) patchComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	// Get the comment ID from the URL
+	commentID := ps.ByName("commentId")
+
+	// Get the current version of the comment
+	current, ok := rt.editableComment(w, r, commentID)
+	if !ok {
+		return
+	}
+
+	// Check that the request is based on the current version, if the client sent it
+	if !checkIfMatch(w, r, current.Version, false) {
+		return
+	}
+
+	// Apply the patch in the request body to the current comment
+	var comment structs.Comment
+	if !decodeMergePatch(w, r, &current, &comment) {
 		return
 	}
 
+	rt.saveComment(w, current, comment)
+}
+
+// editableComment returns the comment with the given ID, checking that the user making the request is its author.
+// Otherwise it writes the error response and returns false.
+func (rt *_router) editableComment(w http.ResponseWriter, r *http.Request, commentID string) (structs.Comment, bool) {
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
-	if err != nil || beaerToken != comment.AuthorID {
+	beaerToken, err := rt.authenticate(r)
+	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
+		return structs.Comment{}, false
+	}
+
+	// Get the comment
+	comment, err := rt.db.GetComment(commentID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return comment, false
+	}
+	if comment.AuthorID != beaerToken {
+		// Only the author can edit the comment
+		writeStatus(w, http.StatusUnauthorized)
+		return comment, false
+	}
+	return comment, true
+}
+
+// saveComment replaces the current version of a comment with the edited one
+func (rt *_router) saveComment(w http.ResponseWriter, current structs.Comment, comment structs.Comment) {
+	// Check the new text with the content filter
+	decision, ok := rt.filterContent(w, contentfilter.Content{AuthorID: current.AuthorID, Kind: reportComment, Text: comment.Caption, Edit: true})
+	if !ok {
 		return
 	}
 
-	// Edit the comment
-	err = rt.db.EditComment(commentID, comment)
+	// Edit the comment, unless it was edited in the meantime
+	version, err := rt.db.EditComment(current.CommentID, comment, current.Version)
 	if err != nil {
-		// If there was an error editing the comment, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
+		return
+	}
+	setETag(w, version)
+
+	// Hide the comment until a moderator reviews it, if the content filter asks so
+	if decision.Verdict == contentfilter.Hold {
+		err = rt.holdForReview(reportComment, current.CommentID, current.AuthorID, decision)
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error holding comment for review")
+			writeStatus(w, http.StatusInternalServerError)
+			return
+		}
+		writeHeld(w, "Comment held for review: "+decision.Message, nil)
 		return
 	}
 
@@ -197,24 +288,46 @@ func (rt *_router) deleteComment(w http.ResponseWriter, r *http.Request, ps http
 	// Get comment author id
 	comment, err := rt.db.GetComment(commentID)
 	if err != nil {
-		// If there was an error getting the comment, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != comment.AuthorID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Delete the comment
 	err = rt.db.DeleteComment(commentID)
 	if err != nil {
-		// If there was an error deleting the comment, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Set the header and write the response body
+	w.WriteHeader(http.StatusOK)
+}
+
+func (rt *_router) restoreComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	// Get the comment ID from the URL
+	commentID := ps.ByName("commentId")
+
+	// Check authorization (only the author can restore a comment)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Restore the comment if it belongs to the bearer and it is still in the grace period
+	err = rt.db.RestoreComment(commentID, beaerToken, rt.restoreDeadline())
+	if err != nil {
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
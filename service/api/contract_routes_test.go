@@ -0,0 +1,548 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// unknownID is a well-formed ID of no resource
+const unknownID = "00000000-0000-4000-8000-000000000000"
+
+// jpeg is the start of a JPEG file, enough to be stored as a photo
+var jpeg = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00\xff\xd9")
+
+// TestContract drives every route of the API through a scenario, checking the status and the shape of each response,
+// on every backend of contractBackends. It fails if a route registered in api-handler.go is never requested.
+func TestContract(t *testing.T) {
+	t.Parallel()
+	for _, backend := range contractBackends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := contractConfig()
+			cfg.Database = backend.open(t)
+			testContract(t, cfg)
+		})
+	}
+}
+
+// testContract is the scenario of TestContract, on the database of cfg
+func testContract(t *testing.T, cfg Config) {
+	s := newContractServer(t, cfg)
+
+	// The steps depend on each other, stop at the first failing one
+	step := func(name string, f func(t *testing.T)) {
+		if !t.Run(name, f) {
+			t.FailNow()
+		}
+	}
+
+	var alice, bob, carol, mod, admin string
+	step("session", func(t *testing.T) {
+		s.do(t, call{method: http.MethodGet, route: "/liveness"}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/context"}, http.StatusOK)
+
+		alice = s.login(t, "alice")
+		bob = s.login(t, "bob_b")
+		carol = s.login(t, "carol")
+		mod = s.login(t, "moderator1")
+		admin = s.login(t, "admin1")
+		s.setRole(t, mod, database.RoleModerator)
+		s.setRole(t, admin, database.RoleAdmin)
+
+		// Logging in again gives the same ID, in a new session
+		token := s.tokens[alice]
+		r := s.do(t, call{method: http.MethodPost, route: "/session", body: structs.Username{Username: "alice"}}, http.StatusOK)
+		if s.addSession(t, r) != alice || s.tokens[alice] == token {
+			t.Errorf("logging in again gave %s, expected a new session of %s", r.body, alice)
+		}
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: map[string]string{"userId": alice}, token: token}, http.StatusOK)
+
+		// Usernames are checked against the specification, and against the reserved ones
+		s.do(t, call{method: http.MethodPost, route: "/session", body: structs.Username{Username: "a!"}}, http.StatusBadRequest)
+		s.do(t, call{method: http.MethodPost, route: "/session", body: structs.Username{Username: "admin"}}, http.StatusBadRequest)
+		s.do(t, call{method: http.MethodPost, route: "/session", body: []byte(`{"username":"alice"}`), contentType: "text/plain"}, http.StatusBadRequest)
+
+		// Idempotent retries get the same response. The keys of logins are scoped to the username.
+		key := map[string]string{"Idempotency-Key": "login-dave"}
+		first := s.do(t, call{method: http.MethodPost, route: "/session", header: key, body: structs.Username{Username: "dave_d"}}, http.StatusCreated)
+		retry := s.do(t, call{method: http.MethodPost, route: "/session", header: key, body: structs.Username{Username: "dave_d"}}, http.StatusCreated)
+		if retry.session(t) != first.session(t) || retry.header.Get("Idempotent-Replayed") != "true" {
+			t.Errorf("the retry was not replayed: %s", retry.body)
+		}
+		s.do(t, call{method: http.MethodPost, route: "/session", header: key, body: structs.Credentials{Username: "dave_d", Password: "a wrong password"}}, http.StatusUnprocessableEntity)
+		s.do(t, call{method: http.MethodPost, route: "/session", header: key, body: structs.Username{Username: "gina_g"}}, http.StatusCreated)
+
+		// Claiming an account sets its password, then the password is required. Only the user can claim it.
+		dave := s.addSession(t, first)
+		claim := structs.Credentials{Username: "dave_d", Password: "long enough password"}
+		s.do(t, call{method: http.MethodPost, route: "/session/claim", as: dave, body: structs.Credentials{Username: "dave_d", Password: "short"}}, http.StatusBadRequest)
+		s.do(t, call{method: http.MethodPost, route: "/session/claim", as: dave, body: structs.Credentials{Username: "nobody", Password: "long enough password"}}, http.StatusNotFound)
+		s.do(t, call{method: http.MethodPost, route: "/session/claim", body: claim}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPost, route: "/session/claim", as: alice, body: claim}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPost, route: "/session/claim", token: dave, body: claim}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPost, route: "/session/claim", as: dave, body: claim}, http.StatusOK)
+		s.do(t, call{method: http.MethodPost, route: "/session/claim", as: dave, body: claim}, http.StatusConflict)
+		s.do(t, call{method: http.MethodPost, route: "/session", body: structs.Username{Username: "dave_d"}}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPost, route: "/session", body: structs.Credentials{Username: "dave_d", Password: "long enough password"}}, http.StatusOK)
+	})
+
+	aliceParams := map[string]string{"userId": alice}
+	step("users", func(t *testing.T) {
+		s.do(t, call{method: http.MethodGet, route: "/users", query: "username=ali", as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users", as: bob}, http.StatusBadRequest)
+
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: aliceParams, as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: map[string]string{"userId": unknownID}, as: bob}, http.StatusNotFound)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: map[string]string{"userId": "not-an-id"}, as: bob}, http.StatusBadRequest)
+
+		// Replacing the profile requires its version
+		profile := map[string]string{"username": "alice", "bio": "Hello"}
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}", params: aliceParams, as: alice, body: profile}, http.StatusPreconditionRequired)
+		tag := s.etag(t, "/users/{userId}", aliceParams, alice)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}", params: aliceParams, as: bob, body: profile, header: map[string]string{"If-Match": tag}}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}", params: aliceParams, as: alice, body: profile, header: map[string]string{"If-Match": tag}}, http.StatusOK)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}", params: aliceParams, as: alice, body: profile, header: map[string]string{"If-Match": tag}}, http.StatusPreconditionFailed)
+
+		// Patching it doesn't
+		s.do(t, call{method: http.MethodPatch, route: "/users/{userId}", params: aliceParams, as: alice, body: map[string]interface{}{"bio": nil}, contentType: mergePatchContentType}, http.StatusOK)
+		s.do(t, call{method: http.MethodPatch, route: "/users/{userId}", params: aliceParams, as: alice, body: map[string]interface{}{"bio": "Hi"}}, http.StatusBadRequest)
+
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/usernames", params: aliceParams, as: alice}, http.StatusOK)
+
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/password", params: map[string]string{"userId": carol}, as: carol, body: map[string]string{"password": "carol's password"}}, http.StatusOK)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/password", params: map[string]string{"userId": carol}, as: carol, body: structs.PasswordChange{CurrentPassword: "wrong password", Password: "another password"}}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/password", params: map[string]string{"userId": carol}, as: bob, body: map[string]string{"password": "bob's password"}}, http.StatusUnauthorized)
+
+		// Deleted users can be restored during the grace period
+		erin := s.login(t, "erin_e")
+		erinParams := map[string]string{"userId": erin}
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}", params: erinParams, as: bob}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}", params: erinParams, as: erin}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: erinParams, as: bob}, http.StatusNotFound)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/restore", params: erinParams, as: erin}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: erinParams, as: bob}, http.StatusOK)
+	})
+
+	var photo, post, comment string
+	postParams := func() map[string]string { return map[string]string{"userId": alice, "postId": post} }
+	commentParams := func() map[string]string {
+		return map[string]string{"userId": alice, "postId": post, "commentId": comment}
+	}
+	step("photos", func(t *testing.T) {
+		r := s.do(t, call{method: http.MethodPost, route: "/users/{userId}/photos", params: aliceParams, as: alice, body: multipartFile{field: "photo", data: jpeg}}, http.StatusCreated)
+		photo = r.id(t)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/photos", params: aliceParams, as: bob, body: multipartFile{field: "photo", data: jpeg}}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/photos", params: aliceParams, as: alice, body: multipartFile{field: "file", data: jpeg}}, http.StatusBadRequest)
+
+		photoParams := map[string]string{"userId": alice, "photoId": photo}
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/photos/{photoId}", params: photoParams, as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/photos/{photoId}", params: map[string]string{"userId": alice, "photoId": unknownID}, as: bob}, http.StatusNotFound)
+
+		spare := s.do(t, call{method: http.MethodPost, route: "/users/{userId}/photos", params: aliceParams, as: alice, body: multipartFile{field: "photo", data: jpeg}}, http.StatusCreated)
+		spareParams := map[string]string{"userId": alice, "photoId": spare.id(t)}
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/photos/{photoId}", params: spareParams, as: bob}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/photos/{photoId}", params: spareParams, as: alice}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/photos/{photoId}", params: spareParams, as: alice}, http.StatusNotFound)
+	})
+
+	step("posts", func(t *testing.T) {
+		// The body sent by the web UI
+		newPost := map[string]string{"authorId": alice, "authorUsername": "alice", "creationDate": "2024-01-01T00:00:00Z", "caption": "First post", "image": photo}
+		r := s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: aliceParams, as: alice, body: newPost}, http.StatusCreated)
+		post = r.id(t)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: aliceParams, as: bob, body: newPost}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: aliceParams, as: alice, body: map[string]string{"caption": ""}}, http.StatusBadRequest)
+
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts", params: aliceParams, as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}", params: postParams(), as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}", params: map[string]string{"userId": alice, "postId": unknownID}, as: bob}, http.StatusNotFound)
+
+		tag := s.etag(t, "/users/{userId}/posts/{postId}", postParams(), alice)
+		edited := map[string]string{"caption": "Edited post", "image": photo}
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/posts/{postId}", params: postParams(), as: alice, body: edited}, http.StatusPreconditionRequired)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/posts/{postId}", params: postParams(), as: alice, body: edited, header: map[string]string{"If-Match": tag}}, http.StatusOK)
+		s.do(t, call{method: http.MethodPatch, route: "/users/{userId}/posts/{postId}", params: postParams(), as: alice, body: map[string]string{"caption": "Patched post"}, contentType: mergePatchContentType, header: map[string]string{"If-Match": tag}}, http.StatusPreconditionFailed)
+		s.do(t, call{method: http.MethodPatch, route: "/users/{userId}/posts/{postId}", params: postParams(), as: alice, body: map[string]string{"caption": "Patched post"}, contentType: mergePatchContentType}, http.StatusOK)
+		s.do(t, call{method: http.MethodPatch, route: "/users/{userId}/posts/{postId}", params: postParams(), as: bob, body: map[string]string{"caption": "Not mine"}, contentType: mergePatchContentType}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}/revisions", params: postParams(), as: bob}, http.StatusOK)
+
+		// Idempotent retries get the same response. Keys are scoped to the user, requests without a session are
+		// refused.
+		key := map[string]string{"Idempotency-Key": "post-alice"}
+		first := s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: aliceParams, as: alice, header: key, body: newPost}, http.StatusCreated)
+		retry := s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: aliceParams, as: alice, header: key, body: newPost}, http.StatusCreated)
+		if retry.id(t) != first.id(t) || retry.header.Get("Idempotent-Replayed") != "true" {
+			t.Errorf("the retry was not replayed: %s", retry.body)
+		}
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: aliceParams, as: alice, header: key, body: edited}, http.StatusUnprocessableEntity)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: aliceParams, header: key, body: newPost}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: map[string]string{"userId": bob}, as: bob, header: key, body: map[string]string{"caption": "By bob", "image": photo}}, http.StatusCreated)
+
+		// Deleted posts can be restored by their author
+		spare := s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: aliceParams, as: alice, body: newPost}, http.StatusCreated)
+		spareParams := map[string]string{"userId": alice, "postId": spare.id(t)}
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/posts/{postId}", params: spareParams, as: bob}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/posts/{postId}", params: spareParams, as: alice}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}", params: spareParams, as: bob}, http.StatusNotFound)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts/{postId}/restore", params: spareParams, as: alice}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}", params: spareParams, as: bob}, http.StatusOK)
+	})
+
+	step("likes", func(t *testing.T) {
+		likeParams := map[string]string{"userId": alice, "postId": post, "likeId": bob}
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/posts/{postId}/likes/{likeId}", params: likeParams, as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/posts/{postId}/likes/{likeId}", params: likeParams, as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}/likes", params: postParams(), as: carol}, http.StatusOK)
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/posts/{postId}/likes/{likeId}", params: likeParams, as: bob}, http.StatusOK)
+	})
+
+	step("comments", func(t *testing.T) {
+		newComment := map[string]string{"authorId": bob, "authorUsername": "bob_b", "creationDate": "2024-01-01T00:00:00Z", "caption": "Nice"}
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts/{postId}/comments", params: postParams(), as: bob, body: newComment}, http.StatusCreated)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts/{postId}/comments", params: postParams(), as: carol, body: newComment}, http.StatusUnauthorized)
+
+		var comments structs.CommentStream
+		r := s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}/comments", params: postParams(), as: carol}, http.StatusOK)
+		r.decode(t, &comments)
+		if len(comments.Comments) != 1 {
+			t.Fatalf("expected one comment, got %s", r.body)
+		}
+		comment = comments.Comments[0].CommentID
+
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}/comments/{commentId}", params: commentParams(), as: carol}, http.StatusOK)
+		tag := s.etag(t, "/users/{userId}/posts/{postId}/comments/{commentId}", commentParams(), bob)
+		edited := map[string]string{"authorId": bob, "caption": "Very nice"}
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/posts/{postId}/comments/{commentId}", params: commentParams(), as: bob, body: edited, header: map[string]string{"If-Match": tag}}, http.StatusOK)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/posts/{postId}/comments/{commentId}", params: commentParams(), as: carol, body: edited, header: map[string]string{"If-Match": tag}}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPatch, route: "/users/{userId}/posts/{postId}/comments/{commentId}", params: commentParams(), as: bob, body: map[string]string{"caption": "Really nice"}, contentType: mergePatchContentType}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}/comments/{commentId}/revisions", params: commentParams(), as: carol}, http.StatusOK)
+
+		likeParams := commentParams()
+		likeParams["likeId"] = carol
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/posts/{postId}/comments/{commentId}/likes/{likeId}", params: likeParams, as: carol}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}/comments/{commentId}/likes", params: commentParams(), as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/posts/{postId}/comments/{commentId}/likes/{likeId}", params: likeParams, as: carol}, http.StatusOK)
+
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/posts/{postId}/comments/{commentId}", params: commentParams(), as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/posts/{postId}/comments/{commentId}", params: commentParams(), as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}/comments/{commentId}", params: commentParams(), as: carol}, http.StatusNotFound)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts/{postId}/comments/{commentId}/restore", params: commentParams(), as: bob}, http.StatusOK)
+	})
+
+	step("follows", func(t *testing.T) {
+		followParams := map[string]string{"userId": bob, "followingId": alice}
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/following/{followingId}", params: followParams, as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/following/{followingId}", params: followParams, as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/followers", params: aliceParams, as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/following", params: map[string]string{"userId": bob}, as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/feed", params: map[string]string{"userId": bob}, as: bob}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/feed", params: map[string]string{"userId": bob}, as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/following/{followingId}", params: followParams, as: bob}, http.StatusOK)
+	})
+
+	step("bans", func(t *testing.T) {
+		// Alice bans carol, who can't see her anymore
+		banParams := map[string]string{"userId": alice, "bannedId": carol}
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/banned/{bannedId}", params: banParams, as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodPut, route: "/users/{userId}/banned/{bannedId}", params: banParams, as: alice}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/banned", params: aliceParams, as: alice}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/banned", params: aliceParams, as: carol}, http.StatusUnauthorized)
+
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: aliceParams, as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts", params: aliceParams, as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}", params: postParams(), as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}/comments", params: postParams(), as: carol}, http.StatusUnauthorized)
+
+		s.do(t, call{method: http.MethodDelete, route: "/users/{userId}/banned/{bannedId}", params: banParams, as: alice}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}", params: postParams(), as: carol}, http.StatusOK)
+	})
+
+	step("auth", func(t *testing.T) {
+		// Requests without a token, with an unknown token, or with the ID of a user instead of the token of their
+		// session
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts", params: aliceParams}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts", params: aliceParams, token: unknownID}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts", params: aliceParams, token: alice}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/feed", params: aliceParams}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/admin/stats"}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/admin/stats", as: alice}, http.StatusForbidden)
+	})
+
+	var report string
+	step("reports", func(t *testing.T) {
+		reason := map[string]string{"reason": "spam"}
+		var created structs.Report
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts/{postId}/reports", params: postParams(), as: carol, body: reason}, http.StatusCreated).decode(t, &created)
+		report = created.ReportID
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts/{postId}/reports", params: postParams(), as: carol, body: reason}, http.StatusConflict)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts/{postId}/reports", params: postParams(), as: bob, body: map[string]string{"reason": "boring"}}, http.StatusBadRequest)
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts/{postId}/comments/{commentId}/reports", params: commentParams(), as: carol, body: reason}, http.StatusCreated)
+		var userReport structs.Report
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/reports", params: map[string]string{"userId": bob}, as: carol, body: reason}, http.StatusCreated).decode(t, &userReport)
+
+		s.do(t, call{method: http.MethodGet, route: "/admin/reports", as: mod}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/admin/reports", as: carol}, http.StatusForbidden)
+		reportParams := map[string]string{"reportId": report}
+		s.do(t, call{method: http.MethodGet, route: "/admin/reports/{reportId}", params: reportParams, as: mod}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/admin/reports/{reportId}", params: map[string]string{"reportId": unknownID}, as: mod}, http.StatusNotFound)
+		s.do(t, call{method: http.MethodPost, route: "/admin/reports/{reportId}/claim", params: reportParams, as: mod}, http.StatusOK)
+		s.do(t, call{method: http.MethodPost, route: "/admin/reports/{reportId}/claim", params: reportParams, as: admin}, http.StatusConflict)
+		s.do(t, call{method: http.MethodPost, route: "/admin/reports/{reportId}/resolve", params: reportParams, as: mod, body: structs.Resolution{Action: "warn", Note: "No spam"}}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/warnings", params: aliceParams, as: alice}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/warnings", params: aliceParams, as: bob}, http.StatusUnauthorized)
+
+		// A failed action leaves the report open, a closed report can't be resolved again
+		userReportParams := map[string]string{"reportId": userReport.ReportID}
+		s.do(t, call{method: http.MethodPost, route: "/admin/reports/{reportId}/resolve", params: userReportParams, as: mod, body: structs.Resolution{Action: "hide"}}, http.StatusBadRequest)
+		s.do(t, call{method: http.MethodPost, route: "/admin/reports/{reportId}/resolve", params: userReportParams, as: mod, body: structs.Resolution{Action: "warn", Note: "No spam"}}, http.StatusOK)
+		s.do(t, call{method: http.MethodPost, route: "/admin/reports/{reportId}/resolve", params: userReportParams, as: mod, body: structs.Resolution{Action: "warn"}}, http.StatusConflict)
+
+		var reports structs.ReportCollection
+		s.do(t, call{method: http.MethodGet, route: "/admin/reports", query: "status=open", as: mod}, http.StatusOK).decode(t, &reports)
+		if len(reports.Reports) == 0 {
+			t.Fatal("no open reports left")
+		}
+		s.do(t, call{method: http.MethodPost, route: "/admin/reports/{reportId}/dismiss", params: map[string]string{"reportId": reports.Reports[0].ReportID}, as: mod, body: structs.Resolution{Note: "Fine"}}, http.StatusOK)
+	})
+
+	step("admin", func(t *testing.T) {
+		s.do(t, call{method: http.MethodGet, route: "/admin/users", as: admin}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/admin/users", query: "limit=0", as: admin}, http.StatusBadRequest)
+		s.do(t, call{method: http.MethodGet, route: "/admin/stats", as: admin}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/admin/audit", as: admin}, http.StatusOK)
+
+		// Moderators can suspend users, but not other moderators
+		carolParams := map[string]string{"userId": carol}
+		s.do(t, call{method: http.MethodPut, route: "/admin/users/{userId}/suspension", params: map[string]string{"userId": admin}, as: mod, body: structs.Suspension{Reason: "No"}}, http.StatusForbidden)
+		s.do(t, call{method: http.MethodPut, route: "/admin/users/{userId}/suspension", params: carolParams, as: mod, body: structs.Suspension{Reason: "Spam"}}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: aliceParams, as: carol}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodDelete, route: "/admin/users/{userId}/suspension", params: carolParams, as: mod}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: aliceParams, as: carol}, http.StatusOK)
+
+		s.do(t, call{method: http.MethodPut, route: "/admin/users/{userId}/role", params: carolParams, as: mod, body: structs.Role{Role: database.RoleModerator}}, http.StatusForbidden)
+		s.do(t, call{method: http.MethodPut, route: "/admin/users/{userId}/role", params: carolParams, as: admin, body: structs.Role{Role: "king"}}, http.StatusBadRequest)
+		s.do(t, call{method: http.MethodPut, route: "/admin/users/{userId}/role", params: carolParams, as: admin, body: structs.Role{Role: database.RoleModerator}}, http.StatusOK)
+
+		// Moderators can remove content, but not the content of administrators
+		adminPost := s.do(t, call{method: http.MethodPost, route: "/users/{userId}/posts", params: map[string]string{"userId": admin}, as: admin, body: map[string]string{"authorId": admin, "authorUsername": "admin1", "caption": "By the admin", "image": photo}}, http.StatusCreated)
+		s.do(t, call{method: http.MethodDelete, route: "/admin/posts/{postId}", params: map[string]string{"postId": adminPost.id(t)}, as: mod}, http.StatusForbidden)
+		s.do(t, call{method: http.MethodDelete, route: "/admin/posts/{postId}", params: map[string]string{"postId": post}, as: bob}, http.StatusForbidden)
+		s.do(t, call{method: http.MethodDelete, route: "/admin/comments/{commentId}", params: map[string]string{"commentId": comment}, as: mod}, http.StatusOK)
+		s.do(t, call{method: http.MethodDelete, route: "/admin/posts/{postId}", params: map[string]string{"postId": post}, as: mod}, http.StatusOK)
+		s.do(t, call{method: http.MethodDelete, route: "/admin/posts/{postId}", params: map[string]string{"postId": unknownID}, as: mod}, http.StatusNotFound)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/posts/{postId}", params: postParams(), as: bob}, http.StatusNotFound)
+	})
+
+	step("export", func(t *testing.T) {
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/export", params: aliceParams, as: bob}, http.StatusUnauthorized)
+		var job structs.Job
+		s.do(t, call{method: http.MethodPost, route: "/users/{userId}/export", params: aliceParams, as: alice}, http.StatusAccepted).decode(t, &job)
+
+		jobParams := map[string]string{"userId": alice, "jobId": job.JobID}
+		deadline := time.Now().Add(10 * time.Second)
+		for job.Status != database.JobDone {
+			if time.Now().After(deadline) {
+				t.Fatalf("the export did not finish: %+v", job)
+			}
+			time.Sleep(10 * time.Millisecond)
+			s.do(t, call{method: http.MethodGet, route: "/users/{userId}/jobs/{jobId}", params: jobParams, as: alice}, http.StatusOK).decode(t, &job)
+		}
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/jobs/{jobId}", params: jobParams, as: bob}, http.StatusUnauthorized)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/export/{jobId}", params: jobParams, as: alice}, http.StatusOK)
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/export/{jobId}", params: map[string]string{"userId": alice, "jobId": unknownID}, as: alice}, http.StatusNotFound)
+
+		// Once purged, the archive is expired
+		err := os.Remove(filepath.Join(s.exportDirectory, job.JobID+".zip"))
+		if err != nil {
+			t.Fatalf("removing the archive: %v", err)
+		}
+		var e structs.Error
+		s.do(t, call{method: http.MethodGet, route: "/users/{userId}/export/{jobId}", params: jobParams, as: alice}, http.StatusNotFound).decode(t, &e)
+		if e.Code != codeExportExpired {
+			t.Errorf("expected the %s code, got %+v", codeExportExpired, e)
+		}
+	})
+
+	// Every route must have been requested
+	for _, route := range registeredRoutes(t) {
+		if route == "GET /session/oidc/login" || route == "GET /session/oidc/callback" {
+			// Registered only when OIDC is configured, see TestContractOIDC
+			continue
+		}
+		if !s.called[route] {
+			t.Errorf("%s is not covered by the contract tests", route)
+		}
+	}
+}
+
+// oidcTestProvider is an OpenID Connect provider issuing ID tokens for a single user
+type oidcTestProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// nonce is put in the next ID token, it must be the one of the login being finished
+	nonce string
+
+	// tamper changes the claims of the next ID tokens once signed
+	tamper bool
+}
+
+func newOIDCTestProvider(t *testing.T) *oidcTestProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating the signing key: %v", err)
+	}
+	p := &oidcTestProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken(t)})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// idToken returns a signed ID token for the user of the provider
+func (p *oidcTestProvider) idToken(t *testing.T) string {
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Errorf("encoding the ID token: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := segment(map[string]string{"alg": "RS256", "kid": "test"}) + "." + segment(map[string]interface{}{
+		"iss":                p.server.URL,
+		"sub":                "frank-subject",
+		"aud":                "wasa",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"nonce":              p.nonce,
+		"preferred_username": "frank",
+	})
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Errorf("signing the ID token: %v", err)
+	}
+	if p.tamper {
+		header := strings.Split(unsigned, ".")[0]
+		unsigned = header + "." + segment(map[string]interface{}{
+			"iss":   p.server.URL,
+			"sub":   "mallory-subject",
+			"aud":   "wasa",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": p.nonce,
+		})
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// startLogin requests GET /session/oidc/login, notes the nonce of the login and returns the query string of the
+// callback finishing it, with the header carrying the state cookie of the browser
+func (p *oidcTestProvider) startLogin(t *testing.T, s *contractServer) (string, map[string]string) {
+	t.Helper()
+	r := s.do(t, call{method: http.MethodGet, route: "/session/oidc/login"}, http.StatusFound)
+	location, err := url.Parse(r.header.Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), p.server.URL+"/authorize?") {
+		t.Fatalf("unexpected redirect to %q", r.header.Get("Location"))
+	}
+	p.nonce = location.Query().Get("nonce")
+	state := location.Query().Get("state")
+
+	cookies := (&http.Response{Header: r.header}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || cookies[0].Value != state || !cookies[0].HttpOnly ||
+		cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected cookies %v", r.header.Values("Set-Cookie"))
+	}
+	return "state=" + url.QueryEscape(state) + "&code=code", map[string]string{"Cookie": cookies[0].String()}
+}
+
+// TestContractOIDC drives the routes of the login through an OpenID Connect provider, registered only when one is
+// configured
+func TestContractOIDC(t *testing.T) {
+	t.Parallel()
+	provider := newOIDCTestProvider(t)
+	cfg := contractConfig()
+	cfg.OIDC = OIDCConfig{Issuer: provider.server.URL, ClientID: "wasa", RedirectURL: "http://localhost/session/oidc/callback"}
+	s := newContractServer(t, cfg)
+
+	// Logins refused by the provider, or unknown
+	s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: "error=access_denied"}, http.StatusUnauthorized)
+	s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: "state=unknown&code=code", header: map[string]string{"Cookie": oidcStateCookie + "=unknown"}}, http.StatusUnauthorized)
+
+	// The first login creates the user, the next ones find it
+	callback, cookie := provider.startLogin(t, s)
+	frank := s.addSession(t, s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: callback, header: cookie}, http.StatusOK))
+	callback, cookie = provider.startLogin(t, s)
+	again := s.addSession(t, s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: callback, header: cookie}, http.StatusOK))
+	if again != frank {
+		t.Errorf("the second login gave %s, expected %s", again, frank)
+	}
+	s.do(t, call{method: http.MethodGet, route: "/users/{userId}", params: map[string]string{"userId": frank}, as: frank}, http.StatusOK)
+
+	// A state can't be used twice
+	s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: callback, header: cookie}, http.StatusUnauthorized)
+
+	// A login can only be finished by the browser that started it
+	callback, _ = provider.startLogin(t, s)
+	_, other := provider.startLogin(t, s)
+	s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: callback}, http.StatusUnauthorized)
+	s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: callback, header: other}, http.StatusUnauthorized)
+
+	// ID tokens changed after being signed, or issued for another login, are refused
+	callback, cookie = provider.startLogin(t, s)
+	provider.tamper = true
+	s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: callback, header: cookie}, http.StatusUnauthorized)
+	provider.tamper = false
+	callback, cookie = provider.startLogin(t, s)
+	provider.nonce = "another login"
+	s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: callback, header: cookie}, http.StatusUnauthorized)
+	if _, err := s.db.GetIdentityUser(provider.server.URL, "mallory-subject"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("expected the tampered identity to be unknown, got %v", err)
+	}
+
+	// The browser is sent back to the web app, if configured
+	cfg.OIDC.PostLoginRedirect = "http://localhost/#/"
+	s = newContractServer(t, cfg)
+	callback, cookie = provider.startLogin(t, s)
+	r := s.do(t, call{method: http.MethodGet, route: "/session/oidc/callback", query: callback, header: cookie}, http.StatusFound)
+	if !strings.HasPrefix(r.header.Get("Location"), "http://localhost/#/#token=") {
+		t.Errorf("unexpected redirect to %q", r.header.Get("Location"))
+	}
+}
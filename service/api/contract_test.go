@@ -0,0 +1,411 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/doc"
+	"github.com/attiliov/WASA-Photo/service/api/apitest"
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+/*
+	This file contains the contract tests of the API: every route registered in api-handler.go is driven through
+	httptest against the databases of contractBackends (package memdb and SQLite), and every response is checked
+	against doc/api.yaml (status code, headers and body) by the response validation of the openapi package.
+*/
+
+// contractServer is the API served by httptest, on an in-memory database
+type contractServer struct {
+	db     database.AppDatabase
+	server *httptest.Server
+
+	// exportDirectory is where the export archives are written
+	exportDirectory string
+
+	// tokens are the session tokens of the users logged in by login, by user ID
+	tokens map[string]string
+
+	// called are the operations requested, as "METHOD /path/{param}"
+	called map[string]bool
+}
+
+// contractBackends are the databases the contract tests run on: the in-memory one and SQLite, opened like the server
+// does (see OpenSQLite)
+var contractBackends = []struct {
+	name string
+	open func(t *testing.T) database.AppDatabase
+}{
+	{name: "memdb", open: func(t *testing.T) database.AppDatabase { return memdb.New() }},
+	{name: "SQLite", open: openSQLite},
+}
+
+// openSQLite returns a new SQLite database in the temporary directory of the test
+func openSQLite(t *testing.T) database.AppDatabase {
+	t.Helper()
+	writer, reader, err := database.OpenSQLite(filepath.Join(t.TempDir(), "wasa.db"), 5*time.Second)
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = reader.Close()
+		_ = writer.Close()
+	})
+	db, err := database.NewWithReader(writer, reader)
+	if err != nil {
+		t.Fatalf("creating the AppDatabase: %v", err)
+	}
+	return db
+}
+
+// newContractServer starts the API with the given configuration. The logger, the database (in memory), the export
+// directory and the validator are filled in if missing.
+func newContractServer(t *testing.T, cfg Config) *contractServer {
+	t.Helper()
+
+	if cfg.Logger == nil {
+		cfg.Logger = apitest.Logger()
+	}
+	if cfg.Database == nil {
+		cfg.Database = memdb.New()
+	}
+	if cfg.ExportDirectory == "" {
+		cfg.ExportDirectory = t.TempDir()
+	}
+	if cfg.Validator == nil {
+		cfg.Validator = apitest.Validator(t)
+	}
+
+	router, err := New(cfg)
+	if err != nil {
+		t.Fatalf("creating the router: %v", err)
+	}
+	t.Cleanup(func() { _ = router.Close() })
+	server := apitest.NewServer(t, router.Handler())
+
+	return &contractServer{
+		db:              cfg.Database,
+		server:          server,
+		exportDirectory: cfg.ExportDirectory,
+		tokens:          make(map[string]string),
+		called:          make(map[string]bool),
+	}
+}
+
+// contractConfig is the configuration of the servers of the contract tests
+func contractConfig() Config {
+	return Config{
+		DeletionGracePeriod:    time.Hour,
+		UsernameChangeCooldown: 0,
+		ReservedUsernames:      []string{"admin"},
+		UsernameOnlyLogin:      true,
+		IdempotencyTTL:         time.Hour,
+	}
+}
+
+// call is a request to an operation of the specification
+type call struct {
+	method string
+	route  string            // Path of the specification, e.g. /users/{userId}
+	params map[string]string // Values of the path parameters
+	query  string
+	as     string // ID of a user logged in by login, whose session token is sent
+	token  string // Bearer token sent if as is empty, none if empty
+	header map[string]string
+
+	// body is sent as JSON, unless it is a []byte (sent as is) or a multipartFile
+	body        interface{}
+	contentType string // Defaults to application/json for JSON bodies
+}
+
+// multipartFile is a body of a single file, sent as multipart/form-data
+type multipartFile struct {
+	field string
+	data  []byte
+}
+
+// response is the response to a call
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// decode decodes the JSON body of the response into v
+func (r response) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal(r.body, v)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", r.body, err)
+	}
+}
+
+// id decodes the resource ID in the body, either a JSON string, a structs.ResourceID or a structs.Success with one
+func (r response) id(t *testing.T) string {
+	t.Helper()
+	var value interface{}
+	r.decode(t, &value)
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if id, ok := v["resourceId"].(string); ok {
+			return id
+		}
+		if body, ok := v["body"].(map[string]interface{}); ok {
+			if id, ok := body["resourceId"].(string); ok {
+				return id
+			}
+		}
+	}
+	t.Fatalf("no resource ID in %s", r.body)
+	return ""
+}
+
+// session decodes the session in the body, checking that it has a token
+func (r response) session(t *testing.T) structs.Session {
+	t.Helper()
+	var session structs.Session
+	r.decode(t, &session)
+	if session.UserID == "" || session.Token == "" {
+		t.Fatalf("no session in %s", r.body)
+	}
+	return session
+}
+
+// do sends the call and checks that the status is the expected one, and that the response matches the specification
+func (s *contractServer) do(t *testing.T, c call, status int) response {
+	t.Helper()
+	s.called[c.method+" "+c.route] = true
+
+	path := c.route
+	for name, value := range c.params {
+		path = strings.ReplaceAll(path, "{"+name+"}", value)
+	}
+	if strings.Contains(path, "{") {
+		t.Fatalf("missing path parameters in %s", path)
+	}
+	if c.query != "" {
+		path += "?" + c.query
+	}
+
+	var body io.Reader
+	contentType := c.contentType
+	switch b := c.body.(type) {
+	case nil:
+	case []byte:
+		body = bytes.NewReader(b)
+	case multipartFile:
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, err := writer.CreateFormFile(b.field, "photo.jpg")
+		if err == nil {
+			_, err = part.Write(b.data)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			t.Fatalf("encoding the multipart body: %v", err)
+		}
+		body = &buf
+		contentType = writer.FormDataContentType()
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("encoding the body: %v", err)
+		}
+		body = bytes.NewReader(data)
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+
+	req, err := http.NewRequest(c.method, s.server.URL+path, body)
+	if err != nil {
+		t.Fatalf("creating the request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	token := c.token
+	if c.as != "" {
+		token = s.tokens[c.as]
+		if token == "" {
+			t.Fatalf("%s is not logged in", c.as)
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, value := range c.header {
+		req.Header.Set(name, value)
+	}
+
+	// Don't follow the redirects, they are responses of the API too
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", c.method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: reading the response: %v", c.method, path, err)
+	}
+	r := response{status: resp.StatusCode, header: resp.Header, body: data}
+
+	if r.status != status {
+		t.Fatalf("%s %s: status %d, expected %d: %s", c.method, path, r.status, status, data)
+	}
+	if r.header.Get(requestIDHeader) == "" {
+		t.Errorf("%s %s: no %s header", c.method, path, requestIDHeader)
+	}
+	if status >= 400 {
+		var e structs.Error
+		r.decode(t, &e)
+		if e.Code == "" || e.Status != status || e.RequestID != r.header.Get(requestIDHeader) {
+			t.Errorf("%s %s: malformed error %s", c.method, path, data)
+		}
+	}
+	return r
+}
+
+// login signs up the user with the given username and returns their ID, the next calls can be made as them
+func (s *contractServer) login(t *testing.T, username string) string {
+	t.Helper()
+	r := s.do(t, call{method: http.MethodPost, route: "/session", body: structs.Username{Username: username}}, http.StatusCreated)
+	return s.addSession(t, r)
+}
+
+// addSession records the session in the body of the response of a login, and returns the ID of its user
+func (s *contractServer) addSession(t *testing.T, r response) string {
+	t.Helper()
+	session := r.session(t)
+	s.tokens[session.UserID] = session.Token
+	return session.UserID
+}
+
+// setRole gives the role to the user
+func (s *contractServer) setRole(t *testing.T, userID string, role string) {
+	t.Helper()
+	err := s.db.SetUserRole(userID, role)
+	if err != nil {
+		t.Fatalf("setting the role of %s: %v", userID, err)
+	}
+}
+
+// etag returns the ETag of the resource at the route, as read by the user with the given ID
+func (s *contractServer) etag(t *testing.T, route string, params map[string]string, as string) string {
+	t.Helper()
+	r := s.do(t, call{method: http.MethodGet, route: route, params: params, as: as}, http.StatusOK)
+	tag := r.header.Get("ETag")
+	if tag == "" {
+		t.Fatalf("no ETag for %s", route)
+	}
+	return tag
+}
+
+// registeredRoutes returns the routes registered in api-handler.go, as "METHOD /path/{param}"
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "api-handler.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parsing api-handler.go: %v", err)
+	}
+
+	param := regexp.MustCompile(`:(\w+)`)
+	var routes []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		// Look for rt.router.METHOD("path", handler)
+		callExpr, ok := n.(*ast.CallExpr)
+		if !ok || len(callExpr.Args) != 2 {
+			return true
+		}
+		method, ok := callExpr.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		receiver, ok := method.X.(*ast.SelectorExpr)
+		if !ok || receiver.Sel.Name != "router" {
+			return true
+		}
+		path, ok := callExpr.Args[0].(*ast.BasicLit)
+		if !ok || path.Kind != token.STRING {
+			return true
+		}
+		value, err := strconv.Unquote(path.Value)
+		if err != nil {
+			t.Fatalf("route %s: %v", path.Value, err)
+		}
+		routes = append(routes, method.Sel.Name+" "+param.ReplaceAllString(value, "{$1}"))
+		return true
+	})
+	sort.Strings(routes)
+	return routes
+}
+
+// specifiedRoutes returns the operations of doc/api.yaml, as "METHOD /path/{param}"
+func specifiedRoutes(t *testing.T) []string {
+	t.Helper()
+	spec, err := openapi3.NewLoader().LoadFromData(doc.OpenAPI)
+	if err != nil {
+		t.Fatalf("loading the specification: %v", err)
+	}
+	err = spec.Validate(context.Background())
+	if err != nil {
+		t.Fatalf("validating the specification: %v", err)
+	}
+
+	var routes []string
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			routes = append(routes, method+" "+path)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// TestRoutesMatchSpecification checks that the routes of the router and the operations of the specification are the
+// same
+func TestRoutesMatchSpecification(t *testing.T) {
+	t.Parallel()
+	registered := registeredRoutes(t)
+	if len(registered) == 0 {
+		t.Fatal("no routes found in api-handler.go")
+	}
+	specified := make(map[string]bool)
+	for _, route := range specifiedRoutes(t) {
+		specified[route] = true
+	}
+
+	for _, route := range registered {
+		if !specified[route] {
+			t.Errorf("%s is registered but not in doc/api.yaml", route)
+		}
+		delete(specified, route)
+	}
+	for route := range specified {
+		t.Errorf("%s is in doc/api.yaml but not registered", route)
+	}
+}
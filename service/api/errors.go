@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the error responses of the API. Every error is answered with a structs.Error body with a
+	machine-readable code, the status, a message and the ID of the request, so that the failure reported by a client
+	can be found in the logs.
+
+	The errors of the database are mapped to a status by writeDatabaseError:
+	   - database.ErrNotFound: 404
+	   - database.ErrConflict: 409
+	   - database.ErrVersionMismatch: 412
+	   - any other error: 500
+*/
+
+// requestIDHeader is the response header carrying the ID of the request, set by withRequestContext
+const requestIDHeader = "X-Request-ID"
+
+// Machine-readable codes of the errors, more specific than the ones of errorCodes
+const (
+	codeVersionMismatch  = "version_mismatch"
+	codeContentRejected  = "content_rejected"
+	codeInvalidUsername  = "invalid_username"
+	codeUsernameTaken    = "username_taken"
+	codeInvalidPassword  = "invalid_password"
+	codeIdempotencyReuse = "idempotency_key_reused"
+	codeExportFailed     = "export_failed"
+	codeExportExpired    = "export_expired"
+	codeExportCancelled  = "export_cancelled"
+	codeInvalidRequest   = "invalid_request"
+)
+
+// errorCodes are the codes of the error statuses, used when the error has no more specific code
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusGone:                  "gone",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "unprocessable",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// writeError answers with the given status code and error body. The code and the message default to the ones of the
+// status, the request ID is taken from the X-Request-ID header of the response.
+func writeError(w http.ResponseWriter, status int, body structs.Error) {
+	if body.Code == "" {
+		body.Code = errorCodes[status]
+		if body.Code == "" {
+			body.Code = "error"
+		}
+	}
+	if body.Message == "" {
+		body.Message = strings.ToLower(http.StatusText(status))
+	}
+	body.Status = status
+	body.RequestID = w.Header().Get(requestIDHeader)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeStatus answers with the given error status code, when the default message of the status is enough
+func writeStatus(w http.ResponseWriter, status int) {
+	writeError(w, status, structs.Error{})
+}
+
+// writeDatabaseError answers with the status of an error returned by the database, see the list above. Unexpected
+// errors are logged.
+func (rt *_router) writeDatabaseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		writeError(w, http.StatusNotFound, structs.Error{Message: "the resource does not exist"})
+	case errors.Is(err, database.ErrConflict):
+		writeError(w, http.StatusConflict, structs.Error{Message: "the request conflicts with the current state of the resource"})
+	case errors.Is(err, database.ErrVersionMismatch):
+		writePreconditionFailed(w)
+	default:
+		rt.baseLogger.WithError(err).WithField("reqid", w.Header().Get(requestIDHeader)).Error("database error")
+		writeStatus(w, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// exportJobKind is the kind of the jobs building a user data export
+const exportJobKind = "export"
+
+// exportQueueSize is how many export jobs can wait for a worker, the new exports are refused beyond
+const exportQueueSize = 64
+
+// exportPath returns the path of the archive produced by the export job with the given jobID
+func (rt *_router) exportPath(jobID string) string {
+	return filepath.Join(rt.exportDirectory, jobID+".zip")
+}
+
+// runExportWorker runs the export jobs of the queue, one at a time, until rt.stop is closed
+func (rt *_router) runExportWorker() {
+	defer rt.jobs.Done()
+
+	for {
+		select {
+		case <-rt.stop:
+			return
+		case job := <-rt.exports:
+			rt.runExport(job)
+		}
+	}
+}
+
+// runExport runs the export job. Interrupted jobs are restarted from scratch when the router is created again, so the
+// job can be stopped at any step.
+func (rt *_router) runExport(job structs.Job) {
+	logger := rt.baseLogger.WithField("job", job.JobID)
+
+	err := rt.db.UpdateJob(job.JobID, database.JobRunning, 0)
+	if err != nil {
+		logger.WithError(err).Error("error starting export job")
+		return
+	}
+
+	err = rt.writeExport(job)
+	if errors.Is(err, errJobStopped) {
+		logger.Info("export job interrupted, it will be resumed at the next start")
+		return
+	} else if err != nil {
+		logger.WithError(err).Error("error exporting user data")
+		err = rt.db.UpdateJob(job.JobID, database.JobFailed, 0)
+		if err != nil {
+			logger.WithError(err).Error("error updating export job")
+		}
+		return
+	}
+
+	err = rt.db.UpdateJob(job.JobID, database.JobDone, 100)
+	if err != nil {
+		logger.WithError(err).Error("error completing export job")
+	}
+}
+
+// writeExport writes the archive with every data of the job user: a JSON file for each kind of data and the photo
+// files in the photos/ folder. The archive is built in a temporary file, renamed when complete.
+func (rt *_router) writeExport(job structs.Job) error {
+	userID := job.UserID
+
+	// Collect the user data
+	user, err := rt.db.GetUser(userID)
+	if err != nil {
+		return fmt.Errorf("getting user: %w", err)
+	}
+	postIDs, err := rt.db.GetUserPosts(userID)
+	if err != nil {
+		return fmt.Errorf("getting posts: %w", err)
+	}
+	posts := make([]structs.UserPost, 0, len(postIDs))
+	for _, postID := range postIDs {
+		post, err := rt.db.GetPost(postID.ResourceID)
+		if err != nil {
+			return fmt.Errorf("getting post %s: %w", postID.ResourceID, err)
+		}
+		posts = append(posts, post)
+	}
+	comments, err := rt.db.GetUserComments(userID)
+	if err != nil {
+		return fmt.Errorf("getting comments: %w", err)
+	}
+	likes, err := rt.db.GetUserLikes(userID)
+	if err != nil {
+		return fmt.Errorf("getting likes: %w", err)
+	}
+	followers, err := rt.db.GetFollowersList(userID)
+	if err != nil {
+		return fmt.Errorf("getting followers: %w", err)
+	}
+	following, err := rt.db.GetFollowingsList(userID)
+	if err != nil {
+		return fmt.Errorf("getting followings: %w", err)
+	}
+	banned, err := rt.db.GetUserBanList(userID)
+	if err != nil {
+		return fmt.Errorf("getting banned users: %w", err)
+	}
+	usernames, err := rt.db.GetUsernameHistory(userID)
+	if err != nil {
+		return fmt.Errorf("getting username history: %w", err)
+	}
+	photos, err := rt.db.GetUserPhotos(userID, false)
+	if err != nil {
+		return fmt.Errorf("getting photos: %w", err)
+	}
+
+	documents := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", user},
+		{"usernames.json", structs.UsernameHistory{Usernames: usernames}},
+		{"posts.json", posts},
+		{"comments.json", structs.CommentStream{Comments: comments}},
+		{"likes.json", structs.LikeCollection{Likes: likes}},
+		{"followers.json", structs.UserCollection{Users: followers}},
+		{"following.json", structs.UserCollection{Users: following}},
+		{"banned.json", structs.UserCollection{Users: banned}},
+	}
+
+	// Write the archive
+	err = os.MkdirAll(rt.exportDirectory, 0o700)
+	if err != nil {
+		return fmt.Errorf("creating export directory: %w", err)
+	}
+	partial := rt.exportPath(job.JobID) + ".part"
+	file, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("creating archive: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(partial)
+	}()
+	archive := zip.NewWriter(file)
+
+	steps := len(documents) + len(photos)
+	for i, document := range documents {
+		entry, err := archive.Create(document.name)
+		if err != nil {
+			return fmt.Errorf("adding %s: %w", document.name, err)
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(document.content)
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", document.name, err)
+		}
+		err = rt.reportProgress(job.JobID, i+1, steps)
+		if err != nil {
+			return err
+		}
+	}
+	for i, photoID := range photos {
+		photo, err := rt.db.GetPhoto(userID, photoID)
+		if err != nil {
+			// The file may have been removed in the meantime, skip it
+			rt.baseLogger.WithError(err).WithField("job", job.JobID).Warning("skipping missing photo in export")
+			continue
+		}
+		entry, err := archive.Create("photos/" + photoID + ".jpg")
+		if err != nil {
+			return fmt.Errorf("adding photo %s: %w", photoID, err)
+		}
+		_, err = entry.Write(photo)
+		if err != nil {
+			return fmt.Errorf("writing photo %s: %w", photoID, err)
+		}
+		err = rt.reportProgress(job.JobID, len(documents)+i+1, steps)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return fmt.Errorf("closing archive: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("closing archive file: %w", err)
+	}
+	err = os.Rename(partial, rt.exportPath(job.JobID))
+	if err != nil {
+		return fmt.Errorf("moving archive: %w", err)
+	}
+	return nil
+}
+
+// purgeExports removes the archives, complete or not, last written more than rt.exportTTL ago
+func (rt *_router) purgeExports() error {
+	entries, err := os.ReadDir(rt.exportDirectory)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading export directory: %w", err)
+	}
+
+	expired := globaltime.Now().Add(-rt.exportTTL)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".zip") && !strings.HasSuffix(entry.Name(), ".zip.part") {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("reading %s: %w", entry.Name(), err)
+		}
+		if info.ModTime().After(expired) {
+			continue
+		}
+		err = os.Remove(filepath.Join(rt.exportDirectory, entry.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
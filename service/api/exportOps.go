@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/julienschmidt/httprouter"
+)
+
+/*
+	This file contains the handlers for the API endpoints that are used to export the data of a user
+	i.e. the following endpoints:
+		- POST /users/:userId/export
+		- GET /users/:userId/export/:jobId
+
+	The exports are built in background by a fixed number of workers (Config.ExportWorkers), taking the jobs from a
+	queue of exportQueueSize. The archives are removed by the purge job once Config.ExportTTL is over.
+*/
+
+// exportRetryAfter is the Retry-After of the exports refused because the queue is full
+const exportRetryAfter = time.Minute
+
+func (rt *_router) startExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check authorization (a user can export only their own data)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil || beaerToken != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Check that the user exists
+	_, err = rt.db.GetUser(userID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// A user builds one export at a time: return the unfinished one, if any
+	jobs, err := rt.db.GetUserJobs(userID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+	for _, job := range jobs {
+		if job.Kind == exportJobKind && (job.Status == database.JobPending || job.Status == database.JobRunning) {
+			writeJob(w, job)
+			return
+		}
+	}
+
+	// Create the job and queue it for the export workers
+	job, err := rt.db.CreateJob(exportJobKind, userID, globaltime.Now())
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error creating export job")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+	select {
+	case rt.exports <- job:
+	default:
+		// Too many exports waiting: refuse this one rather than letting the queue grow
+		err = rt.db.UpdateJob(job.JobID, database.JobCancelled, 0)
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error cancelling export job")
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(exportRetryAfter.Seconds())))
+		writeError(w, http.StatusServiceUnavailable, structs.Error{Message: "too many exports in progress, retry later"})
+		return
+	}
+
+	writeJob(w, job)
+}
+
+// writeJob answers with the job, not done yet
+func writeJob(w http.ResponseWriter, job structs.Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+func (rt *_router) getExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	// Get the user ID and the job ID from the URL
+	userID := ps.ByName("userId")
+	jobID := ps.ByName("jobId")
+
+	// Check authorization (a user can download only their own data)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil || beaerToken != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Get the job
+	job, err := rt.db.GetJob(jobID)
+	if err != nil || job.UserID != userID || job.Kind != exportJobKind {
+		writeStatus(w, http.StatusNotFound)
+		return
+	}
+
+	// If the export is not ready, return the job status
+	if job.Status == database.JobFailed {
+		writeError(w, http.StatusInternalServerError, structs.Error{Code: codeExportFailed, Message: "the export failed, start a new one"})
+		return
+	}
+	if job.Status == database.JobCancelled {
+		writeError(w, http.StatusGone, structs.Error{Code: codeExportCancelled, Message: "the export was cancelled, start a new one"})
+		return
+	}
+	if job.Status != database.JobDone {
+		writeJob(w, job)
+		return
+	}
+
+	// Send the archive, unless it expired
+	archive, err := os.Open(rt.exportPath(job.JobID))
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, structs.Error{Code: codeExportExpired, Message: "the export expired, start a new one"})
+		return
+	} else if err != nil {
+		rt.baseLogger.WithError(err).Error("error opening export archive")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+	defer archive.Close()
+	info, err := archive.Stat()
+	if err != nil {
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="wasa-photo-export.zip"`)
+	http.ServeContent(w, r, "", info.ModTime(), archive)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// TestExportQueue checks that a user builds one export at a time, and that the exports are refused once the queue is
+// full
+func TestExportQueue(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	rt := &_router{
+		baseLogger: logger,
+		db:         memdb.New(),
+		exports:    make(chan structs.Job, 1), // No worker takes the jobs
+		stop:       make(chan struct{}),
+	}
+	alice, err := rt.db.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("creating alice: %v", err)
+	}
+	bob, err := rt.db.CreateUser("bob")
+	if err != nil {
+		t.Fatalf("creating bob: %v", err)
+	}
+
+	start := func(userID string, status int) structs.Job {
+		t.Helper()
+		session, err := rt.startSession(userID)
+		if err != nil {
+			t.Fatalf("starting the session: %v", err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/users/"+userID+"/export", nil)
+		r.Header.Set("Authorization", "Bearer "+session.Token)
+		w := httptest.NewRecorder()
+		rt.startExport(w, r, httprouter.Params{{Key: "userId", Value: userID}})
+		if w.Code != status {
+			t.Fatalf("expected status %d, got %d: %s", status, w.Code, w.Body)
+		}
+		var job structs.Job
+		if status == http.StatusAccepted {
+			err := json.Unmarshal(w.Body.Bytes(), &job)
+			if err != nil {
+				t.Fatalf("decoding the job: %v", err)
+			}
+		}
+		return job
+	}
+
+	first := start(alice.UserID, http.StatusAccepted)
+	if len(rt.exports) != 1 {
+		t.Fatalf("expected the export in the queue")
+	}
+	if again := start(alice.UserID, http.StatusAccepted); again.JobID != first.JobID {
+		t.Fatalf("expected the unfinished export %s, got %s", first.JobID, again.JobID)
+	}
+
+	// The queue is full
+	start(bob.UserID, http.StatusServiceUnavailable)
+	jobs, err := rt.db.GetUserJobs(bob.UserID)
+	if err != nil || len(jobs) != 1 || jobs[0].Status != database.JobCancelled {
+		t.Fatalf("expected the refused export to be cancelled, got %+v: %v", jobs, err)
+	}
+
+	// The cancelled export is gone, polling it stops
+	session, err := rt.startSession(bob.UserID)
+	if err != nil {
+		t.Fatalf("starting the session: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/users/"+bob.UserID+"/export/"+jobs[0].JobID, nil)
+	r.Header.Set("Authorization", "Bearer "+session.Token)
+	w := httptest.NewRecorder()
+	rt.getExport(w, r, httprouter.Params{{Key: "userId", Value: bob.UserID}, {Key: "jobId", Value: jobs[0].JobID}})
+	var e structs.Error
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || w.Code != http.StatusGone || e.Code != codeExportCancelled {
+		t.Fatalf("expected the cancelled export to be gone, got %d: %s", w.Code, w.Body)
+	}
+}
+
+// TestPurgeExports checks that the archives older than the TTL are removed, and only them
+func TestPurgeExports(t *testing.T) {
+	rt := &_router{exportDirectory: t.TempDir(), exportTTL: time.Hour}
+	old := time.Now().Add(-2 * time.Hour)
+	for name, modified := range map[string]time.Time{
+		"old.zip":      old,
+		"old.zip.part": old,
+		"new.zip":      time.Now(),
+		"new.zip.part": time.Now(),
+		"other.txt":    old,
+	} {
+		path := filepath.Join(rt.exportDirectory, name)
+		err := ioutil.WriteFile(path, nil, 0o600)
+		if err == nil {
+			err = os.Chtimes(path, modified, modified)
+		}
+		if err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+	}
+
+	err := rt.purgeExports()
+	if err != nil {
+		t.Fatalf("purging the exports: %v", err)
+	}
+	entries, err := os.ReadDir(rt.exportDirectory)
+	if err != nil {
+		t.Fatalf("reading the directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	if len(names) != 3 || names[0] != "new.zip" || names[1] != "new.zip.part" || names[2] != "other.txt" {
+		t.Fatalf("expected the recent archives and the other files, got %v", names)
+	}
+
+	// Nothing to purge before the first export
+	rt.exportDirectory = filepath.Join(rt.exportDirectory, "missing")
+	err = rt.purgeExports()
+	if err != nil {
+		t.Fatalf("purging a missing directory: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/attiliov/WASA-Photo/service/contentfilter"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// filterReporterID is the reporter of the reports filed by the content filter for the content it holds for review
+const filterReporterID = ""
+
+// filterReasons maps the rules of the content filter to the reasons of the reports it files, "other" by default
+var filterReasons = map[string]string{
+	contentfilter.RuleBlocklist: "other",
+	contentfilter.RuleLinks:     "spam",
+	contentfilter.RuleRepeated:  "spam",
+}
+
+// filterContent runs the content filter on the text of a post or a comment before it is saved. If the text is
+// rejected it answers the request and returns false, otherwise the decision tells whether the content must be held.
+func (rt *_router) filterContent(w http.ResponseWriter, content contentfilter.Content) (contentfilter.Decision, bool) {
+	if rt.contentFilter == nil {
+		return contentfilter.Decision{Verdict: contentfilter.Accept}, true
+	}
+	decision := rt.contentFilter.Check(content)
+	if decision.Verdict == contentfilter.Reject {
+		writeError(w, http.StatusBadRequest, structs.Error{Code: codeContentRejected, Message: decision.Message, Rule: decision.Rule})
+		return decision, false
+	}
+	return decision, true
+}
+
+// holdForReview hides the saved post or comment held by the content filter, and files a report so that a moderator
+// reviews it. Dismissing the report publishes the content.
+func (rt *_router) holdForReview(kind string, targetID string, authorID string, decision contentfilter.Decision) error {
+	var err error
+	if kind == reportPost {
+		err = rt.db.HoldPost(targetID)
+	} else {
+		err = rt.db.HoldComment(targetID)
+	}
+	if err != nil {
+		return err
+	}
+
+	reason, known := filterReasons[decision.Rule]
+	if !known {
+		reason = "other"
+	}
+	_, err = rt.db.CreateReport(structs.Report{
+		ReporterID:   filterReporterID,
+		TargetType:   kind,
+		TargetID:     targetID,
+		TargetUserID: authorID,
+		Reason:       reason,
+		Details:      decision.Message,
+	})
+	return err
+}
+
+// writeHeld answers a request whose content was saved but held for review
+func writeHeld(w http.ResponseWriter, message string, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(structs.Success{Message: message, Body: body})
+}
@@ -23,24 +23,23 @@ func (rt *_router) getFollowersList(w http.ResponseWriter, r *http.Request, ps h
 	userID := ps.ByName("userId")
 
 	// Check authorization (bearer token not banned from user)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, beaerToken)
 	if err != nil || banned {
 		// If there was an error checking if the user is banned, return a 500 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Get the followers of the specified user
 	followers, err := rt.db.GetFollowersList(userID)
 	if err != nil {
-		// If there was an error getting the followers, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -49,28 +48,23 @@ func (rt *_router) getFollowersList(w http.ResponseWriter, r *http.Request, ps h
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) getFollowingsList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Get the user ID from the URL
 	userID := ps.ByName("userId")
 	// Check authorization (bearer token not banned from user)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, beaerToken)
 	if err != nil || banned {
 		// If there was an error checking if the user is banned, return a 500 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -79,7 +73,7 @@ func (rt *_router) getFollowingsList(w http.ResponseWriter, r *http.Request, ps
 	if err != nil {
 		rt.baseLogger.Println("err:", err)
 		// If there was an error getting the followings, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
@@ -88,12 +82,7 @@ func (rt *_router) getFollowingsList(w http.ResponseWriter, r *http.Request, ps
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -105,10 +94,10 @@ func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprou
 	followingID := ps.ByName("followingId")
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -117,7 +106,7 @@ func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprou
 	if err != nil {
 		rt.baseLogger.Println("err:", err)
 		// If there was an error following the user, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
@@ -126,12 +115,7 @@ func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprou
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -143,10 +127,10 @@ func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httpr
 	followingID := ps.ByName("followingId")
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -155,7 +139,7 @@ func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httpr
 	if err != nil {
 		rt.baseLogger.Println("err:", err)
 		// If there was an error unfollowing the user, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
@@ -164,10 +148,5 @@ func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httpr
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
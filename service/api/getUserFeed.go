@@ -20,10 +20,10 @@ func (rt *_router) getFeed(w http.ResponseWriter, r *http.Request, ps httprouter
 	userID := ps.ByName("userId")
 
 	// Check authorization (a user can request only their own feed)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || userID != beaerToken {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -32,7 +32,7 @@ func (rt *_router) getFeed(w http.ResponseWriter, r *http.Request, ps httprouter
 	if err != nil {
 		rt.baseLogger.Println("Error getting user feed:", err)
 		// If there was an error getting the user feed, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
@@ -41,10 +41,5 @@ func (rt *_router) getFeed(w http.ResponseWriter, r *http.Request, ps httprouter
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
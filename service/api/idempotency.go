@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxIdempotencyKeyLength is the maximum length of the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodySize is the largest body of a request with an Idempotency-Key, read in memory to fingerprint it:
+// the size of the largest photo that can be uploaded
+const maxIdempotentBodySize = maxPhotoSize
+
+// responseRecorder is a http.ResponseWriter keeping a copy of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotencyScope returns the scope of the Idempotency-Key of the request with the given body: the same key can be
+// used in different scopes. It fails if the request is to be handled as if it had no key.
+type idempotencyScope func(r *http.Request, body []byte) (string, error)
+
+// idempotent makes the handler safe to retry with the Idempotency-Key header. The first request with a key is handled
+// and its response is saved for rt.idempotencyTTL. A retry with the same key and the same body gets the saved
+// response, with the Idempotent-Replayed header; a request reusing the key with a different body gets a 422 status,
+// and one sent while the first is still being handled gets a 409 status. Server errors are not saved, so that the
+// request can be retried. Keys are scoped to the user of the session: requests without a valid session are handled
+// as if they had no key, and the handler refuses them.
+func (rt *_router) idempotent(handle httprouter.Handle) httprouter.Handle {
+	return rt.idempotentIn(func(r *http.Request, _ []byte) (string, error) {
+		return rt.sessionUser(r)
+	}, handle)
+}
+
+// idempotentLogin is idempotent for the logins, which have no session yet: their keys are scoped to the submitted
+// username. Requests without a username are handled as if they had no key, and the handler refuses them.
+func (rt *_router) idempotentLogin(handle httprouter.Handle) httprouter.Handle {
+	return rt.idempotentIn(func(_ *http.Request, body []byte) (string, error) {
+		var credentials structs.Credentials
+		err := json.Unmarshal(body, &credentials)
+		if err != nil || credentials.Username == "" {
+			return "", errors.New("no username")
+		}
+		// User IDs, the scopes of the other keys, have no spaces
+		return "login " + credentials.Username, nil
+	}, handle)
+}
+
+// idempotentIn is idempotent with the keys in the scope returned by scopeOf
+func (rt *_router) idempotentIn(scopeOf idempotencyScope, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || rt.idempotencyTTL <= 0 {
+			handle(w, r, ps)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, http.StatusBadRequest, structs.Error{Message: "the Idempotency-Key header is too long"})
+			return
+		}
+
+		// Read the body to fingerprint the request, and put it back for the handler
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+		if err != nil {
+			if int64(len(body)) == maxIdempotentBodySize {
+				// MaxBytesReader returns an error after reading the maximum size
+				writeError(w, http.StatusRequestEntityTooLarge, structs.Error{Message: "the request body is too large"})
+				return
+			}
+			writeStatus(w, http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		scope, err := scopeOf(r, body)
+		if err != nil {
+			handle(w, r, ps)
+			return
+		}
+		fingerprint := requestFingerprint(r, body)
+
+		saved, reserved, err := rt.db.ReserveIdempotencyKey(scope, key, fingerprint, globaltime.Now().Add(-rt.idempotencyTTL))
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error reserving idempotency key")
+			writeStatus(w, http.StatusInternalServerError)
+			return
+		}
+		if !reserved {
+			switch {
+			case saved.Fingerprint != fingerprint:
+				writeError(w, http.StatusUnprocessableEntity, structs.Error{Code: codeIdempotencyReuse, Message: "the Idempotency-Key has already been used for a different request"})
+			case saved.Status == 0:
+				writeError(w, http.StatusConflict, structs.Error{Message: "a request with the same Idempotency-Key is being processed"})
+			default:
+				if saved.ContentType != "" {
+					w.Header().Set("Content-Type", saved.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(saved.Status)
+				_, _ = w.Write(saved.Body)
+			}
+			return
+		}
+
+		// Handle the request and save the response
+		rec := &responseRecorder{ResponseWriter: w}
+		handle(rec, r, ps)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status >= http.StatusInternalServerError {
+			err = rt.db.DeleteIdempotencyKey(scope, key)
+		} else {
+			err = rt.db.SaveIdempotentResponse(scope, key, structs.IdempotentResponse{
+				Fingerprint: fingerprint,
+				Status:      rec.status,
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+			})
+		}
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error saving idempotent response")
+		}
+	}
+}
+
+// requestFingerprint returns a hash of the method, path and body of the request. Multipart bodies are hashed part by
+// part, since clients usually pick a new boundary when they send a request again.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	_, _ = io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		_, _ = hash.Write(body)
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			// End of the body, or a malformed one that the handler will refuse
+			break
+		}
+		_, _ = fmt.Fprintf(hash, "%q %q\n", part.FormName(), part.FileName())
+		_, _ = io.Copy(hash, part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
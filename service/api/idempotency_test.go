@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// TestIdempotentBodySize checks that the body of a request with an Idempotency-Key is read up to the size of the
+// largest photo
+func TestIdempotentBodySize(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	rt := &_router{baseLogger: logger, db: memdb.New(), idempotencyTTL: time.Hour}
+	alice, err := rt.db.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("creating alice: %v", err)
+	}
+	session, err := rt.startSession(alice.UserID)
+	if err != nil {
+		t.Fatalf("starting the session: %v", err)
+	}
+
+	var received int
+	handle := rt.idempotent(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		body, _ := io.ReadAll(r.Body)
+		received = len(body)
+		w.WriteHeader(http.StatusCreated)
+	})
+	for _, tc := range []struct {
+		key    string
+		size   int
+		status int
+	}{
+		{key: "largest", size: maxIdempotentBodySize, status: http.StatusCreated},
+		{key: "too-large", size: maxIdempotentBodySize + 1, status: http.StatusRequestEntityTooLarge},
+	} {
+		received = -1
+		r := httptest.NewRequest(http.MethodPost, "/users/"+alice.UserID+"/photos", bytes.NewReader(make([]byte, tc.size)))
+		r.Header.Set("Authorization", "Bearer "+session.Token)
+		r.Header.Set("Idempotency-Key", tc.key)
+		w := httptest.NewRecorder()
+		handle(w, r, nil)
+		if w.Code != tc.status {
+			t.Fatalf("%s: expected status %d, got %d", tc.key, tc.status, w.Code)
+		}
+		if tc.status == http.StatusCreated && received != tc.size {
+			t.Fatalf("%s: the handler received %d bytes, expected %d", tc.key, received, tc.size)
+		}
+		if tc.status != http.StatusCreated && received != -1 {
+			t.Fatalf("%s: the handler was called", tc.key)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+/*
+	This file contains the handlers for the API endpoints that are used to follow the background jobs of a user
+	i.e. the following endpoints:
+		- GET /users/:userId/jobs/:jobId
+*/
+
+func (rt *_router) getJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	// Get the user ID and the job ID from the URL
+	userID := ps.ByName("userId")
+	jobID := ps.ByName("jobId")
+
+	// Check authorization. Deleted users can follow the deletion of their account, so they are accepted.
+	sessionUserID, err := rt.sessionUser(r)
+	if err != nil || sessionUserID != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Get the job
+	job, err := rt.db.GetJob(jobID)
+	if err != nil || job.UserID != userID {
+		writeStatus(w, http.StatusNotFound)
+		return
+	}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+)
+
+// errJobStopped is returned by the background jobs steps when the router is closing
+var errJobStopped = errors.New("job stopped")
+
+// errJobCancelled is returned by the background jobs steps when the job was cancelled, see AppDatabase.CancelJobs
+var errJobCancelled = errors.New("job cancelled")
+
+// reportProgress records that done out of total steps of the job with the given jobID are complete. It returns
+// errJobStopped if the router is closing, so that the job can stop at a consistent point.
+func (rt *_router) reportProgress(jobID string, done int, total int) error {
+	select {
+	case <-rt.stop:
+		return errJobStopped
+	default:
+	}
+
+	// Keep the last percent for the completion of the job
+	progress := 0
+	if total > 0 {
+		progress = done * 99 / total
+	}
+	err := rt.db.UpdateJob(jobID, database.JobRunning, progress)
+	if err != nil {
+		return fmt.Errorf("updating job progress: %w", err)
+	}
+	return nil
+}
+
+// resumeJobs queues the export jobs that were pending or interrupted the last time the router was closed, in
+// background as they can be more than the queue holds. Account deletion jobs are run by the purge job instead.
+func (rt *_router) resumeJobs() error {
+	jobs, err := rt.db.GetDueJobs(exportJobKind, globaltime.Now())
+	if err != nil {
+		return fmt.Errorf("getting unfinished export jobs: %w", err)
+	}
+	rt.jobs.Add(1)
+	go func() {
+		defer rt.jobs.Done()
+		for _, job := range jobs {
+			select {
+			case <-rt.stop:
+				return
+			case rt.exports <- job:
+			}
+		}
+	}()
+	return nil
+}
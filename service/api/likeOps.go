@@ -28,24 +28,23 @@ func (rt *_router) getPostLikes(w http.ResponseWriter, r *http.Request, ps httpr
 	userID := ps.ByName("userId")
 
 	// Check authorization (bearer token not banned from post owner)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, beaerToken)
 	if err != nil || banned {
 		// If there was an error checking if the user is banned, return a 500 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Get the likes of the specified post
 	likes, err := rt.db.GetPostLikes(postID)
 	if err != nil {
-		// If there was an error getting the likes, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -54,12 +53,7 @@ func (rt *_router) getPostLikes(w http.ResponseWriter, r *http.Request, ps httpr
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) likePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -71,18 +65,17 @@ func (rt *_router) likePost(w http.ResponseWriter, r *http.Request, ps httproute
 	likerID := ps.ByName("likeId")
 
 	// Check authorization i.e. likerID == bearerToken
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != likerID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Like the post
 	err = rt.db.LikePost(postID, likerID)
 	if err != nil {
-		// If there was an error liking the post, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -99,18 +92,17 @@ func (rt *_router) unlikePost(w http.ResponseWriter, r *http.Request, ps httprou
 	likerID := ps.ByName("likeId")
 
 	// Check authorization i.e. likerID == bearerToken
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != likerID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Like the post
 	err = rt.db.UnlikePost(postID, likerID)
 	if err != nil {
-		// If there was an error liking the post, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -127,24 +119,23 @@ func (rt *_router) getCommentLikes(w http.ResponseWriter, r *http.Request, ps ht
 	userID := ps.ByName("userId")
 
 	// Check authorization (bearer token not banned from comment owner)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, beaerToken)
 	if err != nil || banned {
 		// If there was an error checking if the user is banned, return a 500 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Get the likes of the specified post
 	likes, err := rt.db.GetCommentLikes(commentID)
 	if err != nil {
-		// If there was an error getting the likes, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -153,12 +144,7 @@ func (rt *_router) getCommentLikes(w http.ResponseWriter, r *http.Request, ps ht
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) likeComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -170,18 +156,17 @@ func (rt *_router) likeComment(w http.ResponseWriter, r *http.Request, ps httpro
 	likerID := ps.ByName("likeId")
 
 	// Check authorization i.e. likerID == bearerToken
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != likerID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Like the post
 	err = rt.db.LikeComment(commentID, likerID)
 	if err != nil {
-		// If there was an error liking the post, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -198,18 +183,17 @@ func (rt *_router) unlikeComment(w http.ResponseWriter, r *http.Request, ps http
 	likerID := ps.ByName("likeId")
 
 	// Check authorization i.e. likerID == bearerToken
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != likerID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Like the post
 	err = rt.db.UnlikeComment(commentID, likerID)
 	if err != nil {
-		// If there was an error liking the post, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -10,7 +10,7 @@ import (
 func (rt *_router) liveness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	/* Example of liveness check:
 	if err := rt.DB.Ping(); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}*/
 }
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+)
+
+/*
+	This file contains the client of the OpenID Connect provider used to log in, i.e. the authorization code flow with
+	PKCE (RFC 7636): discovery of the provider endpoints, exchange of the authorization code and verification of the
+	ID token.
+*/
+
+// OIDCConfig configures the login through an OpenID Connect provider. The login is disabled if Issuer is empty.
+type OIDCConfig struct {
+	// Issuer is the URL of the provider, the discovery document is at Issuer + "/.well-known/openid-configuration"
+	Issuer string
+
+	// ClientID and ClientSecret identify this server to the provider. ClientSecret is empty for public clients.
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the URL of GET /session/oidc/callback, as registered on the provider
+	RedirectURL string
+
+	// Scopes requested to the provider, "openid" is always added
+	Scopes []string
+
+	// PostLoginRedirect is where the browser is sent after the login, with the session in the "token" and "userId"
+	// fragment parameters. If empty, the callback answers with the session like POST /session.
+	PostLoginRedirect string
+}
+
+// oidcLoginTimeout is how long a login started with GET /session/oidc/login can take
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcMaxPendingLogins is how many logins can wait for the callback of the provider at the same time
+const oidcMaxPendingLogins = 10000
+
+// errTooManyLogins is returned by startLogin when too many logins are waiting for the callback of the provider
+var errTooManyLogins = errors.New("too many pending logins")
+
+// oidcClockSkew is the tolerance used when checking the expiration of ID tokens
+const oidcClockSkew = time.Minute
+
+// oidcLogin is a login started and waiting for the callback of the provider
+type oidcLogin struct {
+	verifier string // PKCE code verifier
+	nonce    string
+	expires  time.Time
+}
+
+// oidcClaims are the claims of the ID token used to identify the user
+type oidcClaims struct {
+	Issuer            string          `json:"iss"`
+	Subject           string          `json:"sub"`
+	Audience          json.RawMessage `json:"aud"` // A string or an array of strings
+	Expiration        int64           `json:"exp"`
+	Nonce             string          `json:"nonce"`
+	Email             string          `json:"email"`
+	EmailVerified     bool            `json:"email_verified"`
+	PreferredUsername string          `json:"preferred_username"`
+}
+
+// oidcProvider is the client of the OpenID Connect provider
+type oidcProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu sync.Mutex
+	// Endpoints from the discovery document, loaded at the first login
+	issuer                string
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+	// keys are the signing keys of the provider by key ID
+	keys map[string]*rsa.PublicKey
+	// logins are the logins waiting for the callback by state, at most maxLogins
+	logins    map[string]oidcLogin
+	maxLogins int
+}
+
+func newOIDCProvider(cfg OIDCConfig) *oidcProvider {
+	return &oidcProvider{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		logins:    make(map[string]oidcLogin),
+		maxLogins: oidcMaxPendingLogins,
+	}
+}
+
+// randomToken returns a random URL-safe string
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// getJSON decodes the JSON document at url into v
+func (p *oidcProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover loads the endpoints of the provider, if not done yet. It must be called with p.mu held.
+func (p *oidcProvider) discover() error {
+	if p.issuer != "" {
+		return nil
+	}
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	err := p.getJSON(strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &doc)
+	if err != nil {
+		return fmt.Errorf("getting discovery document: %w", err)
+	}
+	if doc.Issuer == "" || doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return errors.New("incomplete discovery document")
+	}
+	p.issuer = doc.Issuer
+	p.authorizationEndpoint = doc.AuthorizationEndpoint
+	p.tokenEndpoint = doc.TokenEndpoint
+	p.jwksURI = doc.JWKSURI
+	return nil
+}
+
+// startLogin records a new login and returns the URL of the provider where the user has to be sent, and the state
+// of the login. It returns errTooManyLogins if maxLogins are already waiting.
+func (p *oidcProvider) startLogin() (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := p.discover()
+	if err != nil {
+		return "", "", err
+	}
+	if len(p.logins) >= p.maxLogins {
+		p.purgeLogins()
+		if len(p.logins) >= p.maxLogins {
+			return "", "", errTooManyLogins
+		}
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("generating state: %w", err)
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("generating nonce: %w", err)
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("generating code verifier: %w", err)
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	p.logins[state] = oidcLogin{verifier: verifier, nonce: nonce, expires: globaltime.Now().Add(oidcLoginTimeout)}
+
+	scopes := []string{"openid"}
+	for _, scope := range p.cfg.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.authorizationEndpoint + separator + query.Encode(), state, nil
+}
+
+// purgeLogins forgets the logins never completed. It must be called with p.mu held.
+func (p *oidcProvider) purgeLogins() {
+	for state, login := range p.logins {
+		if globaltime.Now().After(login.expires) {
+			delete(p.logins, state)
+		}
+	}
+}
+
+// purgeExpiredLogins forgets the logins never completed, the purge job calls it so that they don't wait for the
+// next login to reach maxLogins
+func (p *oidcProvider) purgeExpiredLogins() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.purgeLogins()
+}
+
+// finishLogin exchanges the authorization code of the login with the given state, and returns the verified claims
+// of the ID token
+func (p *oidcProvider) finishLogin(state string, code string) (oidcClaims, error) {
+	var claims oidcClaims
+
+	p.mu.Lock()
+	login, ok := p.logins[state]
+	delete(p.logins, state)
+	tokenEndpoint := p.tokenEndpoint
+	p.mu.Unlock()
+	if !ok || globaltime.Now().After(login.expires) {
+		return claims, errors.New("unknown or expired login")
+	}
+
+	// Exchange the authorization code
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {login.verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return claims, fmt.Errorf("creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return claims, fmt.Errorf("exchanging authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return claims, fmt.Errorf("unexpected status %d from token endpoint", resp.StatusCode)
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return claims, fmt.Errorf("decoding token response: %w", err)
+	}
+
+	claims, err = p.verify(token.IDToken)
+	if err != nil {
+		return claims, fmt.Errorf("verifying ID token: %w", err)
+	}
+	if claims.Nonce != login.nonce {
+		return claims, errors.New("wrong nonce in ID token")
+	}
+	return claims, nil
+}
+
+// verify checks the signature (RS256 only), the issuer, the audience and the expiration of the ID token, and
+// returns its claims
+func (p *oidcProvider) verify(idToken string) (oidcClaims, error) {
+	var claims oidcClaims
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("malformed token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return claims, fmt.Errorf("decoding header: %w", err)
+	}
+	if header.Algorithm != "RS256" {
+		return claims, fmt.Errorf("unsupported signing algorithm %q", header.Algorithm)
+	}
+	key, err := p.key(header.KeyID)
+	if err != nil {
+		return claims, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("decoding signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return claims, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return claims, fmt.Errorf("decoding claims: %w", err)
+	}
+	p.mu.Lock()
+	issuer := p.issuer
+	p.mu.Unlock()
+	if claims.Issuer != issuer {
+		return claims, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if !claims.hasAudience(p.cfg.ClientID) {
+		return claims, errors.New("token not issued for this client")
+	}
+	if globaltime.Now().After(time.Unix(claims.Expiration, 0).Add(oidcClockSkew)) {
+		return claims, errors.New("token expired")
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("missing subject")
+	}
+	return claims, nil
+}
+
+// key returns the signing key with the given key ID, reloading the keys of the provider if it is unknown (the
+// provider may have rotated them)
+func (p *oidcProvider) key(keyID string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[keyID]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	err := p.getJSON(p.jwksURI, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("getting signing keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.KeyType != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", keyID)
+	}
+	return key, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// hasAudience returns true if the token was issued for the given client
+func (c oidcClaims) hasAudience(clientID string) bool {
+	var audience string
+	if json.Unmarshal(c.Audience, &audience) == nil {
+		return audience == clientID
+	}
+	var audiences []string
+	if json.Unmarshal(c.Audience, &audiences) == nil {
+		for _, a := range audiences {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
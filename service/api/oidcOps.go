@@ -0,0 +1,199 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/attiliov/WASA-Photo/service/usernames"
+	"github.com/julienschmidt/httprouter"
+)
+
+/*
+	This file contains the handlers for the API endpoints that are used to log in through the OpenID Connect provider
+	i.e. the following endpoints:
+		- GET /session/oidc/login
+		- GET /session/oidc/callback
+*/
+
+// oidcUsernameAttempts is how many random suffixes are tried when the username suggested by the provider is taken
+const oidcUsernameAttempts = 10
+
+// oidcStateCookie is the cookie binding a login to the browser that started it: the callback is refused if the
+// state in the query string is not the one of the cookie, so that a login can't be finished in another browser
+const oidcStateCookie = "wasa_oidc_state"
+
+// oidcStateCookiePath is the path of the state cookie, it is only sent to the callback
+const oidcStateCookiePath = "/session/oidc"
+
+func (rt *_router) startOIDCLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Record the login and get the page of the provider
+	location, state, err := rt.oidc.startLogin()
+	if errors.Is(err, errTooManyLogins) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(oidcLoginTimeout.Seconds())))
+		writeStatus(w, http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		rt.baseLogger.WithError(err).Error("error starting OIDC login")
+		writeStatus(w, http.StatusBadGateway)
+		return
+	}
+
+	// Bind the login to the browser. Lax, as the provider sends the browser back with a cross-site redirect.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		MaxAge:   int(oidcLoginTimeout.Seconds()),
+		Secure:   strings.HasPrefix(rt.oidc.cfg.RedirectURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// Send the user to the provider
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+func (rt *_router) finishOIDCLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+
+	// The provider reports errors (e.g. the user refused the login) in the query string
+	if providerError := query.Get("error"); providerError != "" {
+		writeError(w, http.StatusUnauthorized, structs.Error{Message: "login refused: " + providerError})
+		return
+	}
+
+	// The login must have been started by this browser. The cookie is not needed anymore.
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcStateCookiePath, MaxAge: -1})
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		writeError(w, http.StatusUnauthorized, structs.Error{Message: "login not started by this browser"})
+		return
+	}
+
+	// Exchange the authorization code and verify the identity of the user
+	claims, err := rt.oidc.finishLogin(state, query.Get("code"))
+	if err != nil {
+		rt.baseLogger.WithError(err).Warn("OIDC login failed")
+		writeError(w, http.StatusUnauthorized, structs.Error{Message: "login failed"})
+		return
+	}
+
+	// Get the user linked to the identity, creating it if needed
+	user, err := rt.oidcUser(claims)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error getting OIDC user")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Suspended users can't log in
+	suspended, err := rt.db.IsSuspended(user.UserID)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error checking suspension")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+	if suspended {
+		writeError(w, http.StatusForbidden, structs.Error{Message: errAccountSuspended.Error()})
+		return
+	}
+
+	// Start the session
+	session, err := rt.startSession(user.UserID)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error starting session")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Send the browser back to the web app, if configured. The fragment is not sent to the server of the web app.
+	if rt.oidcPostLoginRedirect != "" {
+		fragment := url.Values{"token": {session.Token}, "userId": {session.UserID}}
+		http.Redirect(w, r, rt.oidcPostLoginRedirect+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	// Otherwise return the session in the response body, as POST /session
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(session)
+}
+
+// oidcUser returns the user linked to the identity in the claims. An identity seen for the first time is linked to
+// the user with the same verified email, or to a new user.
+func (rt *_router) oidcUser(claims oidcClaims) (structs.User, error) {
+	// Identity already linked
+	userID, err := rt.db.GetIdentityUser(claims.Issuer, claims.Subject)
+	if err == nil {
+		return rt.db.GetUser(userID)
+	}
+
+	// Existing user with the same verified email
+	verifiedEmail := ""
+	if claims.EmailVerified {
+		verifiedEmail = claims.Email
+	}
+	user, err := rt.db.GetUserByEmail(verifiedEmail)
+	if verifiedEmail == "" || err != nil {
+		// New user
+		user, err = rt.createOIDCUser(claims)
+		if err != nil {
+			return user, err
+		}
+		if verifiedEmail != "" {
+			err = rt.db.SetUserEmail(user.UserID, verifiedEmail)
+			if err != nil {
+				return user, err
+			}
+		}
+	}
+
+	err = rt.db.LinkIdentity(claims.Issuer, claims.Subject, user.UserID)
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// createOIDCUser creates a user with the username suggested by the provider, or a similar available one
+func (rt *_router) createOIDCUser(claims oidcClaims) (structs.User, error) {
+	suggested := claims.PreferredUsername
+	if suggested == "" {
+		suggested = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	// Keep the characters allowed in usernames
+	base := strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' {
+			return c
+		}
+		return -1
+	}, suggested)
+	if len(base) > usernames.MaxLength-5 {
+		base = base[:usernames.MaxLength-5]
+	}
+	for len(base) < usernames.MinLength {
+		base += "_"
+	}
+
+	username := base
+	for i := 0; i < oidcUsernameAttempts; i++ {
+		status, err := rt.checkUsername(username, "")
+		if err == nil {
+			return rt.db.CreateUser(username)
+		}
+		if status == http.StatusInternalServerError {
+			return structs.User{}, err
+		}
+		username = fmt.Sprintf("%s%04d", base, rand.Intn(10000)) // #nosec G404 -- not a secret
+	}
+	return structs.User{}, fmt.Errorf("no available username for %q", suggested)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+)
+
+// TestOIDCPendingLogins checks that the logins waiting for the provider are capped, and that the expired ones are
+// forgotten
+func TestOIDCPendingLogins(t *testing.T) {
+	provider := newOIDCTestProvider(t)
+	p := newOIDCProvider(OIDCConfig{Issuer: provider.server.URL, ClientID: "wasa", RedirectURL: "http://localhost/session/oidc/callback"})
+	p.maxLogins = 2
+
+	globaltime.FixedTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	defer func() { globaltime.FixedTime = time.Time{} }()
+
+	for i := 0; i < 2; i++ {
+		_, _, err := p.startLogin()
+		if err != nil {
+			t.Fatalf("starting login %d: %v", i, err)
+		}
+	}
+	_, _, err := p.startLogin()
+	if !errors.Is(err, errTooManyLogins) {
+		t.Fatalf("expected too many logins, got %v", err)
+	}
+
+	// The expired logins make room for the new ones
+	globaltime.FixedTime = globaltime.FixedTime.Add(oidcLoginTimeout + time.Second)
+	_, _, err = p.startLogin()
+	if err != nil {
+		t.Fatalf("starting a login after the expiration: %v", err)
+	}
+	if len(p.logins) != 1 {
+		t.Fatalf("expected only the new login, got %d", len(p.logins))
+	}
+
+	// The purge job forgets them too
+	globaltime.FixedTime = globaltime.FixedTime.Add(oidcLoginTimeout + time.Second)
+	p.purgeExpiredLogins()
+	if len(p.logins) != 0 {
+		t.Fatalf("expected no login, got %d", len(p.logins))
+	}
+}
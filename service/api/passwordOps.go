@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*
+	This file contains the handlers for the API endpoints that are used to manage the credentials of the users
+	i.e. the following endpoints:
+		- POST /session/claim
+		- PUT /users/:userId/password
+*/
+
+// Length limits of a password. bcrypt ignores everything after the 72nd byte.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// passwordRule is the name of the rule violated by invalid passwords, see structs.Error
+const passwordRule = "password"
+
+// errWrongCredentials is returned by checkCredentials when the user can't log in with the given password
+var errWrongCredentials = errors.New("wrong username or password")
+
+// errUnclaimedAccount is returned by checkCredentials when the user has no password and must claim the account
+var errUnclaimedAccount = errors.New("the account has no password, log in with the username alone and claim it with POST /session/claim")
+
+// errAccountSuspended is returned by checkCredentials when the user is suspended
+var errAccountSuspended = errors.New("the account is suspended")
+
+// validatePassword checks that password follows the length rules
+func validatePassword(password string) *structs.Error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return &structs.Error{Code: codeInvalidPassword, Message: "password must be between 8 and 72 bytes long", Rule: passwordRule}
+	}
+	return nil
+}
+
+// hashPassword returns the hash of the password to store in the database
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// checkCredentials checks that the user with the given userID can log in with the given password (empty for a
+// username-only login). It returns errWrongCredentials, errUnclaimedAccount or errAccountSuspended if they can't.
+func (rt *_router) checkCredentials(userID string, password string) error {
+	hash, err := rt.db.GetPasswordHash(userID)
+	if err != nil {
+		return err
+	}
+	suspended, err := rt.db.IsSuspended(userID)
+	if err != nil {
+		return err
+	}
+
+	// Username-only account
+	if hash == "" {
+		if password != "" || !rt.usernameOnlyLogin {
+			return errUnclaimedAccount
+		}
+	} else if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return errWrongCredentials
+	}
+
+	// Tell suspended users why they can't log in, once they proved who they are
+	if suspended {
+		return errAccountSuspended
+	}
+	return nil
+}
+
+// claimAccount sets the password of a username-only account. The user must be logged in, i.e. have logged in with
+// the username alone.
+func (rt *_router) claimAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Parse and decode the request body into a Credentials object
+	var credentials structs.Credentials
+	err := json.NewDecoder(r.Body).Decode(&credentials)
+	if err != nil {
+		// If there is something wrong with the request body, return a 400 status
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	// Check the new password
+	if invalid := validatePassword(credentials.Password); invalid != nil {
+		writeError(w, http.StatusBadRequest, *invalid)
+		return
+	}
+
+	// Get the user from the database
+	user, err := rt.db.GetUser(credentials.Username)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Only the user can claim their account. Suspended users are refused too.
+	userID, err := rt.authenticate(r)
+	if err != nil || userID != user.UserID {
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Save the password, unless the account was claimed in the meantime
+	hash, err := hashPassword(credentials.Password)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error hashing password")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+	err = rt.db.ClaimAccount(user.UserID, hash)
+	if errors.Is(err, database.ErrConflict) {
+		writeError(w, http.StatusConflict, structs.Error{Message: "the account has already been claimed"})
+		return
+	} else if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Return the user's ID in the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(user.UserID)
+}
+
+func (rt *_router) changePassword(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Parse and decode the request body into a PasswordChange object
+	var change structs.PasswordChange
+	err := json.NewDecoder(r.Body).Decode(&change)
+	if err != nil {
+		// If there is something wrong with the request body, return a 400 status
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	// Check that the beaer in the body matches the user ID in the URL (authorized operation)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil || beaerToken != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Check the new password
+	if invalid := validatePassword(change.Password); invalid != nil {
+		writeError(w, http.StatusBadRequest, *invalid)
+		return
+	}
+
+	// If the user already has a password, the current one is required
+	hash, err := rt.db.GetPasswordHash(userID)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error getting password hash")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+	if hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(change.CurrentPassword)) != nil {
+		writeError(w, http.StatusUnauthorized, structs.Error{Message: errWrongCredentials.Error()})
+		return
+	}
+
+	// Save the new password
+	hash, err = hashPassword(change.Password)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error hashing password")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+	err = rt.db.SetPasswordHash(userID, hash)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error setting password hash")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "Password changed successfully"}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -15,25 +15,28 @@ import (
 		- DELETE /users/:userId/photos/:photoId
 */
 
+// maxPhotoSize is the size of the largest photo that can be uploaded, in bytes
+const maxPhotoSize = 10 << 20
+
 func (rt *_router) savePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	rt.baseLogger.Println("savePhoto called")
 	// Get the user ID from the URL
 	userID := ps.ByName("userId")
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
 		// rt.baseLogger.Println("savePhoto called: 401")
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Parse the multipart form in the request
-	err = r.ParseMultipartForm(10 << 20) // Max memory 10MB
+	err = r.ParseMultipartForm(maxPhotoSize) // Max memory 10MB
 	if err != nil {
 		// rt.baseLogger.Println("savePhoto called: 400")
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
 		return
 	}
 
@@ -41,7 +44,7 @@ func (rt *_router) savePhoto(w http.ResponseWriter, r *http.Request, ps httprout
 	file, _, err := r.FormFile("photo") // "photo" is the key of the form data
 	if err != nil {
 		// rt.baseLogger.Println("savePhoto called: 400")
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
@@ -49,23 +52,15 @@ func (rt *_router) savePhoto(w http.ResponseWriter, r *http.Request, ps httprout
 	// Upload the photo
 	id, err := rt.db.SavePhoto(userID, file)
 	if err != nil {
-		// If there was an error uploading the photo, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		// rt.baseLogger.Println("Error saving photo: ", err)
 		return
 	}
 
 	// Set the header and write the response body
-	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(id)
-	// rt.baseLogger.Println("id: ", id)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		// rt.baseLogger.Println("Error encoding response: ", err)
-		return
-	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(id)
 }
 
 func (rt *_router) getPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -80,9 +75,7 @@ func (rt *_router) getPhoto(w http.ResponseWriter, r *http.Request, ps httproute
 	// Get the photo
 	photo, err := rt.db.GetPhoto(userID, photoID)
 	if err != nil {
-		// If there was an error getting the photo, return a 500 status
-		rt.baseLogger.Println("Error getting photo: ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -91,10 +84,8 @@ func (rt *_router) getPhoto(w http.ResponseWriter, r *http.Request, ps httproute
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(photo)
 	if err != nil {
-		// If there was an error writing the response, return a 500 status
+		// The response has already started, the error can only be logged
 		rt.baseLogger.Println("Error writing response: ", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
 	}
 }
 
@@ -105,19 +96,17 @@ func (rt *_router) deletePhoto(w http.ResponseWriter, r *http.Request, ps httpro
 	photoID := ps.ByName("photoId")
 
 	// Check authorization
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Delete the photo
 	err = rt.db.DeletePhoto(userID, photoID)
 	if err != nil {
-		// If there was an error deleting the photo, return a 500 status
-		rt.baseLogger.Println("Error deleting photo: ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
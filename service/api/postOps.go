@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/json"
+	"github.com/attiliov/WASA-Photo/service/contentfilter"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
 	"github.com/attiliov/WASA-Photo/service/structs"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
@@ -13,8 +15,10 @@ import (
 		- GET /users/userId/posts
 		- POST /users/userId/posts
 		- PUT /users/userId/posts/postId
+		- PATCH /users/userId/posts/postId
 		- DELETE /users/userId/posts/postId
 		- GET /users/userId/posts/postId
+		- POST /users/userId/posts/postId/restore
 */
 
 func (rt *_router) getUserPosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -22,23 +26,22 @@ func (rt *_router) getUserPosts(w http.ResponseWriter, r *http.Request, ps httpr
 	userID := ps.ByName("userId")
 
 	// Check that that the bearer is not banned from post owner
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, beaerToken) // isBanned(userID, beaerToken) returns true if the bearer is banned from the user with the given ID
 	if err != nil || banned {
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Get the posts of the specified user
 	posts_id, err := rt.db.GetUserPosts(userID) // getUserPosts(userID) returns the list of post IDs of the given user
 	if err != nil {
-		// If there was an error getting the posts, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -47,12 +50,7 @@ func (rt *_router) getUserPosts(w http.ResponseWriter, r *http.Request, ps httpr
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) createPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -64,23 +62,42 @@ func (rt *_router) createPost(w http.ResponseWriter, r *http.Request, ps httprou
 	err := json.NewDecoder(r.Body).Decode(&post)
 	if err != nil {
 		// If there is something wrong with the request body, return a 400 status
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
 		return
 	}
+	// The creation date is the one of the server, not the one sent by the client
+	post.CreationDate = globaltime.Now()
 
 	// Check that the beaer in the body matches the user ID in the URL (authorized operation)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Check the caption with the content filter
+	decision, ok := rt.filterContent(w, contentfilter.Content{AuthorID: userID, Kind: reportPost, Text: post.Caption})
+	if !ok {
 		return
 	}
 
 	// Create a new post in the database
 	post_id, err := rt.db.AddPost(post) // createPost(userID, post) returns the post ID of the created post
 	if err != nil {
-		// If there was an error creating the post, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Hide the post until a moderator reviews it, if the content filter asks so
+	if decision.Verdict == contentfilter.Hold {
+		err = rt.holdForReview(reportPost, post_id.ResourceID, userID, decision)
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error holding post for review")
+			writeStatus(w, http.StatusInternalServerError)
+			return
+		}
+		writeHeld(w, "Post held for review: "+decision.Message, post_id)
 		return
 	}
 
@@ -89,12 +106,8 @@ func (rt *_router) createPost(w http.ResponseWriter, r *http.Request, ps httprou
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) getPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -103,34 +116,29 @@ func (rt *_router) getPost(w http.ResponseWriter, r *http.Request, ps httprouter
 	postID := ps.ByName("postId")
 
 	// Check that that the bearer is not banned from post owner
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, beaerToken) // isBanned(userID, beaerToken) returns true if the bearer is banned from the user with the given ID
 	if err != nil || banned {
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Get the post with the specified ID
 	post, err := rt.db.GetPost(postID) // getPost(userID, postID) returns the post with the given ID
 	if err != nil {
-		// If there was an error getting the post, return a 404 status
-		w.WriteHeader(http.StatusNotFound)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
 	// Set the header and write the response body
+	setETag(w, post.Version)
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(post)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(post)
 }
 
 func (rt *_router) editPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -144,23 +152,94 @@ func (rt *_router) editPost(w http.ResponseWriter, r *http.Request, ps httproute
 	if err != nil {
 		rt.baseLogger.Println("error decoding request body", err)
 		// If there is something wrong with the request body, return a 400 status
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
 		return
 	}
 
 	// Check that the beaer in the body matches the user ID in the URL (authorized operation)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Get the current version of the post
+	current, err := rt.db.GetPost(postID)
+	if err != nil || current.AuthorID != userID {
+		// If the post does not exist or is not of the user, return a 404 status
+		writeStatus(w, http.StatusNotFound)
+		return
+	}
+
+	// Check that the request replaces the current version
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	rt.savePost(w, current, post)
+}
+
+func (rt *_router) patchPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID and post ID from the URL
+	userID := ps.ByName("userId")
+	postID := ps.ByName("postId")
+
+	// Check that the beaer matches the user ID in the URL (authorized operation)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil || beaerToken != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Get the current version of the post
+	current, err := rt.db.GetPost(postID)
+	if err != nil || current.AuthorID != userID {
+		// If the post does not exist or is not of the user, return a 404 status
+		writeStatus(w, http.StatusNotFound)
 		return
 	}
 
-	// Update the post with the specified ID
-	err = rt.db.UpdatePost(postID, post) // updatePost(postID, post) returns an error if the post does not exist
+	// Check that the request is based on the current version, if the client sent it
+	if !checkIfMatch(w, r, current.Version, false) {
+		return
+	}
+
+	// Apply the patch in the request body to the current post
+	var post structs.UserPost
+	if !decodeMergePatch(w, r, &current, &post) {
+		return
+	}
+
+	rt.savePost(w, current, post)
+}
+
+// savePost replaces the current version of a post with the edited one
+func (rt *_router) savePost(w http.ResponseWriter, current structs.UserPost, post structs.UserPost) {
+	// Check the new caption with the content filter
+	decision, ok := rt.filterContent(w, contentfilter.Content{AuthorID: current.AuthorID, Kind: reportPost, Text: post.Caption, Edit: true})
+	if !ok {
+		return
+	}
+
+	// Update the post, unless it was edited in the meantime
+	version, err := rt.db.UpdatePost(current.PostID, post, current.Version)
 	if err != nil {
-		// If there was an error updating the post, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
+		return
+	}
+	setETag(w, version)
+
+	// Hide the post until a moderator reviews it, if the content filter asks so
+	if decision.Verdict == contentfilter.Hold {
+		err = rt.holdForReview(reportPost, current.PostID, current.AuthorID, decision)
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error holding post for review")
+			writeStatus(w, http.StatusInternalServerError)
+			return
+		}
+		writeHeld(w, "Post held for review: "+decision.Message, nil)
 		return
 	}
 
@@ -169,12 +248,7 @@ func (rt *_router) editPost(w http.ResponseWriter, r *http.Request, ps httproute
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) deletePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -183,18 +257,17 @@ func (rt *_router) deletePost(w http.ResponseWriter, r *http.Request, ps httprou
 	postID := ps.ByName("postId")
 
 	// Check that the beaer in the body matches the user ID in the URL (authorized operation)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Delete the post with the specified ID
 	err = rt.db.DeletePost(postID) // deletePost(postID) returns an error if the post does not exist
 	if err != nil {
-		// If there was an error deleting the post, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -203,10 +276,33 @@ func (rt *_router) deletePost(w http.ResponseWriter, r *http.Request, ps httprou
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) restorePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID and post ID from the URL
+	userID := ps.ByName("userId")
+	postID := ps.ByName("postId")
+
+	// Check that the beaer in the body matches the user ID in the URL (authorized operation)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil || beaerToken != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Restore the post if it belongs to the user and it is still in the grace period
+	err = rt.db.RestorePost(postID, userID, rt.restoreDeadline())
 	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
+
+	// Create a response object
+	response := structs.Success{Message: "Post restored successfully"}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
 }
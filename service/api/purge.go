@@ -0,0 +1,49 @@
+package api
+
+import (
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+)
+
+// purgeDeleted is the background job that periodically removes for good the posts and comments whose deletion grace
+// period is over, the expired idempotency keys, export archives and OIDC logins, and runs the due account deletion
+// jobs. It runs until rt.stop is closed.
+func (rt *_router) purgeDeleted(interval time.Duration) {
+	defer rt.jobs.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := rt.db.PurgeDeleted(globaltime.Now().Add(-rt.deletionGracePeriod))
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error purging deleted resources")
+		}
+		err = rt.db.PurgeIdempotencyKeys(globaltime.Now().Add(-rt.idempotencyTTL))
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("error purging idempotency keys")
+		}
+		if rt.exportTTL > 0 {
+			err = rt.purgeExports()
+			if err != nil {
+				rt.baseLogger.WithError(err).Error("error purging export archives")
+			}
+		}
+		if rt.oidc != nil {
+			rt.oidc.purgeExpiredLogins()
+		}
+		rt.runAccountDeletions()
+
+		select {
+		case <-rt.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// restoreDeadline returns the oldest deletion time that can still be restored
+func (rt *_router) restoreDeadline() time.Time {
+	return globaltime.Now().Add(-rt.deletionGracePeriod)
+}
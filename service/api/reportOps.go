@@ -0,0 +1,532 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/julienschmidt/httprouter"
+)
+
+/*
+	This file contains the handlers for the API endpoints that are used to report posts, comments and users, and the
+	moderation queue where moderators handle the reports.
+	i.e. the following endpoints:
+		- POST /users/:userId/posts/:postId/reports
+		- POST /users/:userId/posts/:postId/comments/:commentId/reports
+		- POST /users/:userId/reports
+		- GET /users/:userId/warnings
+		- GET /admin/reports (moderator)
+		- GET /admin/reports/:reportId (moderator)
+		- POST /admin/reports/:reportId/claim (moderator)
+		- POST /admin/reports/:reportId/resolve (moderator)
+		- POST /admin/reports/:reportId/dismiss (moderator)
+*/
+
+// Types of the reported resources
+const (
+	reportPost    = "post"
+	reportComment = "comment"
+	reportUser    = "user"
+)
+
+// reportReasons is the taxonomy of the reasons a report can be filed for
+var reportReasons = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate":           true,
+	"violence":       true,
+	"nudity":         true,
+	"self-harm":      true,
+	"misinformation": true,
+	"impersonation":  true,
+	"other":          true,
+}
+
+// Actions a moderator can resolve a report with
+const (
+	resolutionHide    = "hide"
+	resolutionDelete  = "delete"
+	resolutionWarn    = "warn"
+	resolutionSuspend = "suspend"
+)
+
+// maxReportDetailsLength is the maximum length of the free text of a report
+const maxReportDetailsLength = 1000
+
+// Actions recorded in the audit log
+const (
+	auditClaimReport   = "claim-report"
+	auditResolveReport = "resolve-report"
+	auditDismissReport = "dismiss-report"
+)
+
+func (rt *_router) reportPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the post ID from the URL
+	postID := ps.ByName("postId")
+
+	// Get the reported post
+	post, err := rt.db.GetPost(postID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	rt.fileReport(w, r, structs.Report{TargetType: reportPost, TargetID: postID, TargetUserID: post.AuthorID})
+}
+
+func (rt *_router) reportComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the comment ID from the URL
+	commentID := ps.ByName("commentId")
+
+	// Get the reported comment
+	comment, err := rt.db.GetComment(commentID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	rt.fileReport(w, r, structs.Report{TargetType: reportComment, TargetID: commentID, TargetUserID: comment.AuthorID})
+}
+
+func (rt *_router) reportUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check that the reported user exists
+	active, err := rt.db.IsActiveUser(userID)
+	if err != nil || !active {
+		// User not found, return a 404 status
+		writeStatus(w, http.StatusNotFound)
+		return
+	}
+
+	rt.fileReport(w, r, structs.Report{TargetType: reportUser, TargetID: userID, TargetUserID: userID})
+}
+
+// fileReport creates the report of the given target with the reason in the request body, on behalf of the requester
+func (rt *_router) fileReport(w http.ResponseWriter, r *http.Request, report structs.Report) {
+	// Get the reporter
+	reporterID, err := rt.authenticate(r)
+	if err != nil {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Parse and decode the request body into a Report object
+	var body structs.Report
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		// If there is something wrong with the request body, return a 400 status
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+	if !reportReasons[body.Reason] {
+		writeError(w, http.StatusBadRequest, structs.Error{Message: "unknown reason"})
+		return
+	}
+	if len(body.Details) > maxReportDetailsLength {
+		writeError(w, http.StatusBadRequest, structs.Error{Message: "details must be at most 1000 characters long"})
+		return
+	}
+
+	// Users can't report themselves or their own content
+	if report.TargetUserID == reporterID {
+		writeError(w, http.StatusBadRequest, structs.Error{Message: "you can't report yourself"})
+		return
+	}
+
+	// Users can't report the same thing twice while the first report is waiting
+	pending, err := rt.db.HasOpenReport(reporterID, report.TargetID)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error checking open reports")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+	if pending {
+		writeError(w, http.StatusConflict, structs.Error{Message: "you already reported this"})
+		return
+	}
+
+	// Create the report
+	report.ReporterID = reporterID
+	report.Reason = body.Reason
+	report.Details = body.Details
+	report, err = rt.db.CreateReport(report)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error creating report")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+func (rt *_router) getUserWarnings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check that the beaer in the body matches the user ID in the URL (authorized operation)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil || beaerToken != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Get the warnings
+	warnings, err := rt.db.GetUserWarnings(userID)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error getting warnings")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.WarningCollection{Warnings: warnings}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) listReports(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Check that the requester is a moderator
+	_, _, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Get the requested status and page
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", database.ReportOpen, database.ReportClaimed, database.ReportResolved, database.ReportDismissed:
+	default:
+		writeError(w, http.StatusBadRequest, structs.Error{Message: "invalid status"})
+		return
+	}
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, structs.Error{Message: err.Error()})
+		return
+	}
+
+	// Get the reports
+	reports, err := rt.db.GetReports(status, offset, limit)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error getting reports")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.ReportCollection{Reports: reports}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) getReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the report ID from the URL
+	reportID := ps.ByName("reportId")
+
+	// Check that the requester is a moderator
+	_, _, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Get the report
+	report, err := rt.db.GetReport(reportID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// pendingReport returns the report with the given reportID if the moderator moderatorID can handle it, i.e. if it is
+// open or claimed by them. Otherwise it answers the request and returns false.
+func (rt *_router) pendingReport(w http.ResponseWriter, reportID string, moderatorID string) (structs.Report, bool) {
+	report, err := rt.db.GetReport(reportID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return report, false
+	}
+	switch {
+	case report.Status == database.ReportOpen:
+	case report.Status == database.ReportClaimed && report.ModeratorID == moderatorID:
+	case report.Status == database.ReportClaimed:
+		writeError(w, http.StatusConflict, structs.Error{Message: "the report has been claimed by another moderator"})
+		return report, false
+	default:
+		writeError(w, http.StatusConflict, structs.Error{Message: "the report is already closed"})
+		return report, false
+	}
+	return report, true
+}
+
+func (rt *_router) claimReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the report ID from the URL
+	reportID := ps.ByName("reportId")
+
+	// Check that the requester is a moderator
+	actorID, _, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Check that the report can be claimed
+	if _, ok := rt.pendingReport(w, reportID, actorID); !ok {
+		return
+	}
+
+	// Claim the report
+	err = rt.audited(actorID, auditClaimReport, reportID, "", func(db database.AppDatabase) error {
+		return db.ClaimReport(reportID, actorID)
+	})
+	if err != nil {
+		// Claimed by someone else in the meantime, return a 409 status
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "Report claimed successfully"}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) resolveReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the report ID from the URL
+	reportID := ps.ByName("reportId")
+
+	// Check that the requester is a moderator
+	actorID, actorRole, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Parse and decode the request body into a Resolution object
+	var resolution structs.Resolution
+	err = json.NewDecoder(r.Body).Decode(&resolution)
+	if err != nil {
+		// If there is something wrong with the request body, return a 400 status
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	// Check that the report can be resolved
+	report, ok := rt.pendingReport(w, reportID, actorID)
+	if !ok {
+		return
+	}
+
+	// Close the report, then apply the action, in a single transaction: closing the report fails if another moderator
+	// closed it in the meantime, and the action is undone if it fails
+	status := http.StatusOK
+	var photos []string
+	err = rt.audited(actorID, auditResolveReport, reportID, resolution.Action, func(db database.AppDatabase) error {
+		err := db.CloseReport(reportID, actorID, database.ReportResolved, resolution.Action, resolution.Note)
+		if err != nil {
+			return err
+		}
+		status, err = rt.applyResolution(db, report, resolution, actorID, actorRole, &photos)
+		if err == nil && report.ReporterID == filterReporterID && (resolution.Action == resolutionWarn || resolution.Action == resolutionSuspend) {
+			// Content held by the content filter stays hidden when the report is resolved
+			status, err = rt.applyResolution(db, report, structs.Resolution{Action: resolutionHide}, actorID, actorRole, &photos)
+		}
+		return err
+	})
+	switch {
+	case err == nil:
+	case status == http.StatusInternalServerError:
+		rt.baseLogger.WithError(err).WithField("action", resolution.Action).Error("error resolving report")
+		writeStatus(w, status)
+		return
+	case status != http.StatusOK:
+		writeError(w, status, structs.Error{Message: err.Error()})
+		return
+	default:
+		// Closed by another moderator in the meantime, return a 409 status
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Remove the photo files of the purged post, now that the purge is committed. A missing file was already removed,
+	// and the resolution stands even if a file can't be removed.
+	for _, photoID := range photos {
+		err = rt.db.DeletePhoto("", photoID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			rt.baseLogger.WithError(err).WithField("photo", photoID).Error("error removing the photo of a purged post")
+		}
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "Report resolved successfully", Body: resolution}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// statusError is a shorthand to return a status code with an error message
+func statusError(status int, message string) (int, error) {
+	return status, errors.New(message)
+}
+
+// applyResolution applies the action of the resolution to the target of the report through db. It returns the status
+// code to answer with if it fails. The photos of the purged post are added to photos, their files are to be removed
+// once db is committed.
+func (rt *_router) applyResolution(db database.AppDatabase, report structs.Report, resolution structs.Resolution, actorID string, actorRole string, photos *[]string) (int, error) {
+	switch resolution.Action {
+	case resolutionHide:
+		// Remove the content, the author can't restore it
+		var err error
+		switch report.TargetType {
+		case reportPost:
+			err = db.RemovePost(report.TargetID, actorID)
+		case reportComment:
+			err = db.RemoveComment(report.TargetID, actorID)
+		default:
+			return statusError(http.StatusBadRequest, "users can't be hidden, suspend them instead")
+		}
+		if err != nil {
+			return statusError(http.StatusNotFound, "the content is already deleted")
+		}
+
+	case resolutionDelete:
+		// Remove the content and purge it without waiting for the grace period. The author may already have
+		// deleted it, so removing it is allowed not to find it.
+		var err error
+		switch report.TargetType {
+		case reportPost:
+			err = db.RemovePost(report.TargetID, actorID)
+			if err == nil || errors.Is(err, database.ErrNotFound) {
+				var purged []string
+				purged, err = db.PurgePost(report.TargetID)
+				*photos = append(*photos, purged...)
+			}
+		case reportComment:
+			err = db.RemoveComment(report.TargetID, actorID)
+			if err == nil || errors.Is(err, database.ErrNotFound) {
+				err = db.PurgeComment(report.TargetID)
+			}
+		default:
+			// Delete the account as if the user did it
+			if status, err := checkCanModerate(db, actorRole, report.TargetUserID); err != nil {
+				return status, err
+			}
+			err = db.DeleteUser(report.TargetUserID)
+			if errors.Is(err, database.ErrNotFound) {
+				return statusError(http.StatusNotFound, "the user is already deleted")
+			}
+			if err == nil {
+				_, err = db.CreateJob(accountDeletionJobKind, report.TargetUserID, globaltime.Now().Add(rt.deletionGracePeriod))
+			}
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+	case resolutionWarn:
+		err := db.AddWarning(report.TargetUserID, report.ReportID, resolution.Note)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+	case resolutionSuspend:
+		if status, err := checkCanModerate(db, actorRole, report.TargetUserID); err != nil {
+			return status, err
+		}
+		err := db.SuspendUser(report.TargetUserID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+	default:
+		return statusError(http.StatusBadRequest, "unknown action")
+	}
+	return http.StatusOK, nil
+}
+
+// checkCanModerate is canModerate returning the status code to answer with when the action is not allowed
+func checkCanModerate(db database.AppDatabase, actorRole string, userID string) (int, error) {
+	allowed, err := canModerate(db, actorRole, userID)
+	if err != nil {
+		return statusError(http.StatusNotFound, "the user doesn't exist anymore")
+	}
+	if !allowed {
+		return statusError(http.StatusForbidden, "the user has the same or a higher role")
+	}
+	return http.StatusOK, nil
+}
+
+func (rt *_router) dismissReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the report ID from the URL
+	reportID := ps.ByName("reportId")
+
+	// Check that the requester is a moderator
+	actorID, _, err := rt.authorize(r, database.RoleModerator)
+	if err != nil {
+		writeAuthorizationError(w, err)
+		return
+	}
+
+	// Parse and decode the request body into a Resolution object, only the note is used
+	var resolution structs.Resolution
+	err = json.NewDecoder(r.Body).Decode(&resolution)
+	if err != nil {
+		// If there is something wrong with the request body, return a 400 status
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	// Check that the report can be dismissed
+	report, ok := rt.pendingReport(w, reportID, actorID)
+	if !ok {
+		return
+	}
+
+	// Close the report without doing anything. Content held by the content filter is published in the same
+	// transaction.
+	err = rt.audited(actorID, auditDismissReport, reportID, resolution.Note, func(db database.AppDatabase) error {
+		err := db.CloseReport(reportID, actorID, database.ReportDismissed, "", resolution.Note)
+		if err != nil || report.ReporterID != filterReporterID {
+			return err
+		}
+		if report.TargetType == reportPost {
+			return db.ReleasePost(report.TargetID)
+		}
+		return db.ReleaseComment(report.TargetID)
+	})
+	if err != nil {
+		// Closed by another moderator in the meantime, return a 409 status
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "Report dismissed successfully"}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -7,6 +7,8 @@ Each value here should be assumed valid only per request only, with some excepti
 package reqcontext
 
 import (
+	"context"
+
 	"github.com/gofrs/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -19,3 +21,17 @@ type RequestContext struct {
 	// Logger is a custom field logger for the request
 	Logger logrus.FieldLogger
 }
+
+// contextKey is the key of the RequestContext in a context.Context
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the request context rc
+func NewContext(ctx context.Context, rc RequestContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, rc)
+}
+
+// FromContext returns the request context carried by ctx, if any
+func FromContext(ctx context.Context) (RequestContext, bool) {
+	rc, ok := ctx.Value(contextKey{}).(RequestContext)
+	return rc, ok
+}
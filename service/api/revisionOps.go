@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/julienschmidt/httprouter"
+)
+
+/*
+	This file contains the handlers for the API endpoints that are used to read the edit history of posts and comments
+	i.e. the following endpoints:
+		- GET /users/:userId/posts/:postId/revisions
+		- GET /users/:userId/posts/:postId/comments/:commentId/revisions
+*/
+
+func (rt *_router) getPostRevisions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	// Get the user ID and post ID from the URL
+	userID := ps.ByName("userId")
+	postID := ps.ByName("postId")
+
+	// Check authorization (bearer token not banned from post owner)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+	banned, err := rt.db.IsBanned(userID, beaerToken)
+	if err != nil || banned {
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Get the revisions of the specified post
+	revisions, err := rt.db.GetPostRevisions(postID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Create a response object
+	response := structs.RevisionCollection{Revisions: revisions}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) getCommentRevisions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	// Get the user ID and comment ID from the URL
+	userID := ps.ByName("userId")
+	commentID := ps.ByName("commentId")
+
+	// Check authorization (bearer token not banned from post owner)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+	banned, err := rt.db.IsBanned(userID, beaerToken)
+	if err != nil || banned {
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Get the revisions of the specified comment
+	revisions, err := rt.db.GetCommentRevisions(commentID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Create a response object
+	response := structs.RevisionCollection{Revisions: revisions}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
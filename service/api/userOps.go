@@ -2,8 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/attiliov/WASA-Photo/service/globaltime"
 	"github.com/attiliov/WASA-Photo/service/structs"
 	"github.com/julienschmidt/httprouter"
 )
@@ -14,16 +17,18 @@ import (
 	   - GET /users
 	   - GET /users/:userId
 	   - PUT /users/:userId
+	   - PATCH /users/:userId
 	   - DELETE /users/:userId
+	   - POST /users/:userId/restore
 */
 
 func (rt *_router) searchUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	// Get requesterId
-	requesterId, err := getBearerToken(r)
+	requesterId, err := rt.authenticate(r)
 	if err != nil {
-		// If there was an error getting the bearer token, return a 400 status
-		w.WriteHeader(http.StatusBadRequest)
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
@@ -34,15 +39,14 @@ func (rt *_router) searchUser(w http.ResponseWriter, r *http.Request, ps httprou
 	// Check that the username is not empty
 	if username.Username == "" {
 		// If the username is empty, return a 400 status
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
 		return
 	}
 
 	// Get users with similar usernames
 	users, err := rt.db.SearchUsername(username.Username)
 	if err != nil {
-		// If there was an error getting the users, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
@@ -51,7 +55,7 @@ func (rt *_router) searchUser(w http.ResponseWriter, r *http.Request, ps httprou
 	for _, user := range users {
 		isBanned, err := rt.db.IsBanned(user.UserID, requesterId)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			rt.writeDatabaseError(w, err)
 			return
 		}
 		if !isBanned {
@@ -65,12 +69,7 @@ func (rt *_router) searchUser(w http.ResponseWriter, r *http.Request, ps httprou
 
 	// Set the header and write the response body
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(response)
 }
 
 func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -78,35 +77,37 @@ func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps htt
 	userID := ps.ByName("userId")
 
 	// Check that thwe reqeuster is not banned from the userID
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 	banned, err := rt.db.IsBanned(userID, beaerToken) // isBanned(userID, beaerToken) returns true if the bearer is banned from the user with the given ID
 	if err != nil || banned {
 		// If there was an error getting the banned status, return unauthorized
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
 	// Get the user with the specified ID
 	user, err := rt.db.GetUser(userID)
 	if err != nil {
+		// If the user changed username, redirect to their profile
+		ownerID, err := rt.db.ResolveUsername(userID)
+		if err == nil {
+			http.Redirect(w, r, "/users/"+ownerID, http.StatusMovedPermanently)
+			return
+		}
 		// User not found, return a 404 status
-		w.WriteHeader(http.StatusNotFound)
+		writeStatus(w, http.StatusNotFound)
 		return
 	}
 
 	// Set the header and write the response body
+	setETag(w, user.Version)
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(user)
-	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	_ = json.NewEncoder(w).Encode(user)
 }
 
 func (rt *_router) updateUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -118,34 +119,105 @@ func (rt *_router) updateUserProfile(w http.ResponseWriter, r *http.Request, ps
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
 		// If there is something wrong with the request body, return a 400 status
-		w.WriteHeader(http.StatusBadRequest)
+		writeStatus(w, http.StatusBadRequest)
 		return
 	}
 
 	// Check that the beaer in the body matches the user ID in the URL (authorized operation)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
-	// Update the user with the specified ID
-	err = rt.db.UpdateUser(userID, user)
+	// Get the current version of the user
+	current, err := rt.db.GetUser(userID)
 	if err != nil {
-		// If there was an error updating the user, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
 		return
 	}
 
-	// Set the header and write the response body
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(user)
+	// Check that the request replaces the current version
+	if !checkIfMatch(w, r, current.Version, true) {
+		return
+	}
+
+	rt.saveUserProfile(w, current, user)
+}
+
+func (rt *_router) patchUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check that the beaer matches the user ID in the URL (authorized operation)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil || beaerToken != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Get the current version of the user
+	current, err := rt.db.GetUser(userID)
 	if err != nil {
-		// If there was an error encoding the response, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Check that the request is based on the current version, if the client sent it
+	if !checkIfMatch(w, r, current.Version, false) {
+		return
+	}
+
+	// Apply the patch in the request body to the current user
+	var user structs.User
+	if !decodeMergePatch(w, r, &current, &user) {
 		return
 	}
+
+	rt.saveUserProfile(w, current, user)
+}
+
+// saveUserProfile replaces the current version of a user with the edited one, and writes the updated user
+func (rt *_router) saveUserProfile(w http.ResponseWriter, current structs.User, user structs.User) {
+	// Check the rules for a username change
+	if current.Username != user.Username {
+		status, err := rt.checkUsername(user.Username, current.UserID)
+		if err != nil {
+			rt.writeUsernameError(w, status, err)
+			return
+		}
+		wait, err := rt.usernameCooldown(current.UserID)
+		if err != nil {
+			rt.writeDatabaseError(w, err)
+			return
+		}
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeStatus(w, http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	// Update the user, unless it was edited in the meantime
+	_, err := rt.db.UpdateUser(current.UserID, user, current.Version)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Get the updated user
+	updated, err := rt.db.GetUser(current.UserID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Set the header and write the response body
+	setETag(w, updated.Version)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(updated)
 }
 
 func (rt *_router) deleteUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -153,18 +225,61 @@ func (rt *_router) deleteUserProfile(w http.ResponseWriter, r *http.Request, ps
 	userID := ps.ByName("userId")
 
 	// Check that the beaer in the body matches the user ID in the URL (authorized operation)
-	beaerToken, err := getBearerToken(r)
+	beaerToken, err := rt.authenticate(r)
 	if err != nil || beaerToken != userID {
 		// If there was an error getting the bearer token, return a 401 status
-		w.WriteHeader(http.StatusUnauthorized)
+		writeStatus(w, http.StatusUnauthorized)
 		return
 	}
 
-	// Delete the user with the specified ID
+	// Delete the user with the specified ID, it can be restored until the grace period is over
 	err = rt.db.DeleteUser(userID)
 	if err != nil {
-		// If there was an error deleting the user, return a 500 status
-		w.WriteHeader(http.StatusInternalServerError)
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Schedule the deletion of all the user data at the end of the grace period
+	job, err := rt.db.CreateJob(accountDeletionJobKind, userID, globaltime.Now().Add(rt.deletionGracePeriod))
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error scheduling account deletion")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.Success{Message: "User deleted successfully", Body: job}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) restoreUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check that the session is of the user in the URL (authorized operation). The user is deleted, so authenticate
+	// would refuse them.
+	sessionUserID, err := rt.sessionUser(r)
+	if err != nil || sessionUserID != userID {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Restore the user if it is still in the grace period
+	err = rt.db.RestoreUser(userID, rt.restoreDeadline())
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Cancel the deletion of the user data
+	err = rt.db.CancelJobs(accountDeletionJobKind, userID)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error cancelling account deletion")
+		writeStatus(w, http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/sirupsen/logrus"
+)
+
+// historyErrorDB is a database failing to read the username history
+type historyErrorDB struct {
+	database.AppDatabase
+}
+
+func (historyErrorDB) GetUsernameHistory(string) ([]structs.UsernameChange, error) {
+	return nil, errors.New("database is down")
+}
+
+// TestUsernameCooldownError checks that a database error while checking the username cooldown is not reported as a
+// rate limit
+func TestUsernameCooldownError(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	rt := &_router{baseLogger: logger, db: historyErrorDB{memdb.New()}}
+	alice, err := rt.db.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("creating alice: %v", err)
+	}
+
+	edited := alice
+	edited.Username = "alice2"
+	w := httptest.NewRecorder()
+	rt.saveUserProfile(w, alice, edited)
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("expected status 500 without Retry-After, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/attiliov/WASA-Photo/service/usernames"
+	"github.com/julienschmidt/httprouter"
+)
+
+/*
+	This file contains the handlers for the API endpoints that are used to read the username history of a user,
+	and the rules applied when a username is chosen
+	i.e. the following endpoints:
+		- GET /users/:userId/usernames
+*/
+
+func (rt *_router) getUsernameHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	// Get the user ID from the URL
+	userID := ps.ByName("userId")
+
+	// Check authorization (bearer token not banned from user)
+	beaerToken, err := rt.authenticate(r)
+	if err != nil {
+		// If there was an error getting the bearer token, return a 401 status
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+	banned, err := rt.db.IsBanned(userID, beaerToken)
+	if err != nil || banned {
+		writeStatus(w, http.StatusUnauthorized)
+		return
+	}
+
+	// Check that the user exists
+	_, err = rt.db.GetUser(userID)
+	if err != nil {
+		rt.writeDatabaseError(w, err)
+		return
+	}
+
+	// Get the previous usernames of the user
+	usernames, err := rt.db.GetUsernameHistory(userID)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("error getting username history")
+		writeStatus(w, http.StatusInternalServerError)
+		return
+	}
+
+	// Create a response object
+	response := structs.UsernameHistory{Usernames: usernames}
+
+	// Set the header and write the response body
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// checkUsername checks that username can be chosen by the user with the given userID (empty for a new user).
+// If it can't, it returns the status code to answer with and the error, a *usernames.RuleError when a rule is violated.
+func (rt *_router) checkUsername(username string, userID string) (int, error) {
+	err := usernames.Validate(username)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if rt.isReservedUsername(username) {
+		return http.StatusBadRequest, &usernames.RuleError{Rule: usernames.RuleReserved, Message: "username is reserved"}
+	}
+	if rt.isUsernameTaken(username, userID) {
+		return http.StatusConflict, &usernames.RuleError{Rule: usernames.RuleUnique, Message: "username is already taken"}
+	}
+	lookalikes, err := rt.db.GetLookalikeUsers(username)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for _, user := range lookalikes {
+		if user.UserID != userID {
+			return http.StatusConflict, &usernames.RuleError{
+				Rule:    usernames.RuleConfusable,
+				Message: "username looks like the username of another user",
+			}
+		}
+	}
+	return 0, nil
+}
+
+// writeUsernameError answers with the status code and the error returned by checkUsername
+func (rt *_router) writeUsernameError(w http.ResponseWriter, status int, err error) {
+	var ruleErr *usernames.RuleError
+	if !errors.As(err, &ruleErr) {
+		rt.baseLogger.WithError(err).Error("error checking username")
+		writeStatus(w, status)
+		return
+	}
+	code := codeInvalidUsername
+	if status == http.StatusConflict {
+		code = codeUsernameTaken
+	}
+	writeError(w, status, structs.Error{Code: code, Message: ruleErr.Message, Rule: ruleErr.Rule})
+}
+
+// isReservedUsername returns true if the username, or a lookalike of it, can't be chosen by users
+func (rt *_router) isReservedUsername(username string) bool {
+	skeleton := usernames.Skeleton(username)
+	for _, reserved := range rt.reservedUsernames {
+		if skeleton == usernames.Skeleton(reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUsernameTaken returns true if the username is used, or was used in the past, by a user other than userID
+func (rt *_router) isUsernameTaken(username string, userID string) bool {
+	user, err := rt.db.GetUser(username)
+	if err == nil && user.UserID != userID {
+		return true
+	}
+	previousOwner, err := rt.db.ResolveUsername(username)
+	return err == nil && previousOwner != userID
+}
+
+// usernameCooldown returns how long the user with the given userID has to wait before changing username again
+func (rt *_router) usernameCooldown(userID string) (time.Duration, error) {
+	history, err := rt.db.GetUsernameHistory(userID)
+	if err != nil || len(history) == 0 {
+		return 0, err
+	}
+	wait := history[0].ChangeDate.Add(rt.usernameChangeCooldown).Sub(globaltime.Now())
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
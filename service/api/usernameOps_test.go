@@ -0,0 +1,25 @@
+package api
+
+import "testing"
+
+func TestIsReservedUsername(t *testing.T) {
+	rt := &_router{reservedUsernames: []string{"admin", "Support"}}
+	tests := []struct {
+		username string
+		reserved bool
+	}{
+		{"admin", true},
+		{"ADMIN", true},
+		{"adm1n", true},
+		{"аdmin", true}, // Cyrillic a
+		{"support", true},
+		{"5upp0rt", true},
+		{"admins", false},
+		{"alice", false},
+	}
+	for _, test := range tests {
+		if got := rt.isReservedUsername(test.username); got != test.reserved {
+			t.Errorf("isReservedUsername(%q) = %v, expected %v", test.username, got, test.reserved)
+		}
+	}
+}
@@ -2,10 +2,15 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/attiliov/WASA-Photo/service/database"
 )
 
+// getBearerToken returns the bearer token of the request, i.e. the token of the session of the user making it
 func getBearerToken(r *http.Request) (string, error) {
 
 	// Get the Authorization header value
@@ -22,3 +27,115 @@ func getBearerToken(r *http.Request) (string, error) {
 	bearerToken := parts[1]
 	return bearerToken, nil
 }
+
+// sessionUser returns the ID of the user of the session whose token is the bearer token of the request. The user can
+// be deleted or suspended: use authenticate instead, unless the request must be accepted from deleted users too.
+func (rt *_router) sessionUser(r *http.Request) (string, error) {
+	token, err := getBearerToken(r)
+	if err != nil {
+		return "", err
+	}
+
+	userID, err := rt.db.GetSessionUser(hashSessionToken(token))
+	if errors.Is(err, database.ErrNotFound) {
+		return "", errors.New("unknown session")
+	} else if err != nil {
+		return "", fmt.Errorf("getting session: %w", err)
+	}
+	return userID, nil
+}
+
+// SessionUser returns the ID of the user of the session of the request, see Router
+func (rt *_router) SessionUser(r *http.Request) (string, error) {
+	return rt.sessionUser(r)
+}
+
+// authenticate returns the ID of the user making the request. It fails if the Authorization header is not valid, if
+// the session is unknown, if the user does not exist anymore (e.g. the account was deleted) or if the user is
+// suspended.
+func (rt *_router) authenticate(r *http.Request) (string, error) {
+	userID, err := rt.sessionUser(r)
+	if err != nil {
+		return "", err
+	}
+
+	active, err := rt.db.IsActiveUser(userID)
+	if err != nil {
+		return "", fmt.Errorf("checking user: %w", err)
+	}
+	if !active {
+		return "", errors.New("user not found or deleted")
+	}
+
+	suspended, err := rt.db.IsSuspended(userID)
+	if err != nil {
+		return "", fmt.Errorf("checking suspension: %w", err)
+	}
+	if suspended {
+		return "", errors.New("user suspended")
+	}
+	return userID, nil
+}
+
+// roleRanks orders the roles, each role has the permissions of the roles with a lower rank
+var roleRanks = map[string]int{
+	database.RoleUser:      0,
+	database.RoleModerator: 1,
+	database.RoleAdmin:     2,
+}
+
+// errMissingRole is returned by authorize when the user making the request doesn't have the required role
+var errMissingRole = errors.New("missing role")
+
+// authorize returns the ID and the role of the user making the request, like authenticate. It also fails with
+// errMissingRole if the user doesn't have at least the given role.
+func (rt *_router) authorize(r *http.Request, role string) (string, string, error) {
+	userID, err := rt.authenticate(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	userRole, err := rt.db.GetUserRole(userID)
+	if err != nil {
+		return "", "", fmt.Errorf("getting role: %w", err)
+	}
+	if roleRanks[userRole] < roleRanks[role] {
+		return "", "", fmt.Errorf("role %s required: %w", role, errMissingRole)
+	}
+	return userID, userRole, nil
+}
+
+// writeAuthorizationError answers a request refused by authorize: 403 if the user is authenticated but doesn't have
+// the role, 401 otherwise
+func writeAuthorizationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errMissingRole) {
+		writeStatus(w, http.StatusForbidden)
+		return
+	}
+	writeStatus(w, http.StatusUnauthorized)
+}
+
+// Page sizes of the paginated lists
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pagination returns the offset and limit query parameters of the request
+func pagination(r *http.Request) (int, int, error) {
+	offset, limit := 0, defaultPageSize
+	var err error
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, errors.New("invalid limit")
+		}
+	}
+	return offset, limit, nil
+}
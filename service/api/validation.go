@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/attiliov/WASA-Photo/service/openapi"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+	This file contains the validation of the requests and the responses against the OpenAPI specification
+	(doc/api.yaml). Requests that don't match it are refused with a 400 status before reaching the handlers, the error
+	body names the parameter or the field that is not valid.
+
+	When the validator checks the responses too (in debug mode), every response is buffered and checked before being
+	sent. A response that doesn't match the specification is still sent, but it is logged and marked with the
+	X-OpenAPI-Violation header, so that the drift between the handlers and the specification shows up in tests.
+*/
+
+// validated checks the requests to h, and optionally its responses, against the OpenAPI specification
+func (rt *_router) validated(h http.Handler) http.Handler {
+	if rt.validator == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := rt.validator.ValidateRequest(r)
+		if err != nil {
+			var validationErr *openapi.Error
+			if !errors.As(err, &validationErr) {
+				validationErr = &openapi.Error{Message: err.Error()}
+			}
+			writeError(w, http.StatusBadRequest, structs.Error{Code: codeInvalidRequest, Message: validationErr.Message, Field: validationErr.Field})
+			return
+		}
+		if req == nil || !rt.validator.ValidatesResponses() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// Buffer the response, so that it can be marked before being sent
+		response := &bufferedResponse{ResponseWriter: w}
+		h.ServeHTTP(response, r)
+		err = req.ValidateResponse(response.statusCode(), w.Header(), response.body.Bytes())
+		if err != nil {
+			rt.baseLogger.WithError(err).WithFields(logrus.Fields{
+				"reqid":  w.Header().Get(requestIDHeader),
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"status": response.statusCode(),
+			}).Error("response does not match the API specification")
+			// Header values can't span several lines
+			w.Header().Set(openapi.ViolationHeader, strings.Join(strings.Fields(err.Error()), " "))
+		}
+		response.flush()
+	})
+}
+
+// bufferedResponse is a http.ResponseWriter keeping the status and the body until flush is called. The headers are
+// the ones of the underlying ResponseWriter, they are sent by flush too.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+// statusCode returns the status of the response, 200 if the handler didn't set it
+func (b *bufferedResponse) statusCode() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+// flush sends the buffered response
+func (b *bufferedResponse) flush() {
+	b.ResponseWriter.WriteHeader(b.statusCode())
+	_, _ = b.ResponseWriter.Write(b.body.Bytes())
+}
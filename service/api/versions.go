@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the helpers for the optimistic concurrency of the editable resources (users, posts and comments).
+	Every resource has a version, incremented by each edit and sent in the ETag header. PUT requests must send it back
+	in the If-Match header, while PATCH requests may: if the resource was edited in the meantime the request fails with
+	a 412 status, instead of silently overwriting the other edit.
+
+	PATCH requests carry a JSON merge patch (RFC 7396), i.e. an object with only the fields to change.
+*/
+
+// mergePatchContentType is the media type of the body of the PATCH requests
+const mergePatchContentType = "application/merge-patch+json"
+
+// etag returns the ETag of the given version of a resource
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// setETag sets the ETag header of the response to the given version
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// checkIfMatch checks the If-Match header of the request against the current version of the resource. If the header
+// is missing but required, or no ETag in it matches, it writes the error response (428 or 412) and returns false.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int, required bool) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if required {
+			writeError(w, http.StatusPreconditionRequired, structs.Error{Message: "the If-Match header is required, send the ETag of the resource"})
+			return false
+		}
+		return true
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	w.Header().Set("ETag", current)
+	writePreconditionFailed(w)
+	return false
+}
+
+// writePreconditionFailed answers that the resource was modified since the version the request is based on
+func writePreconditionFailed(w http.ResponseWriter) {
+	writeError(w, http.StatusPreconditionFailed, structs.Error{Code: codeVersionMismatch, Message: "the resource was modified by another request, get it again and retry"})
+}
+
+// decodeMergePatch applies the JSON merge patch in the body of the request to current, and decodes the result into
+// patched. current and patched must be pointers to the same type. If the body is not a valid merge patch for the
+// resource, it writes the error response (415 or 400) and returns false.
+func decodeMergePatch(w http.ResponseWriter, r *http.Request, current interface{}, patched interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != mergePatchContentType {
+		w.Header().Set("Accept-Patch", mergePatchContentType)
+		writeError(w, http.StatusUnsupportedMediaType, structs.Error{Message: "the body must be a JSON merge patch (" + mergePatchContentType + ")"})
+		return false
+	}
+
+	var patch interface{}
+	err = json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, structs.Error{Message: "the body is not valid JSON"})
+		return false
+	}
+
+	// Go through the generic JSON form of the resource, so that the patch is applied to its JSON fields
+	document, err := json.Marshal(current)
+	if err == nil {
+		var target interface{}
+		err = json.Unmarshal(document, &target)
+		if err == nil {
+			document, err = json.Marshal(mergePatch(target, patch))
+		}
+	}
+	if err == nil {
+		err = json.Unmarshal(document, patched)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, structs.Error{Message: "the patch does not fit the resource: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// mergePatch applies the patch to the target as described by RFC 7396: the members of a patch object replace the
+// ones of the target, recursively, and null members remove them. Any other patch replaces the whole target.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
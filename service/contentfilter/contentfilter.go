@@ -0,0 +1,271 @@
+/*
+Package contentfilter checks the text of posts and comments before they are saved.
+
+A Filter looks at a Content and returns a Decision: the content is accepted, held for review by the moderators, or
+rejected. A Pipeline runs several filters and keeps the strictest decision. New builds the pipeline described by a
+Config, with the filters of this package:
+
+  - Blocklist: words or regular expressions that are not allowed
+  - LinkLimit: a maximum number of links
+  - RepeatDetector: the same text sent again and again by one user
+*/
+package contentfilter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+)
+
+// Verdict is the outcome of a filter, ordered from the most to the least permissive
+type Verdict int
+
+const (
+	// Accept lets the content be published
+	Accept Verdict = iota
+	// Hold saves the content, but hides it until a moderator reviews it
+	Hold
+	// Reject refuses the content
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Accept:
+		return "accept"
+	case Hold:
+		return "hold"
+	case Reject:
+		return "reject"
+	}
+	return fmt.Sprintf("Verdict(%d)", int(v))
+}
+
+// Names of the rules a content can violate
+const (
+	RuleBlocklist = "blocklist"
+	RuleLinks     = "links"
+	RuleRepeated  = "repeated"
+)
+
+// Content is the text checked by the filters
+type Content struct {
+	AuthorID string
+	Kind     string // "post" or "comment"
+	Text     string
+	Edit     bool // The text replaces the one of an existing post or comment
+}
+
+// Decision is the outcome of a filter. Rule and Message explain it when the content is not accepted.
+type Decision struct {
+	Verdict Verdict
+	Rule    string
+	Message string
+}
+
+// Filter checks a content
+type Filter interface {
+	Check(content Content) Decision
+}
+
+// Pipeline is a Filter running every filter in order. It returns the first rejection, otherwise the first hold.
+type Pipeline []Filter
+
+func (p Pipeline) Check(content Content) Decision {
+	decision := Decision{Verdict: Accept}
+	for _, filter := range p {
+		d := filter.Check(content)
+		if d.Verdict > decision.Verdict {
+			decision = d
+		}
+		if decision.Verdict == Reject {
+			break
+		}
+	}
+	return decision
+}
+
+// Blocklist is a Filter matching the text against a list of rules
+type Blocklist struct {
+	rules   []*regexp.Regexp
+	verdict Verdict
+}
+
+// NewBlocklist returns a Blocklist giving the verdict to the texts matching one of the patterns. A pattern enclosed
+// in slashes (e.g. "/fr[e3]{2} money/") is a regular expression, otherwise it's a word where "*" matches any letters
+// (e.g. "spam*" matches "spammer"). Patterns are case-insensitive.
+func NewBlocklist(patterns []string, verdict Verdict) (*Blocklist, error) {
+	b := &Blocklist{verdict: verdict}
+	for _, pattern := range patterns {
+		var expr string
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			expr = pattern[1 : len(pattern)-1]
+		} else {
+			parts := strings.Split(pattern, "*")
+			for i := range parts {
+				parts[i] = regexp.QuoteMeta(parts[i])
+			}
+			expr = `\b` + strings.Join(parts, `\w*`) + `\b`
+		}
+		rule, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		b.rules = append(b.rules, rule)
+	}
+	return b, nil
+}
+
+func (b *Blocklist) Check(content Content) Decision {
+	for _, rule := range b.rules {
+		if rule.MatchString(content.Text) {
+			if b.verdict == Hold {
+				return Decision{Verdict: b.verdict, Rule: RuleBlocklist, Message: "the text contains words that need a review"}
+			}
+			return Decision{Verdict: b.verdict, Rule: RuleBlocklist, Message: "the text contains words that are not allowed"}
+		}
+	}
+	return Decision{Verdict: Accept}
+}
+
+// linkPattern matches the links in a text
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkLimit is a Filter giving Verdict to the texts with more than Max links
+type LinkLimit struct {
+	Max     int
+	Verdict Verdict
+}
+
+func (l LinkLimit) Check(content Content) Decision {
+	if len(linkPattern.FindAllStringIndex(content.Text, -1)) > l.Max {
+		return Decision{Verdict: l.Verdict, Rule: RuleLinks, Message: fmt.Sprintf("the text can contain at most %d links", l.Max)}
+	}
+	return Decision{Verdict: Accept}
+}
+
+// RepeatDetector is a Filter remembering the texts sent by each user. A text sent more than max times by the same
+// user within window gets the verdict. Texts are compared ignoring the case and the spaces. Edits are not checked:
+// fixing a typo is not sending the text again.
+type RepeatDetector struct {
+	max     int
+	window  time.Duration
+	verdict Verdict
+
+	mu        sync.Mutex
+	recent    map[string][]sent // By author ID, oldest first
+	lastSweep time.Time         // When the texts of every author were last pruned, see sweep
+}
+
+type sent struct {
+	text string
+	at   time.Time
+}
+
+// NewRepeatDetector returns a RepeatDetector, see RepeatDetector
+func NewRepeatDetector(max int, window time.Duration, verdict Verdict) *RepeatDetector {
+	return &RepeatDetector{max: max, window: window, verdict: verdict, recent: make(map[string][]sent), lastSweep: globaltime.Now()}
+}
+
+// Check records the text and checks how many times it was sent. Every checked text is recorded, even if it ends up
+// being rejected by another filter.
+func (d *RepeatDetector) Check(content Content) Decision {
+	if content.Edit {
+		return Decision{Verdict: Accept}
+	}
+	text := strings.ToLower(strings.Join(strings.Fields(content.Text), " "))
+	now := globaltime.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(now)
+	texts := d.prune(content.AuthorID, now)
+
+	count := 1
+	for _, t := range texts {
+		if t.text == text {
+			count++
+		}
+	}
+	d.recent[content.AuthorID] = append(texts, sent{text: text, at: now})
+
+	if count > d.max {
+		return Decision{Verdict: d.verdict, Rule: RuleRepeated, Message: "the same text was sent too many times, wait before sending it again"}
+	}
+	return Decision{Verdict: Accept}
+}
+
+// prune forgets the texts of the author sent before the window, and returns the others
+func (d *RepeatDetector) prune(authorID string, now time.Time) []sent {
+	texts := d.recent[authorID]
+	first := 0
+	for first < len(texts) && now.Sub(texts[first].at) >= d.window {
+		first++
+	}
+	if first == len(texts) {
+		delete(d.recent, authorID)
+		return nil
+	}
+	d.recent[authorID] = texts[first:]
+	return texts[first:]
+}
+
+// sweep prunes the texts of every author, so that the authors who stopped sending texts are forgotten. It runs at
+// most once per window: the texts of an author are pruned anyway when they send a new one.
+func (d *RepeatDetector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.window {
+		return
+	}
+	d.lastSweep = now
+	for author := range d.recent {
+		d.prune(author, now)
+	}
+}
+
+// Config describes the filters of the pipeline built by New. Empty lists and zero values disable the filters, except
+// for MaxLinks which is disabled by a negative value.
+type Config struct {
+	// Blocked are the Blocklist patterns of the rejected texts
+	Blocked []string
+
+	// Held are the Blocklist patterns of the texts held for review
+	Held []string
+
+	// MaxLinks is how many links a text can contain before being held for review. Negative values disable the limit.
+	MaxLinks int
+
+	// MaxRepeats is how many times a user can send the same text within RepeatWindow
+	MaxRepeats   int
+	RepeatWindow time.Duration
+}
+
+// New returns the Pipeline described by cfg
+func New(cfg Config) (Pipeline, error) {
+	var pipeline Pipeline
+	if len(cfg.Blocked) > 0 {
+		blocklist, err := NewBlocklist(cfg.Blocked, Reject)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, blocklist)
+	}
+	if len(cfg.Held) > 0 {
+		blocklist, err := NewBlocklist(cfg.Held, Hold)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, blocklist)
+	}
+	if cfg.MaxLinks >= 0 {
+		pipeline = append(pipeline, LinkLimit{Max: cfg.MaxLinks, Verdict: Hold})
+	}
+	if cfg.MaxRepeats > 0 && cfg.RepeatWindow > 0 {
+		pipeline = append(pipeline, NewRepeatDetector(cfg.MaxRepeats, cfg.RepeatWindow, Reject))
+	}
+	return pipeline, nil
+}
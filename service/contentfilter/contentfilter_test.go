@@ -0,0 +1,144 @@
+package contentfilter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+)
+
+func TestBlocklist(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		text    string
+		match   bool
+	}{
+		{pattern: "spam", text: "buy my spam", match: true},
+		{pattern: "spam", text: "Buy My SPAM!", match: true},
+		{pattern: "spam", text: "a spammer", match: false},
+		{pattern: "spam*", text: "a spammer", match: true},
+		{pattern: "spam*", text: "spam", match: true},
+		{pattern: "*coin", text: "get bitcoin now", match: true},
+		{pattern: "free money", text: "FREE   money", match: false},
+		{pattern: "free money", text: "free money", match: true},
+		{pattern: "a.b", text: "axb", match: false},
+		{pattern: "a.b", text: "a.b", match: true},
+		{pattern: "/fr[e3]{2} money/", text: "fr33 money here", match: true},
+		{pattern: "/fr[e3]{2} money/", text: "free cash", match: false},
+		{pattern: "/^hello$/", text: "HELLO", match: true},
+	} {
+		t.Run(tc.pattern+" "+tc.text, func(t *testing.T) {
+			blocklist, err := NewBlocklist([]string{tc.pattern}, Reject)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			decision := blocklist.Check(Content{Text: tc.text})
+			if (decision.Verdict == Reject) != tc.match {
+				t.Fatalf("expected match %v, got %+v", tc.match, decision)
+			}
+			if tc.match && decision.Rule != RuleBlocklist {
+				t.Fatalf("expected the blocklist rule, got %+v", decision)
+			}
+		})
+	}
+
+	if _, err := NewBlocklist([]string{"/fr[ee/"}, Reject); err == nil {
+		t.Fatal("expected an invalid regular expression to fail")
+	}
+}
+
+func TestLinkLimit(t *testing.T) {
+	limit := LinkLimit{Max: 1, Verdict: Hold}
+	for _, tc := range []struct {
+		text    string
+		verdict Verdict
+	}{
+		{text: "no links", verdict: Accept},
+		{text: "see https://example.com", verdict: Accept},
+		{text: "see www.example.com", verdict: Accept},
+		{text: "see http://a.example and HTTPS://b.example", verdict: Hold},
+		{text: "see www.a.example, www.b.example and www.c.example", verdict: Hold},
+		{text: "https:// alone", verdict: Accept},
+	} {
+		t.Run(tc.text, func(t *testing.T) {
+			decision := limit.Check(Content{Text: tc.text})
+			if decision.Verdict != tc.verdict {
+				t.Fatalf("expected %v, got %+v", tc.verdict, decision)
+			}
+		})
+	}
+}
+
+// fixedFilter is a Filter returning the same decision, counting its calls
+type fixedFilter struct {
+	decision Decision
+	calls    *int
+}
+
+func (f fixedFilter) Check(Content) Decision {
+	*f.calls++
+	return f.decision
+}
+
+func TestPipeline(t *testing.T) {
+	accept := Decision{Verdict: Accept}
+	hold := Decision{Verdict: Hold, Rule: "hold"}
+	otherHold := Decision{Verdict: Hold, Rule: "other hold"}
+	reject := Decision{Verdict: Reject, Rule: "reject"}
+	otherReject := Decision{Verdict: Reject, Rule: "other reject"}
+	for _, tc := range []struct {
+		name      string
+		decisions []Decision
+		expected  Decision
+		calls     int
+	}{
+		{name: "empty", expected: accept},
+		{name: "all accept", decisions: []Decision{accept, accept}, expected: accept, calls: 2},
+		{name: "hold", decisions: []Decision{accept, hold, accept}, expected: hold, calls: 3},
+		{name: "first hold", decisions: []Decision{hold, otherHold}, expected: hold, calls: 2},
+		{name: "reject after hold", decisions: []Decision{hold, reject}, expected: reject, calls: 2},
+		{name: "reject stops", decisions: []Decision{reject, otherReject, hold}, expected: reject, calls: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			var pipeline Pipeline
+			for _, d := range tc.decisions {
+				pipeline = append(pipeline, fixedFilter{decision: d, calls: &calls})
+			}
+			decision := pipeline.Check(Content{Text: "text"})
+			if decision != tc.expected || calls != tc.calls {
+				t.Fatalf("expected %+v after %d calls, got %+v after %d", tc.expected, tc.calls, decision, calls)
+			}
+		})
+	}
+}
+
+func TestRepeatDetector(t *testing.T) {
+	globaltime.FixedTime = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	defer func() { globaltime.FixedTime = time.Time{} }()
+
+	detector := NewRepeatDetector(2, time.Minute, Reject)
+	check := func(what string, content Content, expected Verdict) {
+		t.Helper()
+		if decision := detector.Check(content); decision.Verdict != expected {
+			t.Fatalf("%s: expected %v, got %+v", what, expected, decision)
+		}
+	}
+
+	alice := Content{AuthorID: "alice", Text: "Hello  World"}
+	check("first", alice, Accept)
+	check("second, with other spaces and case", Content{AuthorID: "alice", Text: "hello world"}, Accept)
+	check("edit", Content{AuthorID: "alice", Text: "hello world", Edit: true}, Accept)
+	check("other author", Content{AuthorID: "bob", Text: "hello world"}, Accept)
+	check("third", alice, Reject)
+
+	// The texts out of the window are forgotten, those of the authors who stopped sending texts included
+	globaltime.FixedTime = globaltime.FixedTime.Add(time.Minute)
+	check("after the window", alice, Accept)
+	if _, ok := detector.recent["bob"]; ok {
+		t.Fatal("expected the texts of bob to be forgotten")
+	}
+	if texts := detector.recent["alice"]; len(texts) != 1 {
+		t.Fatalf("expected one text of alice, got %+v", texts)
+	}
+}
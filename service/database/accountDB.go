@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+)
+
+/* This file contains the implementation of the functions used to erase every trace of a user account
+   i.e. the follwoing functions
+	DeleteUserLikes(userID string) error
+	DeleteUserFollows(userID string) error
+	DeleteUserBans(userID string) error
+	DeleteUserComments(userID string) error
+	DeleteUserPosts(userID string) error
+	EraseUser(userID string) error
+
+   They are the steps of the account deletion job, and they are meant to be called in this order.
+   Each step runs in a transaction and is idempotent, so an interrupted deletion can simply be started again.
+*/
+
+// DeleteUserLikes removes the likes put by the user with the given userID, updating the like counters
+func (db *appdbimpl) DeleteUserLikes(userID string) error {
+	return db.inTransaction("deleting user likes", []string{
+		`UPDATE Post SET like_count = like_count - 1
+		WHERE id IN (SELECT post_id FROM PostLike WHERE user_id = ?1)`,
+		`DELETE FROM PostLike WHERE user_id = ?1`,
+		`UPDATE Comment SET like_count = like_count - 1
+		WHERE id IN (SELECT comment_id FROM CommentLike WHERE user_id = ?1)`,
+		`DELETE FROM CommentLike WHERE user_id = ?1`,
+	}, userID)
+}
+
+// DeleteUserFollows removes the follows from and to the user with the given userID, updating the follow counters
+func (db *appdbimpl) DeleteUserFollows(userID string) error {
+	return db.inTransaction("deleting user follows", []string{
+		`UPDATE "User" SET following_count = following_count - 1
+		WHERE id IN (SELECT follower FROM Follow WHERE following = ?1)`,
+		`UPDATE "User" SET followers_count = followers_count - 1
+		WHERE id IN (SELECT following FROM Follow WHERE follower = ?1)`,
+		`DELETE FROM Follow WHERE follower = ?1 OR following = ?1`,
+	}, userID)
+}
+
+// DeleteUserBans removes the bans put by and on the user with the given userID
+func (db *appdbimpl) DeleteUserBans(userID string) error {
+	return db.inTransaction("deleting user bans", []string{
+		`DELETE FROM Ban WHERE user_id = ?1 OR banned_user_id = ?1`,
+	}, userID)
+}
+
+// DeleteUserComments removes the comments written by the user with the given userID, with their likes and edit
+// history, updating the comment counters of the commented posts
+func (db *appdbimpl) DeleteUserComments(userID string) error {
+	return db.inTransaction("deleting user comments", []string{
+		`UPDATE Post SET comment_count = comment_count - (
+			SELECT COUNT(*) FROM Comment WHERE post_id = Post.id AND author_id = ?1 AND deleted_at IS NULL
+		)
+		WHERE id IN (SELECT post_id FROM Comment WHERE author_id = ?1)`,
+		`DELETE FROM CommentLike WHERE comment_id IN (SELECT id FROM Comment WHERE author_id = ?1)`,
+		`DELETE FROM Revision WHERE resource_id IN (SELECT id FROM Comment WHERE author_id = ?1)`,
+		`DELETE FROM Comment WHERE author_id = ?1`,
+	}, userID)
+}
+
+// DeleteUserPosts removes the posts of the user with the given userID, with everything attached to them: comments,
+// likes and edit history. Photo files are not touched, see DeletePhoto.
+func (db *appdbimpl) DeleteUserPosts(userID string) error {
+	return db.inTransaction("deleting user posts", []string{
+		`DELETE FROM CommentLike WHERE comment_id IN (
+			SELECT id FROM Comment WHERE post_id IN (SELECT id FROM Post WHERE author_id = ?1)
+		)`,
+		`DELETE FROM Revision WHERE resource_id IN (
+			SELECT id FROM Comment WHERE post_id IN (SELECT id FROM Post WHERE author_id = ?1)
+			UNION
+			SELECT id FROM Post WHERE author_id = ?1
+		)`,
+		`DELETE FROM Comment WHERE post_id IN (SELECT id FROM Post WHERE author_id = ?1)`,
+		`DELETE FROM PostLike WHERE post_id IN (SELECT id FROM Post WHERE author_id = ?1)`,
+		`DELETE FROM Post WHERE author_id = ?1`,
+	}, userID)
+}
+
+// EraseUser removes the row of the user with the given userID, the record of their photos, their username history,
+// their linked identities, their warnings, the reports by and about them and their jobs, the running account deletion
+// included. This is the last step of the account deletion: after it, no row holds the user ID anymore.
+func (db *appdbimpl) EraseUser(userID string) error {
+	return db.inTransaction("erasing user", []string{
+		`DELETE FROM Photo WHERE owner_id = ?1`,
+		`DELETE FROM UsernameHistory WHERE user_id = ?1`,
+		`DELETE FROM Identity WHERE user_id = ?1`,
+		`DELETE FROM Warning WHERE user_id = ?1`,
+		`DELETE FROM Report WHERE reporter_id = ?1 OR target_user_id = ?1`,
+		`DELETE FROM Session WHERE user_id = ?1`,
+		`DELETE FROM Job WHERE user_id = ?1`,
+		`DELETE FROM "User" WHERE id = ?1`,
+	}, userID)
+}
+
+// inTransaction executes the statements in a single transaction, passing args to each of them
+func (db *appdbimpl) inTransaction(description string, statements []string, args ...interface{}) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction for %s: %w", description, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, statement := range statements {
+		_, err = tx.Exec(statement, args...)
+		if err != nil {
+			return fmt.Errorf("error %s: %w", description, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction for %s: %w", description, err)
+	}
+	return nil
+}
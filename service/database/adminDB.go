@@ -0,0 +1,317 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the implementation of every function used by the administration of the users and the content
+	i.e. the follwoing functions
+	GetUserRole(userID string) (string, error)
+	SetUserRole(userID string, role string) error
+	IsSuspended(userID string) (bool, error)
+	SuspendUser(userID string) error
+	UnsuspendUser(userID string) error
+	ListUsers(offset int, limit int) ([]structs.AdminUser, error)
+	GetPostAuthor(postID string) (string, error)
+	GetCommentAuthor(commentID string) (string, error)
+	RemovePost(postID string, moderatorID string) error
+	RemoveComment(commentID string, moderatorID string) error
+	HoldPost(postID string) error
+	HoldComment(commentID string) error
+	ReleasePost(postID string) error
+	ReleaseComment(commentID string) error
+	GetStats() (structs.Stats, error)
+*/
+
+// User roles, each one includes the permissions of the previous ones
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// GetUserRole returns the role of the active user with the given userID
+func (db *appdbimpl) GetUserRole(userID string) (string, error) {
+	var role string
+	err := db.c.QueryRow(`SELECT role FROM "User" WHERE id = ? AND deleted_at IS NULL`, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return role, fmt.Errorf("user not found: %w", ErrNotFound)
+		}
+		return role, fmt.Errorf("error getting user role: %w", err)
+	}
+	return role, nil
+}
+
+// SetUserRole sets the role of the active user with the given userID
+func (db *appdbimpl) SetUserRole(userID string, role string) error {
+	return db.updateActiveUser("setting user role", `UPDATE "User" SET role = ? WHERE id = ? AND deleted_at IS NULL`, role, userID)
+}
+
+// IsSuspended returns true if the user with the given userID is suspended
+func (db *appdbimpl) IsSuspended(userID string) (bool, error) {
+	var suspended bool
+	err := db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM "User" WHERE id = ? AND suspended_at IS NOT NULL)`, userID).Scan(&suspended)
+	if err != nil {
+		return suspended, fmt.Errorf("error checking if user is suspended: %w", err)
+	}
+	return suspended, nil
+}
+
+// SuspendUser suspends the active user with the given userID, their requests are refused until UnsuspendUser
+func (db *appdbimpl) SuspendUser(userID string) error {
+	return db.updateActiveUser("suspending user", `
+	UPDATE 
+		"User" 
+	SET 
+		suspended_at = COALESCE(suspended_at, ?) 
+	WHERE 
+		id = ? AND deleted_at IS NULL`,
+		now(), userID)
+}
+
+// UnsuspendUser lifts the suspension of the active user with the given userID
+func (db *appdbimpl) UnsuspendUser(userID string) error {
+	return db.updateActiveUser("unsuspending user", `UPDATE "User" SET suspended_at = NULL WHERE id = ? AND deleted_at IS NULL`, userID)
+}
+
+// updateActiveUser executes an update of a single active user, failing if the user is not found
+func (db *appdbimpl) updateActiveUser(description string, query string, args ...interface{}) error {
+	res, err := db.c.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("error %s: %w", description, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error %s: %w", description, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("user not found: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// ListUsers returns the users, including the deleted and the suspended ones, ordered by signup date
+func (db *appdbimpl) ListUsers(offset int, limit int) ([]structs.AdminUser, error) {
+	var users []structs.AdminUser
+	rows, err := db.c.Query(`
+	SELECT 
+		id, 
+		username, 
+		signup_date, 
+		last_seen, 
+		bio, 
+		profile_image_id, 
+		followers_count, 
+		following_count, 
+		role, 
+		COALESCE(email, ''), 
+		COALESCE(suspended_at, ''), 
+		COALESCE(deleted_at, '') 
+	FROM 
+		"User" 
+	ORDER BY 
+		signup_date, id
+	LIMIT ? OFFSET ?`,
+		limit, offset)
+	if err != nil {
+		return users, fmt.Errorf("error listing users: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user structs.AdminUser
+		err = rows.Scan(&user.UserID, &user.Username, scanTime(&user.SignUpDate), scanTime(&user.LastSeenDate), &user.Bio, &user.ProfileImage, &user.Followers, &user.Following,
+			&user.Role, &user.Email, scanOptionalTime(&user.SuspendedAt), scanOptionalTime(&user.DeletedAt))
+		if err != nil {
+			return users, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return users, fmt.Errorf("error iterating over users: %w", err)
+	}
+	return users, nil
+}
+
+// GetPostAuthor returns the ID of the author of the post with the given postID. Unlike GetPost, it finds deleted and
+// held posts too, until they are purged.
+func (db *appdbimpl) GetPostAuthor(postID string) (string, error) {
+	return db.contentAuthor("post", "SELECT author_id FROM Post WHERE id = ?", postID)
+}
+
+// GetCommentAuthor returns the ID of the author of the comment with the given commentID, see GetPostAuthor
+func (db *appdbimpl) GetCommentAuthor(commentID string) (string, error) {
+	return db.contentAuthor("comment", "SELECT author_id FROM Comment WHERE id = ?", commentID)
+}
+
+// contentAuthor runs query, selecting the author of the content of the given kind with the given id
+func (db *appdbimpl) contentAuthor(kind string, query string, id string) (string, error) {
+	var authorID string
+	err := db.c.QueryRow(query, id).Scan(&authorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return authorID, fmt.Errorf("%s not found: %w", kind, ErrNotFound)
+		}
+		return authorID, fmt.Errorf("error getting %s author: %w", kind, err)
+	}
+	return authorID, nil
+}
+
+// RemovePost deletes the post with the given postID on behalf of a moderator. Unlike DeletePost, the author can't
+// restore it. Posts held for review can be removed too.
+func (db *appdbimpl) RemovePost(postID string, moderatorID string) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		Post 
+	SET 
+		deleted_at = ?, 
+		removed_by = ?, 
+		held_at = NULL 
+	WHERE 
+		id = ? AND (deleted_at IS NULL OR held_at IS NOT NULL)`,
+		now(), moderatorID, postID)
+	if err != nil {
+		return fmt.Errorf("error removing post: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error removing post: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("post not found: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// RemoveComment deletes the comment with the given commentID on behalf of a moderator. Unlike DeleteComment, the
+// author can't restore it. Comments held for review can be removed too.
+func (db *appdbimpl) RemoveComment(commentID string, moderatorID string) error {
+	// Held comments are already deleted
+	res, err := db.c.Exec(`
+	UPDATE 
+		Comment 
+	SET 
+		removed_by = ?, 
+		held_at = NULL 
+	WHERE 
+		id = ? AND held_at IS NOT NULL`,
+		moderatorID, commentID)
+	if err != nil {
+		return fmt.Errorf("error removing comment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error removing comment: %w", err)
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	err = db.DeleteComment(commentID)
+	if err != nil {
+		return err
+	}
+	_, err = db.c.Exec("UPDATE Comment SET removed_by = ? WHERE id = ?", moderatorID, commentID)
+	if err != nil {
+		return fmt.Errorf("error removing comment: %w", err)
+	}
+	return nil
+}
+
+// HoldPost hides the post with the given postID until a moderator reviews it. The post is hidden like a deleted one,
+// but it can't be restored by its author nor purged.
+func (db *appdbimpl) HoldPost(postID string) error {
+	date := now()
+	res, err := db.c.Exec(`
+	UPDATE 
+		Post 
+	SET 
+		deleted_at = ?, 
+		held_at = ? 
+	WHERE 
+		id = ? AND deleted_at IS NULL`,
+		date, date, postID)
+	if err != nil {
+		return fmt.Errorf("error holding post: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error holding post: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("post not found: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// HoldComment hides the comment with the given commentID until a moderator reviews it, see HoldPost
+func (db *appdbimpl) HoldComment(commentID string) error {
+	err := db.DeleteComment(commentID)
+	if err != nil {
+		return err
+	}
+	_, err = db.c.Exec("UPDATE Comment SET held_at = deleted_at WHERE id = ?", commentID)
+	if err != nil {
+		return fmt.Errorf("error holding comment: %w", err)
+	}
+	return nil
+}
+
+// ReleasePost publishes the post with the given postID held for review
+func (db *appdbimpl) ReleasePost(postID string) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		Post 
+	SET 
+		deleted_at = NULL, 
+		held_at = NULL 
+	WHERE 
+		id = ? AND held_at IS NOT NULL`,
+		postID)
+	if err != nil {
+		return fmt.Errorf("error releasing post: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error releasing post: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("held post not found: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// ReleaseComment publishes the comment with the given commentID held for review
+func (db *appdbimpl) ReleaseComment(commentID string) error {
+	statements := []string{
+		`UPDATE Post SET comment_count = comment_count + 1 WHERE id = (SELECT post_id FROM Comment WHERE id = ?1 AND held_at IS NOT NULL)`,
+		`UPDATE Comment SET deleted_at = NULL, held_at = NULL WHERE id = ?1 AND held_at IS NOT NULL`,
+	}
+	return db.inTransaction("releasing comment", statements, commentID)
+}
+
+// GetStats returns the number of rows of the main tables. Deleted posts and comments are not counted.
+func (db *appdbimpl) GetStats() (structs.Stats, error) {
+	var stats structs.Stats
+	err := db.c.QueryRow(`
+	SELECT 
+		(SELECT COUNT(*) FROM "User" WHERE deleted_at IS NULL), 
+		(SELECT COUNT(*) FROM "User" WHERE deleted_at IS NOT NULL), 
+		(SELECT COUNT(*) FROM "User" WHERE suspended_at IS NOT NULL), 
+		(SELECT COUNT(*) FROM Post WHERE deleted_at IS NULL), 
+		(SELECT COUNT(*) FROM Comment WHERE deleted_at IS NULL), 
+		(SELECT COUNT(*) FROM PostLike) + (SELECT COUNT(*) FROM CommentLike), 
+		(SELECT COUNT(*) FROM Follow), 
+		(SELECT COUNT(*) FROM Ban), 
+		(SELECT COUNT(*) FROM Job WHERE status IN ('`+JobPending+`', '`+JobRunning+`'))`).Scan(
+		&stats.Users, &stats.DeletedUsers, &stats.SuspendedUsers, &stats.Posts, &stats.Comments, &stats.Likes, &stats.Follows, &stats.Bans, &stats.PendingJobs)
+	if err != nil {
+		return stats, fmt.Errorf("error getting stats: %w", err)
+	}
+	return stats, nil
+}
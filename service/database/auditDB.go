@@ -0,0 +1,69 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/gofrs/uuid"
+)
+
+/*
+	This file contains the implementation of every function used to interact with the audit log of the administration
+	actions
+	i.e. the follwoing functions
+	AddAuditEntry(actorID string, action string, targetID string, details string) error
+	GetAuditLog(offset int, limit int) ([]structs.AuditEntry, error)
+*/
+
+// AddAuditEntry records that the moderator or administrator actorID did action on targetID
+func (db *appdbimpl) AddAuditEntry(actorID string, action string, targetID string, details string) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return fmt.Errorf("error generating UUID: %w", err)
+	}
+	_, err = db.c.Exec(`
+	INSERT INTO 
+		AuditLog (id, actor_id, action, target_id, details, creation_date) 
+	VALUES 
+		(?, ?, ?, ?, ?, ?)`,
+		id.String(), actorID, action, targetID, details, now())
+	if err != nil {
+		return fmt.Errorf("error adding audit entry: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLog returns the entries of the audit log, newest first
+func (db *appdbimpl) GetAuditLog(offset int, limit int) ([]structs.AuditEntry, error) {
+	var entries []structs.AuditEntry
+	rows, err := db.c.Query(`
+	SELECT 
+		id, 
+		actor_id, 
+		action, 
+		target_id, 
+		details, 
+		creation_date 
+	FROM 
+		AuditLog 
+	ORDER BY 
+		creation_date DESC, id
+	LIMIT ? OFFSET ?`,
+		limit, offset)
+	if err != nil {
+		return entries, fmt.Errorf("error getting audit log: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry structs.AuditEntry
+		err = rows.Scan(&entry.EntryID, &entry.ActorID, &entry.Action, &entry.TargetID, &entry.Details, scanTime(&entry.CreationDate))
+		if err != nil {
+			return entries, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return entries, fmt.Errorf("error iterating over audit log: %w", err)
+	}
+	return entries, nil
+}
@@ -13,10 +13,8 @@ import (
 	UnbanUser(userID string, bannedID string) error
 */
 
-// IsBanned returns true if the user with the given userID is banned by the user with the given bannedID
-func (db *appdbimpl) IsBanned(userID string, bannedID string) (bool, error) {
-	var banned bool
-	err := db.c.QueryRow(`
+// isBannedQuery checks whether a user banned another one
+const isBannedQuery = `
 		SELECT EXISTS (
 			SELECT
 				1
@@ -24,40 +22,48 @@ func (db *appdbimpl) IsBanned(userID string, bannedID string) (bool, error) {
 				Ban
 			WHERE
 				user_id = ? AND banned_user_id = ?
-		)`, userID, bannedID).Scan(&banned)
+		)`
+
+// IsBanned returns true if the user with the given userID is banned by the user with the given bannedID
+func (db *appdbimpl) IsBanned(userID string, bannedID string) (bool, error) {
+	var banned bool
+	err := db.c.QueryRow(isBannedQuery, userID, bannedID).Scan(&banned)
 	if err != nil {
 		return banned, fmt.Errorf("querying ban: %w", err)
 	}
 	return banned, nil
 }
 
-// GetUserBanList returns all the users banned by the user with the given userID
-func (db *appdbimpl) GetUserBanList(userID string) ([]structs.User, error) {
-	var bannedUsers []structs.User
-
-	rows, err := db.c.Query(`
+// getUserBanListQuery selects the active users banned by a user
+const getUserBanListQuery = `
 		SELECT 
-			User.id,
-			User.username,
-			User.signup_date,
-			User.last_seen,
-			User.bio,
-			User.profile_image_id,
-			User.followers_count,
-			User.following_count
+			"User".id,
+			"User".username,
+			"User".signup_date,
+			"User".last_seen,
+			"User".bio,
+			"User".profile_image_id,
+			"User".followers_count,
+			"User".following_count
 		FROM 
-			Ban JOIN User
+			Ban JOIN "User"
 		ON
-			Ban.banned_user_id = User.id
+			Ban.banned_user_id = "User".id
 		WHERE
-			Ban.user_id = ?`, userID)
+			Ban.user_id = ? AND "User".deleted_at IS NULL`
+
+// GetUserBanList returns all the users banned by the user with the given userID
+func (db *appdbimpl) GetUserBanList(userID string) ([]structs.User, error) {
+	var bannedUsers []structs.User
+
+	rows, err := db.c.Query(getUserBanListQuery, userID)
 	if err != nil {
 		return bannedUsers, fmt.Errorf("querying banned users: %w", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var bannedUser structs.User
-		err = rows.Scan(&bannedUser.UserID, &bannedUser.Username, &bannedUser.SignUpDate, &bannedUser.LastSeenDate, &bannedUser.Bio, &bannedUser.ProfileImage, &bannedUser.Followers, &bannedUser.Following)
+		err = rows.Scan(&bannedUser.UserID, &bannedUser.Username, scanTime(&bannedUser.SignUpDate), scanTime(&bannedUser.LastSeenDate), &bannedUser.Bio, &bannedUser.ProfileImage, &bannedUser.Followers, &bannedUser.Following)
 		if err != nil {
 			return bannedUsers, fmt.Errorf("scanning banned user: %w", err)
 		}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the benchmarks of the connections to SQLite, comparing under concurrent requests:
+	- Default: a single pool on the file in its default journal mode, without busy timeout nor prepared statements
+	- Tuned: the connections of OpenSQLite, with the prepared statements (what the server uses)
+
+	go test -run '^$' -bench . ./service/database/
+
+	The failures/op metric is the share of the operations failing with "database is locked".
+*/
+
+// benchSetup opens a database on a new file, with the connections of the setup
+type benchSetup struct {
+	name string
+	open func(b *testing.B, filename string) *appdbimpl
+}
+
+var benchSetups = []benchSetup{
+	{name: "Default", open: func(b *testing.B, filename string) *appdbimpl {
+		conn, err := sql.Open("sqlite3", filename+"?_foreign_keys=1")
+		if err != nil {
+			b.Fatalf("opening SQLite: %v", err)
+		}
+		b.Cleanup(func() { _ = conn.Close() })
+		db, err := New(conn)
+		if err != nil {
+			b.Fatalf("creating the AppDatabase: %v", err)
+		}
+		impl := db.(*appdbimpl)
+		impl.c.statements = nil
+		impl.c.readerStatements = nil
+		return impl
+	}},
+	{name: "Tuned", open: func(b *testing.B, filename string) *appdbimpl {
+		writer, reader, err := OpenSQLite(filename, 5*time.Second)
+		if err != nil {
+			b.Fatalf("opening SQLite: %v", err)
+		}
+		reader.SetMaxOpenConns(16)
+		reader.SetMaxIdleConns(16)
+		b.Cleanup(func() {
+			_ = reader.Close()
+			_ = writer.Close()
+		})
+		db, err := NewWithReader(writer, reader)
+		if err != nil {
+			b.Fatalf("creating the AppDatabase: %v", err)
+		}
+		return db.(*appdbimpl)
+	}},
+}
+
+// benchData is the content of the databases of the benchmarks: a post with comments
+type benchData struct {
+	db     *appdbimpl
+	postID string
+	users  int64 // Number of the users created so far
+}
+
+// newBenchData opens the database of the setup and fills it
+func newBenchData(b *testing.B, setup benchSetup) *benchData {
+	b.Helper()
+	data := &benchData{db: setup.open(b, filepath.Join(b.TempDir(), "bench.db"))}
+
+	author := data.newUser(b)
+	post, err := data.db.AddPost(structs.UserPost{
+		AuthorID:       author.UserID,
+		AuthorUsername: author.Username,
+		Caption:        "A post",
+	})
+	if err != nil {
+		b.Fatalf("adding the post: %v", err)
+	}
+	data.postID = post.ResourceID
+	for i := 0; i < 20; i++ {
+		_, err = data.db.CreateComment(data.postID, structs.Comment{
+			AuthorID:       author.UserID,
+			AuthorUsername: author.Username,
+			Caption:        fmt.Sprintf("Comment %d", i),
+		})
+		if err != nil {
+			b.Fatalf("adding the comments: %v", err)
+		}
+	}
+	return data
+}
+
+// newUser creates a user with a new username
+func (data *benchData) newUser(b *testing.B) structs.User {
+	user, err := data.db.CreateUser(fmt.Sprintf("user%d", atomic.AddInt64(&data.users, 1)))
+	if err != nil {
+		b.Fatalf("creating the user: %v", err)
+	}
+	return user
+}
+
+// read reads the post and its comments
+func (data *benchData) read() error {
+	_, err := data.db.GetPost(data.postID)
+	if err != nil {
+		return err
+	}
+	_, err = data.db.GetPostComments(data.postID)
+	return err
+}
+
+// write likes the post and takes the like back
+func (data *benchData) write(likerID string) error {
+	err := data.db.LikePost(data.postID, likerID)
+	if err != nil {
+		return err
+	}
+	return data.db.UnlikePost(data.postID, likerID)
+}
+
+// runParallel runs the operation of each goroutine b.N times in total, and reports the share of the operations
+// failing because the database is locked. Any other error fails the benchmark.
+func runParallel(b *testing.B, data *benchData, operation func(likerID string, i int) error) {
+	var operations, failures int64
+	b.SetParallelism(4)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		liker := data.newUser(b)
+		for i := 0; pb.Next(); i++ {
+			atomic.AddInt64(&operations, 1)
+			err := operation(liker.UserID, i)
+			if err != nil && strings.Contains(err.Error(), "database is locked") {
+				atomic.AddInt64(&failures, 1)
+			} else if err != nil {
+				b.Errorf("unexpected error: %v", err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	if operations > 0 {
+		b.ReportMetric(float64(failures)/float64(operations), "failures/op")
+	}
+}
+
+func BenchmarkSQLiteReads(b *testing.B) {
+	for _, setup := range benchSetups {
+		b.Run(setup.name, func(b *testing.B) {
+			data := newBenchData(b, setup)
+			runParallel(b, data, func(string, int) error { return data.read() })
+		})
+	}
+}
+
+func BenchmarkSQLiteWrites(b *testing.B) {
+	for _, setup := range benchSetups {
+		b.Run(setup.name, func(b *testing.B) {
+			data := newBenchData(b, setup)
+			runParallel(b, data, func(likerID string, _ int) error { return data.write(likerID) })
+		})
+	}
+}
+
+// BenchmarkSQLiteMixed runs a write every 10 operations, the rest are reads
+func BenchmarkSQLiteMixed(b *testing.B) {
+	for _, setup := range benchSetups {
+		b.Run(setup.name, func(b *testing.B) {
+			data := newBenchData(b, setup)
+			runParallel(b, data, func(likerID string, i int) error {
+				if i%10 == 0 {
+					return data.write(likerID)
+				}
+				return data.read()
+			})
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+
 	"github.com/attiliov/WASA-Photo/service/structs"
 	"github.com/gofrs/uuid"
 )
@@ -11,28 +13,35 @@ import (
 /* This file contains the implementation of every function used to interact with the comment table
    i.e. the follwoing functions
    	GetPostComments(postID string) ([]structs.Comment, error)
-	CreateComment(postID string, comment structs.Comment) error
+	CreateComment(postID string, comment structs.Comment) (structs.ResourceID, error)
 	GetComment(commentID string) (structs.Comment, error)
-	EditComment(commentID string, comment structs.Comment) error
+	EditComment(commentID string, comment structs.Comment, version int) (int, error)
 	DeleteComment(commentID string) error
+	RestoreComment(commentID string, authorID string, deletedSince time.Time) error
+
+	GetUserComments(userID string) ([]structs.Comment, error)
 */
 
-// GetPostComments returns all the comments of the post with the given postID
-func (db *appdbimpl) GetPostComments(postID string) ([]structs.Comment, error) {
-	var comments []structs.Comment
-	rows, err := db.c.Query(`
+// getPostCommentsQuery selects the visible comments of a post
+const getPostCommentsQuery = `
 	SELECT 
 		id, 
 		author_id, 
 		username,
 		creation_date, 
 		caption, 
-		like_count 
+		like_count,
+		COALESCE(edited_at, '')
 	FROM 
 		Comment 
 	WHERE 
-		post_id = ?`,
-		postID)
+		post_id = ? AND deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM "User" WHERE "User".id = Comment.author_id AND "User".deleted_at IS NULL)`
+
+// GetPostComments returns all the comments of the post with the given postID
+func (db *appdbimpl) GetPostComments(postID string) ([]structs.Comment, error) {
+	var comments []structs.Comment
+	rows, err := db.c.Query(getPostCommentsQuery, postID)
 	if err != nil {
 		return comments, fmt.Errorf("error getting comments: %w", err)
 	}
@@ -40,7 +49,7 @@ func (db *appdbimpl) GetPostComments(postID string) ([]structs.Comment, error) {
 
 	for rows.Next() {
 		var comment structs.Comment
-		err := rows.Scan(&comment.CommentID, &comment.AuthorID, &comment.AuthorUsername, &comment.CreationDate, &comment.Caption, &comment.LikeCount)
+		err := rows.Scan(&comment.CommentID, &comment.AuthorID, &comment.AuthorUsername, scanTime(&comment.CreationDate), &comment.Caption, &comment.LikeCount, scanOptionalTime(&comment.EditedAt))
 		if err != nil {
 			return comments, fmt.Errorf("error getting comment: %w", err)
 		}
@@ -52,32 +61,33 @@ func (db *appdbimpl) GetPostComments(postID string) ([]structs.Comment, error) {
 	return comments, nil
 }
 
-// CreateComment creates a new comment in the database
-func (db *appdbimpl) CreateComment(postID string, comment structs.Comment) error {
+// CreateComment creates a new comment in the database and returns its ID. The comment is created now if it has no
+// creation date.
+func (db *appdbimpl) CreateComment(postID string, comment structs.Comment) (structs.ResourceID, error) {
 	// Check if the post exists
 	var postExists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Post WHERE id = ?)", postID).Scan(&postExists)
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Post WHERE id = ? AND deleted_at IS NULL)", postID).Scan(&postExists)
 	if err != nil {
-		return fmt.Errorf("error checking if post exists: %w", err)
+		return structs.ResourceID{}, fmt.Errorf("error checking if post exists: %w", err)
 	}
 	if !postExists {
-		return errors.New("post does not exist")
+		return structs.ResourceID{}, fmt.Errorf("post does not exist: %w", ErrNotFound)
 	}
 
 	// Check if the author exists
 	var authorExists bool
-	err = db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM User WHERE id = ?)", comment.AuthorID).Scan(&authorExists)
+	err = db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM "User" WHERE id = ? AND deleted_at IS NULL)`, comment.AuthorID).Scan(&authorExists)
 	if err != nil {
-		return fmt.Errorf("error checking if author exists: %w", err)
+		return structs.ResourceID{}, fmt.Errorf("error checking if author exists: %w", err)
 	}
 	if !authorExists {
-		return errors.New("author does not exist")
+		return structs.ResourceID{}, fmt.Errorf("author does not exist: %w", ErrNotFound)
 	}
 
 	// Generate a new UUID v4
 	id, err := uuid.NewV4()
 	if err != nil {
-		return fmt.Errorf("error generating UUID: %w", err)
+		return structs.ResourceID{}, fmt.Errorf("error generating UUID: %w", err)
 	}
 	comment.CommentID = id.String()
 
@@ -86,9 +96,9 @@ func (db *appdbimpl) CreateComment(postID string, comment structs.Comment) error
 		Comment(id, username, post_id, author_id, creation_date, caption, like_count) 
 	VALUES 
 		(?, ?, ?, ?, ?, ?, ?)`,
-		comment.CommentID, comment.AuthorUsername, postID, comment.AuthorID, comment.CreationDate, comment.Caption, 0)
+		comment.CommentID, comment.AuthorUsername, postID, comment.AuthorID, formatCreationDate(comment.CreationDate), comment.Caption, 0)
 	if err != nil {
-		return fmt.Errorf("error creating comment: %w", err)
+		return structs.ResourceID{}, fmt.Errorf("error creating comment: %w", err)
 	}
 
 	// Update the post's comments count
@@ -101,74 +111,106 @@ func (db *appdbimpl) CreateComment(postID string, comment structs.Comment) error
 		id = ?`,
 		postID)
 	if err != nil {
-		return fmt.Errorf("error updating post's comment count: %w", err)
+		return structs.ResourceID{}, fmt.Errorf("error updating post's comment count: %w", err)
 	}
 
-	return nil
+	return structs.ResourceID{ResourceID: comment.CommentID}, nil
 }
 
-// GetComment returns the comment with the given commentID
-func (db *appdbimpl) GetComment(commentID string) (structs.Comment, error) {
-	var comment structs.Comment
-	err := db.c.QueryRow(`
+// getCommentQuery selects a visible comment
+const getCommentQuery = `
 	SELECT 
 		id, 
 		author_id, 
 		username,
 		creation_date, 
 		caption, 
-		like_count 
+		like_count,
+		COALESCE(edited_at, ''),
+		version
 	FROM 
 		Comment 
 	WHERE 
-		id = ?`,
-		commentID).Scan(&comment.CommentID, &comment.AuthorID, &comment.AuthorUsername, &comment.CreationDate, &comment.Caption, &comment.LikeCount)
+		id = ? AND deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM "User" WHERE "User".id = Comment.author_id AND "User".deleted_at IS NULL)`
+
+// GetComment returns the comment with the given commentID
+func (db *appdbimpl) GetComment(commentID string) (structs.Comment, error) {
+	var comment structs.Comment
+	err := db.c.QueryRow(getCommentQuery, commentID).Scan(&comment.CommentID, &comment.AuthorID, &comment.AuthorUsername, scanTime(&comment.CreationDate), &comment.Caption, &comment.LikeCount, scanOptionalTime(&comment.EditedAt), &comment.Version)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return comment, errors.New("comment does not exist")
+		if errors.Is(err, sql.ErrNoRows) {
+			return comment, fmt.Errorf("comment does not exist: %w", ErrNotFound)
 		}
 		return comment, fmt.Errorf("error getting comment: %w", err)
 	}
 	return comment, nil
 }
 
-// EditComment edits the comment with the given commentID
-func (db *appdbimpl) EditComment(commentID string, comment structs.Comment) error {
-	// Check if the comment exists
-	var commentExists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Comment WHERE id = ?)", commentID).Scan(&commentExists)
+// EditComment edits the caption of the comment with the given commentID, if the comment is still at the given version,
+// and returns the new version. It returns ErrVersionMismatch if the comment was modified in the meantime.
+// If the caption changes, the previous one is saved as a revision and the comment is marked as edited.
+func (db *appdbimpl) EditComment(commentID string, comment structs.Comment, version int) (int, error) {
+	tx, err := db.c.Begin()
 	if err != nil {
-		return fmt.Errorf("error checking if comment exists: %w", err)
+		return 0, fmt.Errorf("error starting transaction: %w", err)
 	}
-	if !commentExists {
-		return errors.New("comment does not exist")
+	defer func() { _ = tx.Rollback() }()
+
+	// Get the current caption and version (also checks that the comment exists)
+	var oldCaption string
+	var currentVersion int
+	err = tx.QueryRow("SELECT caption, version FROM Comment WHERE id = ? AND deleted_at IS NULL", commentID).Scan(&oldCaption, &currentVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("comment does not exist: %w", ErrNotFound)
+		}
+		return 0, fmt.Errorf("error checking if comment exists: %w", err)
+	}
+	if currentVersion != version {
+		return 0, ErrVersionMismatch
+	}
+	if oldCaption == comment.Caption {
+		return version, nil
 	}
 
-	_, err = db.c.Exec(`
+	err = addRevision(tx, commentID, oldCaption)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
 	UPDATE 
 		Comment 
 	SET 
-		caption = ? 
+		caption = ?,
+		edited_at = ?,
+		version = version + 1
 	WHERE 
 		id = ?`,
-		comment.Caption, commentID)
+		comment.Caption, now(), commentID)
 	if err != nil {
-		return fmt.Errorf("error editing comment: %w", err)
+		return 0, fmt.Errorf("error editing comment: %w", err)
 	}
-	return nil
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("error committing comment edit: %w", err)
+	}
+	return version + 1, nil
 }
 
-// DeleteComment deletes the comment with the given commentID
+// DeleteComment marks the comment with the given commentID as deleted
 func (db *appdbimpl) DeleteComment(commentID string) error {
 
 	// Check if the comment exists
 	var commentExists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Comment WHERE id = ?)", commentID).Scan(&commentExists)
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Comment WHERE id = ? AND deleted_at IS NULL)", commentID).Scan(&commentExists)
 	if err != nil {
 		return fmt.Errorf("error checking if comment exists: %w", err)
 	}
 	if !commentExists {
-		return errors.New("comment does not exist")
+		return fmt.Errorf("comment does not exist: %w", ErrNotFound)
 	}
 
 	// Get the postID of the comment
@@ -178,8 +220,8 @@ func (db *appdbimpl) DeleteComment(commentID string) error {
 		return fmt.Errorf("error getting postID of comment: %w", err)
 	}
 
-	// Delete the comment
-	_, err = db.c.Exec("DELETE FROM Comment WHERE id = ?", commentID)
+	// Mark the comment as deleted, it will be removed for good by PurgeDeleted
+	_, err = db.c.Exec("UPDATE Comment SET deleted_at = ? WHERE id = ?", now(), commentID)
 	if err != nil {
 		return fmt.Errorf("error deleting comment: %w", err)
 	}
@@ -199,3 +241,83 @@ func (db *appdbimpl) DeleteComment(commentID string) error {
 
 	return nil
 }
+
+// RestoreComment restores the comment with the given commentID, if it belongs to authorID and was deleted after
+// deletedSince
+func (db *appdbimpl) RestoreComment(commentID string, authorID string, deletedSince time.Time) error {
+	// Get the postID of the comment
+	var postID string
+	err := db.c.QueryRow(`
+	SELECT 
+		post_id 
+	FROM 
+		Comment 
+	WHERE 
+		id = ? AND author_id = ? AND deleted_at >= ? AND removed_by IS NULL AND held_at IS NULL`,
+		commentID, authorID, formatTime(deletedSince)).Scan(&postID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no restorable comment found: %w", ErrNotFound)
+		}
+		return fmt.Errorf("error getting comment: %w", err)
+	}
+
+	// Restore the comment
+	_, err = db.c.Exec("UPDATE Comment SET deleted_at = NULL WHERE id = ?", commentID)
+	if err != nil {
+		return fmt.Errorf("error restoring comment: %w", err)
+	}
+
+	// Update the post's comments count
+	_, err = db.c.Exec(`
+	UPDATE
+		Post
+	SET
+		comment_count = comment_count + 1
+	WHERE
+		id = ?`,
+		postID)
+	if err != nil {
+		return fmt.Errorf("error updating post's comment count: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserComments returns all the comments written by the user with the given userID, oldest first
+func (db *appdbimpl) GetUserComments(userID string) ([]structs.Comment, error) {
+	var comments []structs.Comment
+	rows, err := db.c.Query(`
+	SELECT 
+		id, 
+		author_id, 
+		username,
+		creation_date, 
+		caption, 
+		like_count,
+		COALESCE(edited_at, '')
+	FROM 
+		Comment 
+	WHERE 
+		author_id = ? AND deleted_at IS NULL
+	ORDER BY
+		creation_date`,
+		userID)
+	if err != nil {
+		return comments, fmt.Errorf("error getting user comments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var comment structs.Comment
+		err := rows.Scan(&comment.CommentID, &comment.AuthorID, &comment.AuthorUsername, scanTime(&comment.CreationDate), &comment.Caption, &comment.LikeCount, scanOptionalTime(&comment.EditedAt))
+		if err != nil {
+			return comments, fmt.Errorf("error getting comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return comments, fmt.Errorf("error iterating over comments: %w", err)
+	}
+	return comments, nil
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+/*
+	This file contains the implementation of every function used to interact with the credentials of the users
+	i.e. the follwoing functions
+	GetPasswordHash(userID string) (string, error)
+	SetPasswordHash(userID string, hash string) error
+	ClaimAccount(userID string, hash string) error
+	CreateSession(tokenHash string, userID string) error
+	GetSessionUser(tokenHash string) (string, error)
+*/
+
+// GetPasswordHash returns the password hash of the user with the given userID, or an empty string if the user has
+// no password (username-only account)
+func (db *appdbimpl) GetPasswordHash(userID string) (string, error) {
+	var hash sql.NullString
+	err := db.c.QueryRow(`
+	SELECT 
+		password_hash 
+	FROM 
+		"User" 
+	WHERE 
+		id = ? AND deleted_at IS NULL`,
+		userID).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("user not found: %w", ErrNotFound)
+		}
+		return "", fmt.Errorf("error getting password hash: %w", err)
+	}
+	return hash.String, nil
+}
+
+// SetPasswordHash sets the password hash of the user with the given userID
+func (db *appdbimpl) SetPasswordHash(userID string, hash string) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		"User" 
+	SET 
+		password_hash = ? 
+	WHERE 
+		id = ? AND deleted_at IS NULL`,
+		hash, userID)
+	if err != nil {
+		return fmt.Errorf("error setting password hash: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error setting password hash: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("user not found: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// ClaimAccount sets the password hash of the user with the given userID, if the user has no password yet
+// (username-only account). It returns ErrConflict if the user already has one.
+func (db *appdbimpl) ClaimAccount(userID string, hash string) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		"User" 
+	SET 
+		password_hash = ? 
+	WHERE 
+		id = ? AND deleted_at IS NULL AND COALESCE(password_hash, '') = ''`,
+		hash, userID)
+	if err != nil {
+		return fmt.Errorf("error claiming account: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error claiming account: %w", err)
+	}
+	if affected == 0 {
+		// Either the user doesn't exist or it has a password
+		_, err = db.GetPasswordHash(userID)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("account already claimed: %w", ErrConflict)
+	}
+	return nil
+}
+
+// CreateSession records a session of the user with the given userID, identified by the hash of its token
+func (db *appdbimpl) CreateSession(tokenHash string, userID string) error {
+	_, err := db.c.Exec(`
+	INSERT INTO 
+		Session (token_hash, user_id, creation_date) 
+	VALUES 
+		(?, ?, ?)`,
+		tokenHash, userID, now())
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	return nil
+}
+
+// getSessionUserQuery selects the user of a session
+const getSessionUserQuery = `
+	SELECT 
+		user_id 
+	FROM 
+		Session 
+	WHERE 
+		token_hash = ?`
+
+// GetSessionUser returns the ID of the user of the session identified by the hash of its token. The user can be
+// deleted or suspended.
+func (db *appdbimpl) GetSessionUser(tokenHash string) (string, error) {
+	var userID string
+	err := db.c.QueryRow(getSessionUserQuery, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("session not found: %w", ErrNotFound)
+		}
+		return "", fmt.Errorf("error getting session: %w", err)
+	}
+	return userID, nil
+}
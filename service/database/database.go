@@ -27,6 +27,15 @@ This is an example on how to migrate the DB and connect to it:
 	}()
 
 Then you can initialize the AppDatabase and pass it to the api package.
+
+Both SQLite (github.com/mattn/go-sqlite3, driver "sqlite3") and PostgreSQL (github.com/lib/pq, driver "postgres") are
+supported: New finds the engine from the driver of the connection, see dialect.go. The schema is the same for both
+engines, written for each of them: init.sql and the migrations of SQLite, init-postgres.sql and the migrations of
+PostgreSQL. SQLite needs cgo. For a server, OpenSQLite opens the SQLite file in WAL mode with separate connections
+writing and reading, to pass to NewWithReader.
+
+For the tests and the demos, package memdb implements AppDatabase in memory with the same semantics, checked by the
+conformance suite of package databasetest.
 */
 package database
 
@@ -39,8 +48,11 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/attiliov/WASA-Photo/service/globaltime"
 	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/lib/pq"
 )
 
 // AppDatabase is the high level interface for the DB
@@ -48,20 +60,70 @@ type AppDatabase interface {
 	GetUser(username string) (structs.User, error)
 	CreateUser(username string) (structs.User, error)
 	SearchUsername(username string) ([]structs.User, error)
-	UpdateUser(userID string, user structs.User) error
+	UpdateUser(userID string, user structs.User, version int) (int, error)
 	DeleteUser(userID string) error
+	RestoreUser(userID string, deletedSince time.Time) error
+	IsActiveUser(userID string) (bool, error)
+	GetUsernameHistory(userID string) ([]structs.UsernameChange, error)
+	ResolveUsername(username string) (string, error)
+	GetLookalikeUsers(username string) ([]structs.User, error)
+
+	GetPasswordHash(userID string) (string, error)
+	SetPasswordHash(userID string, hash string) error
+	ClaimAccount(userID string, hash string) error
+	CreateSession(tokenHash string, userID string) error
+	GetSessionUser(tokenHash string) (string, error)
+
+	GetIdentityUser(issuer string, subject string) (string, error)
+	LinkIdentity(issuer string, subject string, userID string) error
+	GetUserByEmail(email string) (structs.User, error)
+	SetUserEmail(userID string, email string) error
+
+	GetUserRole(userID string) (string, error)
+	SetUserRole(userID string, role string) error
+	IsSuspended(userID string) (bool, error)
+	SuspendUser(userID string) error
+	UnsuspendUser(userID string) error
+	ListUsers(offset int, limit int) ([]structs.AdminUser, error)
+	GetPostAuthor(postID string) (string, error)
+	GetCommentAuthor(commentID string) (string, error)
+	RemovePost(postID string, moderatorID string) error
+	RemoveComment(commentID string, moderatorID string) error
+	HoldPost(postID string) error
+	HoldComment(commentID string) error
+	ReleasePost(postID string) error
+	ReleaseComment(commentID string) error
+	GetStats() (structs.Stats, error)
+
+	AddAuditEntry(actorID string, action string, targetID string, details string) error
+	GetAuditLog(offset int, limit int) ([]structs.AuditEntry, error)
+
+	CreateReport(report structs.Report) (structs.Report, error)
+	GetReport(reportID string) (structs.Report, error)
+	GetReports(status string, offset int, limit int) ([]structs.Report, error)
+	HasOpenReport(reporterID string, targetID string) (bool, error)
+	ClaimReport(reportID string, moderatorID string) error
+	CloseReport(reportID string, moderatorID string, status string, action string, note string) error
+
+	AddWarning(userID string, reportID string, note string) error
+	GetUserWarnings(userID string) ([]structs.Warning, error)
 
 	GetUserPosts(userID string) ([]structs.ResourceID, error)
 	AddPost(post structs.UserPost) (structs.ResourceID, error)
 	GetPost(postID string) (structs.UserPost, error)
-	UpdatePost(postID string, post structs.UserPost) error
+	UpdatePost(postID string, post structs.UserPost, version int) (int, error)
 	DeletePost(postID string) error
+	RestorePost(postID string, authorID string, deletedSince time.Time) error
 
 	GetPostComments(postID string) ([]structs.Comment, error)
-	CreateComment(postID string, comment structs.Comment) error
+	CreateComment(postID string, comment structs.Comment) (structs.ResourceID, error)
 	GetComment(commentID string) (structs.Comment, error)
-	EditComment(commentID string, comment structs.Comment) error
+	EditComment(commentID string, comment structs.Comment, version int) (int, error)
 	DeleteComment(commentID string) error
+	RestoreComment(commentID string, authorID string, deletedSince time.Time) error
+
+	GetPostRevisions(postID string) ([]structs.Revision, error)
+	GetCommentRevisions(commentID string) ([]structs.Revision, error)
 
 	GetPostLikes(postID string) ([]structs.Like, error)
 	LikePost(postID string, likerID string) error
@@ -83,23 +145,85 @@ type AppDatabase interface {
 
 	GetUserFeed(userID string) ([]structs.ResourceID, error)
 
+	GetUserComments(userID string) ([]structs.Comment, error)
+	GetUserLikes(userID string) ([]structs.Like, error)
+
+	CreateJob(kind string, userID string, scheduledDate time.Time) (structs.Job, error)
+	GetJob(jobID string) (structs.Job, error)
+	GetUserJobs(userID string) ([]structs.Job, error)
+	UpdateJob(jobID string, status string, progress int) error
+	CancelJobs(kind string, userID string) error
+	GetDueJobs(kind string, due time.Time) ([]structs.Job, error)
+
+	DeleteUserLikes(userID string) error
+	DeleteUserFollows(userID string) error
+	DeleteUserBans(userID string) error
+	DeleteUserComments(userID string) error
+	DeleteUserPosts(userID string) error
+	EraseUser(userID string) error
+
+	GetUserPhotos(userID string, includeDeleted bool) ([]string, error)
 	SavePhoto(userID string, photo multipart.File) (string, error)
 	GetPhoto(userID string, photoID string) ([]byte, error)
 	DeletePhoto(userID string, photoID string) error
 
+	PurgeDeleted(deletedBefore time.Time) error
+	PurgePost(postID string) ([]string, error)
+	PurgeComment(commentID string) error
+
+	ReserveIdempotencyKey(scope string, key string, fingerprint string, expiredBefore time.Time) (structs.IdempotentResponse, bool, error)
+	SaveIdempotentResponse(scope string, key string, response structs.IdempotentResponse) error
+	DeleteIdempotencyKey(scope string, key string) error
+	PurgeIdempotencyKeys(createdBefore time.Time) error
+
+	RunInTransaction(action func(tx AppDatabase) error) error
+
 	Ping() error
 }
 
+// Errors returned by AppDatabase, wrapped with the details of the failure. Check them with errors.Is.
+var (
+	// ErrNotFound is returned when the requested resource does not exist, or was deleted
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when a change is not compatible with the current state of the database, e.g. a
+	// duplicate of a unique value
+	ErrConflict = errors.New("conflict")
+
+	// ErrVersionMismatch is returned when updating a resource that was modified since the version the update is based on
+	ErrVersionMismatch = errors.New("the resource was modified by another request")
+)
+
 type appdbimpl struct {
-	c *sql.DB
+	c *dbConn
 }
 
-// New returns a new instance of AppDatabase based on the SQLite connection `db`.
+// New returns a new instance of AppDatabase based on the SQLite or PostgreSQL connection `db`.
 // `db` is required - an error will be returned if `db` is `nil`.
 func New(db *sql.DB) (AppDatabase, error) {
+	return NewWithReader(db, nil)
+}
+
+// NewWithReader returns a new instance of AppDatabase like New, running the queries that only read outside of
+// transactions on `reader`, e.g. the read-only connections of OpenSQLite. `reader` defaults to `db` if nil.
+// The queries run on every page of the app are prepared once, see preparedQueries: New fails if they can't be.
+func NewWithReader(db *sql.DB, reader *sql.DB) (AppDatabase, error) {
+	return newDatabase(db, reader, preparedQueries)
+}
+
+// newDatabase is NewWithReader preparing the given queries instead of preparedQueries
+func newDatabase(db *sql.DB, reader *sql.DB, queries []string) (AppDatabase, error) {
 	if db == nil {
 		return nil, errors.New("database is required when building a AppDatabase")
 	}
+	if reader == nil {
+		reader = db
+	}
+	d, err := dialectOf(db)
+	if err != nil {
+		return nil, err
+	}
+	c := &dbConn{db: db, reader: reader, dialect: d}
 
 	// ---Initialize the database
 	// Get the directory of the current file
@@ -108,10 +232,10 @@ func New(db *sql.DB) (AppDatabase, error) {
 		return nil, errors.New("unable to get current directory")
 	}
 	dir := filepath.Dir(filename)
-	// Read the init.sql file
-	initSQL, err := os.ReadFile(filepath.Join(dir, "init.sql"))
+	// Read the init script of the dialect, e.g. init.sql
+	initSQL, err := os.ReadFile(filepath.Join(dir, d.initScript()))
 	if err != nil {
-		return nil, fmt.Errorf("error reading init.sql: %w", err)
+		return nil, fmt.Errorf("error reading %s: %w", d.initScript(), err)
 	}
 	// Split the SQL statements
 	statements := strings.Split(string(initSQL), ";")
@@ -119,18 +243,162 @@ func New(db *sql.DB) (AppDatabase, error) {
 	for _, statement := range statements {
 		statement = strings.TrimSpace(statement) // remove leading and trailing spaces
 		if statement != "" {
-			_, err = db.Exec(statement)
+			_, err = c.Exec(statement)
 			if err != nil {
 				return nil, fmt.Errorf("error executing statement %q: %w", statement, err)
 			}
 		}
 	}
 
+	// Apply the migrations on top of the base schema
+	err = migrate(c)
+	if err != nil {
+		return nil, fmt.Errorf("error migrating database: %w", err)
+	}
+	err = backfillUsernames(c)
+	if err != nil {
+		return nil, fmt.Errorf("error backfilling usernames: %w", err)
+	}
+
+	// Prepare the statements once the schema is up to date: the plans of the statements prepared before a change of the
+	// schema would be stale
+	c.statements, err = prepareStatements(db, d, queries)
+	if err != nil {
+		return nil, err
+	}
+	c.readerStatements = c.statements
+	if reader != db {
+		c.readerStatements, err = prepareStatements(reader, d, queries)
+		if err != nil {
+			c.statements.close()
+			return nil, err
+		}
+	}
+
 	return &appdbimpl{
-		c: db,
+		c: c,
 	}, nil
 }
 
 func (db *appdbimpl) Ping() error {
 	return db.c.Ping()
 }
+
+// RunInTransaction calls action with a database running every query in a single transaction, committed if action
+// returns nil and rolled back otherwise. The transactions of the methods called by action are part of it.
+func (db *appdbimpl) RunInTransaction(action func(tx AppDatabase) error) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	c := *db.c
+	c.tx = tx
+	err = action(&appdbimpl{c: &c})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// timeFormat is the format of the dates stored in the database: RFC 3339 in UTC, with milliseconds. Every date has
+// the same length, so that the stored dates compare correctly as strings.
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// now returns the current time formatted for storage in the database
+func now() string {
+	return formatTime(globaltime.Now())
+}
+
+// formatTime formats t for storage in the database. Stored times compare correctly as strings.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// formatCreationDate formats the creation date of a new post or comment, the current time if it is not set
+func formatCreationDate(t time.Time) string {
+	if t.IsZero() {
+		return now()
+	}
+	return formatTime(t)
+}
+
+// storedTime returns t as it is read back from the database once stored, see formatTime
+func storedTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+// parseTime parses a date read from the database, see formatTime. SQLite returns the DATETIME columns already parsed.
+// The second result is false if the date is NULL or empty.
+func parseTime(src interface{}) (time.Time, bool, error) {
+	switch v := src.(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case time.Time:
+		return v.UTC(), true, nil
+	case []byte:
+		return parseTime(string(v))
+	case string:
+		if v == "" {
+			return time.Time{}, false, nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date %q: %w", v, err)
+		}
+		return t.UTC(), true, nil
+	default:
+		return time.Time{}, false, fmt.Errorf("invalid date of type %T", src)
+	}
+}
+
+// timeScanner scans a date of the database into a time.Time, the zero time if the date is NULL
+type timeScanner struct {
+	t *time.Time
+}
+
+func (s timeScanner) Scan(src interface{}) error {
+	t, _, err := parseTime(src)
+	*s.t = t
+	return err
+}
+
+// scanTime returns the destination of rows.Scan for a date to store in t
+func scanTime(t *time.Time) sql.Scanner {
+	return timeScanner{t: t}
+}
+
+// optionalTimeScanner scans a date of the database into a *time.Time, nil if the date is NULL or empty
+type optionalTimeScanner struct {
+	t **time.Time
+}
+
+func (s optionalTimeScanner) Scan(src interface{}) error {
+	t, ok, err := parseTime(src)
+	*s.t = nil
+	if ok {
+		*s.t = &t
+	}
+	return err
+}
+
+// scanOptionalTime returns the destination of rows.Scan for a date, possibly NULL, to store in t
+func scanOptionalTime(t **time.Time) sql.Scanner {
+	return optionalTimeScanner{t: t}
+}
+
+// isConstraintViolation reports whether err is the violation of a constraint of the schema, e.g. of a unique index
+func isConstraintViolation(err error) bool {
+	if isSQLiteConstraintViolation(err) {
+		return true
+	}
+	// Class 23 of the SQLSTATE codes: integrity constraint violation
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Class() == "23"
+}
@@ -0,0 +1,1400 @@
+/*
+Package databasetest is the conformance test suite of the implementations of database.AppDatabase. Every
+implementation must pass it, so that the API behaves the same whatever the database.
+
+	func TestConformance(t *testing.T) {
+		databasetest.Run(t, func(t *testing.T) database.AppDatabase {
+			// Return a new empty database
+		})
+	}
+
+The suite checks the behavior seen by the API: the errors returned, the counters, the visibility of deleted, held and
+banned content, the ordering of the lists when it is defined. It does not check how the data is stored.
+*/
+package databasetest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// tests are the tests of the suite, each one run on a new database
+var tests = []struct {
+	name string
+	run  func(t *testing.T, db database.AppDatabase)
+}{
+	{"Users", testUsers},
+	{"UsernameChanges", testUsernameChanges},
+	{"UserDeletion", testUserDeletion},
+	{"Credentials", testCredentials},
+	{"Sessions", testSessions},
+	{"Identities", testIdentities},
+	{"Administration", testAdministration},
+	{"Posts", testPosts},
+	{"Feed", testFeed},
+	{"Comments", testComments},
+	{"Likes", testLikes},
+	{"Follows", testFollows},
+	{"Bans", testBans},
+	{"Moderation", testModeration},
+	{"Reports", testReports},
+	{"AuditLog", testAuditLog},
+	{"Jobs", testJobs},
+	{"AccountErasure", testAccountErasure},
+	{"Purge", testPurge},
+	{"Photos", testPhotos},
+	{"IdempotencyKeys", testIdempotencyKeys},
+	{"Transactions", testTransactions},
+}
+
+// Run runs the suite. open must return a new empty database at every call.
+func Run(t *testing.T, open func(t *testing.T) database.AppDatabase) {
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, open(t))
+		})
+	}
+}
+
+// hourAgo returns the time an hour ago, a bound including what the test just did
+func hourAgo() time.Time {
+	return time.Now().Add(-time.Hour)
+}
+
+// inAnHour returns the time in an hour, a bound excluding what the test just did
+func inAnHour() time.Time {
+	return time.Now().Add(time.Hour)
+}
+
+// recent reports whether the date is close to the current time, i.e. set by the database
+func recent(date time.Time) bool {
+	return date.After(hourAgo()) && date.Before(inAnHour())
+}
+
+// parseDate parses a date in RFC 3339
+func parseDate(t *testing.T, date string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		t.Fatalf("invalid date %s: %v", date, err)
+	}
+	return parsed
+}
+
+// createUser creates a user with the given username
+func createUser(t *testing.T, db database.AppDatabase, username string) structs.User {
+	t.Helper()
+	user, err := db.CreateUser(username)
+	if err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return user
+}
+
+// addPost adds a post of author with the given caption and creation date
+func addPost(t *testing.T, db database.AppDatabase, author structs.User, caption string, date string) string {
+	t.Helper()
+	id, err := db.AddPost(structs.UserPost{
+		AuthorID:       author.UserID,
+		AuthorUsername: author.Username,
+		CreationDate:   parseDate(t, date),
+		Caption:        caption,
+	})
+	if err != nil {
+		t.Fatalf("adding post %q: %v", caption, err)
+	}
+	return id.ResourceID
+}
+
+// addComment adds a comment of author to the post with the given caption and creation date
+func addComment(t *testing.T, db database.AppDatabase, postID string, author structs.User, caption string, date string) string {
+	t.Helper()
+	id, err := db.CreateComment(postID, structs.Comment{
+		AuthorID:       author.UserID,
+		AuthorUsername: author.Username,
+		CreationDate:   parseDate(t, date),
+		Caption:        caption,
+	})
+	if err != nil {
+		t.Fatalf("adding comment %q: %v", caption, err)
+	}
+	return id.ResourceID
+}
+
+// getPost returns the post with the given postID
+func getPost(t *testing.T, db database.AppDatabase, postID string) structs.UserPost {
+	t.Helper()
+	post, err := db.GetPost(postID)
+	if err != nil {
+		t.Fatalf("getting post %s: %v", postID, err)
+	}
+	return post
+}
+
+// getUser returns the user with the given username or ID
+func getUser(t *testing.T, db database.AppDatabase, param string) structs.User {
+	t.Helper()
+	user, err := db.GetUser(param)
+	if err != nil {
+		t.Fatalf("getting user %s: %v", param, err)
+	}
+	return user
+}
+
+// check fails the test if err is not nil
+func check(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+}
+
+// checkError fails the test if err is not target
+func checkError(t *testing.T, what string, err error, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("%s: expected %q, got %v", what, target, err)
+	}
+}
+
+// postIDs returns the IDs of the resources
+func postIDs(ids []structs.ResourceID) []string {
+	list := make([]string, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, id.ResourceID)
+	}
+	return list
+}
+
+// userIDs returns the IDs of the users
+func userIDs(users []structs.User) []string {
+	list := make([]string, 0, len(users))
+	for _, user := range users {
+		list = append(list, user.UserID)
+	}
+	return list
+}
+
+// equal returns true if the lists have the same elements in the same order
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameElements returns true if the lists have the same elements, in any order
+func sameElements(a []string, b []string) bool {
+	counts := make(map[string]int)
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+	}
+	for _, n := range counts {
+		if n != 0 {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+func testUsers(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "Alice")
+	if alice.UserID == "" || alice.Username != "Alice" || alice.Followers != 0 || alice.Following != 0 ||
+		!recent(alice.SignUpDate) || alice.LastSeenDate != alice.SignUpDate {
+		t.Fatalf("unexpected created user %+v", alice)
+	}
+	_, err := db.CreateUser("alice")
+	checkError(t, "creating a user with the same username in another case", err, database.ErrConflict)
+	createUser(t, db, "Alicia")
+
+	// By ID, by username, ignoring the case
+	for _, param := range []string{alice.UserID, "Alice", "ALICE"} {
+		user := getUser(t, db, param)
+		if user.UserID != alice.UserID || user.Username != "Alice" || user.SignUpDate != alice.SignUpDate || user.Version != 1 {
+			t.Fatalf("unexpected user %+v for %s", user, param)
+		}
+	}
+	_, err = db.GetUser("nobody")
+	checkError(t, "getting an unknown user", err, database.ErrNotFound)
+
+	active, err := db.IsActiveUser(alice.UserID)
+	if err != nil || !active {
+		t.Fatalf("expected an active user: %v", err)
+	}
+	active, err = db.IsActiveUser("unknown")
+	if err != nil || active {
+		t.Fatalf("expected an unknown user not to be active: %v", err)
+	}
+
+	// Substrings of the username, ignoring the case
+	found, err := db.SearchUsername("LIC")
+	if err != nil || len(found) != 2 {
+		t.Fatalf("expected the 2 users, got %+v: %v", found, err)
+	}
+	found, err = db.SearchUsername("alici")
+	if err != nil || len(found) != 1 || found[0].Username != "Alicia" {
+		t.Fatalf("expected Alicia, got %+v: %v", found, err)
+	}
+
+	// Usernames that look alike, e.g. with a digit in place of a letter
+	paolo := createUser(t, db, "paolo")
+	lookalikes, err := db.GetLookalikeUsers("pao1o")
+	if err != nil || !equal(userIDs(lookalikes), []string{paolo.UserID}) {
+		t.Fatalf("expected paolo as lookalike, got %+v: %v", lookalikes, err)
+	}
+}
+
+func testUsernameChanges(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	createUser(t, db, "bobby")
+	postID := addPost(t, db, alice, "A post", "2024-01-01T10:00:00Z")
+
+	alice.Username = "alicia"
+	version, err := db.UpdateUser(alice.UserID, alice, 1)
+	if err != nil || version != 2 {
+		t.Fatalf("expected version 2, got %d: %v", version, err)
+	}
+	_, err = db.UpdateUser(alice.UserID, alice, 1)
+	checkError(t, "updating a stale user", err, database.ErrVersionMismatch)
+	alice.Username = "Bobby"
+	_, err = db.UpdateUser(alice.UserID, alice, 2)
+	checkError(t, "taking the username of another user", err, database.ErrConflict)
+
+	// The new username is propagated, the old one is recorded
+	user := getUser(t, db, "alicia")
+	if user.UserID != alice.UserID || user.Version != 2 {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if post := getPost(t, db, postID); post.AuthorUsername != "alicia" {
+		t.Fatalf("expected the new username on the post, got %q", post.AuthorUsername)
+	}
+	history, err := db.GetUsernameHistory(alice.UserID)
+	if err != nil || len(history) != 1 || history[0].Username != "alice" {
+		t.Fatalf("unexpected username history %+v: %v", history, err)
+	}
+	resolved, err := db.ResolveUsername("ALICE")
+	if err != nil || resolved != alice.UserID {
+		t.Fatalf("expected the old username to resolve to the user, got %q: %v", resolved, err)
+	}
+	_, err = db.GetUser("alice")
+	checkError(t, "getting the user by the old username", err, database.ErrNotFound)
+
+	// Going back to the old username removes it from the history
+	user.Username = "alice"
+	_, err = db.UpdateUser(alice.UserID, user, 2)
+	check(t, "going back to the old username", err)
+	history, err = db.GetUsernameHistory(alice.UserID)
+	if err != nil || len(history) != 1 || history[0].Username != "alicia" {
+		t.Fatalf("unexpected username history %+v: %v", history, err)
+	}
+	_, err = db.ResolveUsername("alice")
+	checkError(t, "resolving the current username", err, database.ErrNotFound)
+
+	// The bio and the profile image are updated too
+	user.Bio = "Hello"
+	user.ProfileImage = "image"
+	_, err = db.UpdateUser(alice.UserID, user, 3)
+	check(t, "updating the bio", err)
+	user = getUser(t, db, alice.UserID)
+	if user.Bio != "Hello" || user.ProfileImage != "image" || user.Version != 4 {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	_, err = db.UpdateUser("unknown", user, 1)
+	checkError(t, "updating an unknown user", err, database.ErrNotFound)
+}
+
+func testUserDeletion(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	postID := addPost(t, db, alice, "A post", "2024-01-01T10:00:00Z")
+	commentID := addComment(t, db, postID, alice, "A comment", "2024-01-01T11:00:00Z")
+	check(t, "liking the post", db.LikePost(postID, alice.UserID))
+	check(t, "following", db.FollowUser(bob.UserID, alice.UserID))
+
+	check(t, "deleting the user", db.DeleteUser(alice.UserID))
+	checkError(t, "deleting the user again", db.DeleteUser(alice.UserID), database.ErrNotFound)
+
+	// The user and their content are hidden
+	_, err := db.GetUser(alice.UserID)
+	checkError(t, "getting a deleted user", err, database.ErrNotFound)
+	active, err := db.IsActiveUser(alice.UserID)
+	if err != nil || active {
+		t.Fatalf("expected a deleted user not to be active: %v", err)
+	}
+	found, err := db.SearchUsername("alice")
+	if err != nil || len(found) != 0 {
+		t.Fatalf("expected no user, got %+v: %v", found, err)
+	}
+	_, err = db.GetPost(postID)
+	checkError(t, "getting the post of a deleted user", err, database.ErrNotFound)
+	_, err = db.GetComment(commentID)
+	checkError(t, "getting the comment of a deleted user", err, database.ErrNotFound)
+	posts, err := db.GetUserPosts(alice.UserID)
+	if err != nil || len(posts) != 0 {
+		t.Fatalf("expected no post, got %+v: %v", posts, err)
+	}
+	feed, err := db.GetUserFeed(bob.UserID)
+	if err != nil || len(feed) != 0 {
+		t.Fatalf("expected an empty feed, got %+v: %v", feed, err)
+	}
+	followings, err := db.GetFollowingsList(bob.UserID)
+	if err != nil || len(followings) != 0 {
+		t.Fatalf("expected no following, got %+v: %v", followings, err)
+	}
+	_, err = db.CreateUser("alice")
+	checkError(t, "taking the username of a deleted user", err, database.ErrConflict)
+
+	// Restored only if deleted since the given date
+	err = db.RestoreUser(alice.UserID, inAnHour())
+	checkError(t, "restoring a user deleted before the date", err, database.ErrNotFound)
+	check(t, "restoring the user", db.RestoreUser(alice.UserID, hourAgo()))
+	if post := getPost(t, db, postID); post.Caption != "A post" {
+		t.Fatalf("unexpected post %+v", post)
+	}
+	err = db.RestoreUser(bob.UserID, hourAgo())
+	checkError(t, "restoring a user not deleted", err, database.ErrNotFound)
+}
+
+func testCredentials(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	hash, err := db.GetPasswordHash(alice.UserID)
+	if err != nil || hash != "" {
+		t.Fatalf("expected no password, got %q: %v", hash, err)
+	}
+	check(t, "setting the password", db.SetPasswordHash(alice.UserID, "hash"))
+	hash, err = db.GetPasswordHash(alice.UserID)
+	if err != nil || hash != "hash" {
+		t.Fatalf("expected the password hash, got %q: %v", hash, err)
+	}
+	checkError(t, "setting the password of an unknown user", db.SetPasswordHash("unknown", "hash"), database.ErrNotFound)
+	_, err = db.GetPasswordHash("unknown")
+	checkError(t, "getting the password of an unknown user", err, database.ErrNotFound)
+
+	// Only accounts without a password can be claimed
+	bob := createUser(t, db, "bobby")
+	checkError(t, "claiming a claimed account", db.ClaimAccount(alice.UserID, "other"), database.ErrConflict)
+	check(t, "claiming the account", db.ClaimAccount(bob.UserID, "hash"))
+	checkError(t, "claiming the account again", db.ClaimAccount(bob.UserID, "other"), database.ErrConflict)
+	hash, err = db.GetPasswordHash(bob.UserID)
+	if err != nil || hash != "hash" {
+		t.Fatalf("expected the first password hash, got %q: %v", hash, err)
+	}
+	checkError(t, "claiming an unknown account", db.ClaimAccount("unknown", "hash"), database.ErrNotFound)
+}
+
+func testSessions(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	_, err := db.GetSessionUser("hash")
+	checkError(t, "getting an unknown session", err, database.ErrNotFound)
+	check(t, "creating the session", db.CreateSession("hash", alice.UserID))
+	check(t, "creating another session", db.CreateSession("other", alice.UserID))
+	userID, err := db.GetSessionUser("hash")
+	if err != nil || userID != alice.UserID {
+		t.Fatalf("expected the session of alice, got %q: %v", userID, err)
+	}
+
+	// The sessions of a deleted user are kept, until the user is erased
+	check(t, "deleting the user", db.DeleteUser(alice.UserID))
+	userID, err = db.GetSessionUser("other")
+	if err != nil || userID != alice.UserID {
+		t.Fatalf("expected the session of alice, got %q: %v", userID, err)
+	}
+	check(t, "erasing the user", db.EraseUser(alice.UserID))
+	_, err = db.GetSessionUser("hash")
+	checkError(t, "getting the session of an erased user", err, database.ErrNotFound)
+}
+
+func testIdentities(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+
+	_, err := db.GetIdentityUser("issuer", "subject")
+	checkError(t, "getting an unknown identity", err, database.ErrNotFound)
+	check(t, "linking the identity", db.LinkIdentity("issuer", "subject", alice.UserID))
+	userID, err := db.GetIdentityUser("issuer", "subject")
+	if err != nil || userID != alice.UserID {
+		t.Fatalf("expected alice, got %q: %v", userID, err)
+	}
+	check(t, "linking the identity to another user", db.LinkIdentity("issuer", "subject", bob.UserID))
+	userID, err = db.GetIdentityUser("issuer", "subject")
+	if err != nil || userID != bob.UserID {
+		t.Fatalf("expected bobby, got %q: %v", userID, err)
+	}
+	_, err = db.GetIdentityUser("other", "subject")
+	checkError(t, "getting the identity of another issuer", err, database.ErrNotFound)
+
+	// Emails are compared ignoring the case
+	check(t, "setting the email", db.SetUserEmail(alice.UserID, "Alice@Example.com"))
+	user, err := db.GetUserByEmail("alice@example.COM")
+	if err != nil || user.UserID != alice.UserID {
+		t.Fatalf("expected alice, got %+v: %v", user, err)
+	}
+	_, err = db.GetUserByEmail("bob@example.com")
+	checkError(t, "getting the user of an unknown email", err, database.ErrNotFound)
+}
+
+func testAdministration(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	carol := createUser(t, db, "carol")
+
+	role, err := db.GetUserRole(alice.UserID)
+	if err != nil || role != database.RoleUser {
+		t.Fatalf("expected the user role, got %q: %v", role, err)
+	}
+	check(t, "setting the role", db.SetUserRole(alice.UserID, database.RoleAdmin))
+	role, err = db.GetUserRole(alice.UserID)
+	if err != nil || role != database.RoleAdmin {
+		t.Fatalf("expected the admin role, got %q: %v", role, err)
+	}
+	checkError(t, "setting the role of an unknown user", db.SetUserRole("unknown", database.RoleAdmin), database.ErrNotFound)
+
+	check(t, "suspending", db.SuspendUser(bob.UserID))
+	check(t, "suspending again", db.SuspendUser(bob.UserID))
+	suspended, err := db.IsSuspended(bob.UserID)
+	if err != nil || !suspended {
+		t.Fatalf("expected a suspended user: %v", err)
+	}
+	check(t, "unsuspending", db.UnsuspendUser(bob.UserID))
+	suspended, err = db.IsSuspended(bob.UserID)
+	if err != nil || suspended {
+		t.Fatalf("expected the suspension to be lifted: %v", err)
+	}
+	checkError(t, "suspending an unknown user", db.SuspendUser("unknown"), database.ErrNotFound)
+
+	// Deleted and suspended users are listed too
+	check(t, "suspending", db.SuspendUser(bob.UserID))
+	check(t, "deleting", db.DeleteUser(carol.UserID))
+	check(t, "setting the email", db.SetUserEmail(alice.UserID, "alice@example.com"))
+	var listed []structs.AdminUser
+	for offset := 0; ; offset += 2 {
+		page, err := db.ListUsers(offset, 2)
+		check(t, "listing the users", err)
+		if len(page) == 0 {
+			break
+		}
+		listed = append(listed, page...)
+	}
+	users := make(map[string]structs.AdminUser)
+	for _, user := range listed {
+		users[user.UserID] = user
+	}
+	if len(listed) != 3 || len(users) != 3 {
+		t.Fatalf("expected the 3 users, got %+v", listed)
+	}
+	if u := users[alice.UserID]; u.Role != database.RoleAdmin || u.Email != "alice@example.com" || u.SuspendedAt != nil || u.DeletedAt != nil {
+		t.Fatalf("unexpected alice %+v", u)
+	}
+	if u := users[bob.UserID]; u.Role != database.RoleUser || u.SuspendedAt == nil || !recent(*u.SuspendedAt) || u.DeletedAt != nil {
+		t.Fatalf("unexpected bobby %+v", u)
+	}
+	if u := users[carol.UserID]; u.DeletedAt == nil || !recent(*u.DeletedAt) {
+		t.Fatalf("unexpected carol %+v", u)
+	}
+
+	// Statistics
+	postID := addPost(t, db, alice, "A post", "2024-01-01T10:00:00Z")
+	addPost(t, db, bob, "Another post", "2024-01-01T10:00:00Z")
+	deletedID := addPost(t, db, bob, "A deleted post", "2024-01-01T10:00:00Z")
+	check(t, "deleting the post", db.DeletePost(deletedID))
+	commentID := addComment(t, db, postID, bob, "A comment", "2024-01-01T11:00:00Z")
+	check(t, "liking the post", db.LikePost(postID, bob.UserID))
+	check(t, "liking the comment", db.LikeComment(commentID, alice.UserID))
+	check(t, "following", db.FollowUser(alice.UserID, bob.UserID))
+	check(t, "banning", db.BanUser(bob.UserID, alice.UserID))
+	_, err = db.CreateJob("export", alice.UserID, time.Now())
+	check(t, "creating a job", err)
+	stats, err := db.GetStats()
+	check(t, "getting the statistics", err)
+	expected := structs.Stats{Users: 2, DeletedUsers: 1, SuspendedUsers: 1, Posts: 2, Comments: 1, Likes: 2, Follows: 1, Bans: 1, PendingJobs: 1}
+	if stats != expected {
+		t.Fatalf("expected the statistics %+v, got %+v", expected, stats)
+	}
+}
+
+func testPosts(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	first := addPost(t, db, alice, "First", "2024-01-01T10:00:00Z")
+	third := addPost(t, db, alice, "Third", "2024-01-03T10:00:00Z")
+	second := addPost(t, db, alice, "Second", "2024-01-02T10:00:00Z")
+
+	post := getPost(t, db, first)
+	if post.PostID != first || post.AuthorID != alice.UserID || post.AuthorUsername != "alice" || post.Caption != "First" ||
+		post.LikeCount != 0 || post.CommentCount != 0 || post.EditedAt != nil || post.Version != 1 ||
+		post.CreationDate != parseDate(t, "2024-01-01T10:00:00Z") {
+		t.Fatalf("unexpected post %+v", post)
+	}
+	_, err := db.GetPost("unknown")
+	checkError(t, "getting an unknown post", err, database.ErrNotFound)
+
+	// Newest first
+	posts, err := db.GetUserPosts(alice.UserID)
+	if err != nil || !equal(postIDs(posts), []string{third, second, first}) {
+		t.Fatalf("expected the posts newest first, got %v: %v", posts, err)
+	}
+
+	// Edits
+	post.Caption = "First!"
+	post.Image = "image"
+	version, err := db.UpdatePost(first, post, 1)
+	if err != nil || version != 2 {
+		t.Fatalf("expected version 2, got %d: %v", version, err)
+	}
+	_, err = db.UpdatePost(first, post, 1)
+	checkError(t, "updating a stale post", err, database.ErrVersionMismatch)
+	_, err = db.UpdatePost("unknown", post, 1)
+	checkError(t, "updating an unknown post", err, database.ErrNotFound)
+	post = getPost(t, db, first)
+	if post.Caption != "First!" || post.Image != "image" || post.EditedAt == nil || !recent(*post.EditedAt) || post.Version != 2 {
+		t.Fatalf("unexpected edited post %+v", post)
+	}
+	revisions, err := db.GetPostRevisions(first)
+	if err != nil || len(revisions) != 1 || revisions[0].Caption != "First" || revisions[0].ResourceID != first {
+		t.Fatalf("unexpected revisions %+v: %v", revisions, err)
+	}
+	revisions, err = db.GetPostRevisions(second)
+	if err != nil || len(revisions) != 0 {
+		t.Fatalf("expected no revision, got %+v: %v", revisions, err)
+	}
+
+	// Edits at the same date keep their order
+	globaltime.FixedTime = time.Now()
+	t.Cleanup(func() { globaltime.FixedTime = time.Time{} })
+	for i, caption := range []string{"First?", "First."} {
+		post.Caption = caption
+		_, err = db.UpdatePost(first, post, 2+i)
+		check(t, "editing the post", err)
+	}
+	globaltime.FixedTime = time.Time{}
+	revisions, err = db.GetPostRevisions(first)
+	if err != nil || len(revisions) != 3 || revisions[0].Caption != "First?" || revisions[1].Caption != "First!" ||
+		revisions[2].Caption != "First" {
+		t.Fatalf("expected the revisions newest first, got %+v: %v", revisions, err)
+	}
+	post = getPost(t, db, first)
+
+	// Deletion
+	check(t, "deleting the post", db.DeletePost(second))
+	_, err = db.GetPost(second)
+	checkError(t, "getting a deleted post", err, database.ErrNotFound)
+	_, err = db.GetPostRevisions(second)
+	checkError(t, "getting the revisions of a deleted post", err, database.ErrNotFound)
+	posts, err = db.GetUserPosts(alice.UserID)
+	if err != nil || !equal(postIDs(posts), []string{third, first}) {
+		t.Fatalf("expected the posts not deleted, got %v: %v", posts, err)
+	}
+	err = db.RestorePost(second, "other", hourAgo())
+	checkError(t, "restoring the post of another user", err, database.ErrNotFound)
+	err = db.RestorePost(second, alice.UserID, inAnHour())
+	checkError(t, "restoring a post deleted before the date", err, database.ErrNotFound)
+	check(t, "restoring the post", db.RestorePost(second, alice.UserID, hourAgo()))
+	getPost(t, db, second)
+	err = db.RestorePost(second, alice.UserID, hourAgo())
+	checkError(t, "restoring a post not deleted", err, database.ErrNotFound)
+
+	// Created now without a creation date
+	undated, err := db.AddPost(structs.UserPost{AuthorID: alice.UserID, AuthorUsername: "alice", Caption: "Undated"})
+	check(t, "adding a post without creation date", err)
+	if post := getPost(t, db, undated.ResourceID); !recent(post.CreationDate) {
+		t.Fatalf("expected the post created now, got %+v", post)
+	}
+}
+
+func testFeed(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	carol := createUser(t, db, "carol")
+	david := createUser(t, db, "david")
+	bobPost := addPost(t, db, bob, "By bobby", "2024-01-01T10:00:00Z")
+	carolPost := addPost(t, db, carol, "By carol", "2024-01-02T10:00:00Z")
+	deletedPost := addPost(t, db, carol, "Deleted", "2024-01-03T10:00:00Z")
+	check(t, "deleting the post", db.DeletePost(deletedPost))
+	addPost(t, db, david, "By david", "2024-01-04T10:00:00Z")
+	addPost(t, db, alice, "By alice", "2024-01-05T10:00:00Z")
+
+	feed, err := db.GetUserFeed(alice.UserID)
+	if err != nil || len(feed) != 0 {
+		t.Fatalf("expected an empty feed, got %v: %v", feed, err)
+	}
+
+	// Only the posts of the followed users, not deleted, newest first
+	check(t, "following bobby", db.FollowUser(alice.UserID, bob.UserID))
+	check(t, "following carol", db.FollowUser(alice.UserID, carol.UserID))
+	feed, err = db.GetUserFeed(alice.UserID)
+	if err != nil || !equal(postIDs(feed), []string{carolPost, bobPost}) {
+		t.Fatalf("expected the posts of carol and bobby, got %v: %v", feed, err)
+	}
+	check(t, "unfollowing bobby", db.UnfollowUser(alice.UserID, bob.UserID))
+	feed, err = db.GetUserFeed(alice.UserID)
+	if err != nil || !equal(postIDs(feed), []string{carolPost}) {
+		t.Fatalf("expected the post of carol, got %v: %v", feed, err)
+	}
+}
+
+func testComments(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	postID := addPost(t, db, alice, "A post", "2024-01-01T10:00:00Z")
+	otherPostID := addPost(t, db, alice, "Another post", "2024-01-01T10:00:00Z")
+
+	second := addComment(t, db, postID, bob, "Second", "2024-01-02T10:00:00Z")
+	first := addComment(t, db, otherPostID, bob, "First", "2024-01-01T11:00:00Z")
+	own := addComment(t, db, postID, alice, "Own", "2024-01-03T10:00:00Z")
+	_, err := db.CreateComment("unknown", structs.Comment{AuthorID: bob.UserID, AuthorUsername: "bobby", Caption: "Lost"})
+	checkError(t, "commenting an unknown post", err, database.ErrNotFound)
+	_, err = db.CreateComment(postID, structs.Comment{AuthorID: "unknown", AuthorUsername: "nobody", Caption: "Lost"})
+	checkError(t, "commenting as an unknown user", err, database.ErrNotFound)
+
+	if post := getPost(t, db, postID); post.CommentCount != 2 {
+		t.Fatalf("expected 2 comments, got %d", post.CommentCount)
+	}
+	comment, err := db.GetComment(second)
+	if err != nil || comment.CommentID != second || comment.AuthorID != bob.UserID || comment.AuthorUsername != "bobby" ||
+		comment.Caption != "Second" || comment.LikeCount != 0 || comment.EditedAt != nil || comment.Version != 1 {
+		t.Fatalf("unexpected comment %+v: %v", comment, err)
+	}
+	comments, err := db.GetPostComments(postID)
+	if err != nil || len(comments) != 2 {
+		t.Fatalf("expected 2 comments, got %+v: %v", comments, err)
+	}
+
+	// Oldest first
+	comments, err = db.GetUserComments(bob.UserID)
+	if err != nil || len(comments) != 2 || comments[0].CommentID != first || comments[1].CommentID != second {
+		t.Fatalf("expected the comments of bobby oldest first, got %+v: %v", comments, err)
+	}
+
+	// Edits
+	comment.Caption = "Second!"
+	version, err := db.EditComment(second, comment, 1)
+	if err != nil || version != 2 {
+		t.Fatalf("expected version 2, got %d: %v", version, err)
+	}
+	_, err = db.EditComment(second, comment, 1)
+	checkError(t, "editing a stale comment", err, database.ErrVersionMismatch)
+	version, err = db.EditComment(second, comment, 2)
+	if err != nil || version != 2 {
+		t.Fatalf("expected an edit without changes to keep version 2, got %d: %v", version, err)
+	}
+	comment, err = db.GetComment(second)
+	if err != nil || comment.Caption != "Second!" || comment.EditedAt == nil || !recent(*comment.EditedAt) || comment.Version != 2 {
+		t.Fatalf("unexpected edited comment %+v: %v", comment, err)
+	}
+	revisions, err := db.GetCommentRevisions(second)
+	if err != nil || len(revisions) != 1 || revisions[0].Caption != "Second" {
+		t.Fatalf("unexpected revisions %+v: %v", revisions, err)
+	}
+
+	// Deletion
+	check(t, "deleting the comment", db.DeleteComment(own))
+	checkError(t, "deleting the comment again", db.DeleteComment(own), database.ErrNotFound)
+	_, err = db.GetComment(own)
+	checkError(t, "getting a deleted comment", err, database.ErrNotFound)
+	if post := getPost(t, db, postID); post.CommentCount != 1 {
+		t.Fatalf("expected 1 comment, got %d", post.CommentCount)
+	}
+	comments, err = db.GetPostComments(postID)
+	if err != nil || len(comments) != 1 || comments[0].CommentID != second {
+		t.Fatalf("expected the comment not deleted, got %+v: %v", comments, err)
+	}
+	err = db.RestoreComment(own, bob.UserID, hourAgo())
+	checkError(t, "restoring the comment of another user", err, database.ErrNotFound)
+	err = db.RestoreComment(own, alice.UserID, inAnHour())
+	checkError(t, "restoring a comment deleted before the date", err, database.ErrNotFound)
+	check(t, "restoring the comment", db.RestoreComment(own, alice.UserID, hourAgo()))
+	if post := getPost(t, db, postID); post.CommentCount != 2 {
+		t.Fatalf("expected 2 comments, got %d", post.CommentCount)
+	}
+}
+
+func testLikes(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	carol := createUser(t, db, "carol")
+	postID := addPost(t, db, alice, "A post", "2024-01-01T10:00:00Z")
+	commentID := addComment(t, db, postID, alice, "A comment", "2024-01-01T11:00:00Z")
+
+	// Liking twice counts once
+	check(t, "liking the post", db.LikePost(postID, bob.UserID))
+	check(t, "liking the post again", db.LikePost(postID, bob.UserID))
+	check(t, "liking the post", db.LikePost(postID, carol.UserID))
+	checkError(t, "liking an unknown post", db.LikePost("unknown", bob.UserID), database.ErrNotFound)
+	checkError(t, "liking as an unknown user", db.LikePost(postID, "unknown"), database.ErrNotFound)
+	if post := getPost(t, db, postID); post.LikeCount != 2 {
+		t.Fatalf("expected 2 likes, got %d", post.LikeCount)
+	}
+	likes, err := db.GetPostLikes(postID)
+	if err != nil || len(likes) != 2 {
+		t.Fatalf("expected 2 likes, got %+v: %v", likes, err)
+	}
+	for _, like := range likes {
+		if like.Resource != postID || (like.UserID != bob.UserID || like.Username != "bobby") && (like.UserID != carol.UserID || like.Username != "carol") {
+			t.Fatalf("unexpected like %+v", like)
+		}
+	}
+
+	// Unliking twice counts once
+	check(t, "unliking the post", db.UnlikePost(postID, carol.UserID))
+	check(t, "unliking the post again", db.UnlikePost(postID, carol.UserID))
+	checkError(t, "unliking an unknown post", db.UnlikePost("unknown", carol.UserID), database.ErrNotFound)
+	if post := getPost(t, db, postID); post.LikeCount != 1 {
+		t.Fatalf("expected 1 like, got %d", post.LikeCount)
+	}
+
+	// Comments
+	check(t, "liking the comment", db.LikeComment(commentID, bob.UserID))
+	check(t, "liking the comment again", db.LikeComment(commentID, bob.UserID))
+	check(t, "liking the comment", db.LikeComment(commentID, carol.UserID))
+	checkError(t, "liking an unknown comment", db.LikeComment("unknown", bob.UserID), database.ErrNotFound)
+	check(t, "unliking the comment", db.UnlikeComment(commentID, carol.UserID))
+	check(t, "unliking the comment again", db.UnlikeComment(commentID, carol.UserID))
+	comment, err := db.GetComment(commentID)
+	if err != nil || comment.LikeCount != 1 {
+		t.Fatalf("expected 1 like, got %+v: %v", comment, err)
+	}
+	likes, err = db.GetCommentLikes(commentID)
+	if err != nil || len(likes) != 1 || likes[0].UserID != bob.UserID || likes[0].Resource != commentID {
+		t.Fatalf("expected the like of bobby, got %+v: %v", likes, err)
+	}
+
+	// Both kinds of likes of a user
+	likes, err = db.GetUserLikes(bob.UserID)
+	resources := make([]string, 0, len(likes))
+	for _, like := range likes {
+		resources = append(resources, like.Resource)
+	}
+	if err != nil || !sameElements(resources, []string{postID, commentID}) {
+		t.Fatalf("expected the likes of bobby on the post and the comment, got %+v: %v", likes, err)
+	}
+
+	// The likes of deleted users are hidden
+	check(t, "deleting bobby", db.DeleteUser(bob.UserID))
+	likes, err = db.GetPostLikes(postID)
+	if err != nil || len(likes) != 0 {
+		t.Fatalf("expected no like, got %+v: %v", likes, err)
+	}
+}
+
+func testFollows(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	carol := createUser(t, db, "carol")
+
+	// Following twice counts once
+	check(t, "following", db.FollowUser(alice.UserID, bob.UserID))
+	check(t, "following again", db.FollowUser(alice.UserID, bob.UserID))
+	check(t, "following", db.FollowUser(carol.UserID, bob.UserID))
+	check(t, "following", db.FollowUser(bob.UserID, alice.UserID))
+	if user := getUser(t, db, bob.UserID); user.Followers != 2 || user.Following != 1 {
+		t.Fatalf("unexpected counters %+v", user)
+	}
+	if user := getUser(t, db, alice.UserID); user.Followers != 1 || user.Following != 1 {
+		t.Fatalf("unexpected counters %+v", user)
+	}
+	followers, err := db.GetFollowersList(bob.UserID)
+	if err != nil || !sameElements(userIDs(followers), []string{alice.UserID, carol.UserID}) {
+		t.Fatalf("expected alice and carol, got %+v: %v", followers, err)
+	}
+	followings, err := db.GetFollowingsList(alice.UserID)
+	if err != nil || !equal(userIDs(followings), []string{bob.UserID}) {
+		t.Fatalf("expected bobby, got %+v: %v", followings, err)
+	}
+
+	// Unfollowing twice counts once
+	check(t, "unfollowing", db.UnfollowUser(alice.UserID, bob.UserID))
+	check(t, "unfollowing again", db.UnfollowUser(alice.UserID, bob.UserID))
+	if user := getUser(t, db, bob.UserID); user.Followers != 1 || user.Following != 1 {
+		t.Fatalf("unexpected counters %+v", user)
+	}
+	if user := getUser(t, db, alice.UserID); user.Followers != 1 || user.Following != 0 {
+		t.Fatalf("unexpected counters %+v", user)
+	}
+	followings, err = db.GetFollowingsList(alice.UserID)
+	if err != nil || len(followings) != 0 {
+		t.Fatalf("expected no following, got %+v: %v", followings, err)
+	}
+}
+
+func testBans(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	carol := createUser(t, db, "carol")
+
+	check(t, "banning", db.BanUser(alice.UserID, bob.UserID))
+	check(t, "banning again", db.BanUser(alice.UserID, bob.UserID))
+	check(t, "banning", db.BanUser(alice.UserID, carol.UserID))
+	banned, err := db.IsBanned(alice.UserID, bob.UserID)
+	if err != nil || !banned {
+		t.Fatalf("expected bobby to be banned: %v", err)
+	}
+	// Bans are not symmetric
+	banned, err = db.IsBanned(bob.UserID, alice.UserID)
+	if err != nil || banned {
+		t.Fatalf("expected alice not to be banned: %v", err)
+	}
+	list, err := db.GetUserBanList(alice.UserID)
+	if err != nil || !sameElements(userIDs(list), []string{bob.UserID, carol.UserID}) {
+		t.Fatalf("expected bobby and carol, got %+v: %v", list, err)
+	}
+
+	check(t, "unbanning", db.UnbanUser(alice.UserID, bob.UserID))
+	check(t, "unbanning again", db.UnbanUser(alice.UserID, bob.UserID))
+	banned, err = db.IsBanned(alice.UserID, bob.UserID)
+	if err != nil || banned {
+		t.Fatalf("expected bobby not to be banned: %v", err)
+	}
+	list, err = db.GetUserBanList(alice.UserID)
+	if err != nil || !equal(userIDs(list), []string{carol.UserID}) {
+		t.Fatalf("expected carol, got %+v: %v", list, err)
+	}
+}
+
+func testModeration(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	moderator := createUser(t, db, "moderator")
+	held := addPost(t, db, alice, "Held", "2024-01-01T10:00:00Z")
+	removed := addPost(t, db, alice, "Removed", "2024-01-01T10:00:00Z")
+	postID := addPost(t, db, alice, "A post", "2024-01-01T10:00:00Z")
+
+	// Held posts are hidden until released, their author can't restore them
+	check(t, "holding the post", db.HoldPost(held))
+	checkError(t, "holding the post again", db.HoldPost(held), database.ErrNotFound)
+	_, err := db.GetPost(held)
+	checkError(t, "getting a held post", err, database.ErrNotFound)
+	err = db.RestorePost(held, alice.UserID, hourAgo())
+	checkError(t, "restoring a held post", err, database.ErrNotFound)
+	check(t, "releasing the post", db.ReleasePost(held))
+	getPost(t, db, held)
+	checkError(t, "releasing a post not held", db.ReleasePost(held), database.ErrNotFound)
+
+	// Removed posts are hidden for good
+	check(t, "removing the post", db.RemovePost(removed, moderator.UserID))
+	checkError(t, "removing the post again", db.RemovePost(removed, moderator.UserID), database.ErrNotFound)
+	err = db.RestorePost(removed, alice.UserID, hourAgo())
+	checkError(t, "restoring a removed post", err, database.ErrNotFound)
+	check(t, "holding the post", db.HoldPost(held))
+	if authorID, err := db.GetPostAuthor(held); err != nil || authorID != alice.UserID {
+		t.Fatalf("expected alice as the author of the held post, got %q: %v", authorID, err)
+	}
+	check(t, "removing a held post", db.RemovePost(held, moderator.UserID))
+	checkError(t, "releasing a removed post", db.ReleasePost(held), database.ErrNotFound)
+
+	// Comments
+	heldComment := addComment(t, db, postID, alice, "Held", "2024-01-01T11:00:00Z")
+	removedComment := addComment(t, db, postID, alice, "Removed", "2024-01-01T11:00:00Z")
+	check(t, "holding the comment", db.HoldComment(heldComment))
+	_, err = db.GetComment(heldComment)
+	checkError(t, "getting a held comment", err, database.ErrNotFound)
+	if post := getPost(t, db, postID); post.CommentCount != 1 {
+		t.Fatalf("expected 1 comment, got %d", post.CommentCount)
+	}
+	err = db.RestoreComment(heldComment, alice.UserID, hourAgo())
+	checkError(t, "restoring a held comment", err, database.ErrNotFound)
+	check(t, "releasing the comment", db.ReleaseComment(heldComment))
+	check(t, "releasing the comment again", db.ReleaseComment(heldComment))
+	if post := getPost(t, db, postID); post.CommentCount != 2 {
+		t.Fatalf("expected 2 comments, got %d", post.CommentCount)
+	}
+	check(t, "removing the comment", db.RemoveComment(removedComment, moderator.UserID))
+	checkError(t, "removing the comment again", db.RemoveComment(removedComment, moderator.UserID), database.ErrNotFound)
+	err = db.RestoreComment(removedComment, alice.UserID, hourAgo())
+	checkError(t, "restoring a removed comment", err, database.ErrNotFound)
+	check(t, "holding the comment", db.HoldComment(heldComment))
+	if authorID, err := db.GetCommentAuthor(heldComment); err != nil || authorID != alice.UserID {
+		t.Fatalf("expected alice as the author of the held comment, got %q: %v", authorID, err)
+	}
+	_, err = db.GetCommentAuthor("missing")
+	checkError(t, "getting the author of a missing comment", err, database.ErrNotFound)
+	check(t, "removing a held comment", db.RemoveComment(heldComment, moderator.UserID))
+	if post := getPost(t, db, postID); post.CommentCount != 0 {
+		t.Fatalf("expected no comment, got %d", post.CommentCount)
+	}
+}
+
+func testReports(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	moderator := createUser(t, db, "moderator")
+	other := createUser(t, db, "other")
+	postID := addPost(t, db, bob, "A post", "2024-01-01T10:00:00Z")
+
+	report, err := db.CreateReport(structs.Report{
+		ReporterID:   alice.UserID,
+		TargetType:   "post",
+		TargetID:     postID,
+		TargetUserID: bob.UserID,
+		Reason:       "spam",
+		Details:      "Buy now",
+		Status:       database.ReportResolved, // Ignored
+	})
+	if err != nil || report.ReportID == "" || report.Status != database.ReportOpen || !recent(report.CreationDate) {
+		t.Fatalf("unexpected report %+v: %v", report, err)
+	}
+	stored, err := db.GetReport(report.ReportID)
+	if err != nil || stored != report {
+		t.Fatalf("expected the report %+v, got %+v: %v", report, stored, err)
+	}
+	_, err = db.GetReport("unknown")
+	checkError(t, "getting an unknown report", err, database.ErrNotFound)
+	open, err := db.HasOpenReport(alice.UserID, postID)
+	if err != nil || !open {
+		t.Fatalf("expected an open report: %v", err)
+	}
+	userReport, err := db.CreateReport(structs.Report{ReporterID: alice.UserID, TargetType: "user", TargetID: bob.UserID, TargetUserID: bob.UserID, Reason: "other"})
+	check(t, "reporting the user", err)
+
+	// Claimed by a single moderator
+	check(t, "claiming the report", db.ClaimReport(report.ReportID, moderator.UserID))
+	check(t, "claiming the report again", db.ClaimReport(report.ReportID, moderator.UserID))
+	checkError(t, "claiming the report of another moderator", db.ClaimReport(report.ReportID, other.UserID), database.ErrConflict)
+	err = db.CloseReport(report.ReportID, other.UserID, database.ReportResolved, "hide", "")
+	checkError(t, "closing the report of another moderator", err, database.ErrConflict)
+	open, err = db.HasOpenReport(alice.UserID, postID)
+	if err != nil || !open {
+		t.Fatalf("expected a claimed report to be open: %v", err)
+	}
+	check(t, "closing the report", db.CloseReport(report.ReportID, moderator.UserID, database.ReportResolved, "warn", "Spam"))
+	err = db.CloseReport(report.ReportID, moderator.UserID, database.ReportDismissed, "", "")
+	checkError(t, "closing a closed report", err, database.ErrConflict)
+	checkError(t, "claiming a closed report", db.ClaimReport(report.ReportID, moderator.UserID), database.ErrConflict)
+	open, err = db.HasOpenReport(alice.UserID, postID)
+	if err != nil || open {
+		t.Fatalf("expected no open report: %v", err)
+	}
+	stored, err = db.GetReport(report.ReportID)
+	if err != nil || stored.Status != database.ReportResolved || stored.ModeratorID != moderator.UserID || stored.Action != "warn" || stored.Note != "Spam" {
+		t.Fatalf("unexpected closed report %+v: %v", stored, err)
+	}
+
+	// By status
+	reports, err := db.GetReports(database.ReportOpen, 0, 10)
+	if err != nil || len(reports) != 1 || reports[0].ReportID != userReport.ReportID {
+		t.Fatalf("expected the open report, got %+v: %v", reports, err)
+	}
+	reports, err = db.GetReports("", 0, 10)
+	if err != nil || len(reports) != 2 {
+		t.Fatalf("expected every report, got %+v: %v", reports, err)
+	}
+	reports, err = db.GetReports("", 1, 10)
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("expected the second page, got %+v: %v", reports, err)
+	}
+
+	// Warnings
+	check(t, "warning", db.AddWarning(bob.UserID, report.ReportID, "Spam"))
+	warnings, err := db.GetUserWarnings(bob.UserID)
+	if err != nil || len(warnings) != 1 || warnings[0].ReportID != report.ReportID || warnings[0].Note != "Spam" || warnings[0].WarningID == "" {
+		t.Fatalf("unexpected warnings %+v: %v", warnings, err)
+	}
+	warnings, err = db.GetUserWarnings(alice.UserID)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("expected no warning, got %+v: %v", warnings, err)
+	}
+}
+
+func testAuditLog(t *testing.T, db database.AppDatabase) {
+	for _, action := range []string{"suspend", "remove_post", "set_role"} {
+		check(t, "adding the entry", db.AddAuditEntry("admin", action, "target", "details of "+action))
+	}
+	entries, err := db.GetAuditLog(0, 10)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %+v: %v", entries, err)
+	}
+	for _, entry := range entries {
+		if entry.EntryID == "" || entry.ActorID != "admin" || entry.TargetID != "target" || entry.Details != "details of "+entry.Action || !recent(entry.CreationDate) {
+			t.Fatalf("unexpected entry %+v", entry)
+		}
+	}
+	entries, err = db.GetAuditLog(2, 10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected the last entry, got %+v: %v", entries, err)
+	}
+}
+
+func testJobs(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	now := time.Now()
+
+	export, err := db.CreateJob("export", alice.UserID, now.Add(-time.Minute))
+	if err != nil || export.JobID == "" || export.Status != database.JobPending || export.Progress != 0 || export.Kind != "export" || export.UserID != alice.UserID {
+		t.Fatalf("unexpected job %+v: %v", export, err)
+	}
+	stored, err := db.GetJob(export.JobID)
+	if err != nil || stored != export {
+		t.Fatalf("expected the job %+v, got %+v: %v", export, stored, err)
+	}
+	_, err = db.GetJob("unknown")
+	checkError(t, "getting an unknown job", err, database.ErrNotFound)
+	deletion, err := db.CreateJob("deletion", alice.UserID, now.Add(24*time.Hour))
+	check(t, "creating the job", err)
+	other, err := db.CreateJob("export", bob.UserID, now.Add(-time.Minute))
+	check(t, "creating the job", err)
+
+	check(t, "updating the job", db.UpdateJob(export.JobID, database.JobRunning, 50))
+	stored, err = db.GetJob(export.JobID)
+	if err != nil || stored.Status != database.JobRunning || stored.Progress != 50 {
+		t.Fatalf("unexpected updated job %+v: %v", stored, err)
+	}
+	jobs, err := db.GetUserJobs(alice.UserID)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("expected the 2 jobs of alice, got %+v: %v", jobs, err)
+	}
+
+	// Due jobs are pending or running
+	due, err := db.GetDueJobs("export", now)
+	ids := make([]string, 0, len(due))
+	for _, job := range due {
+		ids = append(ids, job.JobID)
+	}
+	if err != nil || !sameElements(ids, []string{export.JobID, other.JobID}) {
+		t.Fatalf("expected the 2 exports, got %+v: %v", due, err)
+	}
+	due, err = db.GetDueJobs("deletion", now)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("expected no due deletion, got %+v: %v", due, err)
+	}
+	due, err = db.GetDueJobs("deletion", now.Add(48*time.Hour))
+	if err != nil || len(due) != 1 || due[0].JobID != deletion.JobID {
+		t.Fatalf("expected the deletion, got %+v: %v", due, err)
+	}
+	check(t, "finishing the job", db.UpdateJob(export.JobID, database.JobDone, 100))
+	due, err = db.GetDueJobs("export", now)
+	if err != nil || len(due) != 1 || due[0].JobID != other.JobID {
+		t.Fatalf("expected the export of bobby, got %+v: %v", due, err)
+	}
+
+	// Only the unfinished jobs of the kind and the user are cancelled
+	check(t, "cancelling the jobs", db.CancelJobs("deletion", alice.UserID))
+	stored, err = db.GetJob(deletion.JobID)
+	if err != nil || stored.Status != database.JobCancelled {
+		t.Fatalf("expected a cancelled job, got %+v: %v", stored, err)
+	}
+	check(t, "cancelling the jobs", db.CancelJobs("export", alice.UserID))
+	stored, err = db.GetJob(export.JobID)
+	if err != nil || stored.Status != database.JobDone {
+		t.Fatalf("expected a done job, got %+v: %v", stored, err)
+	}
+	stored, err = db.GetJob(other.JobID)
+	if err != nil || stored.Status != database.JobPending {
+		t.Fatalf("expected a pending job, got %+v: %v", stored, err)
+	}
+
+	// A running job is cancelled too, and stays cancelled
+	check(t, "starting the job", db.UpdateJob(other.JobID, database.JobRunning, 10))
+	check(t, "cancelling the jobs", db.CancelJobs("export", bob.UserID))
+	checkError(t, "updating a cancelled job", db.UpdateJob(other.JobID, database.JobRunning, 20), database.ErrConflict)
+	stored, err = db.GetJob(other.JobID)
+	if err != nil || stored.Status != database.JobCancelled || stored.Progress != 10 {
+		t.Fatalf("expected a cancelled job, got %+v: %v", stored, err)
+	}
+	checkError(t, "updating an unknown job", db.UpdateJob("unknown", database.JobDone, 100), database.ErrNotFound)
+}
+
+func testAccountErasure(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	alicePost := addPost(t, db, alice, "By alice", "2024-01-01T10:00:00Z")
+	bobPost := addPost(t, db, bob, "By bobby", "2024-01-01T10:00:00Z")
+	aliceComment := addComment(t, db, bobPost, alice, "By alice", "2024-01-01T11:00:00Z")
+	bobComment := addComment(t, db, bobPost, bob, "By bobby", "2024-01-01T11:00:00Z")
+	addComment(t, db, alicePost, bob, "On alice", "2024-01-01T11:00:00Z")
+	check(t, "liking", db.LikePost(bobPost, alice.UserID))
+	check(t, "liking", db.LikeComment(bobComment, alice.UserID))
+	check(t, "liking", db.LikeComment(aliceComment, bob.UserID))
+	check(t, "following", db.FollowUser(alice.UserID, bob.UserID))
+	check(t, "following", db.FollowUser(bob.UserID, alice.UserID))
+	check(t, "banning", db.BanUser(bob.UserID, alice.UserID))
+	check(t, "linking the identity", db.LinkIdentity("issuer", "subject", alice.UserID))
+	export, err := db.CreateJob("export", alice.UserID, time.Now())
+	check(t, "creating a job", err)
+	check(t, "finishing the job", db.UpdateJob(export.JobID, database.JobDone, 100))
+	check(t, "deleting the user", db.DeleteUser(alice.UserID))
+	deletion, err := db.CreateJob("deletion", alice.UserID, time.Now())
+	check(t, "creating a job", err)
+	check(t, "starting the job", db.UpdateJob(deletion.JobID, database.JobRunning, 0))
+
+	// The steps of the account deletion, each one can be repeated
+	steps := []struct {
+		name string
+		run  func(userID string) error
+	}{
+		{"deleting the likes", db.DeleteUserLikes},
+		{"deleting the follows", db.DeleteUserFollows},
+		{"deleting the bans", db.DeleteUserBans},
+		{"deleting the comments", db.DeleteUserComments},
+		{"deleting the posts", db.DeleteUserPosts},
+		{"erasing the user", db.EraseUser},
+	}
+	for _, step := range steps {
+		check(t, step.name, step.run(alice.UserID))
+		check(t, step.name+" again", step.run(alice.UserID))
+	}
+
+	// The counters of the other users are updated
+	post := getPost(t, db, bobPost)
+	if post.LikeCount != 0 || post.CommentCount != 1 {
+		t.Fatalf("expected no like and 1 comment, got %+v", post)
+	}
+	comment, err := db.GetComment(bobComment)
+	if err != nil || comment.LikeCount != 0 {
+		t.Fatalf("expected no like, got %+v: %v", comment, err)
+	}
+	user := getUser(t, db, bob.UserID)
+	if user.Followers != 0 || user.Following != 0 {
+		t.Fatalf("expected no follow, got %+v", user)
+	}
+	likes, err := db.GetUserLikes(bob.UserID)
+	if err != nil || len(likes) != 0 {
+		t.Fatalf("expected the like of the erased comment to be gone, got %+v: %v", likes, err)
+	}
+	list, err := db.GetUserBanList(bob.UserID)
+	if err != nil || len(list) != 0 {
+		t.Fatalf("expected no ban, got %+v: %v", list, err)
+	}
+	comments, err := db.GetUserComments(bob.UserID)
+	if err != nil || len(comments) != 1 || comments[0].CommentID != bobComment {
+		t.Fatalf("expected the comment on the post of alice to be gone, got %+v: %v", comments, err)
+	}
+
+	// Nothing is left of the user
+	_, err = db.GetPost(alicePost)
+	checkError(t, "getting an erased post", err, database.ErrNotFound)
+	checkError(t, "restoring the erased user", db.RestoreUser(alice.UserID, hourAgo()), database.ErrNotFound)
+	_, err = db.GetIdentityUser("issuer", "subject")
+	checkError(t, "getting the identity of an erased user", err, database.ErrNotFound)
+	jobs, err := db.GetUserJobs(alice.UserID)
+	if err != nil || len(jobs) != 0 {
+		t.Fatalf("expected the jobs to be gone, got %+v: %v", jobs, err)
+	}
+	_, err = db.GetJob(deletion.JobID)
+	checkError(t, "getting the running deletion", err, database.ErrNotFound)
+	createUser(t, db, "alice")
+}
+
+func testPurge(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	deleted := addPost(t, db, alice, "Deleted", "2024-01-01T10:00:00Z")
+	held := addPost(t, db, alice, "Held", "2024-01-01T10:00:00Z")
+	postID := addPost(t, db, alice, "A post", "2024-01-01T10:00:00Z")
+	commentID := addComment(t, db, postID, alice, "Deleted", "2024-01-01T11:00:00Z")
+	check(t, "deleting the post", db.DeletePost(deleted))
+	check(t, "holding the post", db.HoldPost(held))
+	check(t, "deleting the comment", db.DeleteComment(commentID))
+
+	// Not purged yet
+	check(t, "purging", db.PurgeDeleted(hourAgo()))
+	check(t, "restoring the post", db.RestorePost(deleted, alice.UserID, hourAgo()))
+	check(t, "deleting the post", db.DeletePost(deleted))
+
+	// Held content waits for a moderator
+	check(t, "purging", db.PurgeDeleted(inAnHour()))
+	checkError(t, "restoring a purged post", db.RestorePost(deleted, alice.UserID, hourAgo()), database.ErrNotFound)
+	checkError(t, "restoring a purged comment", db.RestoreComment(commentID, alice.UserID, hourAgo()), database.ErrNotFound)
+	check(t, "releasing the held post", db.ReleasePost(held))
+
+	// Right away
+	photos, err := db.PurgePost(postID)
+	if err != nil || len(photos) != 0 {
+		t.Fatalf("purging a post not deleted: expected no photo, got %v: %v", photos, err)
+	}
+	getPost(t, db, postID)
+	commentID = addComment(t, db, postID, alice, "Deleted", "2024-01-01T11:00:00Z")
+	check(t, "purging a comment not deleted", db.PurgeComment(commentID))
+	check(t, "deleting the comment", db.DeleteComment(commentID))
+	check(t, "purging the comment", db.PurgeComment(commentID))
+	checkError(t, "restoring a purged comment", db.RestoreComment(commentID, alice.UserID, hourAgo()), database.ErrNotFound)
+	check(t, "deleting the post", db.DeletePost(postID))
+	_, err = db.PurgePost(postID)
+	check(t, "purging the post", err)
+	checkError(t, "restoring a purged post", db.RestorePost(postID, alice.UserID, hourAgo()), database.ErrNotFound)
+
+	// A missing photo was already removed
+	res, err := db.AddPost(structs.UserPost{AuthorID: alice.UserID, AuthorUsername: "alice", CreationDate: parseDate(t, "2024-01-01T10:00:00Z"), Caption: "A post", Image: "missing"})
+	check(t, "adding the post", err)
+	check(t, "deleting the post", db.DeletePost(res.ResourceID))
+	photos, err = db.PurgePost(res.ResourceID)
+	if err != nil || !equal(photos, []string{"missing"}) {
+		t.Fatalf("purging a post with a missing photo: expected its photo, got %v: %v", photos, err)
+	}
+	checkError(t, "removing the missing photo", db.DeletePhoto("", "missing"), database.ErrNotFound)
+}
+
+// photoFile is a photo in memory, as the multipart.File taken by AppDatabase.SavePhoto
+type photoFile struct {
+	*bytes.Reader
+}
+
+func (photoFile) Close() error {
+	return nil
+}
+
+func testPhotos(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	content := []byte("not really a JPEG")
+	photoID, err := db.SavePhoto(alice.UserID, photoFile{bytes.NewReader(content)})
+	check(t, "saving the photo", err)
+	t.Cleanup(func() { _ = db.DeletePhoto(alice.UserID, photoID) })
+
+	photo, err := db.GetPhoto(alice.UserID, photoID)
+	if err != nil || !bytes.Equal(photo, content) {
+		t.Fatalf("expected the photo, got %q: %v", photo, err)
+	}
+	photos, err := db.GetUserPhotos(alice.UserID, false)
+	if err != nil || !equal(photos, []string{photoID}) {
+		t.Fatalf("expected the photo, got %v: %v", photos, err)
+	}
+
+	// The images of the posts and the profile image count too, once
+	_, err = db.AddPost(structs.UserPost{AuthorID: alice.UserID, AuthorUsername: "alice", CreationDate: parseDate(t, "2024-01-01T10:00:00Z"), Caption: "A post", Image: photoID})
+	check(t, "adding the post", err)
+	_, err = db.AddPost(structs.UserPost{AuthorID: alice.UserID, AuthorUsername: "alice", CreationDate: parseDate(t, "2024-01-01T10:00:00Z"), Caption: "A post", Image: "posted"})
+	check(t, "adding the post", err)
+	alice.ProfileImage = "profile"
+	_, err = db.UpdateUser(alice.UserID, alice, 1)
+	check(t, "setting the profile image", err)
+	photos, err = db.GetUserPhotos(alice.UserID, false)
+	if err != nil || !sameElements(photos, []string{photoID, "posted", "profile"}) {
+		t.Fatalf("expected the 3 photos, got %v: %v", photos, err)
+	}
+
+	// The images of the deleted posts are left out, even if uploaded by the user, unless asked for
+	deleted, err := db.AddPost(structs.UserPost{AuthorID: alice.UserID, AuthorUsername: "alice", CreationDate: parseDate(t, "2024-01-01T10:00:00Z"), Caption: "A post", Image: "deleted"})
+	check(t, "adding the post", err)
+	uploaded, err := db.SavePhoto(alice.UserID, photoFile{bytes.NewReader(content)})
+	check(t, "saving the photo", err)
+	t.Cleanup(func() { _ = db.DeletePhoto(alice.UserID, uploaded) })
+	uploadedPost, err := db.AddPost(structs.UserPost{AuthorID: alice.UserID, AuthorUsername: "alice", CreationDate: parseDate(t, "2024-01-01T10:00:00Z"), Caption: "A post", Image: uploaded})
+	check(t, "adding the post", err)
+	check(t, "deleting the post", db.DeletePost(deleted.ResourceID))
+	check(t, "deleting the post", db.DeletePost(uploadedPost.ResourceID))
+	photos, err = db.GetUserPhotos(alice.UserID, false)
+	if err != nil || !sameElements(photos, []string{photoID, "posted", "profile"}) {
+		t.Fatalf("expected the photos of the posts not deleted, got %v: %v", photos, err)
+	}
+	photos, err = db.GetUserPhotos(alice.UserID, true)
+	if err != nil || !sameElements(photos, []string{photoID, "posted", "profile", "deleted", uploaded}) {
+		t.Fatalf("expected the 5 photos, got %v: %v", photos, err)
+	}
+
+	check(t, "deleting the photo", db.DeletePhoto(alice.UserID, photoID))
+	_, err = db.GetPhoto(alice.UserID, photoID)
+	checkError(t, "getting a deleted photo", err, database.ErrNotFound)
+	checkError(t, "deleting a deleted photo", db.DeletePhoto(alice.UserID, photoID), database.ErrNotFound)
+}
+
+func testIdempotencyKeys(t *testing.T, db database.AppDatabase) {
+	// Reserved once
+	_, reserved, err := db.ReserveIdempotencyKey("alice", "key", "fingerprint", hourAgo())
+	if err != nil || !reserved {
+		t.Fatalf("expected the key to be reserved: %v", err)
+	}
+	response, reserved, err := db.ReserveIdempotencyKey("alice", "key", "other", hourAgo())
+	if err != nil || reserved || response.Fingerprint != "fingerprint" || response.Status != 0 {
+		t.Fatalf("expected the request in progress, got %+v: %v", response, err)
+	}
+	_, reserved, err = db.ReserveIdempotencyKey("bobby", "key", "fingerprint", hourAgo())
+	if err != nil || !reserved {
+		t.Fatalf("expected the key of another scope to be reserved: %v", err)
+	}
+
+	// Replayed once saved
+	saved := structs.IdempotentResponse{Status: 201, ContentType: "application/json", Body: []byte(`{"resourceId":"id"}`)}
+	check(t, "saving the response", db.SaveIdempotentResponse("alice", "key", saved))
+	response, reserved, err = db.ReserveIdempotencyKey("alice", "key", "fingerprint", hourAgo())
+	if err != nil || reserved || response.Fingerprint != "fingerprint" || response.Status != 201 ||
+		response.ContentType != "application/json" || !bytes.Equal(response.Body, saved.Body) {
+		t.Fatalf("expected the saved response, got %+v: %v", response, err)
+	}
+
+	// Replaced once expired
+	_, reserved, err = db.ReserveIdempotencyKey("alice", "key", "new", inAnHour())
+	if err != nil || !reserved {
+		t.Fatalf("expected the expired key to be reserved: %v", err)
+	}
+	response, _, err = db.ReserveIdempotencyKey("alice", "key", "other", hourAgo())
+	if err != nil || response.Fingerprint != "new" || response.Status != 0 || len(response.Body) != 0 {
+		t.Fatalf("expected the new request, got %+v: %v", response, err)
+	}
+
+	// Deleted and purged
+	check(t, "deleting the key", db.DeleteIdempotencyKey("alice", "key"))
+	_, reserved, err = db.ReserveIdempotencyKey("alice", "key", "fingerprint", hourAgo())
+	if err != nil || !reserved {
+		t.Fatalf("expected the deleted key to be reserved: %v", err)
+	}
+	check(t, "purging the keys", db.PurgeIdempotencyKeys(inAnHour()))
+	_, reserved, err = db.ReserveIdempotencyKey("bobby", "key", "fingerprint", hourAgo())
+	if err != nil || !reserved {
+		t.Fatalf("expected the purged key to be reserved: %v", err)
+	}
+}
+
+func testTransactions(t *testing.T, db database.AppDatabase) {
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bobby")
+	postID := addPost(t, db, alice, "Hello", "2024-01-01T10:00:00Z")
+	commentID := addComment(t, db, postID, bob, "Nice", "2024-01-01T11:00:00Z")
+
+	// The changes of a failed transaction are undone, those of the methods running their own transaction included
+	failure := errors.New("failure")
+	err := db.RunInTransaction(func(tx database.AppDatabase) error {
+		check(t, "suspending in the transaction", tx.SuspendUser(bob.UserID))
+		check(t, "deleting the comment in the transaction", tx.DeleteComment(commentID))
+		check(t, "auditing in the transaction", tx.AddAuditEntry(alice.UserID, "suspend", bob.UserID, ""))
+		suspended, err := tx.IsSuspended(bob.UserID)
+		if err != nil || !suspended {
+			t.Fatalf("expected the transaction to see its changes: %v", err)
+		}
+		return failure
+	})
+	checkError(t, "failing the transaction", err, failure)
+	suspended, err := db.IsSuspended(bob.UserID)
+	if err != nil || suspended {
+		t.Fatalf("expected the suspension to be undone: %v", err)
+	}
+	if _, err := db.GetComment(commentID); err != nil {
+		t.Fatalf("expected the comment to be restored: %v", err)
+	}
+	if post := getPost(t, db, postID); post.CommentCount != 1 {
+		t.Fatalf("expected the comment count to be restored, got %d", post.CommentCount)
+	}
+	entries, err := db.GetAuditLog(0, 10)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected no audit entry, got %+v: %v", entries, err)
+	}
+
+	// The changes of a successful transaction are all kept
+	err = db.RunInTransaction(func(tx database.AppDatabase) error {
+		err := tx.SuspendUser(bob.UserID)
+		if err != nil {
+			return err
+		}
+		return tx.AddAuditEntry(alice.UserID, "suspend", bob.UserID, "")
+	})
+	check(t, "committing the transaction", err)
+	suspended, err = db.IsSuspended(bob.UserID)
+	if err != nil || !suspended {
+		t.Fatalf("expected the user to be suspended: %v", err)
+	}
+	entries, err = db.GetAuditLog(0, 10)
+	if err != nil || len(entries) != 1 || entries[0].TargetID != bob.UserID {
+		t.Fatalf("expected the audit entry, got %+v: %v", entries, err)
+	}
+}
@@ -0,0 +1,383 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+/*
+	This file contains the support of the database engines, SQLite and PostgreSQL.
+	The queries of this package are written in the SQL both engines understand (e.g. ON CONFLICT instead of INSERT OR
+	REPLACE, "User" quoted as USER is a reserved word of PostgreSQL), with ? or ?NNN as parameters. Where the engines
+	differ, the query is a dialectQuery, written for each engine. Every query goes through dbConn, which only numbers
+	the parameters as PostgreSQL expects them ($1, $2, ...) and checks that the query gets as many arguments as it has
+	parameters. The schemas differ too: each dialect has its own init script and migrations, see migrations.go.
+*/
+
+// dialect is the SQL dialect of a database engine
+type dialect interface {
+	// rebind returns the query with the parameters of the dialect, and the number of its parameters
+	rebind(query string) (string, int)
+
+	// query returns the SQL of q for the dialect
+	query(q dialectQuery) string
+
+	// initScript returns the name of the file of this directory with the original schema, see New
+	initScript() string
+
+	// migrations returns the schema changes applied on top of the original schema, see migrate
+	migrations() [][]string
+
+	// schemaVersion returns the number of migrations applied to the database, see migrate
+	schemaVersion(c *dbConn) (int, error)
+
+	// setSchemaVersion records that the database is at the given version, in the transaction of the migration
+	setSchemaVersion(tx *dbTx, version int) error
+}
+
+// dialectOf returns the dialect of the driver of db
+func dialectOf(db *sql.DB) (dialect, error) {
+	switch db.Driver().(type) {
+	case *sqlite3.SQLiteDriver:
+		return &sqliteDialect{}, nil
+	case *pq.Driver:
+		return &postgresDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %T", db.Driver())
+	}
+}
+
+// dialectQuery is a query whose SQL differs between the engines, e.g. comparing text ignoring the case
+type dialectQuery struct {
+	sqlite   string
+	postgres string
+}
+
+// sqliteDialect is the dialect of SQLite. The parameters of the queries are counted once, as the queries are the same
+// few ones again and again.
+type sqliteDialect struct {
+	parameters sync.Map // Number of parameters (int) by query
+}
+
+func (d *sqliteDialect) rebind(query string) (string, int) {
+	if parameters, ok := d.parameters.Load(query); ok {
+		return query, parameters.(int)
+	}
+	_, parameters := bindParameters(query, func(n int) string { return "" })
+	d.parameters.Store(query, parameters)
+	return query, parameters
+}
+
+func (*sqliteDialect) query(q dialectQuery) string {
+	return q.sqlite
+}
+
+func (*sqliteDialect) initScript() string {
+	return "init.sql"
+}
+
+func (*sqliteDialect) migrations() [][]string {
+	return migrations
+}
+
+func (*sqliteDialect) schemaVersion(c *dbConn) (int, error) {
+	var version int
+	err := c.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+func (*sqliteDialect) setSchemaVersion(tx *dbTx, version int) error {
+	// PRAGMA does not accept bound parameters
+	_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+	return err
+}
+
+// postgresDialect is the dialect of PostgreSQL. The rebound queries are cached, as they are the same few ones again
+// and again.
+type postgresDialect struct {
+	queries sync.Map // Rebound queries (postgresQuery) by query
+}
+
+// postgresQuery is a query with the parameters of PostgreSQL
+type postgresQuery struct {
+	query      string
+	parameters int
+}
+
+func (d *postgresDialect) rebind(query string) (string, int) {
+	if rebound, ok := d.queries.Load(query); ok {
+		return rebound.(postgresQuery).query, rebound.(postgresQuery).parameters
+	}
+	// PostgreSQL numbers every parameter: $1, $2, ...
+	rebound, parameters := bindParameters(query, func(n int) string { return "$" + strconv.Itoa(n) })
+	d.queries.Store(query, postgresQuery{query: rebound, parameters: parameters})
+	return rebound, parameters
+}
+
+func (*postgresDialect) query(q dialectQuery) string {
+	return q.postgres
+}
+
+func (*postgresDialect) initScript() string {
+	return "init-postgres.sql"
+}
+
+func (*postgresDialect) migrations() [][]string {
+	return postgresMigrations
+}
+
+func (*postgresDialect) schemaVersion(c *dbConn) (int, error) {
+	// There is no user_version pragma, the version is stored in a table
+	_, err := c.Exec("CREATE TABLE IF NOT EXISTS SchemaVersion (version INT NOT NULL)")
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	err = c.QueryRow("SELECT COALESCE(MAX(version), 0) FROM SchemaVersion").Scan(&version)
+	return version, err
+}
+
+func (*postgresDialect) setSchemaVersion(tx *dbTx, version int) error {
+	_, err := tx.Exec("DELETE FROM SchemaVersion")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO SchemaVersion (version) VALUES (?)", version)
+	return err
+}
+
+// bindParameters returns the query with every parameter, ? (the one after the largest so far) or ?NNN (parameter NNN),
+// replaced by placeholder(number of the parameter), and the number of parameters of the query. The question marks in
+// the string literals, the quoted identifiers and the comments are not parameters.
+func bindParameters(query string, placeholder func(n int) string) (string, int) {
+	var b strings.Builder
+	parameters := 0
+	for i := 0; i < len(query); {
+		end := i + 1
+		switch {
+		case query[i] == '\'' || query[i] == '"':
+			// A doubled quote is part of the literal or of the identifier
+			quote := query[i]
+			for end < len(query) && (query[end] != quote || end+1 < len(query) && query[end+1] == quote) {
+				if query[end] == quote {
+					end++
+				}
+				end++
+			}
+			end++
+		case strings.HasPrefix(query[i:], "--"):
+			end = len(query)
+			if newline := strings.IndexByte(query[i:], '\n'); newline >= 0 {
+				end = i + newline + 1
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			end = len(query)
+			if close := strings.Index(query[i+2:], "*/"); close >= 0 {
+				end = i + 2 + close + 2
+			}
+		case query[i] == '?':
+			for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+				end++
+			}
+			n := parameters + 1
+			if end > i+1 {
+				n, _ = strconv.Atoi(query[i+1 : end])
+			}
+			if n > parameters {
+				parameters = n
+			}
+			b.WriteString(placeholder(n))
+			i = end
+			continue
+		}
+		if end > len(query) {
+			end = len(query)
+		}
+		b.WriteString(query[i:end])
+		i = end
+	}
+	return b.String(), parameters
+}
+
+// dbConn is the connection to the database, translating the queries to its dialect. The queries only reading run on
+// reader outside of transactions, the others on db.
+type dbConn struct {
+	db      *sql.DB
+	reader  *sql.DB
+	dialect dialect
+
+	// The statements prepared on db and on reader, nil if they are not prepared, see New
+	statements       *statementCache
+	readerStatements *statementCache
+
+	// The transaction running every query, see RunInTransaction. Nil outside of RunInTransaction.
+	tx *dbTx
+}
+
+// rebind returns the query with the parameters of the dialect. It fails if the number of arguments is not the number
+// of parameters of the query: SQLite would ignore the extra arguments and bind NULL to the missing ones.
+func rebind(d dialect, query string, args []interface{}) (string, error) {
+	query, parameters := d.rebind(query)
+	if len(args) != parameters {
+		return "", fmt.Errorf("%d arguments for the %d parameters of the query %q", len(args), parameters, query)
+	}
+	return query, nil
+}
+
+// pool returns the connections running the query outside of a transaction, with their statements
+func (c *dbConn) pool(query string) (*sql.DB, *statementCache) {
+	if isReadOnly(query) {
+		return c.reader, c.readerStatements
+	}
+	return c.db, c.statements
+}
+
+func (c *dbConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if c.tx != nil {
+		return c.tx.Exec(query, args...)
+	}
+	query, err := rebind(c.dialect, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if stmt := c.statements.cached(query); stmt != nil {
+		return stmt.Exec(args...)
+	}
+	return c.db.Exec(query, args...)
+}
+
+func (c *dbConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if c.tx != nil {
+		return c.tx.Query(query, args...)
+	}
+	query, err := rebind(c.dialect, query, args)
+	if err != nil {
+		return nil, err
+	}
+	db, statements := c.pool(query)
+	if stmt := statements.cached(query); stmt != nil {
+		return stmt.Query(args...)
+	}
+	return db.Query(query, args...)
+}
+
+func (c *dbConn) QueryRow(query string, args ...interface{}) *dbRow {
+	if c.tx != nil {
+		return c.tx.QueryRow(query, args...)
+	}
+	query, err := rebind(c.dialect, query, args)
+	if err != nil {
+		return &dbRow{err: err}
+	}
+	db, statements := c.pool(query)
+	if stmt := statements.cached(query); stmt != nil {
+		return &dbRow{row: stmt.QueryRow(args...)}
+	}
+	return &dbRow{row: db.QueryRow(query, args...)}
+}
+
+// Begin starts a transaction. Inside RunInTransaction, the transaction started is part of the one running: committing
+// or rolling it back does nothing.
+func (c *dbConn) Begin() (*dbTx, error) {
+	if c.tx != nil {
+		return &dbTx{tx: c.tx.tx, dialect: c.dialect, statements: c.statements, nested: true}, nil
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &dbTx{tx: tx, dialect: c.dialect, statements: c.statements}, nil
+}
+
+func (c *dbConn) Ping() error {
+	err := c.db.Ping()
+	if err != nil {
+		return err
+	}
+	return c.reader.Ping()
+}
+
+// dbTx is a transaction of dbConn
+type dbTx struct {
+	tx         *sql.Tx
+	dialect    dialect
+	statements *statementCache // The statements of dbConn.db, nil if they are not prepared
+	nested     bool            // Part of the transaction of RunInTransaction, see dbConn.Begin
+}
+
+// stmt returns the prepared statement of the query for the transaction, or nil if it is not prepared
+func (t *dbTx) stmt(query string) *sql.Stmt {
+	stmt := t.statements.cached(query)
+	if stmt == nil {
+		return nil
+	}
+	// Closed with the transaction
+	return t.tx.Stmt(stmt)
+}
+
+func (t *dbTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	query, err := rebind(t.dialect, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if stmt := t.stmt(query); stmt != nil {
+		return stmt.Exec(args...)
+	}
+	return t.tx.Exec(query, args...)
+}
+
+func (t *dbTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	query, err := rebind(t.dialect, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if stmt := t.stmt(query); stmt != nil {
+		return stmt.Query(args...)
+	}
+	return t.tx.Query(query, args...)
+}
+
+func (t *dbTx) QueryRow(query string, args ...interface{}) *dbRow {
+	query, err := rebind(t.dialect, query, args)
+	if err != nil {
+		return &dbRow{err: err}
+	}
+	if stmt := t.stmt(query); stmt != nil {
+		return &dbRow{row: stmt.QueryRow(args...)}
+	}
+	return &dbRow{row: t.tx.QueryRow(query, args...)}
+}
+
+// dbRow is the result of QueryRow, or the error of the query if it could not run
+type dbRow struct {
+	row *sql.Row
+	err error
+}
+
+// Scan copies the columns of the row into dest, see sql.Row.Scan
+func (r *dbRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.row.Scan(dest...)
+}
+
+func (t *dbTx) Commit() error {
+	if t.nested {
+		return nil
+	}
+	return t.tx.Commit()
+}
+
+func (t *dbTx) Rollback() error {
+	if t.nested {
+		return nil
+	}
+	return t.tx.Rollback()
+}
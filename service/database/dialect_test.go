@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestPostgresRebind(t *testing.T) {
+	for _, tc := range []struct {
+		query      string
+		expected   string
+		parameters int
+	}{
+		{query: "SELECT 1", expected: "SELECT 1", parameters: 0},
+		{query: "SELECT id FROM Post WHERE id = ? AND author_id = ?", expected: "SELECT id FROM Post WHERE id = $1 AND author_id = $2", parameters: 2},
+		{query: "DELETE FROM Follow WHERE follower = ?1 OR following = ?1", expected: "DELETE FROM Follow WHERE follower = $1 OR following = $1", parameters: 1},
+		{query: "SELECT ?2, ?, ?1", expected: "SELECT $2, $3, $1", parameters: 3},
+		{query: "SELECT 'why?' WHERE id = ?", expected: "SELECT 'why?' WHERE id = $1", parameters: 1},
+		{query: "SELECT 'it''s ?', ?", expected: "SELECT 'it''s ?', $1", parameters: 1},
+		{query: `SELECT "what?" FROM "User" WHERE id = ?`, expected: `SELECT "what?" FROM "User" WHERE id = $1`, parameters: 1},
+		{query: "SELECT ? -- why?\nFROM Post", expected: "SELECT $1 -- why?\nFROM Post", parameters: 1},
+		{query: "SELECT /* why? */ ?", expected: "SELECT /* why? */ $1", parameters: 1},
+		{query: "SELECT 'unterminated ?", expected: "SELECT 'unterminated ?", parameters: 0},
+	} {
+		query, parameters := (&postgresDialect{}).rebind(tc.query)
+		if query != tc.expected || parameters != tc.parameters {
+			t.Errorf("%q: expected %q with %d parameters, got %q with %d", tc.query, tc.expected, tc.parameters, query, parameters)
+		}
+		_, parameters = (&sqliteDialect{}).rebind(tc.query)
+		if parameters != tc.parameters {
+			t.Errorf("%q: expected %d SQLite parameters, got %d", tc.query, tc.parameters, parameters)
+		}
+	}
+}
+
+func TestRebindArguments(t *testing.T) {
+	d := &sqliteDialect{}
+	for _, args := range [][]interface{}{{"a"}, {"a", "b", "c"}} {
+		_, err := rebind(d, "SELECT ?, ?", args)
+		if err == nil {
+			t.Errorf("expected %d arguments for 2 parameters to fail", len(args))
+		}
+	}
+	_, err := rebind(d, "SELECT ?, ?", []interface{}{"a", "b"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestMigrationVersions checks that both dialects have every migration
+func TestMigrationVersions(t *testing.T) {
+	if len(postgresMigrations) != len(migrations) {
+		t.Fatalf("%d migrations for PostgreSQL, %d for SQLite", len(postgresMigrations), len(migrations))
+	}
+}
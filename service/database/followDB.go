@@ -13,25 +13,28 @@ import (
 	UnfollowUser(userID string, followingID string) error
 */
 
-// GetFollowersList returns all the followers of the user with the given userID
-func (db *appdbimpl) GetFollowersList(userID string) ([]structs.User, error) {
-	var followers []structs.User
-	rows, err := db.c.Query(`
+// getFollowersListQuery selects the active followers of a user
+const getFollowersListQuery = `
 		SELECT 
-			User.id,
-			User.username,
-			User.signup_date,
-			User.last_seen,
-			User.bio,
-			User.profile_image_id,
-			User.followers_count,
-			User.following_count
+			"User".id,
+			"User".username,
+			"User".signup_date,
+			"User".last_seen,
+			"User".bio,
+			"User".profile_image_id,
+			"User".followers_count,
+			"User".following_count
 		FROM 
-			Follow JOIN User
+			Follow JOIN "User"
 		ON
-			Follow.follower = User.id
+			Follow.follower = "User".id
 		WHERE
-			Follow.following = ?`, userID)
+			Follow.following = ? AND "User".deleted_at IS NULL`
+
+// GetFollowersList returns all the followers of the user with the given userID
+func (db *appdbimpl) GetFollowersList(userID string) ([]structs.User, error) {
+	var followers []structs.User
+	rows, err := db.c.Query(getFollowersListQuery, userID)
 	if err != nil {
 		return followers, fmt.Errorf("querying followers: %w", err)
 	}
@@ -39,7 +42,7 @@ func (db *appdbimpl) GetFollowersList(userID string) ([]structs.User, error) {
 
 	for rows.Next() {
 		var follower structs.User
-		err = rows.Scan(&follower.UserID, &follower.Username, &follower.SignUpDate, &follower.LastSeenDate, &follower.Bio, &follower.ProfileImage, &follower.Followers, &follower.Following)
+		err = rows.Scan(&follower.UserID, &follower.Username, scanTime(&follower.SignUpDate), scanTime(&follower.LastSeenDate), &follower.Bio, &follower.ProfileImage, &follower.Followers, &follower.Following)
 		if err != nil {
 			return followers, fmt.Errorf("scanning follower: %w", err)
 		}
@@ -51,25 +54,28 @@ func (db *appdbimpl) GetFollowersList(userID string) ([]structs.User, error) {
 	return followers, nil
 }
 
-// GetFollowingsList returns all the users followed by the user with the given userID
-func (db *appdbimpl) GetFollowingsList(userID string) ([]structs.User, error) {
-	var followings []structs.User
-	rows, err := db.c.Query(`
+// getFollowingsListQuery selects the active users followed by a user
+const getFollowingsListQuery = `
 		SELECT 
-			User.id,
-			User.username,
-			User.signup_date,
-			User.last_seen,
-			User.bio,
-			User.profile_image_id,
-			User.followers_count,
-			User.following_count
+			"User".id,
+			"User".username,
+			"User".signup_date,
+			"User".last_seen,
+			"User".bio,
+			"User".profile_image_id,
+			"User".followers_count,
+			"User".following_count
 		FROM 
-			Follow JOIN User
+			Follow JOIN "User"
 		ON
-			Follow.following = User.id
+			Follow.following = "User".id
 		WHERE
-			Follow.follower = ?`, userID)
+			Follow.follower = ? AND "User".deleted_at IS NULL`
+
+// GetFollowingsList returns all the users followed by the user with the given userID
+func (db *appdbimpl) GetFollowingsList(userID string) ([]structs.User, error) {
+	var followings []structs.User
+	rows, err := db.c.Query(getFollowingsListQuery, userID)
 	if err != nil {
 		return followings, fmt.Errorf("querying followings: %w", err)
 	}
@@ -77,7 +83,7 @@ func (db *appdbimpl) GetFollowingsList(userID string) ([]structs.User, error) {
 
 	for rows.Next() {
 		var following structs.User
-		err = rows.Scan(&following.UserID, &following.Username, &following.SignUpDate, &following.LastSeenDate, &following.Bio, &following.ProfileImage, &following.Followers, &following.Following)
+		err = rows.Scan(&following.UserID, &following.Username, scanTime(&following.SignUpDate), scanTime(&following.LastSeenDate), &following.Bio, &following.ProfileImage, &following.Followers, &following.Following)
 		if err != nil {
 			return followings, fmt.Errorf("scanning following: %w", err)
 		}
@@ -117,7 +123,7 @@ func (db *appdbimpl) FollowUser(userID string, followingID string) error {
 
 	// Update the following counter
 	_, err = db.c.Exec(`
-		UPDATE User
+		UPDATE "User"
 		SET following_count = following_count + 1
 		WHERE id = ?`, userID)
 	if err != nil {
@@ -126,7 +132,7 @@ func (db *appdbimpl) FollowUser(userID string, followingID string) error {
 
 	// Update the followers counter
 	_, err = db.c.Exec(`
-		UPDATE User
+		UPDATE "User"
 		SET followers_count = followers_count + 1
 		WHERE id = ?`, followingID)
 	if err != nil {
@@ -164,7 +170,7 @@ func (db *appdbimpl) UnfollowUser(userID string, followingID string) error {
 
 	// Update the following counter
 	_, err = db.c.Exec(`
-		UPDATE User
+		UPDATE "User"
 		SET following_count = following_count - 1
 		WHERE id = ?`, userID)
 	if err != nil {
@@ -172,7 +178,7 @@ func (db *appdbimpl) UnfollowUser(userID string, followingID string) error {
 	}
 	// Update the followers counter
 	_, err = db.c.Exec(`
-		UPDATE User
+		UPDATE "User"
 		SET followers_count = followers_count - 1
 		WHERE id = ?`, followingID)
 	if err != nil {
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the implementation of every function used to interact with the idempotency keys
+	i.e. the follwoing functions
+	ReserveIdempotencyKey(scope string, key string, fingerprint string, expiredBefore time.Time) (structs.IdempotentResponse, bool, error)
+	SaveIdempotentResponse(scope string, key string, response structs.IdempotentResponse) error
+	DeleteIdempotencyKey(scope string, key string) error
+	PurgeIdempotencyKeys(createdBefore time.Time) error
+
+	The scope of a key is the user sending it, so that two users can't see the responses of each other.
+*/
+
+// ReserveIdempotencyKey records the key for a new request with the given fingerprint. Keys created before
+// expiredBefore are replaced. It returns true if the key has been reserved, otherwise the request already recorded
+// for the key, with its response if it has been saved.
+func (db *appdbimpl) ReserveIdempotencyKey(scope string, key string, fingerprint string, expiredBefore time.Time) (structs.IdempotentResponse, bool, error) {
+	var response structs.IdempotentResponse
+	tx, err := db.c.Begin()
+	if err != nil {
+		return response, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Forget the expired key
+	_, err = tx.Exec("DELETE FROM IdempotencyKey WHERE scope = ? AND key = ? AND creation_date < ?", scope, key, formatTime(expiredBefore))
+	if err != nil {
+		return response, false, fmt.Errorf("error deleting expired idempotency key: %w", err)
+	}
+
+	res, err := tx.Exec(`
+	INSERT INTO 
+		IdempotencyKey (scope, key, fingerprint, creation_date) 
+	VALUES 
+		(?, ?, ?, ?)
+	ON CONFLICT DO NOTHING`,
+		scope, key, fingerprint, now())
+	if err != nil {
+		return response, false, fmt.Errorf("error reserving idempotency key: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return response, false, fmt.Errorf("error reserving idempotency key: %w", err)
+	}
+
+	// The key is already used
+	if affected == 0 {
+		err = tx.QueryRow(`
+		SELECT 
+			fingerprint, 
+			status, 
+			content_type, 
+			COALESCE(body, '') 
+		FROM 
+			IdempotencyKey 
+		WHERE 
+			scope = ? AND key = ?`,
+			scope, key).Scan(&response.Fingerprint, &response.Status, &response.ContentType, &response.Body)
+		if err != nil {
+			return response, false, fmt.Errorf("error getting idempotency key: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return response, false, fmt.Errorf("error committing idempotency key: %w", err)
+	}
+	return response, affected > 0, nil
+}
+
+// SaveIdempotentResponse saves the response given to the request of the reserved key
+func (db *appdbimpl) SaveIdempotentResponse(scope string, key string, response structs.IdempotentResponse) error {
+	_, err := db.c.Exec(`
+	UPDATE 
+		IdempotencyKey 
+	SET 
+		status = ?, 
+		content_type = ?, 
+		body = ? 
+	WHERE 
+		scope = ? AND key = ?`,
+		response.Status, response.ContentType, response.Body, scope, key)
+	if err != nil {
+		return fmt.Errorf("error saving idempotent response: %w", err)
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey forgets the key, so that the request can be sent again with it
+func (db *appdbimpl) DeleteIdempotencyKey(scope string, key string) error {
+	_, err := db.c.Exec("DELETE FROM IdempotencyKey WHERE scope = ? AND key = ?", scope, key)
+	if err != nil {
+		return fmt.Errorf("error deleting idempotency key: %w", err)
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys removes the keys created before createdBefore
+func (db *appdbimpl) PurgeIdempotencyKeys(createdBefore time.Time) error {
+	_, err := db.c.Exec("DELETE FROM IdempotencyKey WHERE creation_date < ?", formatTime(createdBefore))
+	if err != nil {
+		return fmt.Errorf("error purging idempotency keys: %w", err)
+	}
+	return nil
+}
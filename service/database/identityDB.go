@@ -0,0 +1,126 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the implementation of every function used to link the users to the accounts of external
+	identity providers (OpenID Connect)
+	i.e. the follwoing functions
+	GetIdentityUser(issuer string, subject string) (string, error)
+	LinkIdentity(issuer string, subject string, userID string) error
+	GetUserByEmail(email string) (structs.User, error)
+	SetUserEmail(userID string, email string) error
+*/
+
+// GetIdentityUser returns the ID of the active user linked to the account subject of the provider issuer
+func (db *appdbimpl) GetIdentityUser(issuer string, subject string) (string, error) {
+	var userID string
+	err := db.c.QueryRow(`
+	SELECT 
+		Identity.user_id 
+	FROM 
+		Identity JOIN "User"
+	ON
+		Identity.user_id = "User".id
+	WHERE 
+		Identity.issuer = ? AND Identity.subject = ? AND "User".deleted_at IS NULL`,
+		issuer, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return userID, fmt.Errorf("identity not found: %w", ErrNotFound)
+		}
+		return userID, fmt.Errorf("error getting identity: %w", err)
+	}
+	return userID, nil
+}
+
+// LinkIdentity links the account subject of the provider issuer to the user with the given userID
+func (db *appdbimpl) LinkIdentity(issuer string, subject string, userID string) error {
+	_, err := db.c.Exec(`
+	INSERT INTO 
+		Identity (issuer, subject, user_id, link_date) 
+	VALUES 
+		(?, ?, ?, ?)
+	ON CONFLICT (issuer, subject) DO UPDATE SET
+		user_id = excluded.user_id, 
+		link_date = excluded.link_date`,
+		issuer, subject, userID, now())
+	if err != nil {
+		return fmt.Errorf("error linking identity: %w", err)
+	}
+	return nil
+}
+
+// userByEmailQuery selects the oldest active user with an email, ignoring the case
+var userByEmailQuery = dialectQuery{
+	sqlite: `
+	SELECT 
+		id, 
+		username, 
+		signup_date, 
+		last_seen, 
+		bio, 
+		profile_image_id, 
+		followers_count, 
+		following_count 
+	FROM 
+		"User" 
+	WHERE 
+		email = ? COLLATE NOCASE AND deleted_at IS NULL
+	ORDER BY
+		signup_date
+	LIMIT 1`,
+	postgres: `
+	SELECT 
+		id, 
+		username, 
+		signup_date, 
+		last_seen, 
+		bio, 
+		profile_image_id, 
+		followers_count, 
+		following_count 
+	FROM 
+		"User" 
+	WHERE 
+		lower(email) = lower(?) AND deleted_at IS NULL
+	ORDER BY
+		signup_date
+	LIMIT 1`,
+}
+
+// GetUserByEmail returns the active user with the given email (ignoring the case). If more users have the same
+// email, the oldest one is returned.
+func (db *appdbimpl) GetUserByEmail(email string) (structs.User, error) {
+	var user structs.User
+	err := db.c.QueryRow(db.c.dialect.query(userByEmailQuery), email).Scan(&user.UserID, &user.Username, scanTime(&user.SignUpDate), scanTime(&user.LastSeenDate), &user.Bio, &user.ProfileImage, &user.Followers, &user.Following)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, fmt.Errorf("user not found: %w", ErrNotFound)
+		}
+		return user, fmt.Errorf("error getting user by email: %w", err)
+	}
+	return user, nil
+}
+
+// SetUserEmail sets the (verified) email of the user with the given userID
+func (db *appdbimpl) SetUserEmail(userID string, email string) error {
+	_, err := db.c.Exec(`
+	UPDATE 
+		"User" 
+	SET 
+		email = ? 
+	WHERE 
+		id = ? AND deleted_at IS NULL`,
+		email, userID)
+	if err != nil {
+		return fmt.Errorf("error setting user email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/gofrs/uuid"
+)
+
+/* This file contains the implementation of every function used to interact with the job table
+   i.e. the follwoing functions
+	CreateJob(kind string, userID string, scheduledDate time.Time) (structs.Job, error)
+	GetJob(jobID string) (structs.Job, error)
+	GetUserJobs(userID string) ([]structs.Job, error)
+	UpdateJob(jobID string, status string, progress int) error
+	CancelJobs(kind string, userID string) error
+	GetDueJobs(kind string, due time.Time) ([]structs.Job, error)
+
+   A job is a long running task started on behalf of a user, like a data export or an account deletion.
+*/
+
+// Job statuses
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// CreateJob creates a new pending job of the given kind for the user with the given userID, due at scheduledDate
+func (db *appdbimpl) CreateJob(kind string, userID string, scheduledDate time.Time) (structs.Job, error) {
+	var job structs.Job
+
+	// Generate a new UUID v4
+	id, err := uuid.NewV4()
+	if err != nil {
+		return job, fmt.Errorf("error generating UUID: %w", err)
+	}
+
+	job = structs.Job{
+		JobID:         id.String(),
+		Kind:          kind,
+		UserID:        userID,
+		Status:        JobPending,
+		CreationDate:  storedTime(globaltime.Now()),
+		ScheduledDate: storedTime(scheduledDate),
+	}
+	job.UpdateDate = job.CreationDate
+
+	_, err = db.c.Exec(`
+	INSERT INTO 
+		Job (id, kind, user_id, status, progress, creation_date, scheduled_date, update_date) 
+	VALUES 
+		(?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.JobID, job.Kind, job.UserID, job.Status, job.Progress, formatTime(job.CreationDate), formatTime(job.ScheduledDate), formatTime(job.UpdateDate))
+	if err != nil {
+		return job, fmt.Errorf("error creating job: %w", err)
+	}
+	return job, nil
+}
+
+// GetJob returns the job with the given jobID
+func (db *appdbimpl) GetJob(jobID string) (structs.Job, error) {
+	var job structs.Job
+	err := db.c.QueryRow(`
+	SELECT 
+		id, 
+		kind, 
+		user_id, 
+		status, 
+		progress, 
+		creation_date, 
+		scheduled_date, 
+		update_date 
+	FROM 
+		Job 
+	WHERE 
+		id = ?`,
+		jobID).Scan(&job.JobID, &job.Kind, &job.UserID, &job.Status, &job.Progress, scanTime(&job.CreationDate), scanTime(&job.ScheduledDate), scanTime(&job.UpdateDate))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return job, fmt.Errorf("job not found: %w", ErrNotFound)
+		}
+		return job, fmt.Errorf("error getting job: %w", err)
+	}
+	return job, nil
+}
+
+// UpdateJob sets the status and the progress of the job with the given jobID. A cancelled job stays cancelled: it
+// returns ErrConflict instead, so that a running job can check at every step that it was not cancelled.
+func (db *appdbimpl) UpdateJob(jobID string, status string, progress int) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		Job 
+	SET 
+		status = ?, 
+		progress = ?, 
+		update_date = ? 
+	WHERE 
+		id = ? AND status != ?`,
+		status, progress, now(), jobID, JobCancelled)
+	if err != nil {
+		return fmt.Errorf("error updating job: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error updating job: %w", err)
+	}
+	if affected == 0 {
+		_, err = db.GetJob(jobID)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("job cancelled: %w", ErrConflict)
+	}
+	return nil
+}
+
+// GetUserJobs returns all the jobs of the user with the given userID, newest first
+func (db *appdbimpl) GetUserJobs(userID string) ([]structs.Job, error) {
+	rows, err := db.c.Query(`
+	SELECT 
+		id, 
+		kind, 
+		user_id, 
+		status, 
+		progress, 
+		creation_date, 
+		scheduled_date, 
+		update_date 
+	FROM 
+		Job 
+	WHERE 
+		user_id = ?
+	ORDER BY
+		creation_date DESC`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user jobs: %w", err)
+	}
+	return scanJobs(rows)
+}
+
+// CancelJobs cancels the pending and running jobs of the given kind of the user with the given userID. The running
+// jobs stop at their next step, see UpdateJob.
+func (db *appdbimpl) CancelJobs(kind string, userID string) error {
+	_, err := db.c.Exec(`
+	UPDATE 
+		Job 
+	SET 
+		status = ?, 
+		update_date = ? 
+	WHERE 
+		kind = ? AND user_id = ? AND status IN (?, ?)`,
+		JobCancelled, now(), kind, userID, JobPending, JobRunning)
+	if err != nil {
+		return fmt.Errorf("error cancelling jobs: %w", err)
+	}
+	return nil
+}
+
+// GetDueJobs returns the jobs of the given kind scheduled before due that are pending or were interrupted while
+// running, oldest first
+func (db *appdbimpl) GetDueJobs(kind string, due time.Time) ([]structs.Job, error) {
+	rows, err := db.c.Query(`
+	SELECT 
+		id, 
+		kind, 
+		user_id, 
+		status, 
+		progress, 
+		creation_date, 
+		scheduled_date, 
+		update_date 
+	FROM 
+		Job 
+	WHERE 
+		kind = ? AND status IN (?, ?) AND scheduled_date <= ?
+	ORDER BY
+		scheduled_date`,
+		kind, JobPending, JobRunning, formatTime(due))
+	if err != nil {
+		return nil, fmt.Errorf("error getting due jobs: %w", err)
+	}
+	return scanJobs(rows)
+}
+
+// scanJobs reads all the jobs from rows, closing it
+func scanJobs(rows *sql.Rows) ([]structs.Job, error) {
+	var jobs []structs.Job
+	defer rows.Close()
+
+	for rows.Next() {
+		var job structs.Job
+		err := rows.Scan(&job.JobID, &job.Kind, &job.UserID, &job.Status, &job.Progress, scanTime(&job.CreationDate), scanTime(&job.ScheduledDate), scanTime(&job.UpdateDate))
+		if err != nil {
+			return jobs, fmt.Errorf("error scanning job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return jobs, fmt.Errorf("error iterating over jobs: %w", err)
+	}
+	return jobs, nil
+}
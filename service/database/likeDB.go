@@ -1,7 +1,6 @@
 package database
 
 import (
-	"errors"
 	"fmt"
 	"github.com/attiliov/WASA-Photo/service/structs"
 )
@@ -15,19 +14,23 @@ import (
 	GetCommentLikes(commentID string) ([]structs.Like, error)
 	LikeComment(commentID string, likerID string) error
 	UnlikeComment(commentID string, likerID string) error
+
+	GetUserLikes(userID string) ([]structs.Like, error)
 */
 
-// GetPostLikes returns all the likes of the post with the given postID
-func (db *appdbimpl) GetPostLikes(postID string) ([]structs.Like, error) {
-	var likes []structs.Like
-	rows, err := db.c.Query(`
+// getPostLikesQuery selects the likes of a post by active users
+const getPostLikesQuery = `
 	SELECT 
 		*
 	FROM 
 		PostLike 
 	WHERE 
-		post_id = ?`,
-		postID)
+		post_id = ? AND EXISTS (SELECT 1 FROM "User" WHERE "User".id = PostLike.user_id AND "User".deleted_at IS NULL)`
+
+// GetPostLikes returns all the likes of the post with the given postID
+func (db *appdbimpl) GetPostLikes(postID string) ([]structs.Like, error) {
+	var likes []structs.Like
+	rows, err := db.c.Query(getPostLikesQuery, postID)
 	if err != nil {
 		return likes, fmt.Errorf("error getting likes: %w", err)
 	}
@@ -51,22 +54,22 @@ func (db *appdbimpl) GetPostLikes(postID string) ([]structs.Like, error) {
 func (db *appdbimpl) LikePost(postID string, likerID string) error {
 	// Check if the post exists
 	var postExists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Post WHERE id = ?)", postID).Scan(&postExists)
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Post WHERE id = ? AND deleted_at IS NULL)", postID).Scan(&postExists)
 	if err != nil {
 		return fmt.Errorf("error checking if post exists: %w", err)
 	}
 	if !postExists {
-		return errors.New("post does not exist")
+		return fmt.Errorf("post does not exist: %w", ErrNotFound)
 	}
 
 	// Check if the user exists
 	var userExists bool
-	err = db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM User WHERE id = ?)", likerID).Scan(&userExists)
+	err = db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM "User" WHERE id = ? AND deleted_at IS NULL)`, likerID).Scan(&userExists)
 	if err != nil {
 		return fmt.Errorf("error checking if user exists: %w", err)
 	}
 	if !userExists {
-		return errors.New("user does not exist")
+		return fmt.Errorf("user does not exist: %w", ErrNotFound)
 	}
 
 	// Check if the like already exists
@@ -81,7 +84,7 @@ func (db *appdbimpl) LikePost(postID string, likerID string) error {
 
 	// Get user username
 	var username string
-	err = db.c.QueryRow("SELECT username FROM User WHERE id = ?", likerID).Scan(&username)
+	err = db.c.QueryRow(`SELECT username FROM "User" WHERE id = ?`, likerID).Scan(&username)
 	if err != nil {
 		return fmt.Errorf("error getting username: %w", err)
 	}
@@ -105,12 +108,12 @@ func (db *appdbimpl) LikePost(postID string, likerID string) error {
 func (db *appdbimpl) UnlikePost(postID string, likerID string) error {
 	// Check if the post exists
 	var postExists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Post WHERE id = ?)", postID).Scan(&postExists)
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Post WHERE id = ? AND deleted_at IS NULL)", postID).Scan(&postExists)
 	if err != nil {
 		return fmt.Errorf("error checking if post exists: %w", err)
 	}
 	if !postExists {
-		return errors.New("post does not exist")
+		return fmt.Errorf("post does not exist: %w", ErrNotFound)
 	}
 
 	// Check if the like exists
@@ -137,17 +140,19 @@ func (db *appdbimpl) UnlikePost(postID string, likerID string) error {
 	return nil
 }
 
-// GetCommentLikes returns all the likes of the comment with the given commentID
-func (db *appdbimpl) GetCommentLikes(commentID string) ([]structs.Like, error) {
-	var likes []structs.Like
-	rows, err := db.c.Query(`
+// getCommentLikesQuery selects the likes of a comment by active users
+const getCommentLikesQuery = `
 	SELECT 
 		*
 	FROM 
 		CommentLike 
 	WHERE 
-		comment_id = ?`,
-		commentID)
+		comment_id = ? AND EXISTS (SELECT 1 FROM "User" WHERE "User".id = CommentLike.user_id AND "User".deleted_at IS NULL)`
+
+// GetCommentLikes returns all the likes of the comment with the given commentID
+func (db *appdbimpl) GetCommentLikes(commentID string) ([]structs.Like, error) {
+	var likes []structs.Like
+	rows, err := db.c.Query(getCommentLikesQuery, commentID)
 	if err != nil {
 		return likes, fmt.Errorf("error getting likes: %w", err)
 	}
@@ -171,22 +176,22 @@ func (db *appdbimpl) GetCommentLikes(commentID string) ([]structs.Like, error) {
 func (db *appdbimpl) LikeComment(commentID string, likerID string) error {
 	// Check if the comment exists
 	var commentExists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Comment WHERE id = ?)", commentID).Scan(&commentExists)
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Comment WHERE id = ? AND deleted_at IS NULL)", commentID).Scan(&commentExists)
 	if err != nil {
 		return fmt.Errorf("error checking if comment exists: %w", err)
 	}
 	if !commentExists {
-		return errors.New("comment does not exist")
+		return fmt.Errorf("comment does not exist: %w", ErrNotFound)
 	}
 
 	// Check if the user exists
 	var userExists bool
-	err = db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM User WHERE id = ?)", likerID).Scan(&userExists)
+	err = db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM "User" WHERE id = ? AND deleted_at IS NULL)`, likerID).Scan(&userExists)
 	if err != nil {
 		return fmt.Errorf("error checking if user exists: %w", err)
 	}
 	if !userExists {
-		return errors.New("user does not exist")
+		return fmt.Errorf("user does not exist: %w", ErrNotFound)
 	}
 
 	// Check if the like already exists
@@ -201,7 +206,7 @@ func (db *appdbimpl) LikeComment(commentID string, likerID string) error {
 
 	// Get user username
 	var username string
-	err = db.c.QueryRow("SELECT username FROM User WHERE id = ?", likerID).Scan(&username)
+	err = db.c.QueryRow(`SELECT username FROM "User" WHERE id = ?`, likerID).Scan(&username)
 	if err != nil {
 		return fmt.Errorf("error getting username: %w", err)
 	}
@@ -224,12 +229,12 @@ func (db *appdbimpl) LikeComment(commentID string, likerID string) error {
 func (db *appdbimpl) UnlikeComment(commentID string, likerID string) error {
 	// Check if the comment exists
 	var commentExists bool
-	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Comment WHERE id = ?)", commentID).Scan(&commentExists)
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Comment WHERE id = ? AND deleted_at IS NULL)", commentID).Scan(&commentExists)
 	if err != nil {
 		return fmt.Errorf("error checking if comment exists: %w", err)
 	}
 	if !commentExists {
-		return errors.New("comment does not exist")
+		return fmt.Errorf("comment does not exist: %w", ErrNotFound)
 	}
 
 	// Check if the like exists
@@ -255,3 +260,40 @@ func (db *appdbimpl) UnlikeComment(commentID string, likerID string) error {
 	}
 	return nil
 }
+
+// GetUserLikes returns all the likes put by the user with the given userID, both on posts and on comments
+func (db *appdbimpl) GetUserLikes(userID string) ([]structs.Like, error) {
+	var likes []structs.Like
+	rows, err := db.c.Query(`
+	SELECT 
+		user_id, post_id, username
+	FROM 
+		PostLike 
+	WHERE 
+		user_id = ?
+	UNION ALL
+	SELECT 
+		user_id, comment_id, username
+	FROM 
+		CommentLike 
+	WHERE 
+		user_id = ?`,
+		userID, userID)
+	if err != nil {
+		return likes, fmt.Errorf("error getting user likes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var like structs.Like
+		err := rows.Scan(&like.UserID, &like.Resource, &like.Username)
+		if err != nil {
+			return likes, fmt.Errorf("error getting like: %w", err)
+		}
+		likes = append(likes, like)
+	}
+	if err := rows.Err(); err != nil {
+		return likes, fmt.Errorf("error iterating over likes: %w", err)
+	}
+	return likes, nil
+}
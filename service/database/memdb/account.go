@@ -0,0 +1,178 @@
+package memdb
+
+/*
+	This file contains the steps of the account deletion
+	i.e. the functions of accountDB.go of package database
+*/
+
+// DeleteUserLikes removes the likes put by the user with the given userID, updating the like counters
+func (db *memdb) DeleteUserLikes(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for key := range db.postLikes {
+		if key.userID == userID {
+			if p, ok := db.posts[key.resource]; ok {
+				p.LikeCount--
+			}
+			delete(db.postLikes, key)
+		}
+	}
+	for key := range db.commentLikes {
+		if key.userID == userID {
+			if c, ok := db.comments[key.resource]; ok {
+				c.LikeCount--
+			}
+			delete(db.commentLikes, key)
+		}
+	}
+	return nil
+}
+
+// DeleteUserFollows removes the follows from and to the user with the given userID, updating the follow counters
+func (db *memdb) DeleteUserFollows(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for follow := range db.follows {
+		if follow.to == userID {
+			if u, ok := db.users[follow.from]; ok {
+				u.Following--
+			}
+		}
+		if follow.from == userID {
+			if u, ok := db.users[follow.to]; ok {
+				u.Followers--
+			}
+		}
+	}
+	for follow := range db.follows {
+		if follow.from == userID || follow.to == userID {
+			delete(db.follows, follow)
+		}
+	}
+	return nil
+}
+
+// DeleteUserBans removes the bans put by and on the user with the given userID
+func (db *memdb) DeleteUserBans(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for ban := range db.bans {
+		if ban.from == userID || ban.to == userID {
+			delete(db.bans, ban)
+		}
+	}
+	return nil
+}
+
+// DeleteUserComments removes the comments written by the user with the given userID, with their likes and edit
+// history, updating the comment counters of the commented posts
+func (db *memdb) DeleteUserComments(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.deleteComments(func(c *comment) bool { return c.AuthorID == userID }, true)
+	return nil
+}
+
+// DeletePosts removes the posts of the user with the given userID, with everything attached to them: comments,
+// likes and edit history. Photo files are not touched, see DeletePhoto.
+func (db *memdb) DeleteUserPosts(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.deletePosts(func(p *post) bool { return p.AuthorID == userID })
+	return nil
+}
+
+// deleteComments removes the comments for which deleted returns true, with their likes and revisions. If
+// updateCounters, the live comments are subtracted from the comment counters of their posts.
+func (db *memdb) deleteComments(deleted func(c *comment) bool, updateCounters bool) {
+	for commentID, c := range db.comments {
+		if !deleted(c) {
+			continue
+		}
+		if p, ok := db.posts[c.postID]; ok && updateCounters && c.deletedAt.IsZero() {
+			p.CommentCount--
+		}
+		for key := range db.commentLikes {
+			if key.resource == commentID {
+				delete(db.commentLikes, key)
+			}
+		}
+		db.deleteRevisions(func(resourceID string) bool { return resourceID == commentID })
+		delete(db.comments, commentID)
+	}
+}
+
+// deletePosts removes the posts for which deleted returns true, with their comments, likes and revisions, and
+// returns the removed posts
+func (db *memdb) deletePosts(deleted func(p *post) bool) []*post {
+	var removed []*post
+	for postID, p := range db.posts {
+		if deleted(p) {
+			removed = append(removed, p)
+			delete(db.posts, postID)
+		}
+	}
+	isRemoved := make(map[string]bool)
+	for _, p := range removed {
+		isRemoved[p.PostID] = true
+	}
+	db.deleteComments(func(c *comment) bool { return isRemoved[c.postID] }, false)
+	db.deleteRevisions(func(resourceID string) bool { return isRemoved[resourceID] })
+	for key := range db.postLikes {
+		if isRemoved[key.resource] {
+			delete(db.postLikes, key)
+		}
+	}
+	return removed
+}
+
+// EraseUser removes the row of the user with the given userID, the record of their photos, their username history,
+// their linked identities, their warnings, the reports by and about them and their jobs, the running account deletion
+// included. This is the last step of the account deletion: after it, no row holds the user ID anymore.
+func (db *memdb) EraseUser(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for photoID, p := range db.photos {
+		if p.ownerID == userID {
+			delete(db.photos, photoID)
+		}
+	}
+	for username, change := range db.usernameHistory {
+		if change.userID == userID {
+			delete(db.usernameHistory, username)
+		}
+	}
+	for key, linkedID := range db.identities {
+		if linkedID == userID {
+			delete(db.identities, key)
+		}
+	}
+	for warningID, w := range db.warnings {
+		if w.userID == userID {
+			delete(db.warnings, warningID)
+		}
+	}
+	for reportID, r := range db.reports {
+		if r.ReporterID == userID || r.TargetUserID == userID {
+			delete(db.reports, reportID)
+		}
+	}
+	for tokenHash, sessionUserID := range db.sessions {
+		if sessionUserID == userID {
+			delete(db.sessions, tokenHash)
+		}
+	}
+	for jobID, j := range db.jobs {
+		if j.UserID == userID {
+			delete(db.jobs, jobID)
+		}
+	}
+	delete(db.users, userID)
+	return nil
+}
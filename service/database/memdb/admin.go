@@ -0,0 +1,254 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the administration of the users and the content
+	i.e. the functions of adminDB.go of package database
+*/
+
+// GetUserRole returns the role of the active user with the given userID
+func (db *memdb) GetUserRole(userID string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u := db.activeUser(userID)
+	if u == nil {
+		return "", fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	return u.role, nil
+}
+
+// SetUserRole sets the role of the active user with the given userID
+func (db *memdb) SetUserRole(userID string, role string) error {
+	return db.updateActiveUser(userID, func(u *user) { u.role = role })
+}
+
+// IsSuspended returns true if the user with the given userID is suspended
+func (db *memdb) IsSuspended(userID string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.users[userID]
+	return ok && !u.suspendedAt.IsZero(), nil
+}
+
+// SuspendUser suspends the active user with the given userID, their requests are refused until UnsuspendUser
+func (db *memdb) SuspendUser(userID string) error {
+	return db.updateActiveUser(userID, func(u *user) {
+		if u.suspendedAt.IsZero() {
+			u.suspendedAt = now()
+		}
+	})
+}
+
+// UnsuspendUser lifts the suspension of the active user with the given userID
+func (db *memdb) UnsuspendUser(userID string) error {
+	return db.updateActiveUser(userID, func(u *user) { u.suspendedAt = time.Time{} })
+}
+
+// updateActiveUser applies update to the active user with the given userID, failing if the user is not found
+func (db *memdb) updateActiveUser(userID string, update func(u *user)) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u := db.activeUser(userID)
+	if u == nil {
+		return fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	update(u)
+	return nil
+}
+
+// ListUsers returns the users, including the deleted and the suspended ones, ordered by signup date
+func (db *memdb) ListUsers(offset int, limit int) ([]structs.AdminUser, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list := db.sortedUsers(func(u *user) bool { return true })
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].SignUpDate.Equal(list[j].SignUpDate) {
+			return list[i].SignUpDate.Before(list[j].SignUpDate)
+		}
+		return list[i].UserID < list[j].UserID
+	})
+	start, end := page(len(list), offset, limit)
+	var users []structs.AdminUser
+	for _, u := range list[start:end] {
+		users = append(users, structs.AdminUser{
+			User:        u.profile(),
+			Role:        u.role,
+			Email:       u.email,
+			SuspendedAt: optionalTime(u.suspendedAt),
+			DeletedAt:   optionalTime(u.deletedAt),
+		})
+	}
+	return users, nil
+}
+
+// GetPostAuthor returns the ID of the author of the post with the given postID. Unlike GetPost, it finds deleted and
+// held posts too, until they are purged.
+func (db *memdb) GetPostAuthor(postID string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.posts[postID]
+	if !ok {
+		return "", fmt.Errorf("post not found: %w", database.ErrNotFound)
+	}
+	return p.AuthorID, nil
+}
+
+// GetCommentAuthor returns the ID of the author of the comment with the given commentID, see GetPostAuthor
+func (db *memdb) GetCommentAuthor(commentID string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.comments[commentID]
+	if !ok {
+		return "", fmt.Errorf("comment not found: %w", database.ErrNotFound)
+	}
+	return c.AuthorID, nil
+}
+
+// RemovePost deletes the post with the given postID on behalf of a moderator. Unlike DeletePost, the author can't
+// restore it. Posts held for review can be removed too.
+func (db *memdb) RemovePost(postID string, moderatorID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.posts[postID]
+	if !ok || (!p.deletedAt.IsZero() && p.heldAt.IsZero()) {
+		return fmt.Errorf("post not found: %w", database.ErrNotFound)
+	}
+	p.deletedAt = now()
+	p.removedBy = moderatorID
+	p.heldAt = time.Time{}
+	return nil
+}
+
+// RemoveComment deletes the comment with the given commentID on behalf of a moderator. Unlike DeleteComment, the
+// author can't restore it. Comments held for review can be removed too.
+func (db *memdb) RemoveComment(commentID string, moderatorID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Held comments are already deleted
+	if c, ok := db.comments[commentID]; ok && !c.heldAt.IsZero() {
+		c.removedBy = moderatorID
+		c.heldAt = time.Time{}
+		return nil
+	}
+
+	err := db.deleteComment(commentID)
+	if err != nil {
+		return err
+	}
+	db.comments[commentID].removedBy = moderatorID
+	return nil
+}
+
+// HoldPost hides the post with the given postID until a moderator reviews it. The post is hidden like a deleted one,
+// but it can't be restored by its author nor purged.
+func (db *memdb) HoldPost(postID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p := db.livePost(postID)
+	if p == nil {
+		return fmt.Errorf("post not found: %w", database.ErrNotFound)
+	}
+	date := now()
+	p.deletedAt = date
+	p.heldAt = date
+	return nil
+}
+
+// HoldComment hides the comment with the given commentID until a moderator reviews it, see HoldPost
+func (db *memdb) HoldComment(commentID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err := db.deleteComment(commentID)
+	if err != nil {
+		return err
+	}
+	c := db.comments[commentID]
+	c.heldAt = c.deletedAt
+	return nil
+}
+
+// ReleasePost publishes the post with the given postID held for review
+func (db *memdb) ReleasePost(postID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.posts[postID]
+	if !ok || p.heldAt.IsZero() {
+		return fmt.Errorf("held post not found: %w", database.ErrNotFound)
+	}
+	p.deletedAt = time.Time{}
+	p.heldAt = time.Time{}
+	return nil
+}
+
+// ReleaseComment publishes the comment with the given commentID held for review
+func (db *memdb) ReleaseComment(commentID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.comments[commentID]
+	if !ok || c.heldAt.IsZero() {
+		return nil
+	}
+	if p, ok := db.posts[c.postID]; ok {
+		p.CommentCount++
+	}
+	c.deletedAt = time.Time{}
+	c.heldAt = time.Time{}
+	return nil
+}
+
+// GetStats returns the number of rows of the main tables. Deleted posts and comments are not counted.
+func (db *memdb) GetStats() (structs.Stats, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var stats structs.Stats
+	for _, u := range db.users {
+		if u.deletedAt.IsZero() {
+			stats.Users++
+		} else {
+			stats.DeletedUsers++
+		}
+		if !u.suspendedAt.IsZero() {
+			stats.SuspendedUsers++
+		}
+	}
+	for _, p := range db.posts {
+		if p.deletedAt.IsZero() {
+			stats.Posts++
+		}
+	}
+	for _, c := range db.comments {
+		if c.deletedAt.IsZero() {
+			stats.Comments++
+		}
+	}
+	stats.Likes = len(db.postLikes) + len(db.commentLikes)
+	stats.Follows = len(db.follows)
+	stats.Bans = len(db.bans)
+	for _, j := range db.jobs {
+		if j.Status == database.JobPending || j.Status == database.JobRunning {
+			stats.PendingJobs++
+		}
+	}
+	return stats, nil
+}
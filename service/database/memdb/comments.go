@@ -0,0 +1,185 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the comments of the posts
+	i.e. the functions of commentDB.go of package database
+*/
+
+// comment is a row of the Comment table
+type comment struct {
+	structs.Comment
+	postID    string
+	deletedAt time.Time // Zero if not deleted
+	heldAt    time.Time // Zero if not held for review
+	removedBy string    // The moderator that removed the comment, if any
+	seq       int
+}
+
+// liveComment returns the comment with the given commentID, or nil if it doesn't exist or is deleted
+func (db *memdb) liveComment(commentID string) *comment {
+	c, ok := db.comments[commentID]
+	if !ok || !c.deletedAt.IsZero() {
+		return nil
+	}
+	return c
+}
+
+// listed returns the comment as read by the queries of the lists, without its version
+func (c *comment) listed() structs.Comment {
+	listed := c.Comment
+	listed.Version = 0
+	return listed
+}
+
+// sortedComments returns the comments matching filter, in insertion order
+func (db *memdb) sortedComments(filter func(c *comment) bool) []*comment {
+	var list []*comment
+	for _, c := range db.comments {
+		if filter(c) {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].seq < list[j].seq })
+	return list
+}
+
+// GetPostComments returns all the comments of the post with the given postID
+func (db *memdb) GetPostComments(postID string) ([]structs.Comment, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var comments []structs.Comment
+	for _, c := range db.sortedComments(func(c *comment) bool {
+		return c.postID == postID && c.deletedAt.IsZero() && db.activeUser(c.AuthorID) != nil
+	}) {
+		comments = append(comments, c.listed())
+	}
+	return comments, nil
+}
+
+// CreateComment creates a new comment in the database and returns its ID
+func (db *memdb) CreateComment(postID string, postComment structs.Comment) (structs.ResourceID, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p := db.livePost(postID)
+	if p == nil {
+		return structs.ResourceID{}, fmt.Errorf("post does not exist: %w", database.ErrNotFound)
+	}
+	if db.activeUser(postComment.AuthorID) == nil {
+		return structs.ResourceID{}, fmt.Errorf("author does not exist: %w", database.ErrNotFound)
+	}
+
+	commentID, err := newID()
+	if err != nil {
+		return structs.ResourceID{}, err
+	}
+	postComment.CommentID = commentID
+	postComment.CreationDate = creationDate(postComment.CreationDate)
+	postComment.LikeCount = 0
+	postComment.EditedAt = nil
+	postComment.Version = 1
+	db.comments[commentID] = &comment{Comment: postComment, postID: postID, seq: db.next()}
+	p.CommentCount++
+	return structs.ResourceID{ResourceID: commentID}, nil
+}
+
+// GetComment returns the comment with the given commentID
+func (db *memdb) GetComment(commentID string) (structs.Comment, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.liveComment(commentID)
+	if c == nil || db.activeUser(c.AuthorID) == nil {
+		return structs.Comment{}, fmt.Errorf("comment does not exist: %w", database.ErrNotFound)
+	}
+	return c.Comment, nil
+}
+
+// EditComment edits the caption of the comment with the given commentID, if the comment is still at the given version,
+// and returns the new version, see database.AppDatabase
+func (db *memdb) EditComment(commentID string, edit structs.Comment, version int) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.liveComment(commentID)
+	if c == nil {
+		return 0, fmt.Errorf("comment does not exist: %w", database.ErrNotFound)
+	}
+	if c.Version != version {
+		return 0, database.ErrVersionMismatch
+	}
+	if c.Caption == edit.Caption {
+		return version, nil
+	}
+
+	err := db.addRevision(commentID, c.Caption)
+	if err != nil {
+		return 0, err
+	}
+	c.Caption = edit.Caption
+	c.EditedAt = optionalTime(now())
+	c.Version++
+	return c.Version, nil
+}
+
+// DeleteComment marks the comment with the given commentID as deleted
+func (db *memdb) DeleteComment(commentID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.deleteComment(commentID)
+}
+
+// deleteComment marks the comment with the given commentID as deleted and updates the comment count of its post
+func (db *memdb) deleteComment(commentID string) error {
+	c := db.liveComment(commentID)
+	if c == nil {
+		return fmt.Errorf("comment does not exist: %w", database.ErrNotFound)
+	}
+	c.deletedAt = now()
+	if p, ok := db.posts[c.postID]; ok {
+		p.CommentCount--
+	}
+	return nil
+}
+
+// RestoreComment restores the comment with the given commentID, if it belongs to authorID and was deleted after
+// deletedSince
+func (db *memdb) RestoreComment(commentID string, authorID string, deletedSince time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.comments[commentID]
+	if !ok || c.AuthorID != authorID || c.deletedAt.IsZero() || c.deletedAt.Before(storedTime(deletedSince)) || c.removedBy != "" || !c.heldAt.IsZero() {
+		return fmt.Errorf("no restorable comment found: %w", database.ErrNotFound)
+	}
+	c.deletedAt = time.Time{}
+	if p, ok := db.posts[c.postID]; ok {
+		p.CommentCount++
+	}
+	return nil
+}
+
+// GetUserComments returns all the comments written by the user with the given userID, oldest first
+func (db *memdb) GetUserComments(userID string) ([]structs.Comment, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list := db.sortedComments(func(c *comment) bool { return c.AuthorID == userID && c.deletedAt.IsZero() })
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreationDate.Before(list[j].CreationDate) })
+	var comments []structs.Comment
+	for _, c := range list {
+		comments = append(comments, c.listed())
+	}
+	return comments, nil
+}
@@ -0,0 +1,145 @@
+package memdb
+
+import (
+	"sort"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the follows and the bans between users
+	i.e. the functions of followDB.go and banDB.go of package database
+*/
+
+// pair is the key of the Follow and Ban tables: the follower and the followed user, or the user and the banned user
+type pair struct {
+	from string
+	to   string
+}
+
+// pairedUsers returns the active users paired by the relation, in the insertion order of the pairs. other returns the
+// user of the pair to list, or an empty string to skip the pair.
+func (db *memdb) pairedUsers(relation map[pair]int, other func(p pair) string) []structs.User {
+	var list []pair
+	for p := range relation {
+		if other(p) != "" {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return relation[list[i]] < relation[list[j]] })
+	var users []structs.User
+	for _, p := range list {
+		if u := db.activeUser(other(p)); u != nil {
+			users = append(users, u.profile())
+		}
+	}
+	return users
+}
+
+// GetFollowersList returns all the followers of the user with the given userID
+func (db *memdb) GetFollowersList(userID string) ([]structs.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.pairedUsers(db.follows, func(p pair) string {
+		if p.to == userID {
+			return p.from
+		}
+		return ""
+	}), nil
+}
+
+// GetFollowingsList returns all the users followed by the user with the given userID
+func (db *memdb) GetFollowingsList(userID string) ([]structs.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.pairedUsers(db.follows, func(p pair) string {
+		if p.from == userID {
+			return p.to
+		}
+		return ""
+	}), nil
+}
+
+// FollowUser adds a new entry in the Follow table
+func (db *memdb) FollowUser(userID string, followingID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := pair{from: userID, to: followingID}
+	if _, ok := db.follows[key]; ok {
+		return nil
+	}
+	db.follows[key] = db.next()
+	db.updateFollowCounters(key, 1)
+	return nil
+}
+
+// UnfollowUser removes an entry from the Follow table
+func (db *memdb) UnfollowUser(userID string, followingID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := pair{from: userID, to: followingID}
+	if _, ok := db.follows[key]; !ok {
+		return nil
+	}
+	delete(db.follows, key)
+	db.updateFollowCounters(key, -1)
+	return nil
+}
+
+// updateFollowCounters adds delta to the following counter of the follower and the followers counter of the
+// followed user
+func (db *memdb) updateFollowCounters(follow pair, delta int) {
+	if u, ok := db.users[follow.from]; ok {
+		u.Following += delta
+	}
+	if u, ok := db.users[follow.to]; ok {
+		u.Followers += delta
+	}
+}
+
+// IsBanned returns true if the user with the given userID is banned by the user with the given bannedID
+func (db *memdb) IsBanned(userID string, bannedID string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, banned := db.bans[pair{from: userID, to: bannedID}]
+	return banned, nil
+}
+
+// GetUserBanList returns all the users banned by the user with the given userID
+func (db *memdb) GetUserBanList(userID string) ([]structs.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.pairedUsers(db.bans, func(p pair) string {
+		if p.from == userID {
+			return p.to
+		}
+		return ""
+	}), nil
+}
+
+// BanUser bans the user with the given bannedID from the user with the given userID
+func (db *memdb) BanUser(userID string, bannedID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := pair{from: userID, to: bannedID}
+	if _, ok := db.bans[key]; !ok {
+		db.bans[key] = db.next()
+	}
+	return nil
+}
+
+// UnbanUser unbans the user with the given bannedID from the user with the given userID
+func (db *memdb) UnbanUser(userID string, bannedID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.bans, pair{from: userID, to: bannedID})
+	return nil
+}
@@ -0,0 +1,86 @@
+package memdb
+
+import (
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the idempotency keys
+	i.e. the functions of idempotencyDB.go of package database
+*/
+
+// idempotencyKey is the key of the IdempotencyKey table
+type idempotencyKey struct {
+	scope string
+	key   string
+}
+
+// idempotencyEntry is a row of the IdempotencyKey table
+type idempotencyEntry struct {
+	structs.IdempotentResponse
+	creationDate time.Time
+}
+
+// ReserveIdempotencyKey records the key for a new request with the given fingerprint. Keys created before
+// expiredBefore are replaced. It returns true if the key has been reserved, otherwise the request already recorded
+// for the key, with its response if it has been saved.
+func (db *memdb) ReserveIdempotencyKey(scope string, key string, fingerprint string, expiredBefore time.Time) (structs.IdempotentResponse, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	k := idempotencyKey{scope: scope, key: key}
+	entry, ok := db.idempotencyKeys[k]
+	if ok && entry.creationDate.Before(storedTime(expiredBefore)) {
+		ok = false
+	}
+	if !ok {
+		db.idempotencyKeys[k] = &idempotencyEntry{
+			IdempotentResponse: structs.IdempotentResponse{Fingerprint: fingerprint},
+			creationDate:       now(),
+		}
+		return structs.IdempotentResponse{}, true, nil
+	}
+	response := entry.IdempotentResponse
+	response.Body = append([]byte(nil), entry.Body...)
+	return response, false, nil
+}
+
+// SaveIdempotentResponse saves the response given to the request of the reserved key
+func (db *memdb) SaveIdempotentResponse(scope string, key string, response structs.IdempotentResponse) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	entry, ok := db.idempotencyKeys[idempotencyKey{scope: scope, key: key}]
+	if !ok {
+		return nil
+	}
+	entry.Status = response.Status
+	entry.ContentType = response.ContentType
+	entry.Body = append([]byte(nil), response.Body...)
+	return nil
+}
+
+// DeleteIdempotencyKey forgets the key, so that the request can be sent again with it
+func (db *memdb) DeleteIdempotencyKey(scope string, key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.idempotencyKeys, idempotencyKey{scope: scope, key: key})
+	return nil
+}
+
+// PurgeIdempotencyKeys removes the keys created before createdBefore
+func (db *memdb) PurgeIdempotencyKeys(createdBefore time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	before := storedTime(createdBefore)
+	for k, entry := range db.idempotencyKeys {
+		if entry.creationDate.Before(before) {
+			delete(db.idempotencyKeys, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the jobs started on behalf of the users
+	i.e. the functions of jobDB.go of package database
+*/
+
+// job is a row of the Job table
+type job struct {
+	structs.Job
+	seq int
+}
+
+// sortedJobs returns the jobs matching filter, sorted by the given date of the job in insertion order for the same
+// date. The date is compared in reverse if newestFirst.
+func (db *memdb) sortedJobs(filter func(j *job) bool, date func(j *job) time.Time, newestFirst bool) []structs.Job {
+	var list []*job
+	for _, j := range db.jobs {
+		if filter(j) {
+			list = append(list, j)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !date(list[i]).Equal(date(list[j])) {
+			return date(list[i]).Before(date(list[j])) != newestFirst
+		}
+		return list[i].seq < list[j].seq
+	})
+	var jobs []structs.Job
+	for _, j := range list {
+		jobs = append(jobs, j.Job)
+	}
+	return jobs
+}
+
+// CreateJob creates a new pending job of the given kind for the user with the given userID, due at scheduledDate
+func (db *memdb) CreateJob(kind string, userID string, scheduledDate time.Time) (structs.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	jobID, err := newID()
+	if err != nil {
+		return structs.Job{}, err
+	}
+	userJob := structs.Job{
+		JobID:         jobID,
+		Kind:          kind,
+		UserID:        userID,
+		Status:        database.JobPending,
+		CreationDate:  now(),
+		ScheduledDate: storedTime(scheduledDate),
+	}
+	userJob.UpdateDate = userJob.CreationDate
+	db.jobs[jobID] = &job{Job: userJob, seq: db.next()}
+	return userJob, nil
+}
+
+// GetJob returns the job with the given jobID
+func (db *memdb) GetJob(jobID string) (structs.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	j, ok := db.jobs[jobID]
+	if !ok {
+		return structs.Job{}, fmt.Errorf("job not found: %w", database.ErrNotFound)
+	}
+	return j.Job, nil
+}
+
+// UpdateJob sets the status and the progress of the job with the given jobID. A cancelled job stays cancelled: it
+// returns ErrConflict instead.
+func (db *memdb) UpdateJob(jobID string, status string, progress int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	j, ok := db.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("job not found: %w", database.ErrNotFound)
+	}
+	if j.Status == database.JobCancelled {
+		return fmt.Errorf("job cancelled: %w", database.ErrConflict)
+	}
+	j.Status = status
+	j.Progress = progress
+	j.UpdateDate = now()
+	return nil
+}
+
+// GetUserJobs returns all the jobs of the user with the given userID, newest first
+func (db *memdb) GetUserJobs(userID string) ([]structs.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.sortedJobs(
+		func(j *job) bool { return j.UserID == userID },
+		func(j *job) time.Time { return j.CreationDate },
+		true), nil
+}
+
+// CancelJobs cancels the pending and running jobs of the given kind of the user with the given userID
+func (db *memdb) CancelJobs(kind string, userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, j := range db.jobs {
+		if j.Kind == kind && j.UserID == userID && (j.Status == database.JobPending || j.Status == database.JobRunning) {
+			j.Status = database.JobCancelled
+			j.UpdateDate = now()
+		}
+	}
+	return nil
+}
+
+// GetDueJobs returns the jobs of the given kind scheduled before due that are pending or were interrupted while
+// running, oldest first
+func (db *memdb) GetDueJobs(kind string, due time.Time) ([]structs.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	dueDate := storedTime(due)
+	return db.sortedJobs(
+		func(j *job) bool {
+			return j.Kind == kind && (j.Status == database.JobPending || j.Status == database.JobRunning) && !j.ScheduledDate.After(dueDate)
+		},
+		func(j *job) time.Time { return j.ScheduledDate },
+		false), nil
+}
@@ -0,0 +1,164 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the likes of the posts and of the comments
+	i.e. the functions of likeDB.go of package database
+*/
+
+// likeKey is the key of the PostLike and CommentLike tables
+type likeKey struct {
+	resource string // The post or the comment
+	userID   string
+}
+
+// like is a row of the PostLike or CommentLike table
+type like struct {
+	structs.Like
+	seq int
+}
+
+// sortedLikes returns the likes matching filter, in insertion order
+func sortedLikes(likes map[likeKey]*like, filter func(l *like) bool) []structs.Like {
+	var list []*like
+	for _, l := range likes {
+		if filter(l) {
+			list = append(list, l)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].seq < list[j].seq })
+	var sorted []structs.Like
+	for _, l := range list {
+		sorted = append(sorted, l.Like)
+	}
+	return sorted
+}
+
+// resourceLikes returns the likes of the resource by active users
+func (db *memdb) resourceLikes(likes map[likeKey]*like, resource string) []structs.Like {
+	return sortedLikes(likes, func(l *like) bool { return l.Resource == resource && db.activeUser(l.UserID) != nil })
+}
+
+// addLike adds the like of the active user likerID to the resource, and returns true if it is a new one
+func (db *memdb) addLike(likes map[likeKey]*like, resource string, likerID string) (bool, error) {
+	u := db.activeUser(likerID)
+	if u == nil {
+		return false, fmt.Errorf("user does not exist: %w", database.ErrNotFound)
+	}
+	key := likeKey{resource: resource, userID: likerID}
+	if _, ok := likes[key]; ok {
+		return false, nil
+	}
+	likes[key] = &like{Like: structs.Like{Resource: resource, UserID: likerID, Username: u.Username}, seq: db.next()}
+	return true, nil
+}
+
+// removeLike removes the like of likerID from the resource, and returns true if it existed
+func removeLike(likes map[likeKey]*like, resource string, likerID string) bool {
+	key := likeKey{resource: resource, userID: likerID}
+	if _, ok := likes[key]; !ok {
+		return false
+	}
+	delete(likes, key)
+	return true
+}
+
+// GetPostLikes returns all the likes of the post with the given postID
+func (db *memdb) GetPostLikes(postID string) ([]structs.Like, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.resourceLikes(db.postLikes, postID), nil
+}
+
+// LikePost creates a new like in the database
+func (db *memdb) LikePost(postID string, likerID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p := db.livePost(postID)
+	if p == nil {
+		return fmt.Errorf("post does not exist: %w", database.ErrNotFound)
+	}
+	added, err := db.addLike(db.postLikes, postID, likerID)
+	if err != nil {
+		return err
+	}
+	if added {
+		p.LikeCount++
+	}
+	return nil
+}
+
+// UnlikePost removes a like from the database
+func (db *memdb) UnlikePost(postID string, likerID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p := db.livePost(postID)
+	if p == nil {
+		return fmt.Errorf("post does not exist: %w", database.ErrNotFound)
+	}
+	if removeLike(db.postLikes, postID, likerID) {
+		p.LikeCount--
+	}
+	return nil
+}
+
+// GetCommentLikes returns all the likes of the comment with the given commentID
+func (db *memdb) GetCommentLikes(commentID string) ([]structs.Like, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.resourceLikes(db.commentLikes, commentID), nil
+}
+
+// LikeComment creates a new like in the database
+func (db *memdb) LikeComment(commentID string, likerID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.liveComment(commentID)
+	if c == nil {
+		return fmt.Errorf("comment does not exist: %w", database.ErrNotFound)
+	}
+	added, err := db.addLike(db.commentLikes, commentID, likerID)
+	if err != nil {
+		return err
+	}
+	if added {
+		c.LikeCount++
+	}
+	return nil
+}
+
+// UnlikeComment removes a like from the database
+func (db *memdb) UnlikeComment(commentID string, likerID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := db.liveComment(commentID)
+	if c == nil {
+		return fmt.Errorf("comment does not exist: %w", database.ErrNotFound)
+	}
+	if removeLike(db.commentLikes, commentID, likerID) {
+		c.LikeCount--
+	}
+	return nil
+}
+
+// GetUserLikes returns all the likes put by the user with the given userID, both on posts and on comments
+func (db *memdb) GetUserLikes(userID string) ([]structs.Like, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	byUser := func(l *like) bool { return l.UserID == userID }
+	return append(sortedLikes(db.postLikes, byUser), sortedLikes(db.commentLikes, byUser)...), nil
+}
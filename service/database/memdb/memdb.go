@@ -0,0 +1,169 @@
+/*
+Package memdb is an implementation of database.AppDatabase keeping everything in memory, photos included. It is meant
+for the tests and the demos: nothing is persisted, and it needs neither cgo nor a database server.
+
+	db := memdb.New()
+
+It has the same semantics as the SQL implementation of package database: the same errors, counters, visibility of
+the deleted, held and banned content, and ordering of the lists, as checked by the conformance suite of package
+databasetest. Where the queries of package database don't define an order, the rows are returned in insertion order,
+as SQLite does.
+
+Every method holds a single lock for its whole duration, so the changes are atomic like the transactions of the SQL
+implementation, and the database is safe for concurrent use. RunInTransaction holds the lock for all the methods it
+calls, and restores a copy of the tables if they fail.
+*/
+package memdb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/gofrs/uuid"
+)
+
+// memdb is the in-memory database. Its tables are shared with the databases of the transactions, which don't lock.
+type memdb struct {
+	mu sync.Locker
+	*tables
+}
+
+// tables are the tables of the SQL implementation, with the same columns
+type tables struct {
+	seq int // Number of rows inserted so far, see next
+
+	// Rows are kept in maps, with their insertion order (seq) to sort the lists the same way as SQLite
+	users           map[string]*user
+	usernameHistory map[string]*usernameChange // By old username
+	identities      map[identity]string        // IDs of the linked users
+	sessions        map[string]string          // IDs of the users, by token hash
+	posts           map[string]*post
+	comments        map[string]*comment
+	revisions       map[string]*revision
+	postLikes       map[likeKey]*like
+	commentLikes    map[likeKey]*like
+	follows         map[pair]int // Insertion order of the follows, by follower and following
+	bans            map[pair]int // Insertion order of the bans, by user and banned user
+	photos          map[string]*photo
+	files           map[string][]byte // Content of the photos, the files of the SQL implementation
+	jobs            map[string]*job
+	reports         map[string]*report
+	warnings        map[string]*warning
+	auditLog        map[string]*structs.AuditEntry
+	idempotencyKeys map[idempotencyKey]*idempotencyEntry
+}
+
+// New returns a new empty in-memory AppDatabase
+func New() database.AppDatabase {
+	return &memdb{mu: &sync.Mutex{}, tables: &tables{
+		users:           make(map[string]*user),
+		usernameHistory: make(map[string]*usernameChange),
+		identities:      make(map[identity]string),
+		sessions:        make(map[string]string),
+		posts:           make(map[string]*post),
+		comments:        make(map[string]*comment),
+		revisions:       make(map[string]*revision),
+		postLikes:       make(map[likeKey]*like),
+		commentLikes:    make(map[likeKey]*like),
+		follows:         make(map[pair]int),
+		bans:            make(map[pair]int),
+		photos:          make(map[string]*photo),
+		files:           make(map[string][]byte),
+		jobs:            make(map[string]*job),
+		reports:         make(map[string]*report),
+		warnings:        make(map[string]*warning),
+		auditLog:        make(map[string]*structs.AuditEntry),
+		idempotencyKeys: make(map[idempotencyKey]*idempotencyEntry),
+	}}
+}
+
+func (db *memdb) Ping() error {
+	return nil
+}
+
+// next returns the insertion order of a new row
+func (db *memdb) next() int {
+	db.seq++
+	return db.seq
+}
+
+// newID returns the ID of a new row, a UUID v4 like the ones of the SQL implementation
+func newID() (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("error generating UUID: %w", err)
+	}
+	return id.String(), nil
+}
+
+// now returns the current time as the SQL implementation stores it
+func now() time.Time {
+	return storedTime(globaltime.Now())
+}
+
+// storedTime returns t as the SQL implementation reads it back once stored: in UTC, with milliseconds
+func storedTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+// creationDate returns the creation date of a new post or comment as the SQL implementation stores it, the current
+// time if it is not set
+func creationDate(t time.Time) time.Time {
+	if t.IsZero() {
+		return now()
+	}
+	return storedTime(t)
+}
+
+// optionalTime returns the date of a column that may be NULL (the zero time) as read by the SQL implementation
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// page returns the bounds of the page of n rows starting at offset, as LIMIT and OFFSET: a negative limit means no
+// limit, a negative offset starts from the first row
+func page(n int, offset int, limit int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit >= 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// likeMatch reports whether s matches pattern as the LIKE operator of SQL: % matches any sequence of characters, _ any
+// single character, and letters match ignoring the case
+func likeMatch(s string, pattern string) bool {
+	runes := []rune(s)
+	// matches[i] reports whether the pattern so far matches the first i runes of s
+	matches := make([]bool, len(runes)+1)
+	matches[0] = true
+	for _, p := range pattern {
+		next := make([]bool, len(runes)+1)
+		if p == '%' {
+			next[0] = matches[0]
+			for i := 1; i <= len(runes); i++ {
+				next[i] = matches[i] || next[i-1]
+			}
+		} else {
+			for i := 1; i <= len(runes); i++ {
+				next[i] = matches[i-1] && (p == '_' || unicode.ToLower(p) == unicode.ToLower(runes[i-1]))
+			}
+		}
+		matches = next
+	}
+	return matches[len(runes)]
+}
@@ -0,0 +1,15 @@
+package memdb_test
+
+import (
+	"testing"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/database/databasetest"
+	"github.com/attiliov/WASA-Photo/service/database/memdb"
+)
+
+func TestConformance(t *testing.T) {
+	databasetest.Run(t, func(t *testing.T) database.AppDatabase {
+		return memdb.New()
+	})
+}
@@ -0,0 +1,103 @@
+package memdb
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"sort"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+)
+
+/*
+	This file contains the photos, kept in memory instead of files
+	i.e. the functions of photoDB.go of package database
+*/
+
+// photo is a row of the Photo table
+type photo struct {
+	ownerID string
+}
+
+// GetUserPhotos returns the IDs of the photos of the user with the given userID: the ones they uploaded, the images of
+// their posts and their profile image. Unless includeDeleted is true, the images of the deleted posts are left out.
+func (db *memdb) GetUserPhotos(userID string, includeDeleted bool) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	deletedImages := make(map[string]bool)
+	if !includeDeleted {
+		for _, p := range db.posts {
+			if !p.deletedAt.IsZero() {
+				deletedImages[p.Image] = true
+			}
+		}
+	}
+
+	// The SQL implementation returns the union of the three, sorted and without duplicates
+	found := make(map[string]bool)
+	for photoID, p := range db.photos {
+		if p.ownerID == userID && !deletedImages[photoID] {
+			found[photoID] = true
+		}
+	}
+	for _, p := range db.posts {
+		if p.AuthorID == userID && p.Image != "" && (includeDeleted || p.deletedAt.IsZero()) {
+			found[p.Image] = true
+		}
+	}
+	if u, ok := db.users[userID]; ok && u.ProfileImage != "" {
+		found[u.ProfileImage] = true
+	}
+	var photos []string
+	for photoID := range found {
+		photos = append(photos, photoID)
+	}
+	sort.Strings(photos)
+	return photos, nil
+}
+
+// SavePhoto saves a photo in the database
+func (db *memdb) SavePhoto(userID string, file multipart.File) (string, error) {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("error copying photo: %w", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	photoID, err := newID()
+	if err != nil {
+		return "", err
+	}
+	db.files[photoID] = content
+	db.photos[photoID] = &photo{ownerID: userID}
+	return photoID, nil
+}
+
+// GetPhoto returns the photo with the given photoID
+func (db *memdb) GetPhoto(userID string, photoID string) ([]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	content, ok := db.files[photoID]
+	if !ok {
+		return nil, fmt.Errorf("photo not found: %w", database.ErrNotFound)
+	}
+	// The caller may modify the photo, like the content of a file read from disk
+	return append([]byte(nil), content...), nil
+}
+
+// DeletePhoto deletes the photo with the given photoID
+func (db *memdb) DeletePhoto(userID string, photoID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.files[photoID]; !ok {
+		return fmt.Errorf("photo not found: %w", database.ErrNotFound)
+	}
+	delete(db.files, photoID)
+	delete(db.photos, photoID)
+	return nil
+}
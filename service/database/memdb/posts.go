@@ -0,0 +1,237 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the posts, the feed and the revisions of the captions
+	i.e. the functions of postDB.go and revisionDB.go of package database
+*/
+
+// post is a row of the Post table
+type post struct {
+	structs.UserPost
+	deletedAt time.Time // Zero if not deleted
+	heldAt    time.Time // Zero if not held for review
+	removedBy string    // The moderator that removed the post, if any
+	seq       int
+}
+
+// revision is a row of the Revision table
+type revision struct {
+	structs.Revision
+	seq int
+}
+
+// livePost returns the post with the given postID, or nil if it doesn't exist or is deleted
+func (db *memdb) livePost(postID string) *post {
+	p, ok := db.posts[postID]
+	if !ok || !p.deletedAt.IsZero() {
+		return nil
+	}
+	return p
+}
+
+// newestPostIDs returns the IDs of the posts, newest first
+func newestPostIDs(list []*post) []structs.ResourceID {
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreationDate.Equal(list[j].CreationDate) {
+			return list[i].CreationDate.After(list[j].CreationDate)
+		}
+		return list[i].seq < list[j].seq
+	})
+	var posts []structs.ResourceID
+	for _, p := range list {
+		posts = append(posts, structs.ResourceID{ResourceID: p.PostID})
+	}
+	return posts
+}
+
+// GetUserPosts returns the posts of the user with the given userID
+func (db *memdb) GetUserPosts(userID string) ([]structs.ResourceID, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.activeUser(userID) == nil {
+		return nil, nil
+	}
+	var list []*post
+	for _, p := range db.posts {
+		if p.AuthorID == userID && p.deletedAt.IsZero() {
+			list = append(list, p)
+		}
+	}
+	return newestPostIDs(list), nil
+}
+
+// AddPost adds a new post to the database
+func (db *memdb) AddPost(userPost structs.UserPost) (structs.ResourceID, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	postID, err := newID()
+	if err != nil {
+		return structs.ResourceID{}, err
+	}
+	userPost.PostID = postID
+	userPost.CreationDate = creationDate(userPost.CreationDate)
+	userPost.LikeCount = 0
+	userPost.CommentCount = 0
+	userPost.EditedAt = nil
+	userPost.Version = 1
+	db.posts[postID] = &post{UserPost: userPost, seq: db.next()}
+	return structs.ResourceID{ResourceID: postID}, nil
+}
+
+// GetPost returns the post with the given postID
+func (db *memdb) GetPost(postID string) (structs.UserPost, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p := db.livePost(postID)
+	if p == nil || db.activeUser(p.AuthorID) == nil {
+		return structs.UserPost{}, fmt.Errorf("post not found: %w", database.ErrNotFound)
+	}
+	return p.UserPost, nil
+}
+
+// UpdatePost updates the caption and the image of the post with the given postID, if the post is still at the given
+// version, and returns the new version, see database.AppDatabase
+func (db *memdb) UpdatePost(postID string, update structs.UserPost, version int) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p := db.livePost(postID)
+	if p == nil {
+		return 0, fmt.Errorf("post not found: %w", database.ErrNotFound)
+	}
+	if p.Version != version {
+		return 0, database.ErrVersionMismatch
+	}
+
+	if p.Caption != update.Caption {
+		err := db.addRevision(postID, p.Caption)
+		if err != nil {
+			return 0, err
+		}
+		p.EditedAt = optionalTime(now())
+	}
+
+	p.Caption = update.Caption
+	p.Image = update.Image
+	p.Version++
+	return p.Version, nil
+}
+
+// DeletePost marks the post with the given postID as deleted.
+// The post is hidden from every read, and it is removed for good by PurgeDeleted once the grace period is over.
+func (db *memdb) DeletePost(postID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if p := db.livePost(postID); p != nil {
+		p.deletedAt = now()
+	}
+	return nil
+}
+
+// RestorePost restores the post with the given postID, if it belongs to authorID and was deleted after deletedSince
+func (db *memdb) RestorePost(postID string, authorID string, deletedSince time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.posts[postID]
+	if !ok || p.AuthorID != authorID || p.deletedAt.IsZero() || p.deletedAt.Before(storedTime(deletedSince)) || p.removedBy != "" || !p.heldAt.IsZero() {
+		return fmt.Errorf("no restorable post found: %w", database.ErrNotFound)
+	}
+	p.deletedAt = time.Time{}
+	return nil
+}
+
+// GetUserFeed returns the posts of the users followed by the user with the given userID, newest first
+func (db *memdb) GetUserFeed(userID string) ([]structs.ResourceID, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*post
+	for _, p := range db.posts {
+		if _, followed := db.follows[pair{from: userID, to: p.AuthorID}]; followed && p.deletedAt.IsZero() && db.activeUser(p.AuthorID) != nil {
+			list = append(list, p)
+		}
+	}
+	return newestPostIDs(list), nil
+}
+
+// GetPostRevisions returns the previous captions of the post with the given postID, newest first
+func (db *memdb) GetPostRevisions(postID string) ([]structs.Revision, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.livePost(postID) == nil {
+		return nil, fmt.Errorf("post not found: %w", database.ErrNotFound)
+	}
+	return db.getRevisions(postID), nil
+}
+
+// GetCommentRevisions returns the previous captions of the comment with the given commentID, newest first
+func (db *memdb) GetCommentRevisions(commentID string) ([]structs.Revision, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.liveComment(commentID) == nil {
+		return nil, fmt.Errorf("comment does not exist: %w", database.ErrNotFound)
+	}
+	return db.getRevisions(commentID), nil
+}
+
+// getRevisions returns the revisions of the resource with the given resourceID, newest first
+func (db *memdb) getRevisions(resourceID string) []structs.Revision {
+	var list []*revision
+	for _, r := range db.revisions {
+		if r.ResourceID == resourceID {
+			list = append(list, r)
+		}
+	}
+	// Newest first, by insertion order as two edits can have the same date
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].seq > list[j].seq
+	})
+	var revisions []structs.Revision
+	for _, r := range list {
+		revisions = append(revisions, r.Revision)
+	}
+	return revisions
+}
+
+// addRevision saves the caption that the resource with the given resourceID had before being edited
+func (db *memdb) addRevision(resourceID string, caption string) error {
+	revisionID, err := newID()
+	if err != nil {
+		return err
+	}
+	db.revisions[revisionID] = &revision{
+		Revision: structs.Revision{
+			RevisionID:   revisionID,
+			ResourceID:   resourceID,
+			Caption:      caption,
+			RevisionDate: now(),
+		},
+		seq: db.next(),
+	}
+	return nil
+}
+
+// deleteRevisions deletes the revisions of the resources for which deleted returns true
+func (db *memdb) deleteRevisions(deleted func(resourceID string) bool) {
+	for revisionID, r := range db.revisions {
+		if deleted(r.ResourceID) {
+			delete(db.revisions, revisionID)
+		}
+	}
+}
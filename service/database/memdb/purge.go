@@ -0,0 +1,61 @@
+package memdb
+
+import (
+	"time"
+)
+
+/*
+	This file contains the removal for good of the soft-deleted rows
+	i.e. the functions of purgeDB.go of package database
+*/
+
+// PurgeDeleted removes the posts and comments deleted before deletedBefore, together with everything that depends on
+// them (likes, edit history, comments of purged posts) and the photos of purged posts.
+// Content held for review is not purged, it waits for a moderator.
+func (db *memdb) PurgeDeleted(deletedBefore time.Time) error {
+	before := storedTime(deletedBefore)
+	photos := db.purge(
+		func(p *post) bool { return !p.deletedAt.IsZero() && p.deletedAt.Before(before) && p.heldAt.IsZero() },
+		func(c *comment) bool { return !c.deletedAt.IsZero() && c.deletedAt.Before(before) && c.heldAt.IsZero() })
+
+	// A missing photo means it was already removed
+	for _, photoID := range photos {
+		_ = db.DeletePhoto("", photoID)
+	}
+	return nil
+}
+
+// PurgePost removes for good the deleted post with the given postID, without waiting for the end of the grace period.
+// It returns the IDs of the photos of the post, whose files are left to the caller: they are removed with DeletePhoto
+// once the transaction, if any, is committed.
+func (db *memdb) PurgePost(postID string) ([]string, error) {
+	return db.purge(
+		func(p *post) bool { return p.PostID == postID && !p.deletedAt.IsZero() },
+		func(c *comment) bool { return false }), nil
+}
+
+// PurgeComment removes for good the deleted comment with the given commentID, without waiting for the end of the
+// grace period
+func (db *memdb) PurgeComment(commentID string) error {
+	db.purge(
+		func(p *post) bool { return false },
+		func(c *comment) bool { return c.CommentID == commentID && !c.deletedAt.IsZero() })
+	return nil
+}
+
+// purge removes the posts matching postCondition and the comments matching commentCondition, together with everything
+// that depends on them. It returns the IDs of the photos of the purged posts, whose files are still to be removed.
+func (db *memdb) purge(postCondition func(p *post) bool, commentCondition func(c *comment) bool) []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var photos []string
+	db.deleteComments(commentCondition, false)
+	for _, p := range db.deletePosts(postCondition) {
+		if p.Image != "" {
+			delete(db.photos, p.Image)
+			photos = append(photos, p.Image)
+		}
+	}
+	return photos
+}
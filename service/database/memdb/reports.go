@@ -0,0 +1,229 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the reports, the warnings and the audit log of the moderation
+	i.e. the functions of reportDB.go and auditDB.go of package database
+*/
+
+// report is a row of the Report table
+type report struct {
+	structs.Report
+	seq int
+}
+
+// warning is a row of the Warning table
+type warning struct {
+	structs.Warning
+	userID string
+	seq    int
+}
+
+// CreateReport creates a new open report with the reporter, target and reason of the given report
+func (db *memdb) CreateReport(userReport structs.Report) (structs.Report, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	reportID, err := newID()
+	if err != nil {
+		return userReport, err
+	}
+	userReport.ReportID = reportID
+	userReport.Status = database.ReportOpen
+	userReport.ModeratorID = ""
+	userReport.Action = ""
+	userReport.Note = ""
+	userReport.CreationDate = now()
+	userReport.UpdateDate = userReport.CreationDate
+	db.reports[reportID] = &report{Report: userReport, seq: db.next()}
+	return userReport, nil
+}
+
+// GetReport returns the report with the given reportID
+func (db *memdb) GetReport(reportID string) (structs.Report, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	r, ok := db.reports[reportID]
+	if !ok {
+		return structs.Report{}, fmt.Errorf("report not found: %w", database.ErrNotFound)
+	}
+	return r.Report, nil
+}
+
+// GetReports returns the reports with the given status (every report if empty), oldest first
+func (db *memdb) GetReports(status string, offset int, limit int) ([]structs.Report, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*report
+	for _, r := range db.reports {
+		if status == "" || r.Status == status {
+			list = append(list, r)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreationDate.Equal(list[j].CreationDate) {
+			return list[i].CreationDate.Before(list[j].CreationDate)
+		}
+		return list[i].ReportID < list[j].ReportID
+	})
+	start, end := page(len(list), offset, limit)
+	var reports []structs.Report
+	for _, r := range list[start:end] {
+		reports = append(reports, r.Report)
+	}
+	return reports, nil
+}
+
+// HasOpenReport returns true if the user reporterID already reported targetID and the report is not closed yet
+func (db *memdb) HasOpenReport(reporterID string, targetID string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, r := range db.reports {
+		if r.ReporterID == reporterID && r.TargetID == targetID && (r.Status == database.ReportOpen || r.Status == database.ReportClaimed) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ClaimReport assigns the open report with the given reportID to the moderator moderatorID. It fails if the report
+// is closed or claimed by another moderator.
+func (db *memdb) ClaimReport(reportID string, moderatorID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	r, err := db.openReport(reportID, moderatorID)
+	if err != nil {
+		return err
+	}
+	r.Status = database.ReportClaimed
+	r.ModeratorID = moderatorID
+	r.UpdateDate = now()
+	return nil
+}
+
+// CloseReport closes the report with the given reportID with the given status (resolved or dismissed), recording
+// the action taken. It fails if the report is closed or claimed by another moderator.
+func (db *memdb) CloseReport(reportID string, moderatorID string, status string, action string, note string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	r, err := db.openReport(reportID, moderatorID)
+	if err != nil {
+		return err
+	}
+	r.Status = status
+	r.ModeratorID = moderatorID
+	r.Action = action
+	r.Note = note
+	r.UpdateDate = now()
+	return nil
+}
+
+// openReport returns the report with the given reportID if it is open or claimed by the moderator moderatorID
+func (db *memdb) openReport(reportID string, moderatorID string) (*report, error) {
+	r, ok := db.reports[reportID]
+	if !ok || !(r.Status == database.ReportOpen || (r.Status == database.ReportClaimed && r.ModeratorID == moderatorID)) {
+		return nil, fmt.Errorf("report not found, closed or claimed by another moderator: %w", database.ErrConflict)
+	}
+	return r, nil
+}
+
+// AddWarning records a warning given to the user with the given userID after the report reportID
+func (db *memdb) AddWarning(userID string, reportID string, note string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	warningID, err := newID()
+	if err != nil {
+		return err
+	}
+	db.warnings[warningID] = &warning{
+		Warning: structs.Warning{
+			WarningID:    warningID,
+			ReportID:     reportID,
+			Note:         note,
+			CreationDate: now(),
+		},
+		userID: userID,
+		seq:    db.next(),
+	}
+	return nil
+}
+
+// GetUserWarnings returns the warnings given to the user with the given userID, newest first
+func (db *memdb) GetUserWarnings(userID string) ([]structs.Warning, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*warning
+	for _, w := range db.warnings {
+		if w.userID == userID {
+			list = append(list, w)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreationDate.Equal(list[j].CreationDate) {
+			return list[i].CreationDate.After(list[j].CreationDate)
+		}
+		return list[i].seq < list[j].seq
+	})
+	var warnings []structs.Warning
+	for _, w := range list {
+		warnings = append(warnings, w.Warning)
+	}
+	return warnings, nil
+}
+
+// AddAuditEntry records that the moderator or administrator actorID did action on targetID
+func (db *memdb) AddAuditEntry(actorID string, action string, targetID string, details string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	entryID, err := newID()
+	if err != nil {
+		return err
+	}
+	db.auditLog[entryID] = &structs.AuditEntry{
+		EntryID:      entryID,
+		ActorID:      actorID,
+		Action:       action,
+		TargetID:     targetID,
+		Details:      details,
+		CreationDate: now(),
+	}
+	return nil
+}
+
+// GetAuditLog returns the entries of the audit log, newest first
+func (db *memdb) GetAuditLog(offset int, limit int) ([]structs.AuditEntry, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*structs.AuditEntry
+	for _, entry := range db.auditLog {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreationDate.Equal(list[j].CreationDate) {
+			return list[i].CreationDate.After(list[j].CreationDate)
+		}
+		return list[i].EntryID < list[j].EntryID
+	})
+	start, end := page(len(list), offset, limit)
+	var entries []structs.AuditEntry
+	for _, entry := range list[start:end] {
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,128 @@
+package memdb
+
+import (
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+/*
+	This file contains the transactions
+	i.e. the function RunInTransaction of package database
+*/
+
+// noLock is the lock of the database of a transaction: the transaction already holds the lock of the database
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
+
+// RunInTransaction calls action with a database whose changes are all kept if action returns nil and are all undone
+// otherwise. The other calls wait for the end of the transaction.
+func (db *memdb) RunInTransaction(action func(tx database.AppDatabase) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := db.tables.copy()
+	err := action(&memdb{mu: noLock{}, tables: db.tables})
+	if err != nil {
+		*db.tables = *saved
+	}
+	return err
+}
+
+// copy returns a copy of the tables, with copies of the rows. The rows are never changed through the pointers and
+// slices they contain, so copying their fields is enough.
+func (t *tables) copy() *tables {
+	c := *t
+	c.users = make(map[string]*user, len(t.users))
+	for k, v := range t.users {
+		row := *v
+		c.users[k] = &row
+	}
+	c.usernameHistory = make(map[string]*usernameChange, len(t.usernameHistory))
+	for k, v := range t.usernameHistory {
+		row := *v
+		c.usernameHistory[k] = &row
+	}
+	c.identities = make(map[identity]string, len(t.identities))
+	for k, v := range t.identities {
+		c.identities[k] = v
+	}
+	c.sessions = make(map[string]string, len(t.sessions))
+	for k, v := range t.sessions {
+		c.sessions[k] = v
+	}
+	c.posts = make(map[string]*post, len(t.posts))
+	for k, v := range t.posts {
+		row := *v
+		c.posts[k] = &row
+	}
+	c.comments = make(map[string]*comment, len(t.comments))
+	for k, v := range t.comments {
+		row := *v
+		c.comments[k] = &row
+	}
+	c.revisions = make(map[string]*revision, len(t.revisions))
+	for k, v := range t.revisions {
+		row := *v
+		c.revisions[k] = &row
+	}
+	c.postLikes = copyLikes(t.postLikes)
+	c.commentLikes = copyLikes(t.commentLikes)
+	c.follows = copyPairs(t.follows)
+	c.bans = copyPairs(t.bans)
+	c.photos = make(map[string]*photo, len(t.photos))
+	for k, v := range t.photos {
+		row := *v
+		c.photos[k] = &row
+	}
+	c.files = make(map[string][]byte, len(t.files))
+	for k, v := range t.files {
+		c.files[k] = v
+	}
+	c.jobs = make(map[string]*job, len(t.jobs))
+	for k, v := range t.jobs {
+		row := *v
+		c.jobs[k] = &row
+	}
+	c.reports = make(map[string]*report, len(t.reports))
+	for k, v := range t.reports {
+		row := *v
+		c.reports[k] = &row
+	}
+	c.warnings = make(map[string]*warning, len(t.warnings))
+	for k, v := range t.warnings {
+		row := *v
+		c.warnings[k] = &row
+	}
+	c.auditLog = make(map[string]*structs.AuditEntry, len(t.auditLog))
+	for k, v := range t.auditLog {
+		row := *v
+		c.auditLog[k] = &row
+	}
+	c.idempotencyKeys = make(map[idempotencyKey]*idempotencyEntry, len(t.idempotencyKeys))
+	for k, v := range t.idempotencyKeys {
+		row := *v
+		c.idempotencyKeys[k] = &row
+	}
+	return &c
+}
+
+// copyLikes returns a copy of a table of likes
+func copyLikes(likes map[likeKey]*like) map[likeKey]*like {
+	c := make(map[likeKey]*like, len(likes))
+	for k, v := range likes {
+		row := *v
+		c[k] = &row
+	}
+	return c
+}
+
+// copyPairs returns a copy of the follows or the bans
+func copyPairs(pairs map[pair]int) map[pair]int {
+	c := make(map[pair]int, len(pairs))
+	for k, v := range pairs {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,418 @@
+package memdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/database"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/attiliov/WASA-Photo/service/usernames"
+)
+
+/*
+	This file contains the users, their usernames, credentials and linked identities
+	i.e. the functions of userDB.go, credentialDB.go and identityDB.go of package database
+*/
+
+// user is a row of the User table
+type user struct {
+	structs.User
+	normalized   string // See usernames.Normalize
+	skeleton     string // See usernames.Skeleton
+	email        string
+	passwordHash string
+	role         string
+	suspendedAt  time.Time // Zero if not suspended
+	deletedAt    time.Time // Zero if not deleted
+	seq          int
+}
+
+// usernameChange is a row of the UsernameHistory table
+type usernameChange struct {
+	structs.UsernameChange
+	userID string
+	seq    int
+}
+
+// identity is the key of the Identity table: an account of an identity provider
+type identity struct {
+	issuer  string
+	subject string
+}
+
+// profile returns the user as read by the queries not returning its version
+func (u *user) profile() structs.User {
+	profile := u.User
+	profile.Version = 0
+	return profile
+}
+
+// activeUser returns the user with the given userID, or nil if it doesn't exist or is deleted
+func (db *memdb) activeUser(userID string) *user {
+	u, ok := db.users[userID]
+	if !ok || !u.deletedAt.IsZero() {
+		return nil
+	}
+	return u
+}
+
+// sortedUsers returns the users matching filter, in insertion order
+func (db *memdb) sortedUsers(filter func(u *user) bool) []*user {
+	var list []*user
+	for _, u := range db.users {
+		if filter(u) {
+			list = append(list, u)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].seq < list[j].seq })
+	return list
+}
+
+// GetUser returns the user with the given username or id. Usernames are compared ignoring the case, an exact match
+// is preferred.
+func (db *memdb) GetUser(param string) (structs.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	normalized := usernames.Normalize(param)
+	var found *user
+	for _, u := range db.sortedUsers(func(u *user) bool { return u.deletedAt.IsZero() }) {
+		if u.Username == param {
+			return u.User, nil
+		}
+		if found == nil && (u.normalized == normalized || u.UserID == param) {
+			found = u
+		}
+	}
+	if found == nil {
+		return structs.User{}, fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	return found.User, nil
+}
+
+func (db *memdb) CreateUser(username string) (structs.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.usernameTaken(username, "") {
+		return structs.User{}, fmt.Errorf("username %q already used: %w", username, database.ErrConflict)
+	}
+	userID, err := newID()
+	if err != nil {
+		return structs.User{}, err
+	}
+	signupDate := now()
+	u := &user{
+		User: structs.User{
+			UserID:       userID,
+			Username:     username,
+			SignUpDate:   signupDate,
+			LastSeenDate: signupDate,
+			Version:      1,
+		},
+		normalized: usernames.Normalize(username),
+		skeleton:   usernames.Skeleton(username),
+		role:       database.RoleUser,
+		seq:        db.next(),
+	}
+	db.users[userID] = u
+	return u.profile(), nil
+}
+
+// usernameTaken returns true if a user other than userID, deleted or not, has the username or the same normalized
+// username, like the unique indexes of the SQL implementation
+func (db *memdb) usernameTaken(username string, userID string) bool {
+	normalized := usernames.Normalize(username)
+	for _, u := range db.users {
+		if u.UserID != userID && (u.Username == username || u.normalized == normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchUsername returns a list of users whose username is similar to the given one
+func (db *memdb) SearchUsername(username string) ([]structs.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var users []structs.User
+	for _, u := range db.sortedUsers(func(u *user) bool { return u.deletedAt.IsZero() && likeMatch(u.Username, "%"+username+"%") }) {
+		users = append(users, u.profile())
+	}
+	return users, nil
+}
+
+// UpdateUser updates the username, the bio and the profile image of the user with the given userID, if the user is
+// still at the given version, and returns the new version, see database.AppDatabase
+func (db *memdb) UpdateUser(userID string, update structs.User, version int) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u := db.activeUser(userID)
+	if u == nil {
+		return 0, fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	if u.Version != version {
+		return 0, database.ErrVersionMismatch
+	}
+
+	if u.Username != update.Username {
+		if db.usernameTaken(update.Username, userID) {
+			return 0, fmt.Errorf("username %q already used: %w", update.Username, database.ErrConflict)
+		}
+		db.changeUsername(u, update.Username)
+	}
+
+	u.Username = update.Username
+	u.Bio = update.Bio
+	u.ProfileImage = update.ProfileImage
+	u.Version++
+	return u.Version, nil
+}
+
+// changeUsername records the change of username of the user u and propagates the new username
+func (db *memdb) changeUsername(u *user, username string) {
+	// The old username keeps pointing to the user, the new one is not an old username anymore
+	db.usernameHistory[u.Username] = &usernameChange{
+		UsernameChange: structs.UsernameChange{Username: u.Username, ChangeDate: now()},
+		userID:         u.UserID,
+		seq:            db.next(),
+	}
+	for old, change := range db.usernameHistory {
+		if strings.EqualFold(old, username) && change.userID == u.UserID {
+			delete(db.usernameHistory, old)
+		}
+	}
+
+	u.normalized = usernames.Normalize(username)
+	u.skeleton = usernames.Skeleton(username)
+
+	// Propagate the new username
+	for _, p := range db.posts {
+		if p.AuthorID == u.UserID {
+			p.AuthorUsername = username
+		}
+	}
+	for _, c := range db.comments {
+		if c.AuthorID == u.UserID {
+			c.AuthorUsername = username
+		}
+	}
+	for _, likes := range []map[likeKey]*like{db.postLikes, db.commentLikes} {
+		for _, l := range likes {
+			if l.UserID == u.UserID {
+				l.Username = username
+			}
+		}
+	}
+}
+
+// DeleteUser marks the user with the given userID as deleted.
+// The user and their content are hidden from every read until they are restored or erased.
+func (db *memdb) DeleteUser(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u := db.activeUser(userID)
+	if u == nil {
+		return fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	u.deletedAt = now()
+	return nil
+}
+
+// RestoreUser restores the user with the given userID, if it was deleted after deletedSince
+func (db *memdb) RestoreUser(userID string, deletedSince time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.users[userID]
+	if !ok || u.deletedAt.IsZero() || u.deletedAt.Before(storedTime(deletedSince)) {
+		return fmt.Errorf("no restorable user found: %w", database.ErrNotFound)
+	}
+	u.deletedAt = time.Time{}
+	return nil
+}
+
+// IsActiveUser returns true if the user with the given userID exists and is not deleted
+func (db *memdb) IsActiveUser(userID string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.activeUser(userID) != nil, nil
+}
+
+// GetUsernameHistory returns the usernames previously used by the user with the given userID, newest first
+func (db *memdb) GetUsernameHistory(userID string) ([]structs.UsernameChange, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*usernameChange
+	for _, change := range db.usernameHistory {
+		if change.userID == userID {
+			list = append(list, change)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].ChangeDate.Equal(list[j].ChangeDate) {
+			return list[i].ChangeDate.After(list[j].ChangeDate)
+		}
+		return list[i].seq < list[j].seq
+	})
+	var changes []structs.UsernameChange
+	for _, change := range list {
+		changes = append(changes, change.UsernameChange)
+	}
+	return changes, nil
+}
+
+// ResolveUsername returns the ID of the active user that used the given username in the past
+func (db *memdb) ResolveUsername(username string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var found *usernameChange
+	for old, change := range db.usernameHistory {
+		if strings.EqualFold(old, username) && db.activeUser(change.userID) != nil && (found == nil || change.seq < found.seq) {
+			found = change
+		}
+	}
+	if found == nil {
+		return "", fmt.Errorf("username not found in history: %w", database.ErrNotFound)
+	}
+	return found.userID, nil
+}
+
+// GetLookalikeUsers returns the active users whose username looks like the given one (see usernames.Skeleton)
+func (db *memdb) GetLookalikeUsers(username string) ([]structs.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	skeleton := usernames.Skeleton(username)
+	var users []structs.User
+	for _, u := range db.sortedUsers(func(u *user) bool { return u.deletedAt.IsZero() && u.skeleton == skeleton }) {
+		users = append(users, u.profile())
+	}
+	return users, nil
+}
+
+// GetPasswordHash returns the password hash of the user with the given userID, or an empty string if the user has
+// no password (username-only account)
+func (db *memdb) GetPasswordHash(userID string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u := db.activeUser(userID)
+	if u == nil {
+		return "", fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	return u.passwordHash, nil
+}
+
+// SetPasswordHash sets the password hash of the user with the given userID
+func (db *memdb) SetPasswordHash(userID string, hash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u := db.activeUser(userID)
+	if u == nil {
+		return fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	u.passwordHash = hash
+	return nil
+}
+
+// ClaimAccount sets the password hash of the user with the given userID, if the user has no password yet
+// (username-only account). It returns ErrConflict if the user already has one.
+func (db *memdb) ClaimAccount(userID string, hash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u := db.activeUser(userID)
+	if u == nil {
+		return fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	if u.passwordHash != "" {
+		return fmt.Errorf("account already claimed: %w", database.ErrConflict)
+	}
+	u.passwordHash = hash
+	return nil
+}
+
+// CreateSession records a session of the user with the given userID, identified by the hash of its token
+func (db *memdb) CreateSession(tokenHash string, userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.sessions[tokenHash]; ok {
+		return fmt.Errorf("error creating session: %w", database.ErrConflict)
+	}
+	db.sessions[tokenHash] = userID
+	return nil
+}
+
+// GetSessionUser returns the ID of the user of the session identified by the hash of its token. The user can be
+// deleted or suspended.
+func (db *memdb) GetSessionUser(tokenHash string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	userID, ok := db.sessions[tokenHash]
+	if !ok {
+		return "", fmt.Errorf("session not found: %w", database.ErrNotFound)
+	}
+	return userID, nil
+}
+
+// GetIdentityUser returns the ID of the active user linked to the account subject of the provider issuer
+func (db *memdb) GetIdentityUser(issuer string, subject string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	userID, ok := db.identities[identity{issuer: issuer, subject: subject}]
+	if !ok || db.activeUser(userID) == nil {
+		return "", fmt.Errorf("identity not found: %w", database.ErrNotFound)
+	}
+	return userID, nil
+}
+
+// LinkIdentity links the account subject of the provider issuer to the user with the given userID
+func (db *memdb) LinkIdentity(issuer string, subject string, userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.identities[identity{issuer: issuer, subject: subject}] = userID
+	return nil
+}
+
+// GetUserByEmail returns the active user with the given email (ignoring the case). If more users have the same
+// email, the oldest one is returned.
+func (db *memdb) GetUserByEmail(email string) (structs.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var found *user
+	for _, u := range db.sortedUsers(func(u *user) bool { return u.deletedAt.IsZero() && u.email != "" && strings.EqualFold(u.email, email) }) {
+		if found == nil || u.SignUpDate.Before(found.SignUpDate) {
+			found = u
+		}
+	}
+	if found == nil {
+		return structs.User{}, fmt.Errorf("user not found: %w", database.ErrNotFound)
+	}
+	return found.profile(), nil
+}
+
+// SetUserEmail sets the (verified) email of the user with the given userID
+func (db *memdb) SetUserEmail(userID string, email string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if u := db.activeUser(userID); u != nil {
+		u.email = email
+	}
+	return nil
+}
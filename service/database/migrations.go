@@ -0,0 +1,312 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+	This file contains the schema migrations applied on top of init.sql.
+	init.sql describes the original schema and is executed on every start (every statement is idempotent), while
+	the statements below alter it. The index of the last applied migration is stored in the SQLite `user_version`
+	pragma (in the SchemaVersion table with PostgreSQL), so each migration runs exactly once per database.
+
+	The statements below are written for SQLite. Those of PostgreSQL are in postgresMigrations, with the same versions:
+	every migration is appended to both lists.
+
+	Never edit or reorder an existing migration: append a new one instead.
+*/
+
+// migrations is the ordered list of schema changes of SQLite. Migration i brings the database to version i+1.
+var migrations = [][]string{
+	// 1: edit history for post and comment captions
+	{
+		`ALTER TABLE Post ADD COLUMN edited_at DATETIME DEFAULT NULL`,
+		`ALTER TABLE Comment ADD COLUMN edited_at DATETIME DEFAULT NULL`,
+		`CREATE TABLE IF NOT EXISTS Revision (
+			id VARCHAR(36) PRIMARY KEY,
+			resource_id VARCHAR(36) NOT NULL,
+			caption VARCHAR(5000) NOT NULL,
+			revision_date DATETIME NOT NULL
+		)`,
+	},
+	// 2: soft deletion of users, posts and comments
+	{
+		`ALTER TABLE User ADD COLUMN deleted_at DATETIME DEFAULT NULL`,
+		`ALTER TABLE Post ADD COLUMN deleted_at DATETIME DEFAULT NULL`,
+		`ALTER TABLE Comment ADD COLUMN deleted_at DATETIME DEFAULT NULL`,
+	},
+	// 3: background jobs (e.g. data exports)
+	{
+		`CREATE TABLE IF NOT EXISTS Job (
+			id VARCHAR(36) PRIMARY KEY,
+			kind VARCHAR(32) NOT NULL,
+			user_id VARCHAR(36) NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			progress INT NOT NULL DEFAULT 0,
+			creation_date DATETIME NOT NULL,
+			update_date DATETIME NOT NULL
+		)`,
+	},
+	// 4: scheduled jobs (e.g. account deletions, due at the end of the grace period)
+	{
+		`ALTER TABLE Job ADD COLUMN scheduled_date DATETIME DEFAULT NULL`,
+		`UPDATE Job SET scheduled_date = creation_date`,
+	},
+	// 5: username history, so that old usernames keep pointing to their user
+	{
+		`CREATE TABLE IF NOT EXISTS UsernameHistory (
+			username VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			change_date DATETIME NOT NULL
+		)`,
+	},
+	// 6: case-insensitive and lookalike comparison of usernames, the new columns are filled by backfillUsernames
+	{
+		`ALTER TABLE User ADD COLUMN username_normalized VARCHAR(255) DEFAULT NULL`,
+		`ALTER TABLE User ADD COLUMN username_skeleton VARCHAR(255) DEFAULT NULL`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS user_username_normalized ON User (username_normalized)`,
+		`CREATE INDEX IF NOT EXISTS user_username_skeleton ON User (username_skeleton)`,
+	},
+	// 7: password login
+	{
+		`ALTER TABLE User ADD COLUMN password_hash VARCHAR(255) DEFAULT NULL`,
+	},
+	// 8: login through OpenID Connect providers, users are linked to the provider accounts by their email
+	{
+		`CREATE TABLE IF NOT EXISTS Identity (
+			issuer VARCHAR(255) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			user_id VARCHAR(36) NOT NULL,
+			link_date DATETIME NOT NULL,
+			PRIMARY KEY (issuer, subject)
+		)`,
+		`CREATE INDEX IF NOT EXISTS user_email ON User (email COLLATE NOCASE)`,
+	},
+	// 9: roles, suspensions, removal of content by moderators and audit log of the administration actions
+	{
+		`ALTER TABLE User ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user'`,
+		`ALTER TABLE User ADD COLUMN suspended_at DATETIME DEFAULT NULL`,
+		`ALTER TABLE Post ADD COLUMN removed_by VARCHAR(36) DEFAULT NULL`,
+		`ALTER TABLE Comment ADD COLUMN removed_by VARCHAR(36) DEFAULT NULL`,
+		`CREATE TABLE IF NOT EXISTS AuditLog (
+			id VARCHAR(36) PRIMARY KEY,
+			actor_id VARCHAR(36) NOT NULL,
+			action VARCHAR(32) NOT NULL,
+			target_id VARCHAR(36) NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
+			creation_date DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS audit_log_creation_date ON AuditLog (creation_date)`,
+	},
+	// 10: reports of posts, comments and users, and the warnings given to users by moderators
+	{
+		`CREATE TABLE IF NOT EXISTS Report (
+			id VARCHAR(36) PRIMARY KEY,
+			reporter_id VARCHAR(36) NOT NULL,
+			target_type VARCHAR(16) NOT NULL,
+			target_id VARCHAR(36) NOT NULL,
+			target_user_id VARCHAR(36) NOT NULL,
+			reason VARCHAR(32) NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
+			status VARCHAR(16) NOT NULL,
+			moderator_id VARCHAR(36) NOT NULL DEFAULT '',
+			action VARCHAR(16) NOT NULL DEFAULT '',
+			note TEXT NOT NULL DEFAULT '',
+			creation_date DATETIME NOT NULL,
+			update_date DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS report_status ON Report (status, creation_date)`,
+		`CREATE TABLE IF NOT EXISTS Warning (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			report_id VARCHAR(36) NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			creation_date DATETIME NOT NULL
+		)`,
+	},
+	// 11: posts and comments held for review by the content filter, hidden like the deleted ones until released
+	{
+		`ALTER TABLE Post ADD COLUMN held_at DATETIME DEFAULT NULL`,
+		`ALTER TABLE Comment ADD COLUMN held_at DATETIME DEFAULT NULL`,
+	},
+	// 12: responses saved for the requests with an Idempotency-Key header, replayed when the request is retried
+	{
+		`CREATE TABLE IF NOT EXISTS IdempotencyKey (
+			scope VARCHAR(64) NOT NULL,
+			key VARCHAR(255) NOT NULL,
+			fingerprint VARCHAR(64) NOT NULL,
+			status INTEGER NOT NULL DEFAULT 0,
+			content_type VARCHAR(255) NOT NULL DEFAULT '',
+			body BLOB,
+			creation_date DATETIME NOT NULL,
+			PRIMARY KEY (scope, key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idempotency_key_creation_date ON IdempotencyKey (creation_date)`,
+	},
+	// 13: versions of the users, posts and comments, incremented by every edit and used as their ETag
+	{
+		`ALTER TABLE User ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE Post ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE Comment ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	},
+	// 14: indexes of the lists read on every page: the posts of a user (newest first) and of the feed, the comments and
+	// the likes of a post, the followers of a user. The followings and the bans are served by the primary keys.
+	{
+		`CREATE INDEX IF NOT EXISTS post_author ON Post (author_id, creation_date)`,
+		`CREATE INDEX IF NOT EXISTS comment_post ON Comment (post_id)`,
+		`CREATE INDEX IF NOT EXISTS post_like_post ON PostLike (post_id)`,
+		`CREATE INDEX IF NOT EXISTS comment_like_comment ON CommentLike (comment_id)`,
+		`CREATE INDEX IF NOT EXISTS follow_following ON Follow (following, follower)`,
+	},
+	// 15: dates in RFC 3339 (see formatTime), the existing dates are converted by convertDates
+	{},
+	// 16: order of the revisions of a resource, as two edits can have the same date. The existing revisions are
+	// numbered by date, then by id.
+	{
+		`ALTER TABLE Revision ADD COLUMN seq INTEGER NOT NULL DEFAULT 0`,
+		`UPDATE Revision SET seq = (
+			SELECT COUNT(*) FROM Revision AS r
+			WHERE r.resource_id = Revision.resource_id AND (r.revision_date < Revision.revision_date OR
+				(r.revision_date = Revision.revision_date AND r.id <= Revision.id))
+		)`,
+		`CREATE INDEX IF NOT EXISTS revision_resource ON Revision (resource_id, seq)`,
+	},
+	// 17: sessions of the users, by the SHA-256 hash of their token: the token itself is only known to the client
+	{
+		`CREATE TABLE IF NOT EXISTS Session (
+			token_hash VARCHAR(64) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			creation_date DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS session_user ON Session (user_id)`,
+	},
+}
+
+// conversions are the changes of the data that SQL can't express, by version. They run in the transaction of the
+// migration to the version, after its statements.
+var conversions = map[int]func(tx *dbTx) error{
+	15: convertDates,
+}
+
+// migrate applies every migration not yet recorded in the database
+func migrate(db *dbConn) error {
+	version, err := db.dialect.schemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+
+	migrations := db.dialect.migrations()
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting migration %d: %w", i+1, err)
+		}
+		for _, statement := range migrations[i] {
+			_, err = tx.Exec(statement)
+			if err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("error executing migration %d statement %q: %w", i+1, statement, err)
+			}
+		}
+		if convert, ok := conversions[i+1]; ok {
+			err = convert(tx)
+			if err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("error converting the data of migration %d: %w", i+1, err)
+			}
+		}
+		err = db.dialect.setSchemaVersion(tx, i+1)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error updating schema version to %d: %w", i+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("error committing migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// dateColumns are the columns storing dates
+var dateColumns = []struct {
+	table  string
+	column string
+}{
+	{`"User"`, "signup_date"},
+	{`"User"`, "last_seen"},
+	{`"User"`, "deleted_at"},
+	{`"User"`, "suspended_at"},
+	{"Post", "creation_date"},
+	{"Post", "edited_at"},
+	{"Post", "deleted_at"},
+	{"Post", "held_at"},
+	{"Comment", "creation_date"},
+	{"Comment", "edited_at"},
+	{"Comment", "deleted_at"},
+	{"Comment", "held_at"},
+	{"Revision", "revision_date"},
+	{"Job", "creation_date"},
+	{"Job", "scheduled_date"},
+	{"Job", "update_date"},
+	{"UsernameHistory", "change_date"},
+	{"Identity", "link_date"},
+	{"AuditLog", "creation_date"},
+	{"Report", "creation_date"},
+	{"Report", "update_date"},
+	{"Warning", "creation_date"},
+	{"IdempotencyKey", "creation_date"},
+}
+
+// legacyTimeFormats are the formats of the dates stored before migration 15: RFC 3339 with any precision, the
+// String method of time.Time (the sign up dates) and the formats of SQLite. The dates without time zone are in UTC.
+var legacyTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// convertDates converts the stored dates to the format of formatTime. The dates that can't be parsed are left as they
+// are, and read as the zero time.
+func convertDates(tx *dbTx) error {
+	for _, c := range dateColumns {
+		// Read the text as stored, SQLite would parse it
+		dates, err := queryStrings(tx, fmt.Sprintf("SELECT DISTINCT CAST(%s AS TEXT) FROM %s WHERE %s IS NOT NULL", c.column, c.table, c.column))
+		if err != nil {
+			return fmt.Errorf("error reading %s.%s: %w", c.table, c.column, err)
+		}
+		for _, date := range dates {
+			converted, ok := convertDate(date)
+			if !ok || converted == date {
+				continue
+			}
+			_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?", c.table, c.column, c.column), converted, date)
+			if err != nil {
+				return fmt.Errorf("error converting %s.%s: %w", c.table, c.column, err)
+			}
+		}
+	}
+	return nil
+}
+
+// convertDate converts a date in one of the legacyTimeFormats to the format of formatTime
+func convertDate(date string) (string, bool) {
+	// The String method adds the monotonic clock reading
+	if i := strings.Index(date, " m="); i >= 0 {
+		date = date[:i]
+	}
+	for _, format := range legacyTimeFormats {
+		t, err := time.ParseInLocation(format, date, time.UTC)
+		if err == nil {
+			return formatTime(t), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+)
+
+// TestDateConversion checks that migration 15 converts the dates stored in the legacy formats
+func TestDateConversion(t *testing.T) {
+	conn, err := sql.Open("sqlite3", "file:dateconversion?mode=memory&cache=shared&_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	// The in-memory database lives as long as one of its connections
+	conn.SetConnMaxLifetime(0)
+	conn.SetMaxIdleConns(1)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// Create the database at version 14, before the conversion. Its schema is too old for the prepared queries.
+	all := migrations
+	migrations = migrations[:14]
+	db, err := newDatabase(conn, nil, nil)
+	migrations = all
+	if err != nil {
+		t.Fatalf("creating the AppDatabase: %v", err)
+	}
+
+	user, err := db.CreateUser("alice")
+	if err != nil {
+		t.Fatalf("creating the user: %v", err)
+	}
+	post, err := db.AddPost(structs.UserPost{AuthorID: user.UserID, AuthorUsername: "alice", Caption: "A post"})
+	if err != nil {
+		t.Fatalf("adding the post: %v", err)
+	}
+
+	// Store the dates in the formats used before the migration
+	for _, statement := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE User SET signup_date = ?, last_seen = ?", []interface{}{"2024-01-02 15:04:05.123456789 +0200 CEST m=+0.001000001", "2024-01-02 13:04:05"}},
+		{"UPDATE Post SET creation_date = ?, edited_at = ?", []interface{}{"2024-01-03T10:00:00Z", "not a date"}},
+	} {
+		_, err = conn.Exec(statement.query, statement.args...)
+		if err != nil {
+			t.Fatalf("executing %s: %v", statement.query, err)
+		}
+	}
+
+	db, err = New(conn)
+	if err != nil {
+		t.Fatalf("migrating the AppDatabase: %v", err)
+	}
+	user, err = db.GetUser(user.UserID)
+	if err != nil {
+		t.Fatalf("getting the user: %v", err)
+	}
+	signUp := time.Date(2024, 1, 2, 13, 4, 5, 123000000, time.UTC)
+	if !user.SignUpDate.Equal(signUp) || !user.LastSeenDate.Equal(signUp.Truncate(time.Second)) {
+		t.Fatalf("unexpected dates of %+v", user)
+	}
+
+	var creation, edited string
+	err = conn.QueryRow("SELECT CAST(creation_date AS TEXT), CAST(edited_at AS TEXT) FROM Post WHERE id = ?", post.ResourceID).Scan(&creation, &edited)
+	if err != nil {
+		t.Fatalf("reading the post: %v", err)
+	}
+	if creation != "2024-01-03T10:00:00.000Z" || edited != "not a date" {
+		t.Fatalf("unexpected dates %s and %s", creation, edited)
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gofrs/uuid"
 	"io"
@@ -12,11 +13,44 @@ import (
 /* This file contains the implementation of every function used to interact with the photo table
 	and saving photos
    i.e. the follwoing functions
+	GetUserPhotos(userID string, includeDeleted bool) ([]string, error)
    	SavePhoto(userID string, photo multipart.File) error
 	GetPhoto(userID string, photoID string) ([]byte, error)
 	DeletePhoto(userID string, photoID string) error
 */
 
+// GetUserPhotos returns the IDs of the photos of the user with the given userID: the ones they uploaded, the images of
+// their posts and their profile image. Unless includeDeleted is true, the images of the deleted posts are left out.
+func (db *appdbimpl) GetUserPhotos(userID string, includeDeleted bool) ([]string, error) {
+	var photos []string
+	rows, err := db.c.Query(`
+	SELECT id FROM Photo WHERE owner_id = ?1 AND (?2 OR NOT EXISTS (
+		SELECT 1 FROM Post WHERE Post.image_id = Photo.id AND Post.deleted_at IS NOT NULL
+	))
+	UNION
+	SELECT image_id FROM Post WHERE author_id = ?1 AND image_id != '' AND (?2 OR deleted_at IS NULL)
+	UNION
+	SELECT profile_image_id FROM "User" WHERE id = ?1 AND profile_image_id != ''`,
+		userID, includeDeleted)
+	if err != nil {
+		return photos, fmt.Errorf("error getting user photos: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var photo string
+		err := rows.Scan(&photo)
+		if err != nil {
+			return photos, fmt.Errorf("error scanning photo: %w", err)
+		}
+		photos = append(photos, photo)
+	}
+	if err := rows.Err(); err != nil {
+		return photos, fmt.Errorf("error iterating over photos: %w", err)
+	}
+	return photos, nil
+}
+
 // SavePhoto saves a photo in the database
 func (db *appdbimpl) SavePhoto(userID string, photo multipart.File) (string, error) {
 	// Generate a new UUID v4
@@ -39,6 +73,12 @@ func (db *appdbimpl) SavePhoto(userID string, photo multipart.File) (string, err
 		return "", fmt.Errorf("error copying photo: %w", err)
 	}
 
+	// Keep track of the owner of the photo
+	_, err = db.c.Exec("INSERT INTO Photo (id, owner_id) VALUES (?, ?)", newId, userID)
+	if err != nil {
+		return "", fmt.Errorf("error inserting photo: %w", err)
+	}
+
 	return newId, nil
 }
 
@@ -47,6 +87,9 @@ func (db *appdbimpl) GetPhoto(userID string, photoID string) ([]byte, error) {
 	// Get the photo from the filesystem
 	filePath := filepath.Join("/tmp/", photoID+".jpg")
 	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("photo not found: %w", ErrNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error opening file: %w", err)
 	}
@@ -66,9 +109,17 @@ func (db *appdbimpl) DeletePhoto(userID string, photoID string) error {
 	// Delete the photo from the filesystem
 	filePath := filepath.Join("/tmp/", photoID+".jpg")
 	err := os.Remove(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("photo not found: %w", ErrNotFound)
+	}
 	if err != nil {
 		return fmt.Errorf("error deleting file: %w", err)
 	}
 
+	_, err = db.c.Exec("DELETE FROM Photo WHERE id = ?", photoID)
+	if err != nil {
+		return fmt.Errorf("error deleting photo: %w", err)
+	}
+
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/attiliov/WASA-Photo/service/structs"
 	"github.com/gofrs/uuid"
@@ -15,26 +16,30 @@ import (
 	GetUserPosts(userID string) ([]structs.ResourceID, error)
 	AddPost(userID string, post structs.UserPost) (structs.ResourceID, error)
 	GetPost(postID string) (structs.UserPost, error)
-	UpdatePost(postID string, post structs.UserPost) error
+	UpdatePost(postID string, post structs.UserPost, version int) (int, error)
 	DeletePost(postID string) error
+	RestorePost(postID string, authorID string, deletedSince time.Time) error
 
 	GetUserFeed(userID string) ([]structs.ResourceID, error)
 
 */
 
-// GetUserPosts returns the posts of the user with the given userID
-func (db *appdbimpl) GetUserPosts(userID string) ([]structs.ResourceID, error) {
-	var posts []structs.ResourceID
-	rows, err := db.c.Query(`
+// getUserPostsQuery selects the visible posts of a user, newest first
+const getUserPostsQuery = `
 	SELECT 
 		id 
 	FROM 
 		Post 
 	WHERE 
-		author_id = ?
+		author_id = ? AND deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM "User" WHERE "User".id = Post.author_id AND "User".deleted_at IS NULL)
 	ORDER BY
-		creation_date DESC`,
-		userID)
+		creation_date DESC`
+
+// GetUserPosts returns the posts of the user with the given userID
+func (db *appdbimpl) GetUserPosts(userID string) ([]structs.ResourceID, error) {
+	var posts []structs.ResourceID
+	rows, err := db.c.Query(getUserPostsQuery, userID)
 	if err != nil {
 		return posts, fmt.Errorf("error getting user posts: %w", err)
 	}
@@ -53,7 +58,7 @@ func (db *appdbimpl) GetUserPosts(userID string) ([]structs.ResourceID, error) {
 	return posts, nil
 }
 
-// AddPost adds a new post to the database
+// AddPost adds a new post to the database, created now if the post has no creation date
 func (db *appdbimpl) AddPost(post structs.UserPost) (structs.ResourceID, error) {
 	// Generate a new UUID v4
 	id, err := uuid.NewV4()
@@ -68,17 +73,15 @@ func (db *appdbimpl) AddPost(post structs.UserPost) (structs.ResourceID, error)
         Post (id, author_id, author_username, creation_date, caption, image_id, like_count, comment_count) 
     VALUES 
         (?, ?, ?, ?, ?, ?, ?, ?)`,
-		post.PostID, post.AuthorID, post.AuthorUsername, post.CreationDate, post.Caption, post.Image, 0, 0)
+		post.PostID, post.AuthorID, post.AuthorUsername, formatCreationDate(post.CreationDate), post.Caption, post.Image, 0, 0)
 	if err != nil {
 		return structs.ResourceID{ResourceID: post.PostID}, fmt.Errorf("error inserting post: %w", err)
 	}
 	return structs.ResourceID{ResourceID: post.PostID}, nil
 }
 
-// GetPost returns the post with the given postID
-func (db *appdbimpl) GetPost(postID string) (structs.UserPost, error) {
-	var post structs.UserPost
-	err := db.c.QueryRow(`
+// getPostQuery selects a visible post
+const getPostQuery = `
 	SELECT 
 		id, 
 		author_id, 
@@ -87,69 +90,143 @@ func (db *appdbimpl) GetPost(postID string) (structs.UserPost, error) {
 		caption, 
 		image_id, 
 		like_count, 
-		comment_count 
+		comment_count,
+		COALESCE(edited_at, ''),
+		version
 	FROM 
 		Post 
 	WHERE 
-		id = ?`,
-		postID).Scan(&post.PostID, &post.AuthorID, &post.AuthorUsername, &post.CreationDate, &post.Caption, &post.Image, &post.LikeCount, &post.CommentCount)
+		id = ? AND deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM "User" WHERE "User".id = Post.author_id AND "User".deleted_at IS NULL)`
+
+// GetPost returns the post with the given postID
+func (db *appdbimpl) GetPost(postID string) (structs.UserPost, error) {
+	var post structs.UserPost
+	err := db.c.QueryRow(getPostQuery, postID).Scan(&post.PostID, &post.AuthorID, &post.AuthorUsername, scanTime(&post.CreationDate), &post.Caption, &post.Image, &post.LikeCount, &post.CommentCount, scanOptionalTime(&post.EditedAt), &post.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return post, fmt.Errorf("post not found: %w", err)
+			return post, fmt.Errorf("post not found: %w", ErrNotFound)
 		}
 		return post, fmt.Errorf("error getting post: %w", err)
 	}
 	return post, nil
 }
 
-// UpdatePost updates the post with the given postID
-func (db *appdbimpl) UpdatePost(postID string, post structs.UserPost) error {
-	_, err := db.c.Exec(`
+// UpdatePost updates the caption and the image of the post with the given postID, if the post is still at the given
+// version, and returns the new version. It returns ErrVersionMismatch if the post was modified in the meantime.
+// If the caption changes, the previous one is saved as a revision and the post is marked as edited.
+func (db *appdbimpl) UpdatePost(postID string, post structs.UserPost, version int) (int, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Get the current caption and version
+	var oldCaption string
+	var currentVersion int
+	err = tx.QueryRow("SELECT caption, version FROM Post WHERE id = ? AND deleted_at IS NULL", postID).Scan(&oldCaption, &currentVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("post not found: %w", ErrNotFound)
+		}
+		return 0, fmt.Errorf("error getting post caption: %w", err)
+	}
+	if currentVersion != version {
+		return 0, ErrVersionMismatch
+	}
+
+	if oldCaption != post.Caption {
+		err = addRevision(tx, postID, oldCaption)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec("UPDATE Post SET edited_at = ? WHERE id = ?", now(), postID)
+		if err != nil {
+			return 0, fmt.Errorf("error marking post as edited: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
 	UPDATE 
 		Post 
 	SET 
-		author_id = ?, 
-		author_username = ?, 
 		caption = ?, 
 		image_id = ?, 
-		like_count = ?, 
-		comment_count = ? 
+		version = version + 1 
 	WHERE 
 		id = ?`,
-		post.AuthorID, post.AuthorUsername, post.Caption, post.Image, post.LikeCount, post.CommentCount, postID)
+		post.Caption, post.Image, postID)
 	if err != nil {
-		return fmt.Errorf("error updating post: %w", err)
+		return 0, fmt.Errorf("error updating post: %w", err)
 	}
-	return nil
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("error committing post update: %w", err)
+	}
+	return version + 1, nil
 }
 
-// DeletePost deletes the post with the given postID
+// DeletePost marks the post with the given postID as deleted.
+// The post is hidden from every read, and it is removed for good by PurgeDeleted once the grace period is over.
 func (db *appdbimpl) DeletePost(postID string) error {
 	_, err := db.c.Exec(`
-	DELETE FROM 
+	UPDATE 
 		Post 
+	SET 
+		deleted_at = ? 
 	WHERE 
-		id = ?`,
-		postID)
+		id = ? AND deleted_at IS NULL`,
+		now(), postID)
 	if err != nil {
 		return fmt.Errorf("error deleting post: %w", err)
 	}
 	return nil
 }
 
-// GetUserFeed returns the posts of the users followed by the user with the given userID
-func (db *appdbimpl) GetUserFeed(userID string) ([]structs.ResourceID, error) {
-	var posts []structs.ResourceID
-	rows, err := db.c.Query(`
+// RestorePost restores the post with the given postID, if it belongs to authorID and was deleted after deletedSince
+func (db *appdbimpl) RestorePost(postID string, authorID string, deletedSince time.Time) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		Post 
+	SET 
+		deleted_at = NULL 
+	WHERE 
+		id = ? AND author_id = ? AND deleted_at >= ? AND removed_by IS NULL AND held_at IS NULL`,
+		postID, authorID, formatTime(deletedSince))
+	if err != nil {
+		return fmt.Errorf("error restoring post: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error restoring post: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("no restorable post found: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// getUserFeedQuery selects the visible posts of the users followed by a user, newest first
+const getUserFeedQuery = `
 	SELECT 
 		Post.id 
 	FROM 
 		Post 
 	INNER JOIN 
 		Follow ON Post.author_id = Follow.following
+	INNER JOIN
+		"User" ON Post.author_id = "User".id
 	WHERE 
-		Follow.follower = ?`,
-		userID)
+		Follow.follower = ? AND Post.deleted_at IS NULL AND "User".deleted_at IS NULL
+	ORDER BY
+		Post.creation_date DESC`
+
+// GetUserFeed returns the posts of the users followed by the user with the given userID, newest first
+func (db *appdbimpl) GetUserFeed(userID string) ([]structs.ResourceID, error) {
+	var posts []structs.ResourceID
+	rows, err := db.c.Query(getUserFeedQuery, userID)
 	if err != nil {
 		return posts, fmt.Errorf("error getting user feed: %w", err)
 	}
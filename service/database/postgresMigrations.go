@@ -0,0 +1,174 @@
+package database
+
+/*
+	This file contains the schema migrations of PostgreSQL, the same as the ones of SQLite (see migrations.go) in the
+	SQL of PostgreSQL: USER is a reserved word, the dates are stored as text compared byte by byte (as in SQLite, see
+	formatTime), the emails are compared ignoring the case through lower().
+
+	Never edit or reorder an existing migration: append a new one instead, to both lists.
+*/
+
+// postgresMigrations is the ordered list of schema changes of PostgreSQL. Migration i brings the database to version
+// i+1, like migrations[i] for SQLite.
+var postgresMigrations = [][]string{
+	// 1: edit history for post and comment captions
+	{
+		`ALTER TABLE Post ADD COLUMN edited_at TEXT COLLATE "C" DEFAULT NULL`,
+		`ALTER TABLE Comment ADD COLUMN edited_at TEXT COLLATE "C" DEFAULT NULL`,
+		`CREATE TABLE IF NOT EXISTS Revision (
+			id VARCHAR(36) PRIMARY KEY,
+			resource_id VARCHAR(36) NOT NULL,
+			caption VARCHAR(5000) NOT NULL,
+			revision_date TEXT COLLATE "C" NOT NULL
+		)`,
+	},
+	// 2: soft deletion of users, posts and comments
+	{
+		`ALTER TABLE "User" ADD COLUMN deleted_at TEXT COLLATE "C" DEFAULT NULL`,
+		`ALTER TABLE Post ADD COLUMN deleted_at TEXT COLLATE "C" DEFAULT NULL`,
+		`ALTER TABLE Comment ADD COLUMN deleted_at TEXT COLLATE "C" DEFAULT NULL`,
+	},
+	// 3: background jobs (e.g. data exports)
+	{
+		`CREATE TABLE IF NOT EXISTS Job (
+			id VARCHAR(36) PRIMARY KEY,
+			kind VARCHAR(32) NOT NULL,
+			user_id VARCHAR(36) NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			progress INT NOT NULL DEFAULT 0,
+			creation_date TEXT COLLATE "C" NOT NULL,
+			update_date TEXT COLLATE "C" NOT NULL
+		)`,
+	},
+	// 4: scheduled jobs (e.g. account deletions, due at the end of the grace period)
+	{
+		`ALTER TABLE Job ADD COLUMN scheduled_date TEXT COLLATE "C" DEFAULT NULL`,
+		`UPDATE Job SET scheduled_date = creation_date`,
+	},
+	// 5: username history, so that old usernames keep pointing to their user
+	{
+		`CREATE TABLE IF NOT EXISTS UsernameHistory (
+			username VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			change_date TEXT COLLATE "C" NOT NULL
+		)`,
+	},
+	// 6: case-insensitive and lookalike comparison of usernames, the new columns are filled by backfillUsernames
+	{
+		`ALTER TABLE "User" ADD COLUMN username_normalized VARCHAR(255) DEFAULT NULL`,
+		`ALTER TABLE "User" ADD COLUMN username_skeleton VARCHAR(255) DEFAULT NULL`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS user_username_normalized ON "User" (username_normalized)`,
+		`CREATE INDEX IF NOT EXISTS user_username_skeleton ON "User" (username_skeleton)`,
+	},
+	// 7: password login
+	{
+		`ALTER TABLE "User" ADD COLUMN password_hash VARCHAR(255) DEFAULT NULL`,
+	},
+	// 8: login through OpenID Connect providers, users are linked to the provider accounts by their email
+	{
+		`CREATE TABLE IF NOT EXISTS Identity (
+			issuer VARCHAR(255) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			user_id VARCHAR(36) NOT NULL,
+			link_date TEXT COLLATE "C" NOT NULL,
+			PRIMARY KEY (issuer, subject)
+		)`,
+		`CREATE INDEX IF NOT EXISTS user_email ON "User" (lower(email))`,
+	},
+	// 9: roles, suspensions, removal of content by moderators and audit log of the administration actions
+	{
+		`ALTER TABLE "User" ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user'`,
+		`ALTER TABLE "User" ADD COLUMN suspended_at TEXT COLLATE "C" DEFAULT NULL`,
+		`ALTER TABLE Post ADD COLUMN removed_by VARCHAR(36) DEFAULT NULL`,
+		`ALTER TABLE Comment ADD COLUMN removed_by VARCHAR(36) DEFAULT NULL`,
+		`CREATE TABLE IF NOT EXISTS AuditLog (
+			id VARCHAR(36) PRIMARY KEY,
+			actor_id VARCHAR(36) NOT NULL,
+			action VARCHAR(32) NOT NULL,
+			target_id VARCHAR(36) NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
+			creation_date TEXT COLLATE "C" NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS audit_log_creation_date ON AuditLog (creation_date)`,
+	},
+	// 10: reports of posts, comments and users, and the warnings given to users by moderators
+	{
+		`CREATE TABLE IF NOT EXISTS Report (
+			id VARCHAR(36) PRIMARY KEY,
+			reporter_id VARCHAR(36) NOT NULL,
+			target_type VARCHAR(16) NOT NULL,
+			target_id VARCHAR(36) NOT NULL,
+			target_user_id VARCHAR(36) NOT NULL,
+			reason VARCHAR(32) NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
+			status VARCHAR(16) NOT NULL,
+			moderator_id VARCHAR(36) NOT NULL DEFAULT '',
+			action VARCHAR(16) NOT NULL DEFAULT '',
+			note TEXT NOT NULL DEFAULT '',
+			creation_date TEXT COLLATE "C" NOT NULL,
+			update_date TEXT COLLATE "C" NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS report_status ON Report (status, creation_date)`,
+		`CREATE TABLE IF NOT EXISTS Warning (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			report_id VARCHAR(36) NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			creation_date TEXT COLLATE "C" NOT NULL
+		)`,
+	},
+	// 11: posts and comments held for review by the content filter, hidden like the deleted ones until released
+	{
+		`ALTER TABLE Post ADD COLUMN held_at TEXT COLLATE "C" DEFAULT NULL`,
+		`ALTER TABLE Comment ADD COLUMN held_at TEXT COLLATE "C" DEFAULT NULL`,
+	},
+	// 12: responses saved for the requests with an Idempotency-Key header, replayed when the request is retried
+	{
+		`CREATE TABLE IF NOT EXISTS IdempotencyKey (
+			scope VARCHAR(64) NOT NULL,
+			key VARCHAR(255) NOT NULL,
+			fingerprint VARCHAR(64) NOT NULL,
+			status INTEGER NOT NULL DEFAULT 0,
+			content_type VARCHAR(255) NOT NULL DEFAULT '',
+			body BYTEA,
+			creation_date TEXT COLLATE "C" NOT NULL,
+			PRIMARY KEY (scope, key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idempotency_key_creation_date ON IdempotencyKey (creation_date)`,
+	},
+	// 13: versions of the users, posts and comments, incremented by every edit and used as their ETag
+	{
+		`ALTER TABLE "User" ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE Post ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE Comment ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	},
+	// 14: indexes of the lists read on every page
+	{
+		`CREATE INDEX IF NOT EXISTS post_author ON Post (author_id, creation_date)`,
+		`CREATE INDEX IF NOT EXISTS comment_post ON Comment (post_id)`,
+		`CREATE INDEX IF NOT EXISTS post_like_post ON PostLike (post_id)`,
+		`CREATE INDEX IF NOT EXISTS comment_like_comment ON CommentLike (comment_id)`,
+		`CREATE INDEX IF NOT EXISTS follow_following ON Follow (following, follower)`,
+	},
+	// 15: dates in RFC 3339 (see formatTime), the existing dates are converted by convertDates
+	{},
+	// 16: order of the revisions of a resource
+	{
+		`ALTER TABLE Revision ADD COLUMN seq INTEGER NOT NULL DEFAULT 0`,
+		`UPDATE Revision SET seq = (
+			SELECT COUNT(*) FROM Revision AS r
+			WHERE r.resource_id = Revision.resource_id AND (r.revision_date < Revision.revision_date OR
+				(r.revision_date = Revision.revision_date AND r.id <= Revision.id))
+		)`,
+		`CREATE INDEX IF NOT EXISTS revision_resource ON Revision (resource_id, seq)`,
+	},
+	// 17: sessions of the users, by the SHA-256 hash of their token: the token itself is only known to the client
+	{
+		`CREATE TABLE IF NOT EXISTS Session (
+			token_hash VARCHAR(64) PRIMARY KEY,
+			user_id VARCHAR(36) NOT NULL,
+			creation_date TEXT COLLATE "C" NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS session_user ON Session (user_id)`,
+	},
+}
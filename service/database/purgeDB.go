@@ -0,0 +1,123 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+/* This file contains the implementation of the functions used to remove for good the soft-deleted rows
+   i.e. the follwoing functions
+	PurgeDeleted(deletedBefore time.Time) error
+	PurgePost(postID string) ([]string, error)
+	PurgeComment(commentID string) error
+*/
+
+// PurgeDeleted removes the posts and comments deleted before deletedBefore, together with everything that depends on
+// them (likes, edit history, comments of purged posts) and the photo files of purged posts.
+// Deleted users are not purged here: their account deletion job erases them with all their content. Content held for
+// review is not purged either, it waits for a moderator.
+func (db *appdbimpl) PurgeDeleted(deletedBefore time.Time) error {
+	photos, err := db.purge("deleted_at < ?1 AND held_at IS NULL", "deleted_at < ?1 AND held_at IS NULL", formatTime(deletedBefore))
+	if err != nil {
+		return err
+	}
+
+	// Remove the photo files. A missing file means it was already removed.
+	for _, photoID := range photos {
+		err = db.DeletePhoto("", photoID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("error purging photo %s: %w", photoID, err)
+		}
+	}
+	return nil
+}
+
+// PurgePost removes for good the deleted post with the given postID, without waiting for the end of the grace period.
+// It returns the IDs of the photos of the post, whose files are left to the caller: the purge may be part of a
+// transaction, and the files must be removed with DeletePhoto only once it is committed.
+func (db *appdbimpl) PurgePost(postID string) ([]string, error) {
+	return db.purge("id = ?1 AND deleted_at IS NOT NULL", noPurge, postID)
+}
+
+// PurgeComment removes for good the deleted comment with the given commentID, without waiting for the end of the
+// grace period
+func (db *appdbimpl) PurgeComment(commentID string) error {
+	_, err := db.purge(noPurge, "id = ?1 AND deleted_at IS NOT NULL", commentID)
+	return err
+}
+
+// noPurge is the condition of purge matching no row. It refers to ?1 like the others, as every statement of purge gets
+// the argument.
+const noPurge = "FALSE AND id = ?1"
+
+// purge removes the posts matching postCondition and the comments matching commentCondition (both referring to the
+// argument arg as ?1), together with everything that depends on them. It returns the IDs of the photos of the purged
+// posts, whose files are still to be removed.
+func (db *appdbimpl) purge(postCondition string, commentCondition string, arg interface{}) ([]string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Collect the photos to remove once the rows are gone
+	photos, err := queryStrings(tx, `
+	SELECT image_id FROM Post WHERE (`+postCondition+`) AND image_id != ''`,
+		arg)
+	if err != nil {
+		return nil, fmt.Errorf("error getting photos to purge: %w", err)
+	}
+
+	// The statements are ordered so that dependent rows go before the rows they refer to
+	posts := `SELECT id FROM Post WHERE ` + postCondition
+	comments := `SELECT id FROM Comment WHERE (` + commentCondition + `) OR post_id IN (` + posts + `)`
+	statements := []struct {
+		query       string
+		description string
+	}{
+		{`
+		DELETE FROM CommentLike WHERE comment_id IN (` + comments + `)`, "comment likes"},
+		{`
+		DELETE FROM Revision WHERE resource_id IN (` + comments + ` UNION ` + posts + `)`, "revisions"},
+		{`
+		DELETE FROM Comment WHERE id IN (` + comments + `)`, "comments"},
+		{`
+		DELETE FROM PostLike WHERE post_id IN (` + posts + `)`, "post likes"},
+		{`
+		DELETE FROM Photo WHERE id IN (SELECT image_id FROM Post WHERE ` + postCondition + `)`, "photos"},
+		{`
+		DELETE FROM Post WHERE ` + postCondition, "posts"},
+	}
+	for _, statement := range statements {
+		_, err = tx.Exec(statement.query, arg)
+		if err != nil {
+			return nil, fmt.Errorf("error purging %s: %w", statement.description, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("error committing purge: %w", err)
+	}
+	return photos, nil
+}
+
+// queryStrings runs a query returning a single string column and collects the results
+func queryStrings(tx *dbTx, query string, args ...interface{}) ([]string, error) {
+	var values []string
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return values, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value string
+		err = rows.Scan(&value)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// TestQueryPlans checks with EXPLAIN QUERY PLAN that the queries run on every page of the app, the prepared ones, use
+// the indexes of SQLite
+func TestQueryPlans(t *testing.T) {
+	conn, err := sql.Open("sqlite3", "file:queryplans?mode=memory&cache=shared&_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	// The in-memory database lives as long as one of its connections
+	conn.SetConnMaxLifetime(0)
+	conn.SetMaxIdleConns(1)
+	t.Cleanup(func() { _ = conn.Close() })
+	db, err := New(conn)
+	if err != nil {
+		t.Fatalf("creating the AppDatabase: %v", err)
+	}
+	c := db.(*appdbimpl).c
+
+	for _, query := range preparedQueries {
+		plan := queryPlan(t, c, query)
+		for _, step := range plan {
+			// SCAN reads a whole table (or index), SEARCH looks up an index
+			if strings.HasPrefix(step, "SCAN ") && step != "SCAN CONSTANT ROW" {
+				t.Errorf("full scan (%s) in the plan of%s\n%s", step, query, strings.Join(plan, "\n"))
+			}
+		}
+	}
+}
+
+// queryPlan returns the steps of the plan of the query
+func queryPlan(t *testing.T, c *dbConn, query string) []string {
+	t.Helper()
+	_, parameters := c.dialect.rebind(query)
+	rows, err := c.db.Query("EXPLAIN QUERY PLAN "+query, make([]interface{}, parameters)...)
+	if err != nil {
+		t.Fatalf("explaining %s: %v", query, err)
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var step string
+		err = rows.Scan(&id, &parent, &unused, &step)
+		if err != nil {
+			t.Fatalf("reading the plan of %s: %v", query, err)
+		}
+		plan = append(plan, step)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("reading the plan of %s: %v", query, err)
+	}
+	return plan
+}
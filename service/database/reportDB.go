@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/gofrs/uuid"
+)
+
+/*
+	This file contains the implementation of every function used to interact with the reports and the warnings
+	i.e. the follwoing functions
+	CreateReport(report structs.Report) (structs.Report, error)
+	GetReport(reportID string) (structs.Report, error)
+	GetReports(status string, offset int, limit int) ([]structs.Report, error)
+	HasOpenReport(reporterID string, targetID string) (bool, error)
+	ClaimReport(reportID string, moderatorID string) error
+	CloseReport(reportID string, moderatorID string, status string, action string, note string) error
+	AddWarning(userID string, reportID string, note string) error
+	GetUserWarnings(userID string) ([]structs.Warning, error)
+*/
+
+// Report statuses
+const (
+	ReportOpen      = "open"
+	ReportClaimed   = "claimed"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// CreateReport creates a new open report with the reporter, target and reason of the given report
+func (db *appdbimpl) CreateReport(report structs.Report) (structs.Report, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return report, fmt.Errorf("error generating UUID: %w", err)
+	}
+	report.ReportID = id.String()
+	report.Status = ReportOpen
+	report.ModeratorID = ""
+	report.Action = ""
+	report.Note = ""
+	report.CreationDate = storedTime(globaltime.Now())
+	report.UpdateDate = report.CreationDate
+
+	_, err = db.c.Exec(`
+	INSERT INTO 
+		Report (id, reporter_id, target_type, target_id, target_user_id, reason, details, status, creation_date, update_date) 
+	VALUES 
+		(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		report.ReportID, report.ReporterID, report.TargetType, report.TargetID, report.TargetUserID, report.Reason, report.Details,
+		report.Status, formatTime(report.CreationDate), formatTime(report.UpdateDate))
+	if err != nil {
+		return report, fmt.Errorf("error creating report: %w", err)
+	}
+	return report, nil
+}
+
+// reportColumns are the columns scanned by scanReport, in order
+const reportColumns = `id, reporter_id, target_type, target_id, target_user_id, reason, details, status, moderator_id, action, note,
+	creation_date, update_date`
+
+// scanReport scans a row made of reportColumns
+func scanReport(row interface{ Scan(...interface{}) error }) (structs.Report, error) {
+	var report structs.Report
+	err := row.Scan(&report.ReportID, &report.ReporterID, &report.TargetType, &report.TargetID, &report.TargetUserID, &report.Reason,
+		&report.Details, &report.Status, &report.ModeratorID, &report.Action, &report.Note, scanTime(&report.CreationDate), scanTime(&report.UpdateDate))
+	return report, err
+}
+
+// GetReport returns the report with the given reportID
+func (db *appdbimpl) GetReport(reportID string) (structs.Report, error) {
+	report, err := scanReport(db.c.QueryRow("SELECT "+reportColumns+" FROM Report WHERE id = ?", reportID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return report, fmt.Errorf("report not found: %w", ErrNotFound)
+		}
+		return report, fmt.Errorf("error getting report: %w", err)
+	}
+	return report, nil
+}
+
+// GetReports returns the reports with the given status (every report if empty), oldest first
+func (db *appdbimpl) GetReports(status string, offset int, limit int) ([]structs.Report, error) {
+	var reports []structs.Report
+	rows, err := db.c.Query(`
+	SELECT 
+		`+reportColumns+` 
+	FROM 
+		Report 
+	WHERE 
+		?1 = '' OR status = ?1
+	ORDER BY 
+		creation_date, id
+	LIMIT ?2 OFFSET ?3`,
+		status, limit, offset)
+	if err != nil {
+		return reports, fmt.Errorf("error getting reports: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return reports, fmt.Errorf("error scanning report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return reports, fmt.Errorf("error iterating over reports: %w", err)
+	}
+	return reports, nil
+}
+
+// HasOpenReport returns true if the user reporterID already reported targetID and the report is not closed yet
+func (db *appdbimpl) HasOpenReport(reporterID string, targetID string) (bool, error) {
+	var exists bool
+	err := db.c.QueryRow(`
+	SELECT EXISTS(
+		SELECT 1 FROM Report WHERE reporter_id = ? AND target_id = ? AND status IN ('`+ReportOpen+`', '`+ReportClaimed+`')
+	)`,
+		reporterID, targetID).Scan(&exists)
+	if err != nil {
+		return exists, fmt.Errorf("error checking open reports: %w", err)
+	}
+	return exists, nil
+}
+
+// ClaimReport assigns the open report with the given reportID to the moderator moderatorID. It fails if the report
+// is closed or claimed by another moderator.
+func (db *appdbimpl) ClaimReport(reportID string, moderatorID string) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		Report 
+	SET 
+		status = ?, 
+		moderator_id = ?, 
+		update_date = ? 
+	WHERE 
+		id = ? AND (status = ? OR (status = ? AND moderator_id = ?))`,
+		ReportClaimed, moderatorID, now(), reportID, ReportOpen, ReportClaimed, moderatorID)
+	if err != nil {
+		return fmt.Errorf("error claiming report: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error claiming report: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("report not found, closed or claimed by another moderator: %w", ErrConflict)
+	}
+	return nil
+}
+
+// CloseReport closes the report with the given reportID with the given status (resolved or dismissed), recording
+// the action taken. It fails if the report is closed or claimed by another moderator.
+func (db *appdbimpl) CloseReport(reportID string, moderatorID string, status string, action string, note string) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		Report 
+	SET 
+		status = ?, 
+		moderator_id = ?, 
+		action = ?, 
+		note = ?, 
+		update_date = ? 
+	WHERE 
+		id = ? AND (status = ? OR (status = ? AND moderator_id = ?))`,
+		status, moderatorID, action, note, now(), reportID, ReportOpen, ReportClaimed, moderatorID)
+	if err != nil {
+		return fmt.Errorf("error closing report: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error closing report: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("report not found, closed or claimed by another moderator: %w", ErrConflict)
+	}
+	return nil
+}
+
+// AddWarning records a warning given to the user with the given userID after the report reportID
+func (db *appdbimpl) AddWarning(userID string, reportID string, note string) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return fmt.Errorf("error generating UUID: %w", err)
+	}
+	_, err = db.c.Exec(`
+	INSERT INTO 
+		Warning (id, user_id, report_id, note, creation_date) 
+	VALUES 
+		(?, ?, ?, ?, ?)`,
+		id.String(), userID, reportID, note, now())
+	if err != nil {
+		return fmt.Errorf("error adding warning: %w", err)
+	}
+	return nil
+}
+
+// GetUserWarnings returns the warnings given to the user with the given userID, newest first
+func (db *appdbimpl) GetUserWarnings(userID string) ([]structs.Warning, error) {
+	var warnings []structs.Warning
+	rows, err := db.c.Query(`
+	SELECT 
+		id, 
+		report_id, 
+		note, 
+		creation_date 
+	FROM 
+		Warning 
+	WHERE 
+		user_id = ?
+	ORDER BY 
+		creation_date DESC`,
+		userID)
+	if err != nil {
+		return warnings, fmt.Errorf("error getting warnings: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var warning structs.Warning
+		err = rows.Scan(&warning.WarningID, &warning.ReportID, &warning.Note, scanTime(&warning.CreationDate))
+		if err != nil {
+			return warnings, fmt.Errorf("error scanning warning: %w", err)
+		}
+		warnings = append(warnings, warning)
+	}
+	if err := rows.Err(); err != nil {
+		return warnings, fmt.Errorf("error iterating over warnings: %w", err)
+	}
+	return warnings, nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/gofrs/uuid"
+)
+
+/* This file contains the implementation of every function used to interact with the revision table
+   i.e. the follwoing functions
+	GetPostRevisions(postID string) ([]structs.Revision, error)
+	GetCommentRevisions(commentID string) ([]structs.Revision, error)
+
+   A revision stores the caption a post or a comment had before being edited.
+*/
+
+// GetPostRevisions returns the previous captions of the post with the given postID, newest first
+func (db *appdbimpl) GetPostRevisions(postID string) ([]structs.Revision, error) {
+	var postExists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Post WHERE id = ? AND deleted_at IS NULL)", postID).Scan(&postExists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking if post exists: %w", err)
+	}
+	if !postExists {
+		return nil, fmt.Errorf("post not found: %w", ErrNotFound)
+	}
+	return db.getRevisions(postID)
+}
+
+// GetCommentRevisions returns the previous captions of the comment with the given commentID, newest first
+func (db *appdbimpl) GetCommentRevisions(commentID string) ([]structs.Revision, error) {
+	var commentExists bool
+	err := db.c.QueryRow("SELECT EXISTS(SELECT 1 FROM Comment WHERE id = ? AND deleted_at IS NULL)", commentID).Scan(&commentExists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking if comment exists: %w", err)
+	}
+	if !commentExists {
+		return nil, fmt.Errorf("comment does not exist: %w", ErrNotFound)
+	}
+	return db.getRevisions(commentID)
+}
+
+// getRevisions returns the revisions of the resource with the given resourceID, newest first
+func (db *appdbimpl) getRevisions(resourceID string) ([]structs.Revision, error) {
+	var revisions []structs.Revision
+	rows, err := db.c.Query(`
+	SELECT 
+		id, 
+		resource_id, 
+		caption, 
+		revision_date 
+	FROM 
+		Revision 
+	WHERE 
+		resource_id = ?
+	ORDER BY
+		seq DESC`,
+		resourceID)
+	if err != nil {
+		return revisions, fmt.Errorf("error getting revisions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revision structs.Revision
+		err := rows.Scan(&revision.RevisionID, &revision.ResourceID, &revision.Caption, scanTime(&revision.RevisionDate))
+		if err != nil {
+			return revisions, fmt.Errorf("error scanning revision: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return revisions, fmt.Errorf("error iterating over revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// addRevision saves the caption that the resource with the given resourceID had before being edited. The revisions of a
+// resource are numbered in order (seq), as two edits can have the same date.
+func addRevision(tx *dbTx, resourceID string, caption string) error {
+	// Generate a new UUID v4
+	id, err := uuid.NewV4()
+	if err != nil {
+		return fmt.Errorf("error generating UUID: %w", err)
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO 
+		Revision (id, resource_id, caption, revision_date, seq) 
+	SELECT 
+		?, ?, ?, ?, COALESCE(MAX(seq), 0) + 1
+	FROM 
+		Revision 
+	WHERE 
+		resource_id = ?`,
+		id.String(), resourceID, caption, now(), resourceID)
+	if err != nil {
+		return fmt.Errorf("error inserting revision: %w", err)
+	}
+	return nil
+}
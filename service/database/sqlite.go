@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+/*
+	This file contains the connections to SQLite tuned for the concurrent requests of the server.
+	SQLite allows a single writer at a time: the writes go through a pool of a single connection, which waits for its
+	turn in Go instead of failing with "database is locked", and the reads go through a separate read-only pool. In
+	WAL mode (write-ahead log) the readers don't block the writer and the writer doesn't block the readers.
+*/
+
+// OpenSQLite opens the SQLite database in the file, in WAL mode, and returns the connections writing it (a pool of a
+// single connection) and the connections reading it, to pass to NewWithReader. Each connection waits up to busyTimeout
+// for the locks of the other processes using the file. The size of the pool reading is left to the caller.
+func OpenSQLite(filename string, busyTimeout time.Duration) (writer *sql.DB, reader *sql.DB, err error) {
+	timeout := fmt.Sprint(busyTimeout.Milliseconds())
+
+	// The transactions take the write lock when they begin, as they always end up writing: upgrading a read lock
+	// fails at once instead of waiting for busy_timeout
+	writer, err = sql.Open("sqlite3", "file:"+filename+"?"+url.Values{
+		"_foreign_keys": {"1"},
+		"_journal_mode": {"WAL"},
+		"_busy_timeout": {timeout},
+		"_txlock":       {"immediate"},
+	}.Encode())
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening the connection writing: %w", err)
+	}
+	writer.SetMaxOpenConns(1)
+
+	// Create the file and switch it to WAL mode before opening it read-only
+	err = writer.Ping()
+	if err != nil {
+		_ = writer.Close()
+		return nil, nil, fmt.Errorf("opening the connection writing: %w", err)
+	}
+
+	reader, err = sql.Open("sqlite3", "file:"+filename+"?"+url.Values{
+		"mode":          {"ro"},
+		"_foreign_keys": {"1"},
+		"_busy_timeout": {timeout},
+	}.Encode())
+	if err != nil {
+		_ = writer.Close()
+		return nil, nil, fmt.Errorf("opening the connections reading: %w", err)
+	}
+	return writer, reader, nil
+}
@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package database
+
+// isSQLiteConstraintViolation is a stub because SQLite needs cgo: without it, sqlite3 connections can't be opened.
+func isSQLiteConstraintViolation(err error) bool {
+	return false
+}
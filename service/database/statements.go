@@ -0,0 +1,72 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+/*
+	This file contains the prepared statements of dbConn.
+	The queries run on every page of the app are prepared once by New, instead of being parsed and planned by the
+	engine every time, and New fails if one of them can't be prepared. The other queries run without being prepared.
+*/
+
+// preparedQueries are the queries prepared by New: the ones of the methods run on every page of the app (see
+// TestQueryPlans) and the session lookup of every authenticated request
+var preparedQueries = []string{
+	getUserQuery,
+	getUserPostsQuery,
+	getPostQuery,
+	getPostCommentsQuery,
+	getCommentQuery,
+	getPostLikesQuery,
+	getCommentLikesQuery,
+	getUserFeedQuery,
+	getFollowersListQuery,
+	getFollowingsListQuery,
+	isBannedQuery,
+	getUserBanListQuery,
+	getSessionUserQuery,
+}
+
+// statementCache is the statements prepared on a pool of connections. It is not modified once prepared.
+type statementCache struct {
+	statements map[string]*sql.Stmt // Prepared statements by query, in the dialect of the connections
+}
+
+// prepareStatements prepares the queries, in the dialect d, on db
+func prepareStatements(db *sql.DB, d dialect, queries []string) (*statementCache, error) {
+	c := &statementCache{statements: make(map[string]*sql.Stmt, len(queries))}
+	for _, query := range queries {
+		query, _ = d.rebind(query)
+		stmt, err := db.Prepare(query)
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("error preparing %q: %w", query, err)
+		}
+		c.statements[query] = stmt
+	}
+	return c, nil
+}
+
+// cached returns the prepared statement of the query, or nil if it is not prepared or the cache is nil
+func (c *statementCache) cached(query string) *sql.Stmt {
+	if c == nil {
+		return nil
+	}
+	return c.statements[query]
+}
+
+// close closes the prepared statements
+func (c *statementCache) close() {
+	for _, stmt := range c.statements {
+		_ = stmt.Close()
+	}
+}
+
+// isReadOnly reports whether the query only reads the database, so that it can run on the connections reading
+func isReadOnly(query string) bool {
+	query = strings.TrimSpace(query)
+	return len(query) >= len("SELECT") && strings.EqualFold(query[:len("SELECT")], "SELECT")
+}
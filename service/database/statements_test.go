@@ -0,0 +1,23 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// TestPrepareError checks that New fails if a prepared query is not valid
+func TestPrepareError(t *testing.T) {
+	conn, err := sql.Open("sqlite3", "file:prepareerror?mode=memory&cache=shared&_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	// The in-memory database lives as long as one of its connections
+	conn.SetConnMaxLifetime(0)
+	conn.SetMaxIdleConns(1)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_, err = newDatabase(conn, nil, []string{getUserQuery, "SELECT missing FROM Post WHERE id = ?"})
+	if err == nil {
+		t.Fatal("expected New to fail")
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"github.com/attiliov/WASA-Photo/service/globaltime"
+	"time"
+
 	"github.com/attiliov/WASA-Photo/service/structs"
+	"github.com/attiliov/WASA-Photo/service/usernames"
 	"github.com/gofrs/uuid"
 )
 
@@ -15,14 +17,17 @@ import (
 	GetUser(username string) (structs.User, error)
 	CreateUser(username string) (structs.User, error)
 	SearchUsername(username string) ([]structs.User, error)
-	UpdateUser(userID string, user structs.User) error
+	UpdateUser(userID string, user structs.User, version int) (int, error)
 	DeleteUser(userID string) error
+	RestoreUser(userID string, deletedSince time.Time) error
+	IsActiveUser(userID string) (bool, error)
+	GetUsernameHistory(userID string) ([]structs.UsernameChange, error)
+	ResolveUsername(username string) (string, error)
+	GetLookalikeUsers(username string) ([]structs.User, error)
 */
 
-// GetUser returns the user with the given username or id
-func (db *appdbimpl) GetUser(param string) (structs.User, error) {
-	var user structs.User
-	err := db.c.QueryRow(`
+// getUserQuery selects the active user with an ID or a username, the exact username first
+const getUserQuery = `
     SELECT 
         id, 
 		username, 
@@ -31,15 +36,24 @@ func (db *appdbimpl) GetUser(param string) (structs.User, error) {
         bio, 
         profile_image_id, 
         followers_count, 
-        following_count 
+        following_count, 
+        version 
     FROM 
-        User 
+        "User" 
     WHERE 
-        username = ? OR id = ? `,
-		param, param).Scan(&user.UserID, &user.Username, &user.SignUpDate, &user.LastSeenDate, &user.Bio, &user.ProfileImage, &user.Followers, &user.Following)
+        (username = ?1 OR username_normalized = ?2 OR id = ?1) AND deleted_at IS NULL
+    ORDER BY
+        username = ?1 DESC
+    LIMIT 1`
+
+// GetUser returns the user with the given username or id. Usernames are compared ignoring the case, an exact match
+// is preferred.
+func (db *appdbimpl) GetUser(param string) (structs.User, error) {
+	var user structs.User
+	err := db.c.QueryRow(getUserQuery, param, usernames.Normalize(param)).Scan(&user.UserID, &user.Username, scanTime(&user.SignUpDate), scanTime(&user.LastSeenDate), &user.Bio, &user.ProfileImage, &user.Followers, &user.Following, &user.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return user, fmt.Errorf("user not found: %w", err)
+			return user, fmt.Errorf("user not found: %w", ErrNotFound)
 		}
 		return user, fmt.Errorf("error getting user: %w", err)
 	}
@@ -56,14 +70,14 @@ func (db *appdbimpl) CreateUser(username string) (structs.User, error) {
 	}
 
 	// Set signup date and last seen date to the current time
-	signupDate := globaltime.Now().String()
-	lastSeenDate := globaltime.Now().String()
+	signupDate := now()
+	lastSeenDate := signupDate
 
 	err = db.c.QueryRow(`
     INSERT INTO 
-        User (id, username, signup_date, last_seen, followers_count, following_count) 
+        "User" (id, username, username_normalized, username_skeleton, signup_date, last_seen, followers_count, following_count) 
     VALUES 
-        (?, ?, ?, ?, ?, ?) 
+        (?, ?, ?, ?, ?, ?, ?, ?) 
     RETURNING 
         id, 
         username, 
@@ -73,17 +87,19 @@ func (db *appdbimpl) CreateUser(username string) (structs.User, error) {
         profile_image_id, 
         followers_count, 
         following_count`,
-		userID.String(), username, signupDate, lastSeenDate, 0, 0).Scan(&user.UserID, &user.Username, &user.SignUpDate, &user.LastSeenDate, &user.Bio, &user.ProfileImage, &user.Followers, &user.Following)
+		userID.String(), username, usernames.Normalize(username), usernames.Skeleton(username), signupDate, lastSeenDate, 0, 0).Scan(&user.UserID, &user.Username, scanTime(&user.SignUpDate), scanTime(&user.LastSeenDate), &user.Bio, &user.ProfileImage, &user.Followers, &user.Following)
+	if isConstraintViolation(err) {
+		return user, fmt.Errorf("username %q already used: %w", username, ErrConflict)
+	}
 	if err != nil {
 		return user, fmt.Errorf("error creating user: %w", err)
 	}
 	return user, nil
 }
 
-// SearchUsername returns a list of users whose username is similar to the given one
-func (db *appdbimpl) SearchUsername(username string) ([]structs.User, error) {
-	var users []structs.User
-	rows, err := db.c.Query(`
+// searchUsernameQuery selects the active users whose username matches a pattern, ignoring the case
+var searchUsernameQuery = dialectQuery{
+	sqlite: `
 	SELECT 
 		id, 
 		username, 
@@ -94,10 +110,29 @@ func (db *appdbimpl) SearchUsername(username string) ([]structs.User, error) {
 		followers_count, 
 		following_count 
 	FROM 
-		User 
+		"User" 
 	WHERE 
-		username LIKE ?`,
-		"%"+username+"%")
+		username LIKE ? AND deleted_at IS NULL`,
+	postgres: `
+	SELECT 
+		id, 
+		username, 
+		signup_date, 
+		last_seen, 
+		bio, 
+		profile_image_id, 
+		followers_count, 
+		following_count 
+	FROM 
+		"User" 
+	WHERE 
+		username ILIKE ? AND deleted_at IS NULL`,
+}
+
+// SearchUsername returns a list of users whose username is similar to the given one
+func (db *appdbimpl) SearchUsername(username string) ([]structs.User, error) {
+	var users []structs.User
+	rows, err := db.c.Query(db.c.dialect.query(searchUsernameQuery), "%"+username+"%")
 
 	if err != nil {
 		return users, fmt.Errorf("error searching username: %w", err)
@@ -105,7 +140,7 @@ func (db *appdbimpl) SearchUsername(username string) ([]structs.User, error) {
 	defer rows.Close()
 	for rows.Next() {
 		var user structs.User
-		err = rows.Scan(&user.UserID, &user.Username, &user.SignUpDate, &user.LastSeenDate, &user.Bio, &user.ProfileImage, &user.Followers, &user.Following)
+		err = rows.Scan(&user.UserID, &user.Username, scanTime(&user.SignUpDate), scanTime(&user.LastSeenDate), &user.Bio, &user.ProfileImage, &user.Followers, &user.Following)
 		if err != nil {
 			return users, fmt.Errorf("error scanning user: %w", err)
 		}
@@ -117,38 +152,320 @@ func (db *appdbimpl) SearchUsername(username string) ([]structs.User, error) {
 	return users, nil
 }
 
-// UpdateUser updates the user with the given userID with all the new values in the user struct
-func (db *appdbimpl) UpdateUser(userID string, user structs.User) error {
-	_, err := db.c.Exec(`
+// UpdateUser updates the username, the bio and the profile image of the user with the given userID, if the user is
+// still at the given version, and returns the new version. It returns ErrVersionMismatch if the user was modified in
+// the meantime. The other fields (dates and counters) are managed by the server and are never overwritten.
+// If the username changes, the old one is saved in the username history and the new one is propagated to every row
+// where the username is copied (posts, comments and likes).
+func (db *appdbimpl) UpdateUser(userID string, user structs.User, version int) (int, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Get the current username and version
+	var oldUsername string
+	var currentVersion int
+	err = tx.QueryRow(`SELECT username, version FROM "User" WHERE id = ? AND deleted_at IS NULL`, userID).Scan(&oldUsername, &currentVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("user not found: %w", ErrNotFound)
+		}
+		return 0, fmt.Errorf("error getting username: %w", err)
+	}
+	if currentVersion != version {
+		return 0, ErrVersionMismatch
+	}
+
+	if oldUsername != user.Username {
+		err = changeUsername(tx, userID, oldUsername, user.Username)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`
 	UPDATE 
-		User 
+		"User" 
 	SET 
 		username = ?, 
-		signup_date = ?, 
-		last_seen = ?, 
 		bio = ?, 
 		profile_image_id = ?, 
-		followers_count = ?, 
-		following_count = ? 
+		version = version + 1 
+	WHERE 
+		id = ? AND deleted_at IS NULL`,
+		user.Username, user.Bio, user.ProfileImage, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error updating user: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("error committing user update: %w", err)
+	}
+	return version + 1, nil
+}
+
+// forgetUsernameQuery deletes a username, ignoring the case, from the history of a user
+var forgetUsernameQuery = dialectQuery{
+	sqlite:   `DELETE FROM UsernameHistory WHERE username = ? COLLATE NOCASE AND user_id = ?`,
+	postgres: `DELETE FROM UsernameHistory WHERE lower(username) = lower(?) AND user_id = ?`,
+}
+
+// changeUsername records the change of username of the user with the given userID and propagates the new username
+func changeUsername(tx *dbTx, userID string, oldUsername string, newUsername string) error {
+	// The old username keeps pointing to the user, the new one is not an old username anymore
+	_, err := tx.Exec(`
+	INSERT INTO 
+		UsernameHistory (username, user_id, change_date) 
+	VALUES 
+		(?, ?, ?)
+	ON CONFLICT (username) DO UPDATE SET
+		user_id = excluded.user_id, 
+		change_date = excluded.change_date`,
+		oldUsername, userID, now())
+	if err != nil {
+		return fmt.Errorf("error saving username history: %w", err)
+	}
+	_, err = tx.Exec(tx.dialect.query(forgetUsernameQuery), newUsername, userID)
+	if err != nil {
+		return fmt.Errorf("error updating username history: %w", err)
+	}
+
+	// Update the forms used to compare the username
+	_, err = tx.Exec(`
+	UPDATE 
+		"User" 
+	SET 
+		username_normalized = ?, 
+		username_skeleton = ? 
 	WHERE 
 		id = ?`,
-		user.Username, user.SignUpDate, user.LastSeenDate, user.Bio, user.ProfileImage, user.Followers, user.Following, userID)
+		usernames.Normalize(newUsername), usernames.Skeleton(newUsername), userID)
+	if isConstraintViolation(err) {
+		return fmt.Errorf("username %q already used: %w", newUsername, ErrConflict)
+	}
 	if err != nil {
-		return fmt.Errorf("error updating user: %w", err)
+		return fmt.Errorf("error updating normalized username: %w", err)
+	}
+
+	// Propagate the new username
+	for _, statement := range []string{
+		"UPDATE Post SET author_username = ? WHERE author_id = ?",
+		"UPDATE Comment SET username = ? WHERE author_id = ?",
+		"UPDATE PostLike SET username = ? WHERE user_id = ?",
+		"UPDATE CommentLike SET username = ? WHERE user_id = ?",
+	} {
+		_, err = tx.Exec(statement, newUsername, userID)
+		if err != nil {
+			return fmt.Errorf("error propagating username: %w", err)
+		}
 	}
 	return nil
 }
 
-// DeleteUser deletes the user with the given userID
+// DeleteUser marks the user with the given userID as deleted.
+// The user and their content are hidden from every read until they are restored or purged by PurgeDeleted.
 func (db *appdbimpl) DeleteUser(userID string) error {
-	_, err := db.c.Exec(`
-	DELETE FROM 
-		User 
+	res, err := db.c.Exec(`
+	UPDATE 
+		"User" 
+	SET 
+		deleted_at = ? 
 	WHERE 
-		id = ?`,
-		userID)
+		id = ? AND deleted_at IS NULL`,
+		now(), userID)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("error deleting user: %w", err)
 	}
+	if affected == 0 {
+		return fmt.Errorf("user not found: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// RestoreUser restores the user with the given userID, if it was deleted after deletedSince
+func (db *appdbimpl) RestoreUser(userID string, deletedSince time.Time) error {
+	res, err := db.c.Exec(`
+	UPDATE 
+		"User" 
+	SET 
+		deleted_at = NULL 
+	WHERE 
+		id = ? AND deleted_at >= ?`,
+		userID, formatTime(deletedSince))
+	if err != nil {
+		return fmt.Errorf("error restoring user: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error restoring user: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("no restorable user found: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// IsActiveUser returns true if the user with the given userID exists and is not deleted
+func (db *appdbimpl) IsActiveUser(userID string) (bool, error) {
+	var active bool
+	err := db.c.QueryRow(`SELECT EXISTS(SELECT 1 FROM "User" WHERE id = ? AND deleted_at IS NULL)`, userID).Scan(&active)
+	if err != nil {
+		return active, fmt.Errorf("error checking if user is active: %w", err)
+	}
+	return active, nil
+}
+
+// GetUsernameHistory returns the usernames previously used by the user with the given userID, newest first
+func (db *appdbimpl) GetUsernameHistory(userID string) ([]structs.UsernameChange, error) {
+	var changes []structs.UsernameChange
+	rows, err := db.c.Query(`
+	SELECT 
+		username, 
+		change_date 
+	FROM 
+		UsernameHistory 
+	WHERE 
+		user_id = ?
+	ORDER BY
+		change_date DESC`,
+		userID)
+	if err != nil {
+		return changes, fmt.Errorf("error getting username history: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var change structs.UsernameChange
+		err = rows.Scan(&change.Username, scanTime(&change.ChangeDate))
+		if err != nil {
+			return changes, fmt.Errorf("error scanning username change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return changes, fmt.Errorf("error iterating over username history: %w", err)
+	}
+	return changes, nil
+}
+
+// resolveUsernameQuery selects the active user that used a username, ignoring the case
+var resolveUsernameQuery = dialectQuery{
+	sqlite: `
+	SELECT 
+		UsernameHistory.user_id 
+	FROM 
+		UsernameHistory JOIN "User"
+	ON
+		UsernameHistory.user_id = "User".id
+	WHERE 
+		UsernameHistory.username = ? COLLATE NOCASE AND "User".deleted_at IS NULL`,
+	postgres: `
+	SELECT 
+		UsernameHistory.user_id 
+	FROM 
+		UsernameHistory JOIN "User"
+	ON
+		UsernameHistory.user_id = "User".id
+	WHERE 
+		lower(UsernameHistory.username) = lower(?) AND "User".deleted_at IS NULL`,
+}
+
+// ResolveUsername returns the ID of the active user that used the given username in the past
+func (db *appdbimpl) ResolveUsername(username string) (string, error) {
+	var userID string
+	err := db.c.QueryRow(db.c.dialect.query(resolveUsernameQuery), username).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return userID, fmt.Errorf("username not found in history: %w", ErrNotFound)
+		}
+		return userID, fmt.Errorf("error resolving username: %w", err)
+	}
+	return userID, nil
+}
+
+// GetLookalikeUsers returns the active users whose username looks like the given one (see usernames.Skeleton)
+func (db *appdbimpl) GetLookalikeUsers(username string) ([]structs.User, error) {
+	var users []structs.User
+	rows, err := db.c.Query(`
+	SELECT 
+		id, 
+		username, 
+		signup_date, 
+		last_seen, 
+		bio, 
+		profile_image_id, 
+		followers_count, 
+		following_count 
+	FROM 
+		"User" 
+	WHERE 
+		username_skeleton = ? AND deleted_at IS NULL`,
+		usernames.Skeleton(username))
+	if err != nil {
+		return users, fmt.Errorf("error getting lookalike users: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user structs.User
+		err = rows.Scan(&user.UserID, &user.Username, scanTime(&user.SignUpDate), scanTime(&user.LastSeenDate), &user.Bio, &user.ProfileImage, &user.Followers, &user.Following)
+		if err != nil {
+			return users, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return users, fmt.Errorf("error iterating over users: %w", err)
+	}
+	return users, nil
+}
+
+// backfillUsernames fills the normalized and skeleton forms of the usernames created before they were stored.
+// When two old usernames only differ in the case, the oldest user keeps the normalized form and the other one is
+// only found by its exact username.
+func backfillUsernames(db *dbConn) error {
+	rows, err := db.Query(`SELECT id, username FROM "User" WHERE username_skeleton IS NULL ORDER BY signup_date, id`)
+	if err != nil {
+		return fmt.Errorf("error getting usernames to backfill: %w", err)
+	}
+	type pending struct{ id, username string }
+	var users []pending
+	for rows.Next() {
+		var user pending
+		err = rows.Scan(&user.id, &user.username)
+		if err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("error scanning username: %w", err)
+		}
+		users = append(users, user)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over usernames: %w", err)
+	}
+
+	for _, user := range users {
+		_, err = db.Exec(`UPDATE "User" SET username_skeleton = ? WHERE id = ?`, usernames.Skeleton(user.username), user.id)
+		if err != nil {
+			return fmt.Errorf("error backfilling username skeleton: %w", err)
+		}
+		// Skipped if another user already has the same normalized username
+		_, err = db.Exec(`
+		UPDATE 
+			"User" 
+		SET 
+			username_normalized = ?1 
+		WHERE 
+			id = ?2 AND NOT EXISTS (SELECT 1 FROM "User" WHERE username_normalized = ?1)`,
+			usernames.Normalize(user.username), user.id)
+		if err != nil {
+			return fmt.Errorf("error backfilling normalized username: %w", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,190 @@
+/*
+Package openapi checks the requests and the responses of the API against its OpenAPI specification (doc/api.yaml).
+
+A Validator is built once from the specification. ValidateRequest finds the operation of a request and checks its path
+parameters, query string, headers and body against the schemas of the operation; the returned Request can then check
+the response of the handler. Requests for paths or methods that are not in the specification are not checked, the
+router of the API answers them.
+
+Authentication is not checked here, the handlers do it.
+*/
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// ViolationHeader is the response header set by the API, when it validates its responses, on the responses that
+// don't match the specification. It describes how they don't match.
+const ViolationHeader = "X-OpenAPI-Violation"
+
+// Config describes what the Validator checks
+type Config struct {
+	// ValidateResponses checks the responses too, so that the handlers drifting from the specification are noticed
+	ValidateResponses bool
+}
+
+// Validator checks requests and responses against an OpenAPI specification
+type Validator struct {
+	router  routers.Router
+	options *openapi3filter.Options
+
+	validateResponses bool
+}
+
+// Error is a request that does not match the specification
+type Error struct {
+	// Field is the parameter or the field of the body that is not valid, empty if it is the whole body
+	Field   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Request is a request matched to an operation of the specification
+type Request struct {
+	validator *Validator
+	input     *openapi3filter.RequestValidationInput
+}
+
+func init() {
+	// Resource IDs are UUIDs, the format is not checked unless defined
+	openapi3.DefineStringFormat("uuid", `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// Keep the errors short, without the dump of the schema and of the value
+	openapi3.SchemaErrorDetailsDisabled = true
+
+	// Media types of the specification not known by openapi3filter
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", jsonBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/zip", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("image/jpeg", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("image/png", openapi3filter.FileBodyDecoder)
+}
+
+// New returns a Validator for the OpenAPI specification spec, in YAML or JSON
+func New(spec []byte, cfg Config) (*Validator, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the specification: %w", err)
+	}
+	err = doc.Validate(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error validating the specification: %w", err)
+	}
+
+	// Match the paths on any host, the servers of the specification are only examples
+	doc.Servers = nil
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error building the router of the specification: %w", err)
+	}
+
+	return &Validator{
+		router: router,
+		options: &openapi3filter.Options{
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			// A status missing from the specification is a drift too
+			IncludeResponseStatus: cfg.ValidateResponses,
+		},
+		validateResponses: cfg.ValidateResponses,
+	}, nil
+}
+
+// ValidatesResponses reports whether the responses must be checked too
+func (v *Validator) ValidatesResponses() bool {
+	return v.validateResponses
+}
+
+// ValidateRequest checks r against its operation in the specification. It returns a nil Request if the operation is
+// not in the specification, and an *Error if r does not match it. The body of r is read, and replaced by a copy.
+func (v *Validator) ValidateRequest(r *http.Request) (*Request, error) {
+	route, pathParams, err := v.router.FindRoute(r)
+	if err != nil {
+		return nil, nil
+	}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    v.options,
+	}
+	err = openapi3filter.ValidateRequest(r.Context(), input)
+	if err != nil {
+		return nil, requestError(err)
+	}
+	return &Request{validator: v, input: input}, nil
+}
+
+// ValidateResponse checks the response to the request against the specification
+func (req *Request) ValidateResponse(status int, header http.Header, body []byte) error {
+	return openapi3filter.ValidateResponse(req.input.Request.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: req.input,
+		Status:                 status,
+		Header:                 header,
+		Body:                   ioutil.NopCloser(bytes.NewReader(body)),
+		Options:                req.validator.options,
+	})
+}
+
+// requestError describes the failed validation of a request as an *Error
+func requestError(err error) *Error {
+	var result Error
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) && reqErr.Parameter != nil {
+		result.Field = reqErr.Parameter.Name
+	}
+
+	var schemaErr *openapi3.SchemaError
+	switch {
+	case errors.As(err, &schemaErr):
+		if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+			if result.Field != "" {
+				result.Field += "."
+			}
+			result.Field += strings.Join(pointer, ".")
+		}
+		result.Message = schemaErr.Reason
+	case reqErr != nil:
+		result.Message = reqErr.Reason
+		if reqErr.Err != nil && reqErr.Err.Error() != result.Message {
+			if result.Message == "" {
+				result.Message = reqErr.Err.Error()
+			} else {
+				result.Message += ": " + reqErr.Err.Error()
+			}
+		}
+	default:
+		result.Message = err.Error()
+	}
+	return &result
+}
+
+// jsonBodyDecoder decodes the JSON bodies with a media type other than application/json
+func jsonBodyDecoder(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (interface{}, error) {
+	var value interface{}
+	err := json.NewDecoder(body).Decode(&value)
+	if err != nil {
+		return nil, &openapi3filter.ParseError{Kind: openapi3filter.KindInvalidFormat, Cause: err}
+	}
+	return value, nil
+}
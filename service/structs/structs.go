@@ -1,13 +1,29 @@
 package structs
 
+import (
+	"time"
+)
+
 type Username struct {
 	Username string `json:"username"`
 }
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+type Session struct {
+	UserID string `json:"userId"`
+	Token  string `json:"token"` // Bearer token of the requests of the user
+}
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"` // Required if the user already has a password
+	Password        string `json:"password"`
+}
 type ResourceID struct {
 	ResourceID string `json:"resourceId"`
 }
 type Date struct {
-	Date string `json:"date"`
+	Date time.Time `json:"date"`
 }
 type Caption struct {
 	Caption string `json:"caption"`
@@ -24,34 +40,39 @@ type UserCollection struct {
 }
 
 type User struct {
-	UserID       string `json:"userId"`
-	Username     string `json:"username"`
-	SignUpDate   string `json:"signUpDate"`
-	LastSeenDate string `json:"lastSeenDate"`
-	Bio          string `json:"bio"`
-	ProfileImage string `json:"profileImage"`
-	Followers    int    `json:"followers"`
-	Following    int    `json:"following"`
+	UserID       string    `json:"userId"`
+	Username     string    `json:"username"`
+	SignUpDate   time.Time `json:"signUpDate"`
+	LastSeenDate time.Time `json:"lastSeenDate"`
+	Bio          string    `json:"bio"`
+	ProfileImage string    `json:"profileImage"`
+	Followers    int       `json:"followers"`
+	Following    int       `json:"following"`
+	Version      int       `json:"-"` // Incremented by every edit, sent as the ETag
 }
 
 type UserPost struct {
-	PostID         string `json:"postId"`
-	AuthorUsername string `json:"authorUsername"`
-	AuthorID       string `json:"authorId"`
-	CreationDate   string `json:"creationDate"`
-	Caption        string `json:"caption"`
-	Image          string `json:"image"`
-	LikeCount      int    `json:"likeCount"`
-	CommentCount   int    `json:"commentCount"`
+	PostID         string     `json:"postId"`
+	AuthorUsername string     `json:"authorUsername"`
+	AuthorID       string     `json:"authorId"`
+	CreationDate   time.Time  `json:"creationDate"`
+	Caption        string     `json:"caption"`
+	Image          string     `json:"image"`
+	LikeCount      int        `json:"likeCount"`
+	CommentCount   int        `json:"commentCount"`
+	EditedAt       *time.Time `json:"editedAt,omitempty"` // Nil if the caption was never edited
+	Version        int        `json:"-"`                  // Incremented by every edit, sent as the ETag
 }
 
 type Comment struct {
-	CommentID      string `json:"commentId"`
-	AuthorUsername string `json:"authorUsername"`
-	AuthorID       string `json:"authorId"`
-	CreationDate   string `json:"creationDate"`
-	Caption        string `json:"caption"`
-	LikeCount      int    `json:"likeCount"`
+	CommentID      string     `json:"commentId"`
+	AuthorUsername string     `json:"authorUsername"`
+	AuthorID       string     `json:"authorId"`
+	CreationDate   time.Time  `json:"creationDate"`
+	Caption        string     `json:"caption"`
+	LikeCount      int        `json:"likeCount"`
+	EditedAt       *time.Time `json:"editedAt,omitempty"` // Nil if the caption was never edited
+	Version        int        `json:"-"`                  // Incremented by every edit, sent as the ETag
 }
 
 type PostStream struct {
@@ -62,8 +83,132 @@ type CommentStream struct {
 	Comments []Comment `json:"comments"`
 }
 
+type UsernameChange struct {
+	Username   string    `json:"username"` // The username used before the change
+	ChangeDate time.Time `json:"changeDate"`
+}
+
+type UsernameHistory struct {
+	Usernames []UsernameChange `json:"usernames"`
+}
+
+type Revision struct {
+	RevisionID   string    `json:"revisionId"`
+	ResourceID   string    `json:"resourceId"` // The post or the comment
+	Caption      string    `json:"caption"`    // The caption before the edit
+	RevisionDate time.Time `json:"revisionDate"`
+}
+
+type RevisionCollection struct {
+	Revisions []Revision `json:"revisions"`
+}
+
+type IdempotentResponse struct {
+	Fingerprint string // Hash of the request the response was given to
+	Status      int    // Zero while the request is being processed
+	ContentType string
+	Body        []byte
+}
+
+type Job struct {
+	JobID         string    `json:"jobId"`
+	Kind          string    `json:"kind"` // What the job does, e.g. "export"
+	UserID        string    `json:"userId"`
+	Status        string    `json:"status"`   // One of "pending", "running", "done", "failed"
+	Progress      int       `json:"progress"` // Percentage of work done
+	CreationDate  time.Time `json:"creationDate"`
+	ScheduledDate time.Time `json:"scheduledDate"` // The job does not start before this date
+	UpdateDate    time.Time `json:"updateDate"`
+}
+
+type AdminUser struct {
+	User
+	Role        string     `json:"role"` // One of "user", "moderator", "admin"
+	Email       string     `json:"email"`
+	SuspendedAt *time.Time `json:"suspendedAt,omitempty"` // Nil if the user is not suspended
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`   // Nil if the user is not deleted
+}
+
+type AdminUserCollection struct {
+	Users []AdminUser `json:"users"`
+}
+
+type Role struct {
+	Role string `json:"role"`
+}
+
+type Suspension struct {
+	Reason string `json:"reason"`
+}
+
+type Stats struct {
+	Users          int `json:"users"`
+	DeletedUsers   int `json:"deletedUsers"`
+	SuspendedUsers int `json:"suspendedUsers"`
+	Posts          int `json:"posts"`
+	Comments       int `json:"comments"`
+	Likes          int `json:"likes"`
+	Follows        int `json:"follows"`
+	Bans           int `json:"bans"`
+	PendingJobs    int `json:"pendingJobs"`
+}
+
+type AuditEntry struct {
+	EntryID      string    `json:"entryId"`
+	ActorID      string    `json:"actorId"` // The moderator or administrator
+	Action       string    `json:"action"`
+	TargetID     string    `json:"targetId"` // The user, post or comment
+	Details      string    `json:"details"`
+	CreationDate time.Time `json:"creationDate"`
+}
+
+type AuditLog struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+type Report struct {
+	ReportID     string    `json:"reportId"`
+	ReporterID   string    `json:"reporterId"`
+	TargetType   string    `json:"targetType"` // One of "post", "comment", "user"
+	TargetID     string    `json:"targetId"`
+	TargetUserID string    `json:"targetUserId"` // The reported user, or the author of the reported content
+	Reason       string    `json:"reason"`
+	Details      string    `json:"details"`
+	Status       string    `json:"status"` // One of "open", "claimed", "resolved", "dismissed"
+	ModeratorID  string    `json:"moderatorId"`
+	Action       string    `json:"action"` // How the report was resolved
+	Note         string    `json:"note"`
+	CreationDate time.Time `json:"creationDate"`
+	UpdateDate   time.Time `json:"updateDate"`
+}
+
+type ReportCollection struct {
+	Reports []Report `json:"reports"`
+}
+
+type Resolution struct {
+	Action string `json:"action"` // One of "hide", "delete", "warn", "suspend"; ignored when dismissing
+	Note   string `json:"note"`
+}
+
+type Warning struct {
+	WarningID    string    `json:"warningId"`
+	ReportID     string    `json:"reportId"`
+	Note         string    `json:"note"`
+	CreationDate time.Time `json:"creationDate"`
+}
+
+type WarningCollection struct {
+	Warnings []Warning `json:"warnings"`
+}
+
 type Error struct {
-	Message string `json:"message"`
+	Code      string `json:"code"` // Machine-readable kind of the error, e.g. "not_found"
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+	Rule      string `json:"rule,omitempty"`      // The violated rule, for validation errors
+	Field     string `json:"field,omitempty"`     // The parameter or body field that is not valid
+	RequestID string `json:"requestId,omitempty"` // The ID of the request, also in the X-Request-ID header
 }
 
 type Success struct {
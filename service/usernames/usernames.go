@@ -0,0 +1,131 @@
+/*
+Package usernames contains the rules a username has to follow, and the normal forms used to compare usernames.
+
+Usernames are compared ignoring the case (see Normalize), and two usernames that look alike (e.g. "alice" and "a1ice")
+share the same Skeleton, so that one user can't impersonate another with a lookalike username.
+*/
+package usernames
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Length limits of a username, as in doc/api.yaml
+const (
+	MinLength = 4
+	MaxLength = 20
+)
+
+// Names of the rules a username can violate
+const (
+	RuleLength     = "length"
+	RuleCharset    = "charset"
+	RuleConfusable = "confusable"
+	RuleReserved   = "reserved"
+	RuleUnique     = "unique"
+)
+
+// RuleError is returned when a username violates one of the rules
+type RuleError struct {
+	Rule    string
+	Message string
+}
+
+func (e *RuleError) Error() string {
+	return e.Message
+}
+
+// confusables maps characters outside of the username character set to the ASCII character they look like
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T', 'Х': 'X',
+	'І': 'I', 'Ј': 'J', 'Ѕ': 'S',
+	// Greek
+	'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P',
+	'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// Latin lookalikes
+	'ı': 'i', 'ȷ': 'j', 'ɑ': 'a', 'ɡ': 'g', 'ʟ': 'l', 'ℓ': 'l',
+	// Dashes
+	'‐': '-', '‑': '-', '‒': '-', '–': '-', '—': '-', '−': '-',
+}
+
+// lookalikes are the sequences of the username character set that look like other ones, with their replacement.
+// They are applied in order, after the username has been lowercased.
+var lookalikes = []struct{ from, to string }{
+	{"rn", "m"},
+	{"vv", "w"},
+	{"0", "o"},
+	{"1", "l"},
+	{"i", "l"},
+	{"5", "s"},
+	{"_", "-"},
+}
+
+// Validate checks that username follows the length and character set rules.
+// The returned error is a *RuleError naming the violated rule.
+func Validate(username string) error {
+	length := utf8.RuneCountInString(username)
+	if length < MinLength || length > MaxLength {
+		return &RuleError{
+			Rule:    RuleLength,
+			Message: fmt.Sprintf("username must be between %d and %d characters long", MinLength, MaxLength),
+		}
+	}
+	for _, c := range username {
+		if isAllowed(c) {
+			continue
+		}
+		if lookalike, ok := asciiLookalike(c); ok {
+			return &RuleError{
+				Rule:    RuleConfusable,
+				Message: fmt.Sprintf("username contains %q, which looks like %q", c, lookalike),
+			}
+		}
+		return &RuleError{
+			Rule:    RuleCharset,
+			Message: "username can only contain letters, digits, '_' and '-'",
+		}
+	}
+	return nil
+}
+
+// Normalize returns the form used to compare usernames ignoring the case
+func Normalize(username string) string {
+	return strings.ToLower(username)
+}
+
+// Skeleton returns a form of the username shared by every username that looks like it
+func Skeleton(username string) string {
+	skeleton := strings.Map(func(c rune) rune {
+		if lookalike, ok := asciiLookalike(c); ok {
+			return lookalike
+		}
+		return c
+	}, username)
+	skeleton = Normalize(skeleton)
+	for _, l := range lookalikes {
+		skeleton = strings.ReplaceAll(skeleton, l.from, l.to)
+	}
+	return skeleton
+}
+
+// isAllowed returns true if c is in the username character set
+func isAllowed(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
+
+// asciiLookalike returns the character of the username character set that c looks like, if any
+func asciiLookalike(c rune) (rune, bool) {
+	// Fullwidth forms of ASCII characters
+	if c >= '！' && c <= '～' {
+		c = c - '！' + '!'
+		return c, isAllowed(c)
+	}
+	lookalike, ok := confusables[c]
+	return lookalike, ok
+}
@@ -0,0 +1,110 @@
+package usernames
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		username string
+		rule     string // Empty if valid
+	}{
+		{"", RuleLength},
+		{"abc", RuleLength},
+		{"abcd", ""},
+		{strings.Repeat("a", MaxLength), ""},
+		{strings.Repeat("a", MaxLength+1), RuleLength},
+		{"Ab_c-D9", ""},
+		{"----", ""},
+		{"ab cd", RuleCharset},
+		{"ab.cd", RuleCharset},
+		{"ab@cd", RuleCharset},
+		{"ééééé", RuleCharset},
+		{"ab！cd", RuleCharset},      // Fullwidth form of a character outside of the set
+		{"ééé", RuleLength},         // Counted in characters, not in bytes
+		{"аlice", RuleConfusable},   // Cyrillic a
+		{"alicε", RuleConfusable},   // Greek epsilon
+		{"ａｌｉｃｅ", RuleConfusable},   // Fullwidth
+		{"alice—x", RuleConfusable}, // Em dash
+		{"alıce", RuleConfusable},   // Dotless i
+	}
+	for _, test := range tests {
+		err := Validate(test.username)
+		if test.rule == "" {
+			if err != nil {
+				t.Errorf("Validate(%q): expected no error, got %v", test.username, err)
+			}
+			continue
+		}
+		var ruleErr *RuleError
+		if !errors.As(err, &ruleErr) || ruleErr.Rule != test.rule {
+			t.Errorf("Validate(%q): expected rule %q, got %v", test.username, test.rule, err)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"alice", "alice"},
+		{"Alice", "alice"},
+		{"ALICE_B-9", "alice_b-9"},
+	}
+	for _, test := range tests {
+		if got := Normalize(test.username); got != test.want {
+			t.Errorf("Normalize(%q) = %q, expected %q", test.username, got, test.want)
+		}
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"alice", "Alice", true},
+		{"alice", "a1ice", true},
+		{"alice", "AL1CE", true},
+		{"alice", "aiice", true},
+		{"modem", "modern", true},
+		{"wasa", "vvasa", true},
+		{"root", "r00t", true},
+		{"sam_", "5am-", true},
+		{"paypal", "раураl", true}, // Cyrillic
+		{"alice", "ａｌｉｃｅ", true},   // Fullwidth
+		{"alice", "alıce", true},   // Dotless i
+		{"ALICE", "АLІСЕ", true},   // Cyrillic capitals
+		{"a-b", "a—b", true},       // Em dash
+		{"alice", "alicia", false},
+		{"bob", "bab", false},
+		{"mark", "rnarc", false},
+	}
+	for _, test := range tests {
+		a, b := Skeleton(test.a), Skeleton(test.b)
+		if (a == b) != test.same {
+			t.Errorf("Skeleton(%q) = %q, Skeleton(%q) = %q, expected same: %v", test.a, a, test.b, b, test.same)
+		}
+	}
+}
+
+// TestConfusables checks that every confusable maps to a character of the username character set, is refused by
+// Validate and has the skeleton of its lookalike
+func TestConfusables(t *testing.T) {
+	for c, lookalike := range confusables {
+		if isAllowed(c) || !isAllowed(lookalike) {
+			t.Errorf("%q: expected a character outside of the set mapped to one in it, got %q", c, lookalike)
+		}
+		username := "abc" + string(c)
+		var ruleErr *RuleError
+		if err := Validate(username); !errors.As(err, &ruleErr) || ruleErr.Rule != RuleConfusable {
+			t.Errorf("Validate(%q): expected rule %q, got %v", username, RuleConfusable, err)
+		}
+		if Skeleton(username) != Skeleton("abc"+string(lookalike)) {
+			t.Errorf("%q: expected the skeleton of %q", c, lookalike)
+		}
+	}
+}